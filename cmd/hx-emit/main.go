@@ -1,5 +1,7 @@
 // hx-emit: low-latency event emitter for hx shell hooks.
-// Reads pre/post events via args, appends JSONL to spool.
+// Reads pre/post events via args and sends them to hxd over its Unix socket,
+// with the environment variables listed in HX_ENV_CAPTURE (see env-spec).
+// When hxd is not listening, appends JSONL to the spool instead.
 // No-op if .paused exists or spool unwritable.
 
 package main
@@ -7,7 +9,6 @@ package main
 import (
 	"encoding/base64"
 	"encoding/json"
-	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -15,11 +16,15 @@ import (
 	"time"
 
 	"github.com/mrcawood/History_eXtended/internal/config"
+	"github.com/mrcawood/History_eXtended/internal/envctx"
+	"github.com/mrcawood/History_eXtended/internal/filter"
+	"github.com/mrcawood/History_eXtended/internal/redact"
+	"github.com/mrcawood/History_eXtended/internal/spool"
 )
 
-func spoolDir() string {
-	c, err := config.Load()
-	if err == nil {
+// spoolDir and pausedFile take the config loaded once by main (nil if none).
+func spoolDir(c *config.Config) string {
+	if c != nil {
 		return c.SpoolDir
 	}
 	if v := os.Getenv("HX_SPOOL_DIR"); v != "" {
@@ -29,9 +34,8 @@ func spoolDir() string {
 	return filepath.Join(home, ".local", "share", "hx", "spool")
 }
 
-func pausedFile() string {
-	c, err := config.Load()
-	if err == nil {
+func pausedFile(c *config.Config) string {
+	if c != nil {
 		return filepath.Join(filepath.Dir(c.SpoolDir), ".paused")
 	}
 	if v := os.Getenv("XDG_DATA_HOME"); v != "" {
@@ -41,15 +45,6 @@ func pausedFile() string {
 	return filepath.Join(home, ".local", "share", "hx", ".paused")
 }
 
-func isPaused() bool {
-	_, err := os.Stat(pausedFile())
-	return err == nil
-}
-
-func ensureSpoolDir(dir string) error {
-	return os.MkdirAll(dir, 0755)
-}
-
 type preEvent struct {
 	T    string  `json:"t"`
 	Ts   float64 `json:"ts"`
@@ -59,6 +54,8 @@ type preEvent struct {
 	Cwd  string  `json:"cwd"`
 	Tty  string  `json:"tty"`
 	Host string  `json:"host"`
+
+	Env map[string]string `json:"env,omitempty"`
 }
 
 type postEvent struct {
@@ -71,23 +68,44 @@ type postEvent struct {
 	Pipe  []int   `json:"pipe"`
 }
 
-func appendEvent(line string) error {
-	dir := spoolDir()
-	if err := ensureSpoolDir(dir); err != nil {
-		return err
+// emit delivers payload to hxd, falling back to the spool file. Config is
+// only loaded on the fallback path; hxd applies the pause check, filter
+// rules and secret scrubbing itself, so nothing they reject reaches disk
+// either way.
+func emit(payload []byte) error {
+	if err := spool.Send(spool.SocketPath(), payload, spool.SendTimeout); err == nil {
+		return nil
 	}
-	f, err := os.OpenFile(filepath.Join(dir, "events.jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	c, err := config.Load()
 	if err != nil {
-		return err
+		c = nil
+	}
+	if _, err := os.Stat(pausedFile(c)); err == nil {
+		return nil
 	}
-	defer func() {
-		if closeErr := f.Close(); closeErr != nil {
-			// Log error but don't overwrite the write error
-			fmt.Fprintf(os.Stderr, "Warning: failed to close file: %v\n", closeErr)
-		}
-	}()
-	_, err = f.WriteString(line + "\n")
-	return err
+	// A broken rule is skipped; the rest still apply (hxd reports it)
+	flt, _ := filter.New(c)
+	scrub, _ := redact.Capture(c)
+	payload = spool.ScrubPayload(payload, func(e *spool.Event) bool {
+		cmd, keep := flt.Admit(e.Cmd, e.Cwd, e.Host, scrub)
+		e.Cmd, e.Env = cmd, scrub.ScrubEnv(e.Env)
+		return keep
+	})
+	if len(payload) == 0 {
+		return nil
+	}
+	return spool.Append(spoolDir(c), payload)
+}
+
+// captureEnv reads the variables the hook's spec lists from the environment
+// inherited from the shell. Hooks that predate env capture pass no spec.
+func captureEnv() map[string]string {
+	return envctx.Capture(os.Getenv(envctx.SpecVar), os.LookupEnv)
+}
+
+func jsonLine(v interface{}) []byte {
+	b, _ := json.Marshal(v)
+	return append(b, '\n')
 }
 
 // parsePipe parses comma-separated integers (e.g. "1,0" or "" -> []int{}).
@@ -112,9 +130,6 @@ func parsePipe(s string) []int {
 }
 
 func main() {
-	if isPaused() {
-		os.Exit(0)
-	}
 	if len(os.Args) < 2 {
 		os.Exit(1)
 	}
@@ -122,6 +137,17 @@ func main() {
 	ts := float64(time.Now().UnixNano()) / 1e9
 
 	switch mode {
+	case "env-spec":
+		// env-spec: print the env capture spec for hooks to pass back in HX_ENV_CAPTURE
+		c, err := config.Load()
+		if err != nil {
+			os.Exit(1)
+		}
+		spec, err := envctx.Spec(c.Env)
+		if err != nil {
+			_, _ = os.Stderr.WriteString("hx-emit: " + err.Error() + "\n")
+		}
+		_, _ = os.Stdout.WriteString(spec + "\n")
 	case "pre":
 		// pre SID SEQ CMD_B64 CWD TTY HOST
 		if len(os.Args) < 8 {
@@ -142,9 +168,9 @@ func main() {
 			Cwd:  os.Args[5],
 			Tty:  os.Args[6],
 			Host: os.Args[7],
+			Env:  captureEnv(),
 		}
-		b, _ := json.Marshal(ev)
-		if err := appendEvent(string(b)); err != nil {
+		if err := emit(jsonLine(ev)); err != nil {
 			os.Exit(1)
 		}
 	case "post":
@@ -169,13 +195,14 @@ func main() {
 			DurMs: dur,
 			Pipe:  pipe,
 		}
-		b, _ := json.Marshal(ev)
-		if err := appendEvent(string(b)); err != nil {
+		if err := emit(jsonLine(ev)); err != nil {
 			os.Exit(1)
 		}
 	case "cmd":
 		// cmd SID SEQ CMD_B64 CWD TTY HOST TS_START TS_END EXIT DUR_MS [PIPE]
-		// Single-call mode for Bash hook: writes pre then post in one process.
+		// Single-call mode: writes pre then post in one process. The bundled hooks
+		// now send pre and post separately so hx ps sees running commands; kept
+		// for hooks sourced from older installs.
 		// PIPE optional: comma-separated ints e.g. "1,0"
 		if len(os.Args) < 12 {
 			os.Exit(1)
@@ -190,6 +217,13 @@ func main() {
 		tsEnd, _ := strconv.ParseFloat(os.Args[9], 64)
 		exit, _ := strconv.Atoi(os.Args[10])
 		dur, _ := strconv.ParseInt(os.Args[11], 10, 64)
+		// Empty timestamps (fish has no EPOCHREALTIME): end is now, start is end - duration
+		if tsEnd == 0 {
+			tsEnd = ts
+		}
+		if tsStart == 0 {
+			tsStart = tsEnd - float64(dur)/1000
+		}
 		pipe := []int{}
 		if len(os.Args) >= 13 && os.Args[12] != "" {
 			pipe = parsePipe(os.Args[12])
@@ -203,6 +237,7 @@ func main() {
 			Cwd:  os.Args[5],
 			Tty:  os.Args[6],
 			Host: os.Args[7],
+			Env:  captureEnv(),
 		}
 		postEv := postEvent{
 			T:     "post",
@@ -213,12 +248,8 @@ func main() {
 			DurMs: dur,
 			Pipe:  pipe,
 		}
-		bPre, _ := json.Marshal(preEv)
-		bPost, _ := json.Marshal(postEv)
-		if err := appendEvent(string(bPre)); err != nil {
-			os.Exit(1)
-		}
-		if err := appendEvent(string(bPost)); err != nil {
+		// One payload so pre and post arrive (or fall back) together
+		if err := emit(append(jsonLine(preEv), jsonLine(postEv)...)); err != nil {
 			os.Exit(1)
 		}
 	default:
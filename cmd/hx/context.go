@@ -0,0 +1,43 @@
+package main
+
+import (
+	"database/sql"
+
+	"github.com/mrcawood/History_eXtended/internal/cmdutil"
+	"github.com/mrcawood/History_eXtended/internal/search"
+)
+
+// setContextFlag applies --before/-B, --after/-A or --context/-C (both) n.
+func setContextFlag(before, after *int, flag string, n int) {
+	switch flag {
+	case "--before", "-B":
+		*before = n
+	case "--after", "-A":
+		*after = n
+	default:
+		*before, *after = n, n
+	}
+}
+
+// withContextRows expands hits into groups of neighbouring events from their
+// sessions when before or after is set (find and query --context).
+func withContextRows(conn *sql.DB, rows []cmdutil.Std1Row, before, after int) ([]cmdutil.Std1Row, error) {
+	if before == 0 && after == 0 {
+		return rows, nil
+	}
+	hits := make([]search.Row, len(rows))
+	for i, r := range rows {
+		hits[i] = search.Row{EventID: r.EventID, SessionID: r.SessionID, Seq: r.Seq, StartedAt: r.StartedAt,
+			ExitCode: r.ExitCode, State: r.State, Cwd: r.Cwd, Cmd: r.Cmd}
+	}
+	grouped, err := search.WithContext(conn, hits, before, after)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]cmdutil.Std1Row, len(grouped))
+	for i, r := range grouped {
+		out[i] = cmdutil.Std1Row{EventID: r.EventID, SessionID: r.SessionID, Seq: r.Seq, StartedAt: r.StartedAt,
+			ExitCode: r.ExitCode, State: r.State, Cwd: r.Cwd, Cmd: r.Cmd, Group: r.Group, Context: r.Context}
+	}
+	return out, nil
+}
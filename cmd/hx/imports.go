@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/mrcawood/History_eXtended/internal/cmdutil"
+	"github.com/mrcawood/History_eXtended/internal/db"
+	"github.com/mrcawood/History_eXtended/internal/imp"
+)
+
+// shortBatchID is how many characters of a batch id hx import list prints.
+// FindBatch accepts any unique prefix.
+const shortBatchID = 12
+
+// importBatchRow is one batch in hx import list --json.
+type importBatchRow struct {
+	BatchID    string  `json:"batch_id"`
+	SourceFile string  `json:"source_file"`
+	Shell      string  `json:"shell"`
+	Host       string  `json:"host,omitempty"`
+	ImportedAt float64 `json:"imported_at"`
+	Events     int     `json:"events"`
+	Status     string  `json:"status"`
+}
+
+func cmdImportList(args []string) {
+	asJSON := false
+	for _, a := range args {
+		switch a {
+		case "--json":
+			asJSON = true
+		default:
+			fmt.Fprintf(os.Stderr, "hx import list: unknown option %q\n", a)
+			os.Exit(1)
+		}
+	}
+	conn, err := db.Open(dbPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx import list: %v\n", err)
+		os.Exit(1)
+	}
+	defer func() { _ = conn.Close() }()
+	batches, err := imp.ListBatches(conn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx import list: %v\n", err)
+		os.Exit(1)
+	}
+	if asJSON {
+		rows := []importBatchRow{}
+		for _, b := range batches {
+			rows = append(rows, importBatchRow{
+				BatchID: b.ID, SourceFile: b.SourceFile, Shell: b.Shell, Host: b.Host,
+				ImportedAt: b.ImportedAt, Events: b.EventCount, Status: b.Status,
+			})
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(rows); err != nil {
+			fmt.Fprintf(os.Stderr, "hx import list: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(batches) == 0 {
+		fmt.Println("No imports.")
+		return
+	}
+	printImportList(os.Stdout, batches, cmdutil.RenderWidth(os.Stdout, 0))
+}
+
+func printImportList(w io.Writer, batches []imp.Batch, termWidth int) {
+	const whenW, shellW, eventsW, statusW = 19, 6, 7, 9
+	fileW := termWidth - shortBatchID - whenW - shellW - eventsW - statusW - 10
+	if fileW < 20 {
+		fileW = 20
+	}
+	_, _ = fmt.Fprintf(w, "%-*s  %-*s  %-*s  %*s  %-*s  %s\n",
+		shortBatchID, "BATCH", whenW, "IMPORTED", shellW, "SHELL", eventsW, "EVENTS", statusW, "STATUS", "SOURCE")
+	for _, b := range batches {
+		_, _ = fmt.Fprintf(w, "%-*s  %-*s  %-*s  %*d  %-*s  %s\n",
+			shortBatchID, shortID(b.ID),
+			whenW, cmdutil.FormatWhenAbs(b.ImportedAt),
+			shellW, b.Shell,
+			eventsW, b.EventCount,
+			statusW, batchStatus(b.Status),
+			cmdutil.ShortenPath(b.SourceFile, fileW))
+	}
+}
+
+// shortID returns the prefix of a batch id that hx import list prints. It is
+// cut without an ellipsis so it can be pasted into show, undo or --resume.
+func shortID(id string) string {
+	if len(id) > shortBatchID {
+		return id[:shortBatchID]
+	}
+	return id
+}
+
+// batchStatus labels a batch left running by an interrupted import.
+func batchStatus(status string) string {
+	if status == "running" {
+		return "resumable"
+	}
+	return status
+}
+
+func cmdImportShow(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "hx import show: usage: hx import show <batch_id>\n")
+		os.Exit(1)
+	}
+	conn, err := db.Open(dbPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx import show: %v\n", err)
+		os.Exit(1)
+	}
+	defer func() { _ = conn.Close() }()
+	b, err := imp.FindBatch(conn, args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx import show: %v\n", err)
+		os.Exit(1)
+	}
+	s, err := imp.SummarizeBatch(conn, b, 10)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx import show: %v\n", err)
+		os.Exit(1)
+	}
+	printImportShow(os.Stdout, s)
+}
+
+func printImportShow(w io.Writer, s *imp.BatchSummary) {
+	_, _ = fmt.Fprintf(w, "batch:    %s\n", s.ID)
+	_, _ = fmt.Fprintf(w, "source:   %s\n", s.SourceFile)
+	_, _ = fmt.Fprintf(w, "shell:    %s\n", s.Shell)
+	if s.Host != "" {
+		_, _ = fmt.Fprintf(w, "host:     %s\n", s.Host)
+	}
+	_, _ = fmt.Fprintf(w, "imported: %s\n", cmdutil.FormatWhenAbs(s.ImportedAt))
+	_, _ = fmt.Fprintf(w, "status:   %s\n", batchStatus(s.Status))
+	_, _ = fmt.Fprintf(w, "events:   %d\n", s.Events)
+	if s.Events > 0 {
+		_, _ = fmt.Fprintf(w, "range:    %s .. %s\n", cmdutil.FormatWhenAbs(s.First), cmdutil.FormatWhenAbs(s.Last))
+		tiers := make([]string, 0, len(s.Tiers))
+		for t := range s.Tiers {
+			tiers = append(tiers, t)
+		}
+		sort.Strings(tiers)
+		_, _ = fmt.Fprint(w, "quality: ")
+		for _, t := range tiers {
+			_, _ = fmt.Fprintf(w, " %s=%d", t, s.Tiers[t])
+		}
+		_, _ = fmt.Fprintln(w)
+	}
+	if len(s.Sample) > 0 {
+		_, _ = fmt.Fprintln(w, "first commands:")
+		for _, c := range s.Sample {
+			_, _ = fmt.Fprintf(w, "  %s\n", cmdutil.TruncateRight(c, 100))
+		}
+	}
+	if s.Status == "running" {
+		_, _ = fmt.Fprintf(w, "Interrupted. Continue with: hx import --resume %s\n", s.ID)
+	}
+}
+
+func cmdImportUndo(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "hx import undo: usage: hx import undo <batch_id>\n")
+		os.Exit(1)
+	}
+	conn, err := db.Open(dbPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx import undo: %v\n", err)
+		os.Exit(1)
+	}
+	defer func() { _ = conn.Close() }()
+	b, err := imp.FindBatch(conn, args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx import undo: %v\n", err)
+		os.Exit(1)
+	}
+	res, err := imp.UndoBatch(conn, b)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx import undo: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Removed %d events from batch %s (%s)\n", res.Events, b.ID, b.SourceFile)
+	fmt.Printf("  Cleared %d dedup hashes; the file can be imported again.\n", res.Hashes)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mrcawood/History_eXtended/internal/imp"
+)
+
+func TestPrintImportList(t *testing.T) {
+	batches := []imp.Batch{
+		{ID: "0123456789abcdef0123456789abcdef", SourceFile: "/home/u/.zsh_history", Shell: "zsh", ImportedAt: 1700000000, EventCount: 1234, Status: "complete"},
+		{ID: "fedcba9876543210fedcba9876543210", SourceFile: "/home/u/.bash_history", Shell: "bash", ImportedAt: 1700000100, EventCount: 2000, Status: "running"},
+	}
+	var buf bytes.Buffer
+	printImportList(&buf, batches, 120)
+	out := buf.String()
+	for _, want := range []string{"0123456789ab ", "1234", "resumable", ".bash_history"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "0123456789abc") {
+		t.Errorf("batch id not shortened:\n%s", out)
+	}
+}
+
+func TestPrintImportShow(t *testing.T) {
+	s := &imp.BatchSummary{
+		Batch:  imp.Batch{ID: "abc", SourceFile: "/h", Shell: "zsh", Status: "running"},
+		Events: 3, First: 1700000000, Last: 1700000100,
+		Tiers:  map[string]int{"low": 1, "high": 2},
+		Sample: []string{"make test"},
+	}
+	var buf bytes.Buffer
+	printImportShow(&buf, s)
+	out := buf.String()
+	for _, want := range []string{"events:   3", "quality:  high=2 low=1", "  make test", "hx import --resume abc"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
@@ -7,10 +7,12 @@ import (
 	"bufio"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -23,10 +25,15 @@ import (
 	"github.com/mrcawood/History_eXtended/internal/cmdutil"
 	"github.com/mrcawood/History_eXtended/internal/config"
 	"github.com/mrcawood/History_eXtended/internal/db"
+	"github.com/mrcawood/History_eXtended/internal/embedding"
+	"github.com/mrcawood/History_eXtended/internal/exitcode"
 	"github.com/mrcawood/History_eXtended/internal/export"
+	"github.com/mrcawood/History_eXtended/internal/filter"
+	"github.com/mrcawood/History_eXtended/internal/gitctx"
 	"github.com/mrcawood/History_eXtended/internal/imp"
-	"github.com/mrcawood/History_eXtended/internal/ollama"
+	"github.com/mrcawood/History_eXtended/internal/llm"
 	"github.com/mrcawood/History_eXtended/internal/query"
+	"github.com/mrcawood/History_eXtended/internal/redact"
 	"github.com/mrcawood/History_eXtended/internal/retention"
 	"github.com/mrcawood/History_eXtended/internal/spool"
 	"github.com/mrcawood/History_eXtended/internal/store"
@@ -41,6 +48,16 @@ func getConfig() *config.Config {
 	return c
 }
 
+// loadRedactor returns the secret redactor with config's custom rules, or the
+// built-in detectors alone when there is no config.
+func loadRedactor() (*redact.Redactor, error) {
+	cfg := getConfig()
+	if cfg == nil {
+		return redact.Default(), nil
+	}
+	return redact.New(cfg.Redact)
+}
+
 func pausedFile() string {
 	if c := getConfig(); c != nil {
 		return filepath.Join(filepath.Dir(c.SpoolDir), ".paused")
@@ -135,10 +152,60 @@ func cmdStatus() {
 		} else if len(cfg.IgnorePatterns) > 0 {
 			fmt.Printf("  ignore: %v\n", cfg.IgnorePatterns)
 		}
+		if n := len(cfg.IgnoreRules); n > 0 {
+			fmt.Printf("  ignore_rules: %d\n", n)
+		}
+		p, err := llm.New(cfg)
+		if err != nil {
+			fmt.Printf("  %v\n", err)
+		} else if p != nil {
+			fmt.Printf("  llm: %s at %s\n", p.Name(), p.BaseURL())
+			printEmbeddingStatus(p.EmbedModel())
+		}
 	}
 }
 
-func cmdDebug() {
+// printEmbeddingStatus shows how far hxd has indexed commands for semantic search.
+func printEmbeddingStatus(model string) {
+	conn, err := db.Open(dbPath())
+	if err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+	indexed, total, err := embedding.Stats(conn, model)
+	if err != nil {
+		return
+	}
+	fmt.Printf("  embeddings: %d/%d commands (%s)\n", indexed, total, model)
+}
+
+func cmdDebug(args []string) {
+	var cmd, cwd, host string
+	hasCmd := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--cmd":
+			if i+1 < len(args) {
+				cmd, hasCmd = args[i+1], true
+				i++
+			}
+		case "--cwd":
+			if i+1 < len(args) {
+				cwd = args[i+1]
+				i++
+			}
+		case "--host":
+			if i+1 < len(args) {
+				host = args[i+1]
+				i++
+			}
+		}
+	}
+	if hasCmd {
+		cmdDebugFilter(cmd, cwd, host)
+		return
+	}
+
 	fmt.Println("hx debug")
 	fmt.Println("")
 
@@ -212,6 +279,61 @@ func cmdDebug() {
 	fmt.Println("")
 }
 
+// cmdDebugFilter shows whether cmd, run in cwd on host, would be recorded:
+// the filter rule that drops it, or the text stored after secret scrubbing.
+func cmdDebugFilter(cmd, cwd, host string) {
+	if cwd == "" {
+		cwd, _ = os.Getwd()
+	}
+	if abs, err := filepath.Abs(cwd); err == nil {
+		cwd = abs
+	}
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+	cfg := getConfig()
+	// Broken rules are skipped at capture too: show what capture does
+	flt, err := filter.New(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx debug: WARN %v\n", err)
+	}
+	fmt.Println("hx debug --cmd")
+	fmt.Println("")
+	fmt.Printf("  cmd:     %q\n", cmd)
+	fmt.Printf("  cwd:     %s\n", cmdutil.NormalizePath(cwd))
+	fmt.Printf("  host:    %s\n", host)
+	if root := gitctx.Resolve(cwd).Root; root != "" {
+		ign := filepath.Join(root, filter.IgnoreFile)
+		if _, err := filter.ParseIgnoreFile(ign); err == nil {
+			fmt.Printf("  rules:   config + %s\n", cmdutil.NormalizePath(ign))
+		} else if !os.IsNotExist(err) {
+			fmt.Printf("  rules:   config + %s (WARN %v)\n", cmdutil.NormalizePath(ign), err)
+		}
+	}
+	if rule := flt.Match(cmd, cwd, host); rule != nil {
+		fmt.Printf("  ignored: %s\n", rule)
+		return
+	}
+	scrub, err := redact.Capture(cfg)
+	if err != nil {
+		fmt.Printf("  WARN %v (built-in detectors only)\n", err)
+	}
+	if scrub == nil {
+		fmt.Printf("  record:  %s\n", cmd)
+		return
+	}
+	stored, keep := scrub.Scrub(cmd)
+	if !keep {
+		var kinds []string
+		for _, m := range scrub.Find(cmd) {
+			kinds = append(kinds, m.Kind)
+		}
+		fmt.Printf("  ignored: redact action drop (%s)\n", strings.Join(kinds, ", "))
+		return
+	}
+	fmt.Printf("  record:  %s\n", stored)
+}
+
 func processComm(pid int) string {
 	// Try /proc on Linux first
 	commPath := filepath.Join("/proc", strconv.Itoa(pid), "comm")
@@ -277,13 +399,32 @@ func cmdLast(args []string) {
 	fmt.Printf("Events:  %d\n\n", len(events))
 	showSeq := collectShowSeqs(events)
 	printLastEvents(events, showSeq)
+	if e := endedWhileRunning(events); e != nil {
+		fmt.Printf("\nSession ended while `%s` was running\n", e.cmd)
+	}
 }
 
 type lastEvent struct {
-	seq  int
-	exit *int
-	cwd  string
-	cmd  string
+	seq    int
+	exit   *int
+	pipe   []int
+	signal string
+	state  string // running, interrupted, unknown; "" when completed
+	cwd    string
+	cmd    string
+}
+
+// failed reports a non-zero exit, a failed pipeline stage, a signal kill, or
+// a command cut off by its shell exiting.
+func (e lastEvent) failed() bool {
+	if e.state == store.StateInterrupted {
+		return true
+	}
+	exit := 0
+	if e.exit != nil {
+		exit = *e.exit
+	}
+	return exitcode.Failed(exit, e.pipe) || e.signal != ""
 }
 
 func fetchLastSession(conn *sql.DB) (string, string, float64, []lastEvent, error) {
@@ -298,7 +439,7 @@ func fetchLastSession(conn *sql.DB) (string, string, float64, []lastEvent, error
 	var startedAt float64
 	_ = conn.QueryRow(`SELECT host, started_at FROM sessions WHERE session_id = ?`, sessionID).Scan(&host, &startedAt)
 	rows, err := conn.Query(`
-		SELECT e.seq, e.exit_code, e.cwd, COALESCE(c.cmd_text, '')
+		SELECT e.seq, e.exit_code, COALESCE(e.pipe_status_json, ''), COALESCE(e.signal, ''), COALESCE(e.state, ''), e.cwd, COALESCE(c.cmd_text, '')
 		FROM events e
 		LEFT JOIN command_dict c ON e.cmd_id = c.cmd_id
 		WHERE e.session_id = ?
@@ -311,9 +452,11 @@ func fetchLastSession(conn *sql.DB) (string, string, float64, []lastEvent, error
 	var events []lastEvent
 	for rows.Next() {
 		var e lastEvent
-		if err := rows.Scan(&e.seq, &e.exit, &e.cwd, &e.cmd); err != nil {
+		var pipeJSON string
+		if err := rows.Scan(&e.seq, &e.exit, &pipeJSON, &e.signal, &e.state, &e.cwd, &e.cmd); err != nil {
 			continue
 		}
+		e.pipe = exitcode.ParsePipe(pipeJSON)
 		events = append(events, e)
 	}
 	return sessionID, host, startedAt, events, nil
@@ -322,7 +465,7 @@ func fetchLastSession(conn *sql.DB) (string, string, float64, []lastEvent, error
 func collectShowSeqs(events []lastEvent) map[int]bool {
 	showSeq := make(map[int]bool)
 	for i, e := range events {
-		if e.exit != nil && *e.exit != 0 {
+		if e.failed() {
 			if i > 0 {
 				showSeq[events[i-1].seq] = true
 			}
@@ -350,17 +493,41 @@ func printLastEvents(events []lastEvent, showSeq map[int]bool) {
 			exit = *e.exit
 		}
 		mark := "  "
-		if exit != 0 {
+		if e.failed() {
 			mark = "**"
 		}
+		status := fmt.Sprintf("exit=%d", exit)
+		switch e.state {
+		case store.StateRunning, store.StateInterrupted:
+			status = e.state
+		case store.StateUnknown:
+			status = "exit=?"
+		}
+		if e.signal != "" {
+			status += " " + e.signal
+		}
+		if p := exitcode.FormatPipe(e.pipe); p != "" {
+			status += " pipe=" + p
+		}
 		cmdShort := e.cmd
 		if len(cmdShort) > 60 {
 			cmdShort = cmdShort[:57] + "..."
 		}
-		fmt.Printf("%s [%d] exit=%d  %s\n", mark, e.seq, exit, cmdShort)
+		fmt.Printf("%s [%d] %s  %s\n", mark, e.seq, status, cmdShort)
 	}
 }
 
+// endedWhileRunning returns the last command cut off by its shell exiting, if
+// the session ended that way.
+func endedWhileRunning(events []lastEvent) *lastEvent {
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].state == store.StateInterrupted {
+			return &events[i]
+		}
+	}
+	return nil
+}
+
 type findOpts struct {
 	wide        bool
 	compact     bool
@@ -370,6 +537,10 @@ type findOpts struct {
 	noSelf      bool // backwards compat: same as default
 	noImport    bool
 	width       int // --width flag
+	repo        string
+	branch      string
+	before      int // --before/--after/--context: neighbouring events per hit
+	after       int
 }
 
 func parseFindArgs(args []string) (string, findOpts) {
@@ -391,6 +562,16 @@ func parseFindArgs(args []string) (string, findOpts) {
 			opts.noSelf = true
 		case "--no-import":
 			opts.noImport = true
+		case "--repo":
+			if i+1 < len(args) {
+				opts.repo = repoFilterArg(args[i+1])
+				i++
+			}
+		case "--branch":
+			if i+1 < len(args) {
+				opts.branch = args[i+1]
+				i++
+			}
 		case "--width", "-w":
 			if i+1 < len(args) {
 				if width, err := strconv.Atoi(args[i+1]); err == nil && width > 0 {
@@ -398,6 +579,13 @@ func parseFindArgs(args []string) (string, findOpts) {
 					i++
 				}
 			}
+		case "--before", "-B", "--after", "-A", "--context", "-C":
+			if i+1 < len(args) {
+				if n, err := strconv.Atoi(args[i+1]); err == nil && n >= 0 {
+					setContextFlag(&opts.before, &opts.after, args[i], n)
+					i++
+				}
+			}
 		default:
 			queryParts = append(queryParts, args[i])
 		}
@@ -413,12 +601,32 @@ func parseFindArgs(args []string) (string, findOpts) {
 	return query, opts
 }
 
+// repoFilterArg turns a --repo value into a filter: a path (".", "./x", "/x")
+// resolves to its repo root; a bare name matches the root's base name.
+func repoFilterArg(v string) string {
+	if v != "." && v != ".." && !strings.Contains(v, "/") {
+		return v
+	}
+	p := v
+	if abs, err := filepath.Abs(p); err == nil {
+		p = abs
+	}
+	if info := gitctx.Resolve(p); info.Root != "" {
+		return info.Root
+	}
+	return filepath.Clean(p)
+}
+
 func findTermWidth(opts findOpts) int {
 	return cmdutil.RenderWidth(os.Stdout, opts.width)
 }
 
 func isSelfCmd(cmd string) bool {
 	cmd = strings.TrimSpace(cmd)
+	// hx run wraps a user command: that is history, not hx querying itself
+	if strings.HasPrefix(cmd, "hx run ") || strings.HasPrefix(cmd, "./bin/hx run ") {
+		return false
+	}
 	if cmd == "hx" || strings.HasPrefix(cmd, "hx ") {
 		return true
 	}
@@ -437,8 +645,9 @@ func isSelfCmd(cmd string) bool {
 
 func cmdFind(args []string) {
 	query, opts := parseFindArgs(args)
-	if query == "" {
-		fmt.Fprintf(os.Stderr, "hx find: usage: hx find <text> [--compact|--wide|--debug] [--include-self] [--no-import]\n")
+	q := mustParseQuery("hx find", query)
+	if q.Text == "" && q.Where.IsZero() {
+		fmt.Fprintf(os.Stderr, "hx find: usage: hx find <text> [key:value ...] [--compact|--wide|--debug] [--include-self] [--no-import] [--repo R] [--branch B]\n")
 		fmt.Fprintf(os.Stderr, "  Set HX_FIND_DEFAULT=wide to keep legacy output. Run 'hx find --help' for details.\n")
 		os.Exit(1)
 	}
@@ -449,22 +658,40 @@ func cmdFind(args []string) {
 	}
 	defer func() { _ = conn.Close() }()
 
-	// FTS5: escape double-quotes; use as phrase for multi-word
-	escaped := strings.ReplaceAll(query, "\"", "\"\"")
-	if strings.Contains(escaped, " ") {
-		escaped = "\"" + escaped + "\""
-	}
-
-	sqlQuery := `
-		SELECT e.event_id, e.session_id, e.seq, e.started_at, e.exit_code, e.cwd, COALESCE(c.cmd_text, '')
+	var sqlQuery string
+	var queryArgs []interface{}
+	if q.Text != "" {
+		// FTS5: escape double-quotes; use as phrase for multi-word
+		escaped := strings.ReplaceAll(q.Text, "\"", "\"\"")
+		if strings.Contains(escaped, " ") {
+			escaped = "\"" + escaped + "\""
+		}
+		sqlQuery = `
+		SELECT e.event_id, e.session_id, e.seq, e.started_at, e.exit_code, COALESCE(e.state, ''), e.cwd, COALESCE(c.cmd_text, '')
 		FROM events_fts
 		JOIN events e ON e.event_id = events_fts.rowid
 		LEFT JOIN command_dict c ON e.cmd_id = c.cmd_id
+		LEFT JOIN sessions s ON s.session_id = e.session_id
 		WHERE events_fts MATCH ?`
-	queryArgs := []interface{}{escaped}
+		queryArgs = append(queryArgs, escaped)
+	} else {
+		// Filters only: most recent matching events
+		sqlQuery = `
+		SELECT e.event_id, e.session_id, e.seq, e.started_at, e.exit_code, COALESCE(e.state, ''), e.cwd, COALESCE(c.cmd_text, '')
+		FROM events e
+		LEFT JOIN command_dict c ON e.cmd_id = c.cmd_id
+		LEFT JOIN sessions s ON s.session_id = e.session_id
+		WHERE 1=1`
+	}
 	if opts.noImport {
 		sqlQuery += ` AND e.session_id NOT LIKE 'import-%'`
 	}
+	gitWhere, gitArgs := gitctx.SQLFilter(opts.repo, opts.branch)
+	sqlQuery += gitWhere
+	queryArgs = append(queryArgs, gitArgs...)
+	where, whereArgs := q.Where.SQL()
+	sqlQuery += where
+	queryArgs = append(queryArgs, whereArgs...)
 	sqlQuery += ` ORDER BY e.started_at DESC LIMIT 100`
 
 	rows, err := conn.Query(sqlQuery, queryArgs...)
@@ -478,7 +705,7 @@ func cmdFind(args []string) {
 	var results []findRow
 	for rows.Next() {
 		var r findRow
-		if err := rows.Scan(&r.eventID, &r.sessionID, &r.seq, &r.startedAt, &r.exitCode, &r.cwd, &r.cmd); err != nil {
+		if err := rows.Scan(&r.eventID, &r.sessionID, &r.seq, &r.startedAt, &r.exitCode, &r.state, &r.cwd, &r.cmd); err != nil {
 			continue
 		}
 		excludeSelf := !opts.includeSelf || opts.noSelf
@@ -506,7 +733,12 @@ func cmdFind(args []string) {
 	}
 	std1Rows := make([]cmdutil.Std1Row, len(results))
 	for i, r := range results {
-		std1Rows[i] = cmdutil.Std1Row{EventID: r.eventID, SessionID: r.sessionID, Seq: r.seq, StartedAt: r.startedAt, ExitCode: r.exitCode, Cwd: r.cwd, Cmd: r.cmd}
+		std1Rows[i] = cmdutil.Std1Row{EventID: r.eventID, SessionID: r.sessionID, Seq: r.seq, StartedAt: r.startedAt, ExitCode: r.exitCode, State: r.state, Cwd: r.cwd, Cmd: r.cmd}
+	}
+	std1Rows, err = withContextRows(conn, std1Rows, opts.before, opts.after)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx find: %v\n", err)
+		os.Exit(1)
 	}
 	cmdutil.RenderStandard1(std1Rows, mode, tw, opts.forceWide, w)
 	if len(results) == 0 {
@@ -521,6 +753,7 @@ type findRow struct {
 	seq       int
 	startedAt float64
 	exitCode  *int
+	state     string
 	cwd       string
 	cmd       string
 }
@@ -588,6 +821,10 @@ type queryOpts struct {
 	noFallback  bool
 	explain     bool
 	width       int // --width flag
+	repo        string
+	branch      string
+	before      int // --before/--after/--context: neighbouring events per hit
+	after       int
 }
 
 func parseQueryArgs(args []string) (string, queryOpts) {
@@ -620,6 +857,16 @@ func parseQueryArgs(args []string) (string, queryOpts) {
 			opts.noFallback = true
 		case "--explain":
 			opts.explain = true
+		case "--repo":
+			if i+1 < len(args) {
+				opts.repo = repoFilterArg(args[i+1])
+				i++
+			}
+		case "--branch":
+			if i+1 < len(args) {
+				opts.branch = args[i+1]
+				i++
+			}
 		case "--width", "-w":
 			if i+1 < len(args) {
 				if width, err := strconv.Atoi(args[i+1]); err == nil && width > 0 {
@@ -627,6 +874,13 @@ func parseQueryArgs(args []string) (string, queryOpts) {
 					i++
 				}
 			}
+		case "--before", "-B", "--after", "-A", "--context", "-C":
+			if i+1 < len(args) {
+				if n, err := strconv.Atoi(args[i+1]); err == nil && n >= 0 {
+					setContextFlag(&opts.before, &opts.after, args[i], n)
+					i++
+				}
+			}
 		default:
 			questionParts = append(questionParts, args[i])
 		}
@@ -705,6 +959,7 @@ func printQueryExplain(meta query.RetrieveMeta) {
 	fmt.Fprintf(os.Stderr, "fts_candidates: %d\n", meta.FTSCount)
 	fmt.Fprintf(os.Stderr, "used_fallback: %v\n", meta.UsedFallback)
 	fmt.Fprintf(os.Stderr, "semantic_reranked: %v\n", meta.SemanticReranked)
+	fmt.Fprintf(os.Stderr, "semantic_index: %v\n", meta.SemanticIndex)
 }
 
 func printQueryFallbackNotice(meta query.RetrieveMeta) {
@@ -732,7 +987,24 @@ func queryRenderMode(opts queryOpts) string {
 }
 
 func printQueryLLMSummary(question string, candidates []query.Candidate, cfg *config.Config, opts queryOpts) {
-	if opts.noLLM || cfg == nil || !cfg.OllamaEnabled || !ollama.Available(context.Background(), cfg.OllamaBaseURL) {
+	if opts.noLLM {
+		return
+	}
+	p, err := llm.New(cfg)
+	if err != nil {
+		if opts.verbose {
+			fmt.Fprintf(os.Stderr, "\nhx query: %v\n", err)
+		}
+		return
+	}
+	if p == nil || !p.Available(context.Background()) {
+		return
+	}
+	r, err := loadRedactor()
+	if err != nil {
+		if opts.verbose {
+			fmt.Fprintf(os.Stderr, "\nhx query: %v\n", err)
+		}
 		return
 	}
 	topN := 5
@@ -741,7 +1013,7 @@ func printQueryLLMSummary(question string, candidates []query.Candidate, cfg *co
 	}
 	var b strings.Builder
 	b.WriteString("Question: ")
-	b.WriteString(question)
+	b.WriteString(r.Redact(question))
 	b.WriteString("\n\nEvidence snippets (session_id, event_id, cmd):\n")
 	for i := 0; i < topN; i++ {
 		c := candidates[i]
@@ -750,15 +1022,19 @@ func printQueryLLMSummary(question string, candidates []query.Candidate, cfg *co
 		b.WriteString(" event ")
 		b.WriteString(fmt.Sprintf("%d", c.EventID))
 		b.WriteString(": ")
-		b.WriteString(c.Cmd)
+		b.WriteString(r.Redact(c.Cmd))
 		b.WriteString("\n")
 	}
 	b.WriteString("\nSummarize in 2-3 sentences what the user did, citing session/event IDs. Be concise.")
 
-	summary, err := ollama.Generate(context.Background(), cfg.OllamaBaseURL, cfg.OllamaChatModel, b.String())
+	summary, err := p.Complete(context.Background(), b.String())
 	if err != nil {
 		if opts.verbose {
-			fmt.Fprintf(os.Stderr, "\nOllama unavailable (model %s). Start with: ollama run %s\n", cfg.OllamaChatModel, cfg.OllamaChatModel)
+			if p.Name() == "ollama" {
+				fmt.Fprintf(os.Stderr, "\nOllama unavailable (model %s). Start with: ollama run %s\n", p.ChatModel(), p.ChatModel())
+			} else {
+				fmt.Fprintf(os.Stderr, "\n%s server at %s failed (model %s): %v\n", p.Name(), p.BaseURL(), p.ChatModel(), err)
+			}
 		}
 		return
 	}
@@ -774,8 +1050,10 @@ func cmdQueryByQuestion(conn *sql.DB, question string, opts queryOpts) {
 	if cfg == nil {
 		cfg = &config.Config{OllamaEnabled: true, OllamaBaseURL: "http://localhost:11434", OllamaEmbedModel: "nomic-embed-text", OllamaChatModel: "llama3.2"}
 	}
-	retrieveOpts := &query.RetrieveOpts{NoFallback: opts.noFallback}
-	result, err := query.Retrieve(context.Background(), conn, question, cfg, retrieveOpts)
+	q := mustParseQuery("hx query", question)
+	retrieveOpts := &query.RetrieveOpts{NoFallback: opts.noFallback, Repo: opts.repo, Branch: opts.branch}
+	retrieveOpts.Where, retrieveOpts.WhereArgs = q.Where.SQL()
+	result, err := query.Retrieve(context.Background(), conn, q.Text, cfg, retrieveOpts)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "hx query: %v\n", err)
 		os.Exit(1)
@@ -809,6 +1087,11 @@ func cmdQueryByQuestion(conn *sql.DB, question string, opts queryOpts) {
 			StartedAt: c.StartedAt, ExitCode: &ec, Cwd: c.Cwd, Cmd: c.Cmd,
 		}
 	}
+	std1Rows, err = withContextRows(conn, std1Rows, opts.before, opts.after)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx query: %v\n", err)
+		os.Exit(1)
+	}
 	cmdutil.RenderStandard1(std1Rows, mode, termWidth, opts.forceWide, os.Stdout)
 	fmt.Println()
 
@@ -817,7 +1100,7 @@ func cmdQueryByQuestion(conn *sql.DB, question string, opts queryOpts) {
 
 func isConfigFile(base string) bool {
 	switch base {
-	case ".zshrc", ".bashrc", ".profile", ".bash_profile", ".zprofile":
+	case ".zshrc", ".bashrc", ".profile", ".bash_profile", ".zprofile", "config.fish":
 		return true
 	}
 	return false
@@ -833,12 +1116,28 @@ func suggestHistoryFile(configBase string) string {
 		return filepath.Join(home, ".zsh_history")
 	case ".bashrc", ".bash_profile", ".profile":
 		return filepath.Join(home, ".bash_history")
+	case "config.fish":
+		return filepath.Join(home, ".local", "share", "fish", "fish_history")
 	}
 	return filepath.Join(home, ".zsh_history")
 }
 
 func cmdImport(args []string) {
-	var filePath, host, shell string
+	if len(args) > 0 {
+		switch args[0] {
+		case "list":
+			cmdImportList(args[1:])
+			return
+		case "show":
+			cmdImportShow(args[1:])
+			return
+		case "undo":
+			cmdImportUndo(args[1:])
+			return
+		}
+	}
+	var filePath, host, shell, resume string
+	keepCaptured := false
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
 		case "--file", "-f":
@@ -857,21 +1156,32 @@ func cmdImport(args []string) {
 			i++
 		case "--shell":
 			if i+1 >= len(args) {
-				fmt.Fprintf(os.Stderr, "hx import: --shell requires zsh|bash|auto\n")
+				fmt.Fprintf(os.Stderr, "hx import: --shell requires zsh|bash|fish|atuin|histdb|mcfly|auto\n")
 				os.Exit(1)
 			}
 			shell = args[i+1]
 			i++
+		case "--resume":
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "hx import: --resume requires batch id\n")
+				os.Exit(1)
+			}
+			resume = args[i+1]
+			i++
+		case "--keep-captured":
+			keepCaptured = true
 		}
 	}
-	if filePath == "" {
-		fmt.Fprintf(os.Stderr, "hx import: usage: hx import --file <path> [--host label] [--shell zsh|bash|auto] [--force]\n")
+	if filePath == "" && resume == "" {
+		fmt.Fprintf(os.Stderr, "hx import: usage: hx import --file <path> [--host label] [--shell zsh|bash|fish|atuin|histdb|mcfly|auto] [--keep-captured] [--force]\n")
+		fmt.Fprintf(os.Stderr, "       hx import --resume <batch_id>\n")
+		fmt.Fprintf(os.Stderr, "       hx import list|show <batch_id>|undo <batch_id>\n")
 		os.Exit(1)
 	}
 
 	// Safeguard: warn if importing a config file instead of history
 	base := filepath.Base(filepath.Clean(filePath))
-	if isConfigFile(base) {
+	if filePath != "" && isConfigFile(base) {
 		suggest := suggestHistoryFile(base)
 		fmt.Fprintf(os.Stderr, "hx import: %q looks like a shell config file, not command history.\n", base)
 		fmt.Fprintf(os.Stderr, "  Did you mean: hx import --file %s\n", suggest)
@@ -898,20 +1208,72 @@ func cmdImport(args []string) {
 		os.Exit(1)
 	}
 	defer func() { _ = conn.Close() }()
-	inserted, skipped, truncated, err := imp.Run(conn, filePath, host, shell)
+
+	// Ctrl-C stops after the current transaction; the batch stays resumable
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	// Imported commands get the capture filter and scrubbing live ones do
+	cfg := getConfig()
+	flt, err := filter.New(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx import: WARN %v\n", err)
+	}
+	scrub, err := redact.Capture(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx import: WARN %v (built-in detectors only)\n", err)
+	}
+	opts := imp.Options{Host: host, Shell: shell, BatchID: resume, Filter: flt, Scrub: scrub}
+	if keepCaptured {
+		opts.CapturedWindow = -1
+	}
+	showProgress := cmdutil.IsTerminal(os.Stderr)
+	if showProgress {
+		opts.Progress = func(p imp.Progress) { printImportProgress(os.Stderr, p) }
+	}
+	res, err := imp.Run(ctx, conn, filePath, opts)
+	if showProgress && res != nil {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
 	if err != nil {
+		if res != nil && errors.Is(err, context.Canceled) {
+			fmt.Fprintf(os.Stderr, "hx import: interrupted after %d events\n", res.Inserted)
+			fmt.Fprintf(os.Stderr, "  Continue with: hx import --resume %s\n", res.BatchID)
+			os.Exit(130)
+		}
 		fmt.Fprintf(os.Stderr, "hx import: %v\n", err)
+		if res != nil {
+			fmt.Fprintf(os.Stderr, "  Committed entries are kept. Retry with: hx import --resume %s\n", res.BatchID)
+		}
 		os.Exit(1)
 	}
-	if truncated {
-		fmt.Fprintf(os.Stderr, "hx import: file truncated at %d lines (use smaller file or increase limit)\n", imp.MaxLines)
+	if res.Resumed {
+		fmt.Printf("Resumed batch %s\n", res.BatchID)
+	}
+	fmt.Printf("Imported %d events (skipped %d duplicates)\n", res.Inserted, res.Skipped)
+	if res.Captured > 0 {
+		fmt.Printf("  %d entries were already captured live and not imported again\n", res.Captured)
+	}
+	if res.Filtered > 0 {
+		fmt.Printf("  %d entries matched ignore rules or a secret drop rule and were left out\n", res.Filtered)
 	}
-	fmt.Printf("Imported %d events (skipped %d duplicates)\n", inserted, skipped)
-	if inserted > 0 {
+	if res.Inserted > 0 {
 		fmt.Printf("  Try: hx find <text>  or  hx dump  or  hx last\n")
 	}
 }
 
+// printImportProgress redraws a one-line progress indicator on w.
+func printImportProgress(w io.Writer, p imp.Progress) {
+	if p.Total > 0 {
+		pct := float64(p.Done) * 100 / float64(p.Total)
+		if pct > 100 {
+			pct = 100
+		}
+		_, _ = fmt.Fprintf(w, "\rhx import: %d entries (%.0f%%)\033[K", p.Entries, pct)
+		return
+	}
+	_, _ = fmt.Fprintf(w, "\rhx import: %d entries\033[K", p.Entries)
+}
+
 func cmdPin(args []string) {
 	var sessionID string
 	useLast := false
@@ -981,12 +1343,37 @@ func cmdForget(args []string) {
 		os.Exit(1)
 	}
 	defer func() { _ = conn.Close() }()
+	end := time.Now()
 	n, err := retention.ForgetSince(conn, d)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "hx forget: %v\n", err)
 		os.Exit(1)
 	}
 	fmt.Printf("Forgot %d events\n", n)
+
+	// Propagate to synced devices: tombstone the same window in the vault.
+	// It is queued first so a failed publish is retried by hx sync push.
+	v, err := loadSyncVault(conn)
+	if err != nil {
+		return
+	}
+	payload, err := sync.ForgetTombstone(conn, v.NodeID, float64(end.Add(-d).Unix()), float64(end.UnixNano())/1e9)
+	if err == nil {
+		err = sync.QueueTombstone(conn, v.ID, payload)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx forget: deleted locally, but tombstone not queued: %v\n", err)
+		os.Exit(1)
+	}
+	tombIDs, err := publishPendingTombstones(conn, v)
+	for _, id := range tombIDs {
+		fmt.Printf("Published tombstone %s to %s\n", id, v.ID)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx forget: deleted locally, but tombstone not published: %v\n", err)
+		fmt.Fprintf(os.Stderr, "hx forget: it stays queued; hx sync push publishes it\n")
+		os.Exit(1)
+	}
 }
 
 func parseSince(s string) (time.Duration, error) {
@@ -999,7 +1386,7 @@ func parseSince(s string) (time.Duration, error) {
 func cmdExport(args []string) {
 	sessionID := ""
 	useLast := false
-	redact := false
+	redacted := false
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
 		case "--session", "-s":
@@ -1010,7 +1397,7 @@ func cmdExport(args []string) {
 		case "--last":
 			useLast = true
 		case "--redacted":
-			redact = true
+			redacted = true
 		}
 	}
 	conn, err := db.Open(dbPath())
@@ -1037,7 +1424,14 @@ func cmdExport(args []string) {
 		fmt.Fprintf(os.Stderr, "hx export: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Print(export.Markdown(exp, redact))
+	var r *redact.Redactor
+	if redacted {
+		if r, err = loadRedactor(); err != nil {
+			fmt.Fprintf(os.Stderr, "hx export: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	fmt.Print(export.MarkdownWith(exp, r))
 }
 
 func cmdDump(args []string) {
@@ -1170,7 +1564,7 @@ func cmdSync(args []string) {
 	case "push":
 		cmdSyncPush()
 	case "pull":
-		cmdSyncPull()
+		cmdSyncPull(args[1:])
 	default:
 		fmt.Fprintf(os.Stderr, "hx sync: unknown subcommand %q\n", args[0])
 		os.Exit(1)
@@ -1180,6 +1574,7 @@ func cmdSync(args []string) {
 func cmdSyncInit(args []string) {
 	var storeArg string
 	vaultName := "default"
+	encrypt := true
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
 		case "--store":
@@ -1197,15 +1592,18 @@ func cmdSyncInit(args []string) {
 			vaultName = args[i+1]
 			i++
 		case "--no-encrypt":
-			// TODO: store encrypt=false
+			encrypt = false
 		}
 	}
-	if storeArg == "" || !strings.HasPrefix(storeArg, "folder:") {
-		fmt.Fprintf(os.Stderr, "hx sync init: usage: hx sync init --store folder:/path/to/HXSync [--vault-name NAME]\n")
+	if storeArg == "" {
+		fmt.Fprintf(os.Stderr, "hx sync init: usage: hx sync init --store folder:/path/to/HXSync|s3://bucket/prefix [--vault-name NAME] [--no-encrypt]\n")
+		os.Exit(1)
+	}
+	storeType, storePath, err := parseStoreArg(storeArg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx sync init: %v\n", err)
 		os.Exit(1)
 	}
-	storePath := strings.TrimPrefix(storeArg, "folder:")
-	storePath = strings.TrimSuffix(storePath, "/")
 
 	conn, err := db.Open(dbPath())
 	if err != nil {
@@ -1215,10 +1613,32 @@ func cmdSyncInit(args []string) {
 	defer func() { _ = conn.Close() }()
 
 	vaultID := "vault-" + vaultName
+	v := &syncVault{ID: vaultID, StoreType: storeType, StorePath: storePath}
+	st, err := openSyncStore(v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx sync init: %v\n", err)
+		os.Exit(1)
+	}
+	encrypted, key, err := initVaultMeta(st, vaultID, encrypt)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx sync init: %v\n", err)
+		os.Exit(1)
+	}
+	if encrypted {
+		if err := sync.SaveKeyFile(vaultKeyPath(vaultID), key); err != nil {
+			fmt.Fprintf(os.Stderr, "hx sync init: cache vault key: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	encryptFlag := 0
+	if encrypted {
+		encryptFlag = 1
+	}
+
 	nodeID := sync.NewNodeID()
 	_, err = conn.Exec(`
-		INSERT OR REPLACE INTO sync_vaults (vault_id, name, store_type, store_path, encrypt) VALUES (?, ?, 'folder', ?, 0)
-	`, vaultID, vaultName, storePath)
+		INSERT OR REPLACE INTO sync_vaults (vault_id, name, store_type, store_path, encrypt) VALUES (?, ?, ?, ?, ?)
+	`, vaultID, vaultName, storeType, storePath, encryptFlag)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "hx sync init: %v\n", err)
 		os.Exit(1)
@@ -1229,6 +1649,11 @@ func cmdSyncInit(args []string) {
 		os.Exit(1)
 	}
 	fmt.Printf("Sync initialized. Vault: %s, Node: %s, Store: %s\n", vaultID, nodeID, storePath)
+	if encrypted {
+		fmt.Printf("Encryption: on (key cached at %s)\n", cmdutil.NormalizePath(vaultKeyPath(vaultID)))
+	} else {
+		fmt.Println("Encryption: off")
+	}
 }
 
 func cmdSyncStatus() {
@@ -1239,18 +1664,27 @@ func cmdSyncStatus() {
 	}
 	defer func() { _ = conn.Close() }()
 
-	var vaultID, storePath, nodeID string
-	err = conn.QueryRow(`SELECT v.vault_id, v.store_path, n.node_id FROM sync_vaults v JOIN sync_nodes n ON n.vault_id = v.vault_id LIMIT 1`).Scan(&vaultID, &storePath, &nodeID)
+	v, err := loadSyncVault(conn)
 	if err != nil {
 		fmt.Println("No sync vault configured. Run: hx sync init --store folder:/path/to/HXSync")
 		return
 	}
+	vaultID := v.ID
 	fmt.Printf("Vault: %s\n", vaultID)
-	fmt.Printf("Store: %s\n", storePath)
-	fmt.Printf("Node:  %s\n", nodeID)
+	fmt.Printf("Store: %s\n", v.StorePath)
+	fmt.Printf("Node:  %s\n", v.NodeID)
+	_, keyErr := os.Stat(vaultKeyPath(vaultID))
+	switch {
+	case !v.Encrypt:
+		fmt.Println("Encryption: off")
+	case keyErr == nil:
+		fmt.Println("Encryption: on (key cached)")
+	default:
+		fmt.Println("Encryption: on (locked; passphrase needed on next push/pull)")
+	}
 
-	var pending, imported int
-	_ = conn.QueryRow(`SELECT COUNT(*) FROM events WHERE origin='live' AND event_id NOT IN (SELECT event_id FROM sync_published_events WHERE vault_id=?)`, vaultID).Scan(&pending)
+	var imported int
+	pending, _ := sync.CountUnpublished(conn, vaultID)
 	_ = conn.QueryRow(`SELECT COUNT(*) FROM imported_segments WHERE vault_id=?`, vaultID).Scan(&imported)
 	fmt.Printf("Pending (unpublished): %d events\n", pending)
 	fmt.Printf("Imported segments: %d\n", imported)
@@ -1264,14 +1698,40 @@ func cmdSyncPush() {
 	}
 	defer func() { _ = conn.Close() }()
 
-	var vaultID, storePath, nodeID string
-	err = conn.QueryRow(`SELECT v.vault_id, v.store_path, n.node_id FROM sync_vaults v JOIN sync_nodes n ON n.vault_id = v.vault_id LIMIT 1`).Scan(&vaultID, &storePath, &nodeID)
+	v, err := loadSyncVault(conn)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "hx sync push: no sync vault. Run hx sync init first.\n")
 		os.Exit(1)
 	}
-	fs := sync.NewFolderStore(storePath)
-	res, err := sync.Push(conn, fs, vaultID, nodeID, nil, false)
+	st, err := openSyncStore(v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx sync push: %v\n", err)
+		os.Exit(1)
+	}
+	key, err := vaultKey(v, st)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx sync push: %v\n", err)
+		os.Exit(1)
+	}
+	var redactFn func(string) string
+	if cfg := getConfig(); cfg != nil && cfg.Redact.Sync {
+		r, err := redact.New(cfg.Redact)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "hx sync push: %v\n", err)
+			os.Exit(1)
+		}
+		redactFn = r.Redact
+	}
+	// Tombstones hx forget could not publish go out first
+	tombIDs, err := sync.PublishPendingTombstones(conn, st, v.ID, v.NodeID, key, v.Encrypt)
+	for _, id := range tombIDs {
+		fmt.Printf("Published tombstone %s\n", id)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx sync push: tombstone: %v\n", err)
+		os.Exit(1)
+	}
+	res, err := sync.PushRedacted(conn, st, v.ID, v.NodeID, key, v.Encrypt, redactFn)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "hx sync push: %v\n", err)
 		os.Exit(1)
@@ -1279,7 +1739,18 @@ func cmdSyncPush() {
 	fmt.Printf("Pushed %d segments (%d events)\n", res.SegmentsPublished, res.EventsPublished)
 }
 
-func cmdSyncPull() {
+func cmdSyncPull(args []string) {
+	fullScan := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--full-scan":
+			fullScan = true
+		default:
+			fmt.Fprintf(os.Stderr, "hx sync pull: unknown option %q\n", args[i])
+			os.Exit(1)
+		}
+	}
+
 	conn, err := db.Open(dbPath())
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "hx sync pull: %v\n", err)
@@ -1293,20 +1764,44 @@ func cmdSyncPull() {
 		blobDir = cfg.BlobDir
 	}
 
-	var vaultID, storePath string
-	err = conn.QueryRow(`SELECT vault_id, store_path FROM sync_vaults LIMIT 1`).Scan(&vaultID, &storePath)
+	v, err := loadSyncVault(conn)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "hx sync pull: no sync vault. Run hx sync init first.\n")
 		os.Exit(1)
 	}
-	fs := sync.NewFolderStore(storePath)
-	res, err := sync.Import(conn, fs, blobDir, vaultID, nil)
+	st, err := openSyncStore(v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx sync pull: %v\n", err)
+		os.Exit(1)
+	}
+	key, err := vaultKey(v, st)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx sync pull: %v\n", err)
+		os.Exit(1)
+	}
+	if fullScan {
+		res, err := sync.Import(conn, st, blobDir, v.ID, key)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "hx sync pull: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Imported: %d segments, %d blobs. Skipped: %d segments. Tombstones: %d. Errors: %d\n",
+			res.SegmentsImported, res.BlobsImported, res.SegmentsSkipped, res.TombstonesApplied, res.Errors)
+		return
+	}
+	res, err := sync.PullWithFallback(conn, st, v.ID, v.NodeID, key, v.Encrypt)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "hx sync pull: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Printf("Imported: %d segments, %d blobs. Skipped: %d segments. Tombstones: %d. Errors: %d\n",
-		res.SegmentsImported, res.BlobsImported, res.SegmentsSkipped, res.TombstonesApplied, res.Errors)
+	for _, e := range res.Errors {
+		fmt.Fprintf(os.Stderr, "hx sync pull: %s\n", e)
+	}
+	fmt.Printf("Imported: %d segments. Skipped: %d segments. Tombstones: %d. Errors: %d\n",
+		res.SegmentsImported, res.SegmentsSkipped, res.TombstonesImported, len(res.Errors))
+	if res.FallbackNodes > 0 {
+		fmt.Printf("Scanned %d node(s) without a manifest\n", res.FallbackNodes)
+	}
 }
 
 func main() {
@@ -1337,7 +1832,8 @@ func runCLI(args []string) int {
 	}
 
 	// Subcommand help: hx <cmd> --help or hx <cmd> -h
-	if argsHasHelp(cmdArgs) && isKnownCommand(cmd) {
+	// hx run parses its own: --help after the command belongs to the command
+	if argsHasHelp(cmdArgs) && isKnownCommand(cmd) && cmd != "run" {
 		printSubcommandHelp(os.Stdout, cmd)
 		return 0
 	}
@@ -1357,8 +1853,8 @@ func argsHasHelp(args []string) bool {
 
 func isKnownCommand(cmd string) bool {
 	known := map[string]bool{
-		"status": true, "pause": true, "resume": true, "last": true, "dump": true,
-		"debug": true, "find": true, "search": true, "show": true, "attach": true, "query": true, "import": true,
+		"status": true, "pause": true, "resume": true, "last": true, "ps": true, "dump": true,
+		"debug": true, "find": true, "search": true, "show": true, "attach": true, "run": true, "query": true, "import": true,
 		"pin": true, "forget": true, "export": true, "sync": true,
 	}
 	return known[cmd]
@@ -1374,12 +1870,14 @@ func printRootHelp(w io.Writer) {
 	_, _ = fmt.Fprintln(w, "  pause     stop capturing")
 	_, _ = fmt.Fprintln(w, "  resume    resume capturing")
 	_, _ = fmt.Fprintln(w, "  last      last session summary, failure context")
+	_, _ = fmt.Fprintln(w, "  ps        commands currently running in captured shells")
 	_, _ = fmt.Fprintln(w, "  find      full-text search over commands")
 	_, _ = fmt.Fprintln(w, "  search    interactive history search (machine-readable for Ctrl-R)")
 	_, _ = fmt.Fprintln(w, "  show      event metadata by id (preview for search)")
 	_, _ = fmt.Fprintln(w, "  dump      last 20 events (debug)")
 	_, _ = fmt.Fprintln(w, "  debug     diagnostics: daemon PID, spool, DB event count")
 	_, _ = fmt.Fprintln(w, "  attach    link artifact to session")
+	_, _ = fmt.Fprintln(w, "  run       run a command, saving its output as an artifact if it fails")
 	_, _ = fmt.Fprintln(w, "  query     evidence-backed search (optional Ollama)")
 	_, _ = fmt.Fprintln(w, "  import    import shell history file")
 	_, _ = fmt.Fprintln(w, "  pin       pin session (exempt from retention)")
@@ -1389,7 +1887,7 @@ func printRootHelp(w io.Writer) {
 	_, _ = fmt.Fprintln(w, "")
 	_, _ = fmt.Fprintln(w, "Getting started:")
 	_, _ = fmt.Fprintln(w, "  Import-only:  hx import --file ~/.zsh_history  # then hx find <text>")
-	_, _ = fmt.Fprintln(w, "  Live capture: source src/hooks/hx.zsh (zsh) or src/hooks/bash/hx.bash (bash)")
+	_, _ = fmt.Fprintln(w, "  Live capture: source src/hooks/hx.zsh (zsh), src/hooks/bash/hx.bash (bash) or src/hooks/fish/hx.fish (fish)")
 	_, _ = fmt.Fprintln(w, "")
 	_, _ = fmt.Fprintln(w, "Note: Set HX_FIND_DEFAULT=wide for legacy find output.")
 	_, _ = fmt.Fprintln(w, "")
@@ -1403,24 +1901,32 @@ var helpRegistry = map[string]func(io.Writer){
 		_, _ = fmt.Fprintln(w, "Show capture state, daemon health, and configured paths (spool, db, events).")
 	},
 	"search": func(w io.Writer) {
-		_, _ = fmt.Fprintln(w, "hx search: usage: hx search [query] [options]")
+		_, _ = fmt.Fprintln(w, "hx search: usage: hx search [text] [key:value ...] [options]")
 		_, _ = fmt.Fprintln(w, "  Search command history for Ctrl-R / fzf integration.")
 		_, _ = fmt.Fprintln(w, "  --filter global|host|dir|session   scope results (default: config or global)")
 		_, _ = fmt.Fprintln(w, "  --mode fuzzy|prefix|fts|semantic    match mode (default: fuzzy)")
+		_, _ = fmt.Fprintln(w, "  --rank recent|frecency              order (default: search.rank or recent); frecency favours")
+		_, _ = fmt.Fprintln(w, "                                      commands run often, recently, here and in this repo, that succeed")
 		_, _ = fmt.Fprintln(w, "  -i, --interactive                   full-screen TUI (prints selected cmd to stdout)")
-		_, _ = fmt.Fprintln(w, "       In TUI: Enter/Tab accept (run vs edit per search.enter_accept), Ctrl-O inspect")
+		_, _ = fmt.Fprintln(w, "       In TUI: Enter/Tab accept (run vs edit per search.enter_accept), Ctrl-T rank, Ctrl-O inspect")
 		_, _ = fmt.Fprintln(w, "  --format table|tsv|null|json        output (default: table; null for fzf)")
 		_, _ = fmt.Fprintln(w, "  --limit N                           max rows (default: 50)")
 		_, _ = fmt.Fprintln(w, "  --no-dedup                          show duplicate commands")
+		_, _ = fmt.Fprintln(w, "  -B/-A/-C, --before/--after/--context N")
+		_, _ = fmt.Fprintln(w, "                                      N events before/after/around each hit from its session")
+		_, _ = fmt.Fprintln(w, "                                      (table or json; hits marked >, groups separated by --)")
 		_, _ = fmt.Fprintln(w, "  --no-import                         exclude imported history")
-		_, _ = fmt.Fprintln(w, "  Env: HX_SESSION_ID, HX_SEARCH_HOST, HX_SEARCH_CWD, PWD")
+		_, _ = fmt.Fprintln(w, "  --repo <name|path>                  only commands run in this git repo (. = current)")
+		_, _ = fmt.Fprintln(w, "  --branch <name>                     only commands run on this git branch")
+		_, _ = fmt.Fprintln(w, "  Env: HX_EVENT_SESSION (set by the hooks), HX_SEARCH_HOST, HX_SEARCH_CWD, PWD")
+		printQueryKeysHelp(w)
 	},
 	"show": func(w io.Writer) {
 		_, _ = fmt.Fprintln(w, "hx show: usage: hx show [--raw] <event_id>")
 		_, _ = fmt.Fprintln(w, "  Print event metadata for fzf preview. --raw prints command text only.")
 	},
 	"find": func(w io.Writer) {
-		_, _ = fmt.Fprintln(w, "hx find: usage: hx find <text> [--compact|--wide|--debug] [--include-self] [--no-import] [--width <n>]")
+		_, _ = fmt.Fprintln(w, "hx find: usage: hx find <text> [key:value ...] [--compact|--wide|--debug] [--include-self] [--no-import] [--repo R] [--branch B] [--width <n>]")
 		_, _ = fmt.Fprintln(w, "  Full-text search over commands.")
 		_, _ = fmt.Fprintln(w, "  --compact       compact (default): id, when, exit, cwd, cmd")
 		_, _ = fmt.Fprintln(w, "  --wide          more fidelity: absolute time, wider cwd/cmd (no session_id)")
@@ -1428,21 +1934,47 @@ var helpRegistry = map[string]func(io.Writer){
 		_, _ = fmt.Fprintln(w, "  --include-self  show hx / ./bin/hx commands (default: excluded)")
 		_, _ = fmt.Fprintln(w, "  --no-self       deprecated alias for default (exclude self)")
 		_, _ = fmt.Fprintln(w, "  --no-import     exclude import-* sessions")
+		_, _ = fmt.Fprintln(w, "  --repo <r>      only commands in git repo r (base name or path; . = current)")
+		_, _ = fmt.Fprintln(w, "  --branch <b>    only commands run on git branch b")
 		_, _ = fmt.Fprintln(w, "  --force-wide    keep wide at COLUMNS<120 (else auto-fallback to compact)")
 		_, _ = fmt.Fprintln(w, "  --width <n>     set output width to n columns (overrides HX_WIDTH and COLUMNS)")
+		_, _ = fmt.Fprintln(w, "  -B/-A/-C <n>    --before/--after/--context: n events before/after/around each hit from its")
+		_, _ = fmt.Fprintln(w, "                  session; hits marked >, groups separated by --")
+		printQueryKeysHelp(w)
 	},
 	"last": func(w io.Writer) {
 		_, _ = fmt.Fprintln(w, "hx last [--raw-time]")
 		_, _ = fmt.Fprintln(w, "")
 		_, _ = fmt.Fprintln(w, "Show last session summary with failure context. --raw-time shows epoch seconds.")
 	},
+	"ps": func(w io.Writer) {
+		_, _ = fmt.Fprintln(w, "hx ps [--json]")
+		_, _ = fmt.Fprintln(w, "")
+		_, _ = fmt.Fprintln(w, "List commands still running in every captured shell on this host:")
+		_, _ = fmt.Fprintln(w, "session, tty, elapsed time, cwd, command. --json prints an array.")
+	},
 	"import": func(w io.Writer) {
-		_, _ = fmt.Fprintln(w, "hx import: usage: hx import --file <path> [--host label] [--shell zsh|bash|auto] [--force]")
+		_, _ = fmt.Fprintln(w, "hx import: usage: hx import --file <path> [--host label] [--shell zsh|bash|fish|atuin|histdb|mcfly|auto] [--keep-captured] [--force]")
+		_, _ = fmt.Fprintln(w, "       hx import --resume <batch_id>")
+		_, _ = fmt.Fprintln(w, "       hx import list|show|undo")
 		_, _ = fmt.Fprintln(w, "  Import shell history. Idempotent; duplicates skipped.")
+		_, _ = fmt.Fprintln(w, "  Streams the file with no size limit, committing every 2000 entries; progress is shown on a TTY.")
+		_, _ = fmt.Fprintln(w, "  Multi-line zsh (backslash continuations) and bash (lines between #<ts> markers) commands are kept whole.")
+		_, _ = fmt.Fprintln(w, "  --resume <id>   continue an interrupted import (Ctrl-C prints the batch id)")
+		_, _ = fmt.Fprintln(w, "  --keep-captured also import entries hx already captured live: by default a timestamped entry is")
+		_, _ = fmt.Fprintln(w, "                  skipped when a live or synced event on the same host ran the same command within 5s")
+		_, _ = fmt.Fprintln(w, "  Also reads atuin, zsh-histdb and McFly SQLite databases (opened read-only; auto-detected),")
+		_, _ = fmt.Fprintln(w, "  keeping cwd, exit code, duration and host.")
 		_, _ = fmt.Fprintln(w, "  Safeguard: blocks .zshrc/.bashrc/.profile (use ~/.zsh_history or ~/.bash_history). --force to override.")
+		_, _ = fmt.Fprintln(w, "")
+		_, _ = fmt.Fprintln(w, "  list [--json]   import batches, newest first")
+		_, _ = fmt.Fprintln(w, "  show <batch>    source, event count, time range, quality tiers, first commands")
+		_, _ = fmt.Fprintln(w, "  undo <batch>    delete the batch's events and dedup hashes so the file can be re-imported")
+		_, _ = fmt.Fprintln(w, "                  (local only; events already pushed with hx sync stay in the vault)")
+		_, _ = fmt.Fprintln(w, "  <batch> is a batch id or any unique prefix of one.")
 	},
 	"query": func(w io.Writer) {
-		_, _ = fmt.Fprintln(w, "hx query: usage: hx query \"<question>\" [options]   OR   hx query --file <path>")
+		_, _ = fmt.Fprintln(w, "hx query: usage: hx query \"<question> [key:value ...]\" [options]   OR   hx query --file <path>")
 		_, _ = fmt.Fprintln(w, "  Natural-language search. Extracts keywords (strips stopwords), searches FTS by OR across tokens.")
 		_, _ = fmt.Fprintln(w, "  --no-llm        skip Ollama summary")
 		_, _ = fmt.Fprintln(w, "  --no-fallback   when no FTS match, return empty (default: show recent events with notice)")
@@ -1454,27 +1986,50 @@ var helpRegistry = map[string]func(io.Writer){
 		_, _ = fmt.Fprintln(w, "  --include-self  show hx / ./bin/hx commands (default: excluded)")
 		_, _ = fmt.Fprintln(w, "  --no-self       deprecated alias for default (exclude self)")
 		_, _ = fmt.Fprintln(w, "  --no-import     exclude import-* sessions")
+		_, _ = fmt.Fprintln(w, "  --repo <r>      only commands in git repo r (base name or path; . = current)")
+		_, _ = fmt.Fprintln(w, "  --branch <b>    only commands run on git branch b")
 		_, _ = fmt.Fprintln(w, "  --width <n>     set output width to n columns (overrides HX_WIDTH and COLUMNS)")
+		_, _ = fmt.Fprintln(w, "  -B/-A/-C <n>    --before/--after/--context: n events before/after/around each hit from its session")
+		printQueryKeysHelp(w)
 	},
 	"sync": func(w io.Writer) {
 		_, _ = fmt.Fprintln(w, "hx sync: usage: hx sync <init|status|push|pull> [options]")
 		_, _ = fmt.Fprintln(w, "")
-		_, _ = fmt.Fprintln(w, "  init --store folder:/path/to/HXSync [--vault-name NAME]")
-		_, _ = fmt.Fprintln(w, "  status   show vault, pending events, imported segments")
+		_, _ = fmt.Fprintln(w, "  init --store folder:/path/to/HXSync [--vault-name NAME] [--no-encrypt]")
+		_, _ = fmt.Fprintln(w, "  init --store 's3://bucket/prefix?region=R&endpoint=URL&path_style=true&profile=P'")
+		_, _ = fmt.Fprintln(w, "           encrypted by default; passphrase from prompt or HX_SYNC_PASSPHRASE")
+		_, _ = fmt.Fprintln(w, "           S3 credentials: AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY or ~/.aws/credentials")
+		_, _ = fmt.Fprintln(w, "  status   show vault, encryption, pending events, imported segments")
 		_, _ = fmt.Fprintln(w, "  push     publish local events to store")
-		_, _ = fmt.Fprintln(w, "  pull     import from store into local DB")
+		_, _ = fmt.Fprintln(w, "  pull [--full-scan]")
+		_, _ = fmt.Fprintln(w, "           import from store into local DB; reads node manifests and scans")
+		_, _ = fmt.Fprintln(w, "           only nodes without one. --full-scan re-reads every object (recovery)")
 	},
 	"attach": func(w io.Writer) {
 		_, _ = fmt.Fprintln(w, "hx attach: usage: hx attach --file <path> [--to last|session_id]")
 		_, _ = fmt.Fprintln(w, "  Link artifact to session.")
 	},
+	"run": func(w io.Writer) {
+		_, _ = fmt.Fprintln(w, "hx run: usage: hx run [--keep-kb N] [--always] -- <command> [args...]")
+		_, _ = fmt.Fprintln(w, "  Run a command with its output shown as usual and the last N KB kept (default:")
+		_, _ = fmt.Fprintln(w, "  run_output_kb or 256). On a non-zero exit the output is saved as an artifact")
+		_, _ = fmt.Fprintln(w, "  linked to the command's event (hx show <id>). Exits with the command's status.")
+		_, _ = fmt.Fprintln(w, "  --keep-kb N  keep the last N KB of output")
+		_, _ = fmt.Fprintln(w, "  --always     save the output on success too")
+		_, _ = fmt.Fprintln(w, "  Output goes through pipes, not a terminal: programs that colour only on a")
+		_, _ = fmt.Fprintln(w, "  terminal print plain text. Secrets are masked as in capture (redact.capture).")
+	},
 	"export": func(w io.Writer) {
 		_, _ = fmt.Fprintln(w, "hx export: usage: hx export [--session <SID>|--last] [--redacted]")
 		_, _ = fmt.Fprintln(w, "  Export session as markdown.")
+		_, _ = fmt.Fprintln(w, "  --redacted  mask secrets as <REDACTED:kind> and normalize timestamps, addresses, PIDs")
 	},
 	"forget": func(w io.Writer) {
 		_, _ = fmt.Fprintln(w, "hx forget: usage: hx forget --since 15m|1h|24h|7d")
 		_, _ = fmt.Fprintln(w, "  Delete events in time window.")
+		_, _ = fmt.Fprintln(w, "  Pinned sessions are kept.")
+		_, _ = fmt.Fprintln(w, "  With a sync vault, also publishes a tombstone so other devices delete this")
+		_, _ = fmt.Fprintln(w, "  device's commands in the window. If that fails, hx sync push retries it.")
 	},
 	"pin": func(w io.Writer) {
 		_, _ = fmt.Fprintln(w, "hx pin: usage: hx pin --session <SID>   OR   hx pin --last")
@@ -1498,6 +2053,11 @@ var helpRegistry = map[string]func(io.Writer){
 		_, _ = fmt.Fprintln(w, "")
 		_, _ = fmt.Fprintln(w, "  Run diagnostics: daemon PID validity, spool file (line count, mtime),")
 		_, _ = fmt.Fprintln(w, "  DB event count and most recent timestamp.")
+		_, _ = fmt.Fprintln(w, "")
+		_, _ = fmt.Fprintln(w, "hx debug --cmd <command> [--cwd <dir>] [--host <name>]")
+		_, _ = fmt.Fprintln(w, "  Show whether the command would be recorded: the filter rule that drops it")
+		_, _ = fmt.Fprintln(w, "  (config or the repo's .hxignore), or the text stored after secret scrubbing.")
+		_, _ = fmt.Fprintln(w, "  --cwd defaults to the current directory, --host to this machine.")
 	},
 }
 
@@ -1519,10 +2079,12 @@ func runCommand(cmd string, args []string) {
 		cmdResume()
 	case "last":
 		cmdLast(args)
+	case "ps":
+		cmdPs(args)
 	case "dump":
 		cmdDump(args)
 	case "debug":
-		cmdDebug()
+		cmdDebug(args)
 	case "find":
 		cmdFind(args)
 	case "search":
@@ -1531,6 +2093,8 @@ func runCommand(cmd string, args []string) {
 		cmdShow(args)
 	case "attach":
 		cmdAttach(args)
+	case "run":
+		cmdRun(args)
 	case "query":
 		cmdQuery(args)
 	case "import":
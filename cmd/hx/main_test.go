@@ -26,6 +26,7 @@ func TestIsSelfCmd(t *testing.T) {
 		{"./bin/hx", true},
 		{"./bin/hx find make", true},
 		{"COLUMNS=80 hx find make", true},
+		{"hx run -- make test", false},
 		{"COLUMNS=80 hx query make", true},
 		{"foo | hx query make", true},
 		{"make", false},
@@ -59,6 +60,50 @@ func TestParseQueryArgs(t *testing.T) {
 	}
 }
 
+func TestCollectShowSeqsPipelineAndSignal(t *testing.T) {
+	zero, sigint := 0, 130
+	events := []lastEvent{
+		{seq: 1, exit: &zero},
+		{seq: 2, exit: &zero},
+		{seq: 3, exit: &zero, pipe: []int{2, 0}, cmd: "make | tee log"},
+		{seq: 4, exit: &zero},
+		{seq: 5, exit: &zero},
+		{seq: 6, exit: &zero, pipe: []int{141, 0}, cmd: "yes | head"},
+		{seq: 7, exit: &zero},
+		{seq: 8, exit: &sigint, signal: "SIGINT"},
+	}
+	got := collectShowSeqs(events)
+	for _, seq := range []int{2, 3, 4, 7, 8} {
+		if !got[seq] {
+			t.Errorf("seq %d should be shown (around a failure)", seq)
+		}
+	}
+	for _, seq := range []int{1, 5, 6} {
+		if got[seq] {
+			t.Errorf("seq %d should not be shown", seq)
+		}
+	}
+}
+
+func TestEndedWhileRunning(t *testing.T) {
+	zero := 0
+	events := []lastEvent{
+		{seq: 1, exit: &zero, cmd: "cd infra"},
+		{seq: 2, state: store.StateUnknown, cmd: "vim main.tf"},
+		{seq: 3, state: store.StateInterrupted, cmd: "terraform apply"},
+	}
+	e := endedWhileRunning(events)
+	if e == nil || e.cmd != "terraform apply" {
+		t.Fatalf("endedWhileRunning = %+v, want terraform apply", e)
+	}
+	if !events[2].failed() || events[1].failed() {
+		t.Error("interrupted should count as failed; unknown should not")
+	}
+	if endedWhileRunning(events[:2]) != nil {
+		t.Error("no interrupted event: want nil")
+	}
+}
+
 func TestParseFindArgs(t *testing.T) {
 	query, opts := parseFindArgs([]string{"make"})
 	if query != "make" || !opts.compact || opts.wide || opts.noSelf || opts.noImport {
@@ -368,6 +413,14 @@ func TestFindIntegration(t *testing.T) {
 	if _, err := st.InsertEvent(pre, post, cmdID); err != nil {
 		t.Fatalf("InsertEvent: %v", err)
 	}
+	other := &store.PreEvent{Sid: "test-sess-2", Seq: 1, Ts: 1700000100, Cmd: "make clean", Cwd: "/home/user/proj", Tty: "pts/1", Host: "host1"}
+	otherID, _ := st.CmdID(other.Cmd, other.Ts)
+	if err := st.EnsureSession(other.Sid, other.Host, other.Tty, other.Cwd, other.Ts); err != nil {
+		t.Fatalf("EnsureSession: %v", err)
+	}
+	if _, err := st.InsertEvent(other, &store.PostEvent{Sid: "test-sess-2", Seq: 1, Ts: 1700000101, Pipe: []int{}}, otherID); err != nil {
+		t.Fatalf("InsertEvent: %v", err)
+	}
 	conn.Close()
 
 	// Build and run hx find make (requires sqlite_fts5 for FTS)
@@ -394,4 +447,60 @@ func TestFindIntegration(t *testing.T) {
 	if strings.Contains(outStr, "session_id") {
 		t.Errorf("compact default should not show session_id: %s", outStr)
 	}
+
+	// session:current comes from the variable the hooks export, not HX_SESSION_ID
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, "HX_SESSION_ID=") && !strings.HasPrefix(kv, "HX_EVENT_") {
+			env = append(env, kv)
+		}
+	}
+	env = append(env, "HX_DB_PATH="+dbPath)
+	cmd = exec.Command(exe, "find", "session:current", "make")
+	cmd.Env = append(env, "HX_EVENT_SESSION=test-sess-2")
+	out, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("hx find session:current: %v\n%s", err, out)
+	}
+	if !strings.Contains(string(out), "make clean") || strings.Contains(string(out), "make build") {
+		t.Errorf("session:current should list only test-sess-2: %s", out)
+	}
+	cmd = exec.Command(exe, "find", "session:current", "make")
+	cmd.Env = env
+	if out, err = cmd.CombinedOutput(); err == nil || !strings.Contains(string(out), "not in a captured shell") {
+		t.Errorf("session:current outside a captured shell = %v: %s", err, out)
+	}
+}
+
+func TestPrintFindContextGroups(t *testing.T) {
+	rows := []cmdutil.Std1Row{
+		{EventID: 1, SessionID: "s1", Seq: 1, StartedAt: 1700000000, Cwd: "/x", Cmd: "git fetch", Group: 1, Context: true},
+		{EventID: 2, SessionID: "s1", Seq: 2, StartedAt: 1700000000, Cwd: "/x", Cmd: "git rebase main", Group: 1},
+		{EventID: 9, SessionID: "s2", Seq: 4, StartedAt: 1700000000, Cwd: "/x", Cmd: "git rebase dev", Group: 2},
+	}
+	var buf bytes.Buffer
+	cmdutil.RenderStandard1(rows, "compact", 80, false, &buf)
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("want header, separator, 3 rows and a group separator; got:\n%s", buf.String())
+	}
+	if !strings.HasPrefix(lines[0], "  id") {
+		t.Errorf("header not indented for marks: %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[2], "  1 ") || !strings.HasPrefix(lines[3], "> 2 ") {
+		t.Errorf("context/hit marks wrong:\n%s", buf.String())
+	}
+	if lines[4] != "--" || !strings.HasPrefix(lines[5], "> 9 ") {
+		t.Errorf("groups not separated:\n%s", buf.String())
+	}
+	for i, line := range lines {
+		if len([]rune(line)) > 80 {
+			t.Errorf("line %d longer than 80 columns: %q", i+1, line)
+		}
+	}
+
+	_, opts := parseFindArgs([]string{"-C", "2", "rebase", "--after", "5"})
+	if opts.before != 2 || opts.after != 5 {
+		t.Errorf("parseFindArgs context = -B%d -A%d, want -B2 -A5", opts.before, opts.after)
+	}
 }
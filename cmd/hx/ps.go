@@ -0,0 +1,133 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mrcawood/History_eXtended/internal/cmdutil"
+	"github.com/mrcawood/History_eXtended/internal/db"
+	"github.com/mrcawood/History_eXtended/internal/ingest"
+	"github.com/mrcawood/History_eXtended/internal/store"
+)
+
+// psRow is one running command for hx ps.
+type psRow struct {
+	SessionID string  `json:"session_id"`
+	Seq       int     `json:"seq"`
+	Tty       string  `json:"tty"`
+	Cwd       string  `json:"cwd"`
+	Cmd       string  `json:"cmd"`
+	StartedAt float64 `json:"started_at"`
+	ElapsedS  int64   `json:"elapsed_s"`
+}
+
+func cmdPs(args []string) {
+	asJSON := false
+	for _, a := range args {
+		switch a {
+		case "--json":
+			asJSON = true
+		default:
+			fmt.Fprintf(os.Stderr, "hx ps: unknown option %q\n", a)
+			os.Exit(1)
+		}
+	}
+	conn, err := db.Open(dbPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx ps: %v\n", err)
+		os.Exit(1)
+	}
+	defer func() { _ = conn.Close() }()
+	host, _ := os.Hostname()
+	rows, err := fetchRunning(conn, host, time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx ps: %v\n", err)
+		os.Exit(1)
+	}
+	if asJSON {
+		if rows == nil {
+			rows = []psRow{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(rows); err != nil {
+			fmt.Fprintf(os.Stderr, "hx ps: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(rows) == 0 {
+		fmt.Println("No running commands.")
+		if !daemonRunning() {
+			fmt.Fprintln(os.Stderr, "hx ps: hxd is not running; commands are only listed once ingested")
+		}
+		return
+	}
+	printPs(os.Stdout, rows, cmdutil.RenderWidth(os.Stdout, 0))
+}
+
+// fetchRunning returns running commands on host, oldest first. Sessions whose
+// shell has exited since hxd last checked are skipped.
+func fetchRunning(conn *sql.DB, host string, now time.Time) ([]psRow, error) {
+	rows, err := conn.Query(`
+		SELECT e.session_id, e.seq, COALESCE(s.tty, ''), COALESCE(e.cwd, ''), COALESCE(c.cmd_text, ''), e.started_at
+		FROM events e
+		JOIN sessions s ON s.session_id = e.session_id
+		LEFT JOIN command_dict c ON e.cmd_id = c.cmd_id
+		WHERE e.state = ? AND s.host = ?
+		ORDER BY e.started_at
+	`, store.StateRunning, host)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var out []psRow
+	for rows.Next() {
+		var r psRow
+		if err := rows.Scan(&r.SessionID, &r.Seq, &r.Tty, &r.Cwd, &r.Cmd, &r.StartedAt); err != nil {
+			return nil, err
+		}
+		if !ingest.ShellAlive(r.SessionID, host, host) {
+			continue
+		}
+		r.ElapsedS = int64(now.Sub(time.Unix(0, int64(r.StartedAt*1e9))).Seconds())
+		if r.ElapsedS < 0 {
+			r.ElapsedS = 0
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func printPs(w io.Writer, rows []psRow, termWidth int) {
+	const sessW, ttyW, elapsedW, cwdW = 24, 8, 9, 24
+	cmdW := termWidth - sessW - ttyW - elapsedW - cwdW - 8
+	if cmdW < 20 {
+		cmdW = 20
+	}
+	_, _ = fmt.Fprintf(w, "%-*s  %-*s  %*s  %-*s  %s\n", sessW, "SESSION", ttyW, "TTY", elapsedW, "ELAPSED", cwdW, "CWD", "COMMAND")
+	for _, r := range rows {
+		_, _ = fmt.Fprintf(w, "%-*s  %-*s  %*s  %-*s  %s\n",
+			sessW, cmdutil.TruncateRight(r.SessionID, sessW),
+			ttyW, cmdutil.TruncateRight(r.Tty, ttyW),
+			elapsedW, formatElapsed(r.ElapsedS),
+			cwdW, cmdutil.ShortenPath(r.Cwd, cwdW),
+			cmdutil.TruncateRight(r.Cmd, cmdW))
+	}
+}
+
+// formatElapsed renders seconds as 45s, 12m03s, or 2h05m.
+func formatElapsed(s int64) string {
+	switch {
+	case s < 60:
+		return fmt.Sprintf("%ds", s)
+	case s < 3600:
+		return fmt.Sprintf("%dm%02ds", s/60, s%60)
+	default:
+		return fmt.Sprintf("%dh%02dm", s/3600, (s%3600)/60)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrcawood/History_eXtended/internal/db"
+	"github.com/mrcawood/History_eXtended/internal/store"
+)
+
+func TestFetchRunning(t *testing.T) {
+	conn, err := db.Open(filepath.Join(t.TempDir(), "hx.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	st := store.New(conn)
+
+	dead := exec.Command("true")
+	if err := dead.Run(); err != nil {
+		t.Skip("cannot spawn process:", err)
+	}
+	now := time.Now()
+	start := float64(now.Add(-90 * time.Second).Unix())
+	liveSid := fmt.Sprintf("hx-%d-1-1", os.Getpid())
+	add := func(sid, host, cmd string, seq int, state string) {
+		t.Helper()
+		pre := &store.PreEvent{Ts: start, Sid: sid, Seq: seq, Cmd: cmd, Cwd: "/srv/app", Tty: "pts/3", Host: host}
+		if err := st.EnsureSession(sid, host, pre.Tty, pre.Cwd, pre.Ts); err != nil {
+			t.Fatal(err)
+		}
+		cmdID, err := st.CmdID(cmd, pre.Ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := st.InsertPendingEvent(pre, cmdID, state); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add(liveSid, "here", "make deploy", 1, store.StateRunning)
+	add(fmt.Sprintf("hx-%d-1-1", dead.Process.Pid), "here", "make build", 1, store.StateRunning)
+	add("hx-1-2-3", "elsewhere", "ssh box", 1, store.StateRunning)
+	add(liveSid, "here", "vim", 2, store.StateUnknown)
+
+	rows, err := fetchRunning(conn, "here", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("got %d rows, want 1: %+v", len(rows), rows)
+	}
+	r := rows[0]
+	if r.Cmd != "make deploy" || r.Tty != "pts/3" || r.Cwd != "/srv/app" || r.ElapsedS != 90 {
+		t.Errorf("row = %+v", r)
+	}
+
+	var buf bytes.Buffer
+	printPs(&buf, rows, 120)
+	if !strings.Contains(buf.String(), "1m30s") || !strings.Contains(buf.String(), "make deploy") {
+		t.Errorf("printPs output:\n%s", buf.String())
+	}
+}
+
+func TestFormatElapsed(t *testing.T) {
+	tests := map[int64]string{0: "0s", 59: "59s", 723: "12m03s", 7500: "2h05m"}
+	for in, want := range tests {
+		if got := formatElapsed(in); got != want {
+			t.Errorf("formatElapsed(%d) = %q, want %q", in, got, want)
+		}
+	}
+}
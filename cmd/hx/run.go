@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mrcawood/History_eXtended/internal/artifact"
+	"github.com/mrcawood/History_eXtended/internal/config"
+	"github.com/mrcawood/History_eXtended/internal/db"
+	"github.com/mrcawood/History_eXtended/internal/filter"
+	"github.com/mrcawood/History_eXtended/internal/redact"
+)
+
+// The hooks export the session and seq of the command line being run, so
+// hx run can link its output to the event the hook records for it, and the
+// shell's pid: every process the command starts inherits the variables, but
+// only the shell's own child is the command line the event records.
+const (
+	runSessionVar = "HX_EVENT_SESSION"
+	runSeqVar     = "HX_EVENT_SEQ"
+	runPIDVar     = "HX_EVENT_PID"
+)
+
+type runOpts struct {
+	keepKB int
+	always bool // save output on success too
+	argv   []string
+}
+
+func parseRunArgs(args []string, keepKB int) (runOpts, error) {
+	opts := runOpts{keepKB: keepKB}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--":
+			opts.argv = args[i+1:]
+			return opts, nil
+		case "--keep-kb":
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("--keep-kb requires value")
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n <= 0 {
+				return opts, fmt.Errorf("invalid --keep-kb %q", args[i+1])
+			}
+			opts.keepKB = n
+			i++
+		case "--always":
+			opts.always = true
+		default:
+			if strings.HasPrefix(args[i], "-") {
+				return opts, fmt.Errorf("unknown flag %s (put the command after --)", args[i])
+			}
+			opts.argv = args[i:]
+			return opts, nil
+		}
+	}
+	return opts, nil
+}
+
+func cmdRun(args []string) {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		printSubcommandHelp(os.Stdout, "run")
+		return
+	}
+	cfg := getConfig()
+	keepKB := 256
+	if cfg != nil {
+		keepKB = cfg.RunOutputKB
+	}
+	opts, err := parseRunArgs(args, keepKB)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx run: %v\n", err)
+		os.Exit(1)
+	}
+	if len(opts.argv) == 0 {
+		fmt.Fprintf(os.Stderr, "hx run: usage: hx run [--keep-kb N] [--always] -- <command> [args...]\n")
+		os.Exit(1)
+	}
+
+	tail := &tailBuffer{max: opts.keepKB * 1024}
+	code, err := runTeed(opts.argv, tail)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx run: %v\n", err)
+		os.Exit(code)
+	}
+	if code != 0 || opts.always {
+		// The hook records the line as typed, hx run and its flags included
+		line := "hx run " + strings.Join(args, " ")
+		if aid, err := saveRunOutput(cfg, line, tail.Bytes()); err != nil {
+			fmt.Fprintf(os.Stderr, "hx run: output not saved: %v\n", err)
+		} else if aid > 0 {
+			fmt.Fprintf(os.Stderr, "hx run: saved output as artifact %d (exit %d)\n", aid, code)
+		}
+	}
+	os.Exit(code)
+}
+
+// runTeed runs argv with stdout and stderr copied to the terminal and to
+// tail, and returns its exit status the way a shell reports it (128+n when
+// killed by signal n, 127 when not found, 126 when it cannot be run).
+// Ctrl-C and Ctrl-\ reach the command from the terminal; hx run outlives
+// them to save the output. SIGTERM and SIGHUP are passed on.
+func runTeed(argv []string, tail io.Writer) (int, error) {
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Env = runChildEnv(os.Environ())
+	cmd.Stdout = io.MultiWriter(os.Stdout, tail)
+	cmd.Stderr = io.MultiWriter(os.Stderr, tail)
+	// A background child holding the pipes open must not keep hx run waiting
+	cmd.WaitDelay = time.Second
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+
+	if err := cmd.Start(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return 127, fmt.Errorf("%s: command not found", argv[0])
+		}
+		return 126, err
+	}
+	go func() {
+		for s := range sigs {
+			if s == syscall.SIGTERM || s == syscall.SIGHUP {
+				_ = cmd.Process.Signal(s)
+			}
+		}
+	}()
+	err := cmd.Wait()
+	if cmd.ProcessState == nil {
+		return 1, err
+	}
+	return exitStatus(cmd.ProcessState), nil
+}
+
+// runChildEnv is env without the hook's event variables: a nested hx run
+// belongs to no event of its own.
+func runChildEnv(env []string) []string {
+	out := make([]string, 0, len(env))
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		if name == runSessionVar || name == runSeqVar || name == runPIDVar {
+			continue
+		}
+		out = append(out, kv)
+	}
+	return out
+}
+
+func exitStatus(ps *os.ProcessState) int {
+	if ws, ok := ps.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return ps.ExitCode()
+}
+
+// saveRunOutput stores output as an artifact linked to the command's event.
+// line is the hx run invocation, filtered like the event's command. It saves
+// nothing (artifact 0) when capture is paused or the filter rules keep the
+// command out of history.
+func saveRunOutput(cfg *config.Config, line string, output []byte) (int64, error) {
+	sid := os.Getenv(runSessionVar)
+	seq, err := strconv.Atoi(os.Getenv(runSeqVar))
+	if sid == "" || err != nil {
+		return 0, fmt.Errorf("not run from a shell with hx hooks (%s unset)", runSeqVar)
+	}
+	if pid, err := strconv.Atoi(os.Getenv(runPIDVar)); err != nil || pid != os.Getppid() {
+		return 0, fmt.Errorf("not run by the shell itself (from a script or another program)")
+	}
+	if _, err := os.Stat(pausedFile()); err == nil {
+		return 0, nil
+	}
+	conn, err := db.Open(dbPath())
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = conn.Close() }()
+	// Once hxd has the event, filter its own text: the full line as typed
+	if cmd, err := eventCmd(conn, sid, seq); err == nil {
+		line = cmd
+	}
+	flt, err := filter.New(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx run: %v\n", err)
+	}
+	scrub, _ := redact.Capture(cfg)
+	cwd, _ := os.Getwd()
+	host, _ := os.Hostname()
+	if _, ok := flt.Admit(line, cwd, host, scrub); !ok {
+		return 0, nil
+	}
+
+	stored := output
+	if scrub != nil {
+		stored = []byte(scrub.Redact(string(output)))
+	}
+	return artifact.New(conn).AttachOutput(stored, string(output), sid, seq)
+}
+
+// eventCmd returns the stored command text of event (sid, seq).
+func eventCmd(conn *sql.DB, sid string, seq int) (string, error) {
+	var cmd string
+	err := conn.QueryRow(`
+		SELECT c.cmd_text FROM events e JOIN command_dict c ON c.cmd_id = e.cmd_id
+		WHERE e.session_id = ? AND e.seq = ?
+	`, sid, seq).Scan(&cmd)
+	return cmd, err
+}
+
+// tailBuffer keeps the last max bytes written to it. stdout and stderr are
+// copied in separate goroutines, so writes are serialized.
+type tailBuffer struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+	cut bool // earlier output was dropped
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	// Trim at twice the limit so a chatty command does not copy on every write
+	if len(t.buf) > 2*t.max {
+		t.buf = append(t.buf[:0], t.buf[len(t.buf)-t.max:]...)
+		t.cut = true
+	}
+	return len(p), nil
+}
+
+// Bytes returns the kept output. When earlier output was dropped it starts
+// at the first complete line.
+func (t *tailBuffer) Bytes() []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, cut := t.buf, t.cut
+	if len(b) > t.max {
+		b, cut = b[len(b)-t.max:], true
+	}
+	if cut {
+		if i := bytes.IndexByte(b, '\n'); i >= 0 && i+1 < len(b) {
+			b = b[i+1:]
+		}
+	}
+	return append([]byte(nil), b...)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseRunArgs(t *testing.T) {
+	o, err := parseRunArgs([]string{"--keep-kb", "8", "--", "make", "--help"}, 256)
+	if err != nil || o.keepKB != 8 || o.always || strings.Join(o.argv, " ") != "make --help" {
+		t.Fatalf("parseRunArgs = %+v, %v", o, err)
+	}
+	o, err = parseRunArgs([]string{"--always", "go", "test", "-v"}, 256)
+	if err != nil || o.keepKB != 256 || !o.always || strings.Join(o.argv, " ") != "go test -v" {
+		t.Fatalf("parseRunArgs without -- = %+v, %v", o, err)
+	}
+	for _, bad := range [][]string{{"--keep-kb"}, {"--keep-kb", "0"}, {"-v", "make"}} {
+		if _, err := parseRunArgs(bad, 256); err == nil {
+			t.Errorf("parseRunArgs(%q): want error", bad)
+		}
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	tb := &tailBuffer{max: 10}
+	_, _ = tb.Write([]byte("abc\n"))
+	if got := string(tb.Bytes()); got != "abc\n" {
+		t.Fatalf("short output = %q", got)
+	}
+	for i := 0; i < 5; i++ {
+		_, _ = tb.Write([]byte("line\n"))
+	}
+	_, _ = tb.Write([]byte("end\n"))
+	// Earlier output was dropped: start at the first complete line
+	if got := string(tb.Bytes()); got != "line\nend\n" {
+		t.Fatalf("tail = %q", got)
+	}
+	if len(tb.buf) > 2*tb.max {
+		t.Errorf("buffer grew to %d bytes", len(tb.buf))
+	}
+}
+
+func TestRunTeedExitStatus(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	tests := []struct {
+		script string
+		want   int
+	}{
+		{"echo ok", 0},
+		{"echo boom >&2; exit 3", 3},
+		{"kill -TERM $$", 143},
+	}
+	for _, tt := range tests {
+		code, err := runTeed([]string{"sh", "-c", tt.script}, &tailBuffer{max: 1024})
+		if err != nil || code != tt.want {
+			t.Errorf("runTeed(%q) = %d, %v; want %d", tt.script, code, err, tt.want)
+		}
+	}
+	tail := &tailBuffer{max: 1024}
+	if _, err := runTeed([]string{"sh", "-c", "echo out; echo err >&2"}, tail); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(tail.Bytes()); !strings.Contains(got, "out\n") || !strings.Contains(got, "err\n") {
+		t.Errorf("captured %q, want stdout and stderr", got)
+	}
+	if code, err := runTeed([]string{"hx-no-such-command"}, tail); code != 127 || err == nil {
+		t.Errorf("missing command = %d, %v; want 127", code, err)
+	}
+}
+
+func TestRunEventVarsStayWithTheShell(t *testing.T) {
+	env := runChildEnv([]string{"PATH=/bin", runSessionVar + "=hx-1-2-3", runSeqVar + "=4", runPIDVar + "=1", "HX_EVENT_SEQUEL=x"})
+	if strings.Join(env, " ") != "PATH=/bin HX_EVENT_SEQUEL=x" {
+		t.Errorf("runChildEnv = %q, want the event variables removed", env)
+	}
+
+	// A program the command started inherits the variables but is not the event
+	t.Setenv(runSessionVar, "hx-1-2-3")
+	t.Setenv(runSeqVar, "4")
+	t.Setenv(runPIDVar, strconv.Itoa(os.Getppid()+1))
+	if _, err := saveRunOutput(nil, "hx run -- make", []byte("boom\n")); err == nil || !strings.Contains(err.Error(), "not run by the shell") {
+		t.Errorf("saveRunOutput from a grandchild = %v, want refused", err)
+	}
+}
@@ -2,9 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 
 	"github.com/mrcawood/History_eXtended/internal/db"
@@ -20,12 +23,17 @@ const searchExitRun = 10
 type searchOpts struct {
 	filter      string
 	mode        string
+	rank        string
 	format      string
 	limit       int
 	dedup       bool
 	noDedup     bool
 	noImport    bool
 	interactive bool
+	repo        string
+	branch      string
+	before      int // --before/--after/--context: neighbouring events per hit
+	after       int
 	query       string
 }
 
@@ -54,24 +62,41 @@ func cmdSearch(args []string) {
 		fmt.Fprintf(os.Stderr, "hx search: %v\n", err)
 		os.Exit(1)
 	}
+	rank, err := search.ParseRank(opts.rank)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hx search: %v\n", err)
+		os.Exit(1)
+	}
 
+	q := mustParseQuery("hx search", opts.query)
 	req := search.Request{
-		Query:     opts.query,
+		Query:     q.Text,
 		Filter:    filter,
 		Mode:      mode,
+		Rank:      rank,
 		Host:      searchEnvHost(),
 		Cwd:       searchEnvCwd(),
-		SessionID: os.Getenv("HX_SESSION_ID"),
+		SessionID: searchEnvSession(),
+		Repo:      opts.repo,
+		Branch:    opts.branch,
 		Dedup:     opts.dedup,
 		Limit:     opts.limit,
 		NoImport:  opts.noImport,
+		Where:     q.Where,
 	}
 
+	withContext := opts.before > 0 || opts.after > 0
 	if opts.interactive {
+		if withContext {
+			fmt.Fprintf(os.Stderr, "hx search: --before/--after/--context need non-interactive output\n")
+			os.Exit(1)
+		}
 		if !term.IsTerminal(int(os.Stdin.Fd())) {
 			fmt.Fprintf(os.Stderr, "hx search: %v\n", tui.ErrNotTTY)
 			os.Exit(1)
 		}
+		// The TUI parses its input box itself; start it with the filters too
+		req.Query = opts.query
 		res, err := tui.Run(tui.Options{Conn: conn, Cfg: cfg, Req: req})
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "hx search: %v\n", err)
@@ -95,12 +120,23 @@ func cmdSearch(args []string) {
 		fmt.Fprintf(os.Stderr, "hx search: %v\n", err)
 		os.Exit(1)
 	}
+	if withContext && format != search.FormatTable && format != search.FormatJSON {
+		fmt.Fprintf(os.Stderr, "hx search: --before/--after/--context need --format table or json\n")
+		os.Exit(1)
+	}
 
 	rows, err := search.Search(context.Background(), conn, cfg, req)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "hx search: %v\n", err)
 		os.Exit(1)
 	}
+	if withContext {
+		rows, err = search.WithContext(conn, rows, opts.before, opts.after)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "hx search: %v\n", err)
+			os.Exit(1)
+		}
+	}
 	if err := search.WriteRows(os.Stdout, format, rows); err != nil {
 		fmt.Fprintf(os.Stderr, "hx search: %v\n", err)
 		os.Exit(1)
@@ -176,6 +212,7 @@ func parseSearchArgs(args []string) (searchOpts, error) {
 		if cfg.Search.DefaultMode != "" {
 			opts.mode = cfg.Search.DefaultMode
 		}
+		opts.rank = cfg.Search.Rank
 	}
 	var queryParts []string
 	for i := 0; i < len(args); i++ {
@@ -192,6 +229,12 @@ func parseSearchArgs(args []string) (searchOpts, error) {
 			}
 			opts.mode = args[i+1]
 			i++
+		case "--rank":
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("--rank requires value")
+			}
+			opts.rank = args[i+1]
+			i++
 		case "--format":
 			if i+1 >= len(args) {
 				return opts, fmt.Errorf("--format requires value")
@@ -206,6 +249,28 @@ func parseSearchArgs(args []string) (searchOpts, error) {
 				return opts, fmt.Errorf("invalid --limit")
 			}
 			i++
+		case "--repo":
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("--repo requires value")
+			}
+			opts.repo = repoFilterArg(args[i+1])
+			i++
+		case "--branch":
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("--branch requires value")
+			}
+			opts.branch = args[i+1]
+			i++
+		case "--before", "-B", "--after", "-A", "--context", "-C":
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("%s requires value", args[i])
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 0 {
+				return opts, fmt.Errorf("invalid %s", args[i])
+			}
+			setContextFlag(&opts.before, &opts.after, args[i], n)
+			i++
 		case "--no-dedup":
 			opts.noDedup = true
 		case "--no-import":
@@ -238,6 +303,42 @@ func parseSearchArgs(args []string) (searchOpts, error) {
 	return opts, nil
 }
 
+// mustParseQuery parses input with the query grammar (free text plus
+// key:value filters). On error it prints the query with a caret under the
+// bad term and exits.
+func mustParseQuery(prefix, input string) *search.Query {
+	q, err := search.ParseQuery(input, search.QueryContext{Cwd: searchEnvCwd(), SessionID: searchEnvSession()})
+	if err == nil {
+		return q
+	}
+	var qe *search.QueryError
+	if errors.As(err, &qe) {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", prefix, qe.Msg)
+		for _, line := range strings.Split(qe.Caret(), "\n") {
+			fmt.Fprintf(os.Stderr, "  %s\n", line)
+		}
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", prefix, err)
+	}
+	os.Exit(1)
+	return nil
+}
+
+// printQueryKeysHelp prints the key:value filters shared by find, search and query.
+func printQueryKeysHelp(w io.Writer) {
+	_, _ = fmt.Fprintln(w, "  Filters (key:value, mixed with text; quote values with spaces: host:\"my box\"):")
+	_, _ = fmt.Fprintln(w, "    exit:0 exit:!0      exit status is / is not")
+	_, _ = fmt.Fprintln(w, "    cwd:~/src/foo       run in this directory or below (. = current)")
+	_, _ = fmt.Fprintln(w, "    host:build01        captured on this host")
+	_, _ = fmt.Fprintln(w, "    after:2d before:2026-09-01   age (s, m, h, d, w) or local date")
+	_, _ = fmt.Fprintln(w, "    dur:>30s            duration (>, >=, <, <=; bare number = seconds)")
+	_, _ = fmt.Fprintln(w, "    origin:live         live, import or sync")
+	_, _ = fmt.Fprintln(w, "    repo:hx             git repo (base name or path)")
+	_, _ = fmt.Fprintln(w, "    session:current     this shell's session (or a session id)")
+	_, _ = fmt.Fprintln(w, "    env:AWS_PROFILE=prod  recorded env var is (=), is not (!=) or is set (no value)")
+	_, _ = fmt.Fprintln(w, "  Quote text that contains a colon: \"https://example.com\"")
+}
+
 func searchEnvHost() string {
 	if v := os.Getenv("HX_SEARCH_HOST"); v != "" {
 		return v
@@ -249,6 +350,16 @@ func searchEnvHost() string {
 	return strings.TrimSpace(string(out))
 }
 
+// searchEnvSession returns the session of the shell running hx. The hooks
+// export it per command as HX_EVENT_SESSION; HX_SESSION_ID itself is a
+// shell variable and only reaches hx if the user exported it.
+func searchEnvSession() string {
+	if v := os.Getenv(runSessionVar); v != "" {
+		return v
+	}
+	return os.Getenv("HX_SESSION_ID")
+}
+
 func searchEnvCwd() string {
 	if v := os.Getenv("HX_SEARCH_CWD"); v != "" {
 		return v
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mrcawood/History_eXtended/internal/sync"
+	"golang.org/x/term"
+)
+
+// syncVault is the configured sync vault and this device's node in it.
+type syncVault struct {
+	ID        string
+	StoreType string
+	StorePath string
+	NodeID    string
+	Encrypt   bool
+}
+
+// loadSyncVault returns the first configured vault. Errors if none.
+func loadSyncVault(conn *sql.DB) (*syncVault, error) {
+	var v syncVault
+	var encrypt int
+	err := conn.QueryRow(`
+		SELECT v.vault_id, v.store_type, v.store_path, v.encrypt, n.node_id
+		FROM sync_vaults v JOIN sync_nodes n ON n.vault_id = v.vault_id LIMIT 1
+	`).Scan(&v.ID, &v.StoreType, &v.StorePath, &encrypt, &v.NodeID)
+	if err != nil {
+		return nil, err
+	}
+	v.Encrypt = encrypt != 0
+	return &v, nil
+}
+
+// parseStoreArg splits an --store argument into store type and path.
+func parseStoreArg(arg string) (storeType, storePath string, err error) {
+	switch {
+	case strings.HasPrefix(arg, "folder:"):
+		storePath = strings.TrimSuffix(strings.TrimPrefix(arg, "folder:"), "/")
+		if storePath == "" {
+			return "", "", errors.New("folder store needs a path")
+		}
+		return "folder", storePath, nil
+	case strings.HasPrefix(arg, "s3://"):
+		if _, err := sync.ParseS3URI(arg); err != nil {
+			return "", "", err
+		}
+		return "s3", arg, nil
+	default:
+		return "", "", fmt.Errorf("unsupported store %q (want folder:/path or s3://bucket/prefix)", arg)
+	}
+}
+
+// openSyncStore returns the store backend for v, wrapped with retries.
+// S3 credentials come from the AWS environment or shared credentials file.
+func openSyncStore(v *syncVault) (sync.SyncStore, error) {
+	var st sync.SyncStore
+	switch v.StoreType {
+	case "folder":
+		st = sync.NewFolderStore(v.StorePath)
+	case "s3":
+		cfg, err := sync.ParseS3URI(v.StorePath)
+		if err != nil {
+			return nil, err
+		}
+		s3, err := sync.NewS3Store(context.Background(), cfg)
+		if err != nil {
+			return nil, err
+		}
+		st = s3
+	default:
+		return nil, fmt.Errorf("unsupported store type %q", v.StoreType)
+	}
+	return sync.NewRetryableStore(st, sync.DefaultRetryConfig()), nil
+}
+
+// vaultKeyPath is the local keyfile caching the unlocked vault key.
+func vaultKeyPath(vaultID string) string {
+	return filepath.Join(filepath.Dir(dbPath()), "keys", vaultID+".key")
+}
+
+// vaultKey returns K_master for an encrypted vault (nil when encryption is off).
+// Uses the cached keyfile; otherwise fetches vault metadata, prompts for the
+// passphrase, and caches the unlocked key.
+func vaultKey(v *syncVault, st sync.SyncStore) ([]byte, error) {
+	if !v.Encrypt {
+		return nil, nil
+	}
+	keyPath := vaultKeyPath(v.ID)
+	key, err := sync.LoadKeyFile(keyPath)
+	if err == nil {
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	meta, err := sync.FetchVaultMeta(st, v.ID)
+	if err != nil {
+		return nil, fmt.Errorf("vault metadata: %w", err)
+	}
+	pass, err := readPassphrase("Vault passphrase: ", false)
+	if err != nil {
+		return nil, err
+	}
+	key, err = meta.Unlock(pass)
+	if err != nil {
+		return nil, err
+	}
+	if err := sync.SaveKeyFile(keyPath, key); err != nil {
+		return nil, fmt.Errorf("cache vault key: %w", err)
+	}
+	return key, nil
+}
+
+// readPassphrase reads the vault passphrase from HX_SYNC_PASSPHRASE or the terminal.
+func readPassphrase(prompt string, confirm bool) (string, error) {
+	if v := os.Getenv("HX_SYNC_PASSPHRASE"); v != "" {
+		return v, nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", errors.New("passphrase required (set HX_SYNC_PASSPHRASE or run in a terminal)")
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	b, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	pass := string(b)
+	if pass == "" {
+		return "", errors.New("empty passphrase")
+	}
+	if confirm {
+		fmt.Fprint(os.Stderr, "Confirm passphrase: ")
+		b2, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		if string(b2) != pass {
+			return "", errors.New("passphrases do not match")
+		}
+	}
+	return pass, nil
+}
+
+// initVaultMeta joins an existing vault (verifying the passphrase) or creates
+// its metadata. Returns whether the vault is encrypted and the unlocked key.
+// An unencrypted vault is joined only with --no-encrypt: anyone who can write
+// the store could otherwise swap vault.json to turn a new node into a
+// plaintext publisher.
+func initVaultMeta(st sync.SyncStore, vaultID string, encrypt bool) (bool, []byte, error) {
+	meta, err := sync.FetchVaultMeta(st, vaultID)
+	if err == nil {
+		if !meta.Encrypt {
+			if encrypt {
+				return false, nil, fmt.Errorf("vault %s is not encrypted; pass --no-encrypt to join it without encryption", vaultID)
+			}
+			return false, nil, nil
+		}
+		if !encrypt {
+			return false, nil, errors.New("vault is encrypted; --no-encrypt cannot join it")
+		}
+		pass, err := readPassphrase("Vault passphrase: ", false)
+		if err != nil {
+			return false, nil, err
+		}
+		key, err := meta.Unlock(pass)
+		return true, key, err
+	}
+	if !errors.Is(err, sync.ErrNotFound) {
+		return false, nil, fmt.Errorf("vault metadata: %w", err)
+	}
+	var pass string
+	params := sync.KDFParams{}
+	if encrypt {
+		if pass, err = readPassphrase("New vault passphrase: ", true); err != nil {
+			return false, nil, err
+		}
+		if params, err = sync.DefaultKDFParams(); err != nil {
+			return false, nil, err
+		}
+	}
+	meta, key, err := sync.NewVaultMeta(vaultID, encrypt, pass, params)
+	if err != nil {
+		return false, nil, err
+	}
+	if err := sync.PublishVaultMeta(st, meta); err != nil {
+		return false, nil, fmt.Errorf("publish vault metadata: %w", err)
+	}
+	return encrypt, key, nil
+}
+
+// publishPendingTombstones publishes the tombstones hx forget queued, so peers
+// delete the windows it removed locally.
+func publishPendingTombstones(conn *sql.DB, v *syncVault) ([]string, error) {
+	st, err := openSyncStore(v)
+	if err != nil {
+		return nil, err
+	}
+	key, err := vaultKey(v, st)
+	if err != nil {
+		return nil, err
+	}
+	return sync.PublishPendingTombstones(conn, st, v.ID, v.NodeID, key, v.Encrypt)
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"testing"
+
+	"github.com/mrcawood/History_eXtended/internal/db"
+	"github.com/mrcawood/History_eXtended/internal/store"
+)
+
+// buildHxForSync builds the hx binary into a temp dir (skips if the build fails).
+func buildHxForSync(t *testing.T) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "hx-test")
+	if out, err := exec.Command("go", "build", "-tags", "sqlite_fts5", "-o", bin, ".").CombinedOutput(); err != nil {
+		t.Skipf("build hx: %v\n%s", err, out)
+	}
+	return bin
+}
+
+// runHxEnv runs bin with args and extra env; returns combined output and error.
+func runHxEnv(bin string, env []string, args ...string) (string, error) {
+	cmd := exec.Command(bin, args...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = strings.NewReader("")
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+func seedSyncDB(t *testing.T, dbFile, cmdText string) {
+	t.Helper()
+	conn, err := db.Open(dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	st := store.New(conn)
+	if err := st.EnsureSession("s1", "hostA", "pts/0", "/work", 1000); err != nil {
+		t.Fatal(err)
+	}
+	cmdID, _ := st.CmdID(cmdText, 1000)
+	if _, err := st.InsertEvent(
+		&store.PreEvent{T: "pre", Ts: 1000, Sid: "s1", Seq: 1, Cmd: cmdText, Cwd: "/work", Host: "hostA"},
+		&store.PostEvent{T: "post", Ts: 1001, Sid: "s1", Seq: 1, Exit: 0, DurMs: 5},
+		cmdID,
+	); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncEncryptedVaultRoundTrip(t *testing.T) {
+	bin := buildHxForSync(t)
+	tmp := t.TempDir()
+	storeDir := filepath.Join(tmp, "HXSync")
+	dbA := filepath.Join(tmp, "a", "hx.db")
+	dbB := filepath.Join(tmp, "b", "hx.db")
+	const secretCmd = "deploy --token sekrit-value"
+	seedSyncDB(t, dbA, secretCmd)
+
+	envA := []string{"HX_DB_PATH=" + dbA, "HX_SYNC_PASSPHRASE=pass-one"}
+	if out, err := runHxEnv(bin, envA, "sync", "init", "--store", "folder:"+storeDir); err != nil {
+		t.Fatalf("init A: %v\n%s", err, out)
+	}
+	keyFile := filepath.Join(tmp, "a", "keys", "vault-default.key")
+	fi, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatalf("keyfile not cached: %v", err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("keyfile mode = %o, want 0600", fi.Mode().Perm())
+	}
+	if out, err := runHxEnv(bin, []string{"HX_DB_PATH=" + dbA}, "sync", "push"); err != nil {
+		t.Fatalf("push A (cached key): %v\n%s", err, out)
+	}
+
+	// Nothing in the store may contain the command text in plaintext
+	_ = filepath.Walk(storeDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, _ := os.ReadFile(p)
+		if bytes.Contains(data, []byte("sekrit-value")) {
+			t.Errorf("plaintext command found in %s", p)
+		}
+		return nil
+	})
+
+	// Wrong passphrase cannot join the vault
+	if out, err := runHxEnv(bin, []string{"HX_DB_PATH=" + dbB, "HX_SYNC_PASSPHRASE=wrong"}, "sync", "init", "--store", "folder:"+storeDir); err == nil {
+		t.Fatalf("init B with wrong passphrase should fail:\n%s", out)
+	}
+	envB := []string{"HX_DB_PATH=" + dbB, "HX_SYNC_PASSPHRASE=pass-one"}
+	if out, err := runHxEnv(bin, envB, "sync", "init", "--store", "folder:"+storeDir); err != nil {
+		t.Fatalf("init B: %v\n%s", err, out)
+	}
+	out, err := runHxEnv(bin, envB, "sync", "pull")
+	if err != nil {
+		t.Fatalf("pull B: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "Imported: 1 segments") {
+		t.Errorf("pull B output = %q, want 1 segment imported", out)
+	}
+}
+
+func TestSyncInitNoEncrypt(t *testing.T) {
+	bin := buildHxForSync(t)
+	tmp := t.TempDir()
+	storeDir := filepath.Join(tmp, "HXSync")
+	env := []string{"HX_DB_PATH=" + filepath.Join(tmp, "hx.db")}
+	out, err := runHxEnv(bin, env, "sync", "init", "--store", "folder:"+storeDir, "--no-encrypt")
+	if err != nil {
+		t.Fatalf("init: %v\n%s", err, out)
+	}
+	out, _ = runHxEnv(bin, env, "sync", "status")
+	if !strings.Contains(out, "Encryption: off") {
+		t.Errorf("status = %q, want Encryption: off", out)
+	}
+
+	// Joining an unencrypted vault takes an explicit --no-encrypt
+	envB := []string{"HX_DB_PATH=" + filepath.Join(tmp, "b", "hx.db"), "HX_SYNC_PASSPHRASE=pass-one"}
+	out, err = runHxEnv(bin, envB, "sync", "init", "--store", "folder:"+storeDir)
+	if err == nil || !strings.Contains(out, "--no-encrypt") {
+		t.Fatalf("init B without --no-encrypt = %v, want refused:\n%s", err, out)
+	}
+	if out, err := runHxEnv(bin, envB, "sync", "status"); err == nil && strings.Contains(out, "Encryption:") {
+		t.Errorf("refused init still configured a vault:\n%s", out)
+	}
+	if out, err := runHxEnv(bin, envB, "sync", "init", "--store", "folder:"+storeDir, "--no-encrypt"); err != nil {
+		t.Fatalf("init B --no-encrypt: %v\n%s", err, out)
+	}
+}
+
+func TestForgetPublishesTombstone(t *testing.T) {
+	bin := buildHxForSync(t)
+	tmp := t.TempDir()
+	storeDir := filepath.Join(tmp, "HXSync")
+	dbFile := filepath.Join(tmp, "hx.db")
+	env := []string{"HX_DB_PATH=" + dbFile}
+	if out, err := runHxEnv(bin, env, "sync", "init", "--store", "folder:"+storeDir, "--no-encrypt"); err != nil {
+		t.Fatalf("init: %v\n%s", err, out)
+	}
+	out, err := runHxEnv(bin, env, "forget", "--since", "1h")
+	if err != nil {
+		t.Fatalf("forget: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "Published tombstone") {
+		t.Errorf("forget output = %q, want tombstone published", out)
+	}
+	tombs, _ := filepath.Glob(filepath.Join(storeDir, "vaults", "vault-default", "objects", "tombstones", "*.hxtomb"))
+	if len(tombs) != 1 {
+		t.Fatalf("tombstones in store = %d, want 1", len(tombs))
+	}
+	manifests, _ := filepath.Glob(filepath.Join(storeDir, "vaults", "vault-default", "objects", "manifests", "*.hxman"))
+	if len(manifests) != 1 {
+		t.Fatalf("manifests in store = %d, want 1", len(manifests))
+	}
+
+	conn, err := db.Open(dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	var n int
+	_ = conn.QueryRow(`SELECT COUNT(*) FROM sync_published_tombstones`).Scan(&n)
+	if n != 1 {
+		t.Errorf("sync_published_tombstones rows = %d, want 1", n)
+	}
+}
+
+// fakeS3 is a minimal in-memory S3 stand-in (path-style PUT, GET, ListObjectsV2 with delimiter).
+type fakeS3 struct {
+	mu      gosync.Mutex
+	objects map[string][]byte // "bucket/key"
+	auth    int               // requests carrying a SigV4 Authorization header
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256") {
+		f.auth++
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == http.MethodPut && key != "":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") {
+			body = decodeAWSChunked(body)
+		}
+		f.objects[bucket+"/"+key] = body
+		w.Header().Set("ETag", `"x"`)
+	case r.Method == http.MethodGet && key != "":
+		data, ok := f.objects[bucket+"/"+key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, `<Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		_, _ = w.Write(data)
+	case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		type content struct {
+			Key  string
+			Size int
+		}
+		type commonPrefix struct{ Prefix string }
+		res := struct {
+			XMLName        xml.Name `xml:"ListBucketResult"`
+			Name           string
+			Prefix         string
+			KeyCount       int
+			IsTruncated    bool
+			Contents       []content
+			CommonPrefixes []commonPrefix
+		}{Name: bucket, Prefix: r.URL.Query().Get("prefix")}
+		delim := r.URL.Query().Get("delimiter")
+		seen := map[string]bool{}
+		for k, v := range f.objects {
+			rel, ok := strings.CutPrefix(k, bucket+"/")
+			if !ok || !strings.HasPrefix(rel, res.Prefix) {
+				continue
+			}
+			if i := strings.Index(rel[len(res.Prefix):], delim); delim != "" && i >= 0 {
+				if p := rel[:len(res.Prefix)+i+1]; !seen[p] {
+					seen[p] = true
+					res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{p})
+				}
+				continue
+			}
+			res.Contents = append(res.Contents, content{Key: rel, Size: len(v)})
+		}
+		sort.Slice(res.Contents, func(i, j int) bool { return res.Contents[i].Key < res.Contents[j].Key })
+		sort.Slice(res.CommonPrefixes, func(i, j int) bool { return res.CommonPrefixes[i].Prefix < res.CommonPrefixes[j].Prefix })
+		res.KeyCount = len(res.Contents) + len(res.CommonPrefixes)
+		w.Header().Set("Content-Type", "application/xml")
+		_ = xml.NewEncoder(w).Encode(res)
+	default:
+		http.Error(w, "unsupported", http.StatusNotImplemented)
+	}
+}
+
+// decodeAWSChunked strips aws-chunked framing ("<hex>[;ext]\r\n<data>\r\n", trailers last).
+func decodeAWSChunked(body []byte) []byte {
+	var out []byte
+	r := bufio.NewReader(bytes.NewReader(body))
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return out
+		}
+		size, err := strconv.ParseInt(strings.TrimSpace(strings.SplitN(line, ";", 2)[0]), 16, 64)
+		if err != nil || size == 0 {
+			return out
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return out
+		}
+		out = append(out, chunk...)
+		_, _ = r.ReadString('\n')
+	}
+}
+
+func TestSyncS3StoreRoundTrip(t *testing.T) {
+	bin := buildHxForSync(t)
+	fake := &fakeS3{objects: make(map[string][]byte)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	tmp := t.TempDir()
+	dbA := filepath.Join(tmp, "a", "hx.db")
+	dbB := filepath.Join(tmp, "b", "hx.db")
+	seedSyncDB(t, dbA, "make deploy")
+	storeURI := "s3://hx-sync/team?endpoint=" + srv.URL + "&path_style=true&region=us-east-1"
+	awsEnv := []string{
+		"AWS_ACCESS_KEY_ID=minioadmin",
+		"AWS_SECRET_ACCESS_KEY=minioadmin",
+		"AWS_CONFIG_FILE=" + filepath.Join(tmp, "aws-config"),
+		"AWS_SHARED_CREDENTIALS_FILE=" + filepath.Join(tmp, "aws-credentials"),
+		"AWS_EC2_METADATA_DISABLED=true",
+		"HX_SYNC_PASSPHRASE=pass-one",
+	}
+	envA := append([]string{"HX_DB_PATH=" + dbA}, awsEnv...)
+	envB := append([]string{"HX_DB_PATH=" + dbB}, awsEnv...)
+
+	if out, err := runHxEnv(bin, envA, "sync", "init", "--store", storeURI+"&access_key=a&secret_key=b"); err == nil {
+		t.Fatalf("init with credentials in URI should fail:\n%s", out)
+	}
+	for _, step := range [][]string{{"sync", "init", "--store", storeURI}, {"sync", "push"}} {
+		if out, err := runHxEnv(bin, envA, step...); err != nil {
+			t.Fatalf("A %v: %v\n%s", step, err, out)
+		}
+	}
+	if _, ok := fake.objects["hx-sync/team/vaults/vault-default/vault.json"]; !ok {
+		t.Fatalf("vault metadata not written under prefix; objects: %v", len(fake.objects))
+	}
+	if out, err := runHxEnv(bin, envB, "sync", "init", "--store", storeURI); err != nil {
+		t.Fatalf("init B: %v\n%s", err, out)
+	}
+	out, err := runHxEnv(bin, envB, "sync", "pull")
+	if err != nil {
+		t.Fatalf("pull B: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "Imported: 1 segments") {
+		t.Errorf("pull B output = %q, want 1 segment imported", out)
+	}
+	if fake.auth == 0 {
+		t.Error("requests were not signed with env credentials")
+	}
+
+	conn, err := db.Open(dbA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	var storePath string
+	_ = conn.QueryRow(`SELECT store_path FROM sync_vaults`).Scan(&storePath)
+	if strings.Contains(storePath, "minioadmin") {
+		t.Errorf("credentials stored in DB: %q", storePath)
+	}
+}
@@ -1,17 +1,30 @@
 // hxd: ingestion daemon for hx.
-// Tails spool, pairs pre/post events, batch-inserts into SQLite.
+// Tails spool from a persisted checkpoint, pairs pre/post events, batch-inserts
+// into SQLite, and rotates fully ingested spool into sealed segments.
+// Listens on a per-user Unix socket for events from hx-emit; received events
+// are appended to the spool (which stays the source of truth) and ingested
+// immediately instead of waiting for the next poll.
+// When Ollama is enabled it also fills the embedding index in the background.
 
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/mrcawood/History_eXtended/internal/config"
 	"github.com/mrcawood/History_eXtended/internal/db"
+	"github.com/mrcawood/History_eXtended/internal/embedding"
+	"github.com/mrcawood/History_eXtended/internal/filter"
 	"github.com/mrcawood/History_eXtended/internal/ingest"
+	"github.com/mrcawood/History_eXtended/internal/llm"
+	"github.com/mrcawood/History_eXtended/internal/redact"
 	"github.com/mrcawood/History_eXtended/internal/retention"
 	"github.com/mrcawood/History_eXtended/internal/spool"
 	"github.com/mrcawood/History_eXtended/internal/store"
@@ -76,29 +89,156 @@ func main() {
 	defer func() { _ = os.Remove(pidPath()) }()
 
 	st := store.New(dbc)
-	eventsPath := spool.EventsPath(spoolDir())
+	sd := spoolDir()
 	cfg, _ := config.Load()
 	blobDir := blobDirFromConfig()
+	rotateBytes, grace := spoolLimits(cfg)
 	lastPrune := time.Now()
 
-	// Poll loop: ingest, sleep; run retention every 10 min
+	// Capture checks are built once; the socket and ingest share them
+	capture, err := redact.Capture(cfg)
+	if err != nil {
+		_, _ = os.Stderr.WriteString("hxd: " + err.Error() + " (scrubbing with built-in detectors only)\n")
+	}
+	flt, err := filter.New(cfg)
+	if err != nil {
+		_, _ = os.Stderr.WriteString("hxd: " + err.Error() + "\n")
+	}
+
+	wake := make(chan struct{}, 1)
+	sockPath := spool.SocketPath()
+	if conn, err := spool.Listen(sockPath); err != nil {
+		_, _ = os.Stderr.WriteString("hxd: socket disabled (spool only): " + err.Error() + "\n")
+	} else {
+		defer func() { _ = conn.Close(); _ = os.Remove(sockPath) }()
+		go serveSocket(conn, sd, flt, capture, wake)
+	}
+	go indexEmbeddings(dbc)
+
+	// Poll loop: tail spool from checkpoint, wait for a socket event or the
+	// tick; run retention every 10 min
 	tick := 3 * time.Second
 	pruneInterval := 10 * time.Minute
 	for {
-		n, err := ingest.Run(st, eventsPath, cfg)
+		n, err := ingest.Tail(st, sd, flt, capture, rotateBytes)
 		if err != nil {
 			_, _ = os.Stderr.WriteString("hxd: ingest: " + err.Error() + "\n")
 		}
 		if n > 0 {
 			// Could update last_ingest_at file for hx status
 		}
-		if time.Since(lastPrune) >= pruneInterval && cfg != nil {
-			_, _ = retention.PruneEvents(dbc, cfg)
-			_, _ = retention.PruneBlobs(dbc, blobDir, cfg)
+		if time.Since(lastPrune) >= pruneInterval {
+			if cfg != nil {
+				_, _ = retention.PruneEvents(dbc, cfg)
+				_, _ = retention.PruneBlobs(dbc, blobDir, cfg)
+			}
+			if cp, err := spool.LoadCheckpoint(sd); err == nil {
+				_, _ = spool.PruneSealed(sd, cp, grace)
+			}
 			lastPrune = time.Now()
 		}
-		time.Sleep(tick)
+		select {
+		case <-wake:
+		case <-time.After(tick):
+		}
+	}
+}
+
+// serveSocket drops commands flt rejects from each valid datagram, scrubs
+// secrets from the rest and from their env values with capture (nil when
+// scrubbing is off), appends it to the spool and wakes the ingest loop.
+// Malformed datagrams are dropped, as are events while capture is paused.
+func serveSocket(conn *net.UnixConn, sd string, flt *filter.Filter, capture *redact.Redactor, wake chan<- struct{}) {
+	paused := filepath.Join(filepath.Dir(sd), ".paused")
+	buf := make([]byte, spool.MaxDatagram)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		payload := buf[:n]
+		if !spool.ValidPayload(payload) {
+			continue
+		}
+		if _, err := os.Stat(paused); err == nil {
+			continue
+		}
+		payload = spool.ScrubPayload(payload, func(e *spool.Event) bool {
+			cmd, keep := flt.Admit(e.Cmd, e.Cwd, e.Host, capture)
+			e.Cmd, e.Env = cmd, capture.ScrubEnv(e.Env)
+			return keep
+		})
+		if len(payload) == 0 {
+			continue
+		}
+		if err := spool.Append(sd, payload); err != nil {
+			_, _ = os.Stderr.WriteString("hxd: spool append: " + err.Error() + "\n")
+			continue
+		}
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+const (
+	embedBatch = 64               // commands per embed call
+	embedBusy  = time.Second      // pause between batches while catching up
+	embedIdle  = 30 * time.Second // poll for new commands once caught up
+)
+
+// indexEmbeddings keeps the embedding index current for the configured
+// model. Config is re-read every round; when the model changes, vectors of
+// the old one are dropped and every command is embedded again.
+func indexEmbeddings(dbc *sql.DB) {
+	lastModel := ""
+	for {
+		wait := embedIdle
+		p, err := embedProvider()
+		if err != nil {
+			_, _ = os.Stderr.WriteString("hxd: " + err.Error() + "\n")
+		}
+		if p != nil && p.Available(context.Background()) {
+			model := p.EmbedModel()
+			if model != lastModel {
+				if _, err := embedding.PruneModels(dbc, model); err != nil {
+					_, _ = os.Stderr.WriteString("hxd: " + err.Error() + "\n")
+				} else {
+					lastModel = model
+				}
+			}
+			n, err := embedding.Backfill(context.Background(), dbc, model, p.Embed, embedBatch)
+			if err != nil {
+				_, _ = os.Stderr.WriteString("hxd: " + err.Error() + "\n")
+			} else if n > 0 {
+				wait = embedBusy
+			}
+		}
+		time.Sleep(wait)
+	}
+}
+
+// embedProvider returns the configured llm provider, or nil when inference
+// is turned off.
+func embedProvider() (llm.Provider, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	return llm.New(cfg)
+}
+
+// spoolLimits returns the rotation size and sealed-segment grace period.
+func spoolLimits(cfg *config.Config) (int64, time.Duration) {
+	rotateMB, graceHours := 8, 24
+	if cfg != nil {
+		rotateMB, graceHours = cfg.SpoolRotateMB, cfg.SpoolSealedGraceHours
 	}
+	return int64(rotateMB) << 20, time.Duration(graceHours) * time.Hour
 }
 
 func blobDirFromConfig() string {
@@ -4,12 +4,13 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"regexp"
+	"strings"
 )
 
 // Skeletonize normalizes text for recurrence detection: timestamps, hex addrs, PIDs → placeholders.
-// Returns skeleton_hash = sha256(skeleton_text).
+// Terminal control codes are dropped first (see StripControl).
 func Skeletonize(text string) string {
-	s := text
+	s := StripControl(text)
 	// Unix timestamps: 1707734400.123, 1707734400
 	s = regexp.MustCompile(`\b\d{10}(\.\d+)?\b`).ReplaceAllString(s, "<TS>")
 	// ISO-like: 2024-02-12T10:30:00, 2024-02-12 10:30:00
@@ -28,3 +29,29 @@ func SkeletonHash(text string) string {
 	h := sha256.Sum256([]byte(skel))
 	return hex.EncodeToString(h[:])
 }
+
+// escapeRe matches terminal escape sequences: CSI (colours, cursor moves),
+// OSC (window titles, hyperlinks) and two-byte escapes.
+var escapeRe = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// StripControl removes terminal control codes from captured output: escape
+// sequences, other control characters except tab, and text a carriage return
+// overwrote (progress bars keep only their final state). Output captured by
+// hx run then skeletonizes like the same output redirected to a file.
+func StripControl(text string) string {
+	s := escapeRe.ReplaceAllString(text, "")
+	lines := strings.Split(s, "\n")
+	for i, ln := range lines {
+		ln = strings.TrimSuffix(ln, "\r")
+		if j := strings.LastIndexByte(ln, '\r'); j >= 0 {
+			ln = ln[j+1:]
+		}
+		lines[i] = strings.Map(func(r rune) rune {
+			if (r < 0x20 && r != '\t') || r == 0x7f {
+				return -1
+			}
+			return r
+		}, ln)
+	}
+	return strings.Join(lines, "\n")
+}
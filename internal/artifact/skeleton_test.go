@@ -54,3 +54,14 @@ func TestSkeletonHashDifferent(t *testing.T) {
 		t.Errorf("different content should differ: %s == %s", ha, hb)
 	}
 }
+
+func TestSkeletonIgnoresControlCodes(t *testing.T) {
+	plain := "Downloading 100%\nerror: build failed\n"
+	tty := "\x1b]0;make\x07Downloading 10%\rDownloading 55%\rDownloading 100%\r\n\x1b[1;31merror:\x1b[0m build failed\r\n"
+	if got := StripControl(tty); got != plain {
+		t.Errorf("StripControl = %q, want %q", got, plain)
+	}
+	if SkeletonHash(tty) != SkeletonHash(plain) {
+		t.Error("terminal output and plain log should share a skeleton hash")
+	}
+}
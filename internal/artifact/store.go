@@ -31,13 +31,32 @@ func (s *Store) Attach(filePath string, linkSessionID string, linkEventID *int64
 	if len(content) > maxBytes {
 		content = content[:maxBytes]
 	}
+	return s.insert(content, SkeletonHash(string(content)), inferKind(filePath), linkSessionID, linkEventID, nil)
+}
 
-	sha256Hex, storagePath, byteLen, err := blob.Store(s.blobDir, content)
+// AttachOutput stores output captured by hx run as an "output" artifact for
+// the command at seq in session linkSessionID. skeletonText is what the
+// skeleton hash is computed from, so output stored with secrets masked still
+// matches the raw log in hx query --file. The event may not be ingested yet:
+// the artifact keeps the seq and ingest links it when the event arrives.
+func (s *Store) AttachOutput(content []byte, skeletonText, linkSessionID string, seq int) (artifactID int64, err error) {
+	aid, err := s.insert(content, SkeletonHash(skeletonText), "output", linkSessionID, nil, &seq)
 	if err != nil {
 		return 0, err
 	}
+	// Link now if ingest got there first; a later insert links it otherwise.
+	_, err = s.db.Exec(`
+		UPDATE artifacts SET linked_event_id = (SELECT event_id FROM events WHERE session_id = ? AND seq = ?)
+		WHERE artifact_id = ? AND linked_event_id IS NULL
+	`, linkSessionID, seq, aid)
+	return aid, err
+}
 
-	skeletonHash := SkeletonHash(string(content))
+func (s *Store) insert(content []byte, skeletonHash, kind, linkSessionID string, linkEventID *int64, linkSeq *int) (int64, error) {
+	sha256Hex, storagePath, byteLen, err := blob.Store(s.blobDir, content)
+	if err != nil {
+		return 0, err
+	}
 	now := float64(time.Now().UnixNano()) / 1e9
 
 	_, err = s.db.Exec(
@@ -49,8 +68,8 @@ func (s *Store) Attach(filePath string, linkSessionID string, linkEventID *int64
 	}
 
 	res, err := s.db.Exec(
-		`INSERT INTO artifacts (created_at, kind, sha256, byte_len, blob_path, skeleton_hash, linked_session_id, linked_event_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-		now, inferKind(filePath), sha256Hex, byteLen, storagePath, skeletonHash, linkSessionID, linkEventID,
+		`INSERT INTO artifacts (created_at, kind, sha256, byte_len, blob_path, skeleton_hash, linked_session_id, linked_event_id, linked_seq) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		now, kind, sha256Hex, byteLen, storagePath, skeletonHash, linkSessionID, linkEventID, linkSeq,
 	)
 	if err != nil {
 		return 0, err
@@ -1,6 +1,7 @@
 package artifact
 
 import (
+	"database/sql"
 	"os"
 	"path/filepath"
 	"testing"
@@ -61,3 +62,73 @@ func TestAttachAndQuery(t *testing.T) {
 		t.Errorf("SessionID = %q", sessions[0].SessionID)
 	}
 }
+
+func TestAttachOutputLinksEvent(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HX_BLOB_DIR", filepath.Join(dir, "blobs"))
+	conn, err := db.Open(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer conn.Close()
+	st := store.New(conn)
+	ast := New(conn)
+	if err := st.EnsureSession("sess", "host", "pts/0", "/home", 1700000000); err != nil {
+		t.Fatal(err)
+	}
+	insert := func(seq int, pending bool) int64 {
+		t.Helper()
+		cmdID, _ := st.CmdID("hx run -- make", 1700000000)
+		pre := &store.PreEvent{Sid: "sess", Seq: seq, Ts: 1700000000, Cmd: "hx run -- make", Cwd: "/home"}
+		if pending {
+			_, err = st.InsertPendingEvent(pre, cmdID, "running")
+		} else {
+			_, err = st.InsertEvent(pre, &store.PostEvent{Sid: "sess", Seq: seq, Ts: 1700000001, Exit: 2}, cmdID)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var id int64
+		if err := conn.QueryRow(`SELECT event_id FROM events WHERE session_id = 'sess' AND seq = ?`, seq).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	linked := func(aid int64) int64 {
+		t.Helper()
+		var id sql.NullInt64
+		if err := conn.QueryRow(`SELECT linked_event_id FROM artifacts WHERE artifact_id = ?`, aid).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		return id.Int64
+	}
+
+	// Saved before hxd ingests the command: linked when the event arrives
+	aid, err := ast.AttachOutput([]byte("make: *** [all] Error 2\n"), "make: *** [all] Error 2\n", "sess", 1)
+	if err != nil {
+		t.Fatalf("AttachOutput: %v", err)
+	}
+	if linked(aid) != 0 {
+		t.Fatal("artifact linked before its event exists")
+	}
+	if eventID := insert(1, false); linked(aid) != eventID {
+		t.Errorf("linked_event_id = %d, want %d", linked(aid), eventID)
+	}
+
+	// zsh sends the pre event first: the running event is already there
+	eventID := insert(2, true)
+	aid, err = ast.AttachOutput([]byte("\x1b[31mFAIL\x1b[0m\n"), "\x1b[31mFAIL\x1b[0m\n", "sess", 2)
+	if err != nil {
+		t.Fatalf("AttachOutput: %v", err)
+	}
+	if linked(aid) != eventID {
+		t.Errorf("linked_event_id = %d, want %d", linked(aid), eventID)
+	}
+	var kind, skel string
+	if err := conn.QueryRow(`SELECT kind, skeleton_hash FROM artifacts WHERE artifact_id = ?`, aid).Scan(&kind, &skel); err != nil {
+		t.Fatal(err)
+	}
+	if kind != "output" || skel != SkeletonHash("FAIL\n") {
+		t.Errorf("kind %q skeleton %s, want output and the hash of the plain text", kind, skel)
+	}
+}
@@ -14,8 +14,41 @@ type Std1Row struct {
 	Seq       int
 	StartedAt float64
 	ExitCode  *int
+	State     string // running, interrupted, unknown; "" when completed
 	Cwd       string
 	Cmd       string
+
+	// Context output (--before/--after/--context): Group numbers runs of
+	// neighbouring events, Context marks neighbours that did not match.
+	// Rows of a group are adjacent; Group 0 everywhere means plain output.
+	Group   int
+	Context bool
+}
+
+// std1Marks decorates grouped output like grep -C: "> " before matches,
+// two spaces before context rows and the header, "--" between groups.
+type std1Marks bool
+
+func (m std1Marks) header(line string) string {
+	if !m {
+		return line
+	}
+	return "  " + line
+}
+
+func (m std1Marks) writeRow(w io.Writer, rows []Std1Row, i int, line string) {
+	if !m {
+		_, _ = fmt.Fprintln(w, line)
+		return
+	}
+	if i > 0 && rows[i].Group != rows[i-1].Group {
+		_, _ = fmt.Fprintln(w, "--")
+	}
+	mark := "> "
+	if rows[i].Context {
+		mark = "  "
+	}
+	_, _ = fmt.Fprintln(w, mark+line)
 }
 
 const (
@@ -30,6 +63,23 @@ const (
 
 const debugMinWidth = 100
 
+// exitLabel is the exit code, or a short label for a command that has none
+// yet, matching hx search.
+func exitLabel(r Std1Row) string {
+	if r.ExitCode != nil {
+		return fmt.Sprintf("%d", *r.ExitCode)
+	}
+	switch r.State {
+	case "running":
+		return "run"
+	case "interrupted":
+		return "intr"
+	case "unknown":
+		return "unk"
+	}
+	return "-"
+}
+
 // RenderStandard1 outputs Standard 1 format: no vertical bars, one header, one dashed separator.
 // Mode: "compact" (id|when|exit|cwd|cmd), "wide" (id|when_abs|exit|cwd|cmd), "debug" (adds session_id|seq).
 // Width allocation: cmd gets most, cwd second, fixed widths for id/when/exit.
@@ -45,18 +95,22 @@ func RenderStandard1(rows []Std1Row, mode string, termWidth int, forceWide bool,
 	if mode == "debug" && termWidth < debugMinWidth {
 		mode = "compact"
 	}
+	marks := std1Marks(rows[0].Group > 0)
+	if marks {
+		termWidth -= 2
+	}
 
 	switch mode {
 	case "debug":
-		renderDebug(rows, termWidth, w)
+		renderDebug(rows, termWidth, marks, w)
 	case "wide":
-		renderWide(rows, termWidth, w)
+		renderWide(rows, termWidth, marks, w)
 	default:
-		renderCompact(rows, termWidth, w)
+		renderCompact(rows, termWidth, marks, w)
 	}
 }
 
-func renderCompact(rows []Std1Row, termWidth int, w io.Writer) {
+func renderCompact(rows []Std1Row, termWidth int, marks std1Marks, w io.Writer) {
 	// compact: id | when | exit | cwd | cmd
 	// Fixed: id=8, when=8, exit=5. Remaining: cwd + cmd. cwd gets ~20-24, cmd gets rest.
 	cwdW := 20
@@ -90,17 +144,14 @@ func renderCompact(rows []Std1Row, termWidth int, w io.Writer) {
 		header = fmt.Sprintf("%-*s %-*s %-*s %-*s %-*s", idWidth, "id", whenCompactWidth, "when", exitWidth, "exit", cwdW, "cwd", cmdW, "cmd")
 	}
 	header = clampLine(header, termWidth)
-	_, _ = fmt.Fprintln(w, header)
+	_, _ = fmt.Fprintln(w, marks.header(header))
 
 	// Separator should match header length exactly
 	separator := strings.Repeat("-", len(header))
-	_, _ = fmt.Fprintln(w, separator)
+	_, _ = fmt.Fprintln(w, marks.header(separator))
 
-	for _, r := range rows {
-		exit := "-"
-		if r.ExitCode != nil {
-			exit = fmt.Sprintf("%d", *r.ExitCode)
-		}
+	for i, r := range rows {
+		exit := exitLabel(r)
 		cwdShow := TruncateCwdTail(r.Cwd, cwdW)
 		cmdShow := TruncateRight(r.Cmd, cmdW)
 
@@ -109,11 +160,11 @@ func renderCompact(rows []Std1Row, termWidth int, w io.Writer) {
 
 		// Clamp line to prevent overflow - operate on runes, not bytes
 		line = clampLine(line, termWidth)
-		_, _ = fmt.Fprintln(w, line)
+		marks.writeRow(w, rows, i, line)
 	}
 }
 
-func renderWide(rows []Std1Row, termWidth int, w io.Writer) {
+func renderWide(rows []Std1Row, termWidth int, marks std1Marks, w io.Writer) {
 	// wide: id | when_abs | exit | cwd | cmd (no session_id)
 	// Fixed: id=8, when_abs=19, exit=5. cmd gets most, cwd second.
 	fixed := idWidth + whenAbsWidth + exitWidth + 3
@@ -137,16 +188,13 @@ func renderWide(rows []Std1Row, termWidth int, w io.Writer) {
 
 	header := fmt.Sprintf("%-*s %-*s %-*s %-*s %-*s", idWidth, "id", whenAbsWidth, "when", exitWidth, "exit", cwdW, "cwd", cmdW, "cmd")
 	header = clampLine(header, termWidth)
-	_, _ = fmt.Fprintln(w, header)
+	_, _ = fmt.Fprintln(w, marks.header(header))
 	sepLine := strings.Repeat("-", sepLen)
 	sepLine = clampLine(sepLine, termWidth-1) // Ensure room for newline
-	_, _ = fmt.Fprintln(w, sepLine)
+	_, _ = fmt.Fprintln(w, marks.header(sepLine))
 
-	for _, r := range rows {
-		exit := "-"
-		if r.ExitCode != nil {
-			exit = fmt.Sprintf("%d", *r.ExitCode)
-		}
+	for i, r := range rows {
+		exit := exitLabel(r)
 		cwdShow := TruncateCwdTail(r.Cwd, cwdW)
 		cmdShow := TruncateRight(r.Cmd, cmdW)
 
@@ -155,11 +203,11 @@ func renderWide(rows []Std1Row, termWidth int, w io.Writer) {
 
 		// Clamp line to prevent overflow
 		line = clampLine(line, termWidth)
-		_, _ = fmt.Fprintln(w, line)
+		marks.writeRow(w, rows, i, line)
 	}
 }
 
-func renderDebug(rows []Std1Row, termWidth int, w io.Writer) {
+func renderDebug(rows []Std1Row, termWidth int, marks std1Marks, w io.Writer) {
 	// debug: id | session_id | seq | when_abs | exit | cwd | cmd
 	fixed := idWidth + sessionIDWidth + seqWidth + whenAbsWidth + exitWidth + 4
 	cwdW := 20
@@ -179,16 +227,13 @@ func renderDebug(rows []Std1Row, termWidth int, w io.Writer) {
 
 	header := fmt.Sprintf("%-*s %-*s %-*s %-*s %-*s %-*s %-*s", idWidth, "id", sessionIDWidth, "session_id", seqWidth, "seq", whenAbsWidth, "when", exitWidth, "exit", cwdW, "cwd", cmdW, "cmd")
 	header = clampLine(header, termWidth)
-	_, _ = fmt.Fprintln(w, header)
+	_, _ = fmt.Fprintln(w, marks.header(header))
 	sepLine := strings.Repeat("-", sepLen)
 	sepLine = clampLine(sepLine, termWidth-1) // Ensure room for newline
-	_, _ = fmt.Fprintln(w, sepLine)
+	_, _ = fmt.Fprintln(w, marks.header(sepLine))
 
-	for _, r := range rows {
-		exit := "-"
-		if r.ExitCode != nil {
-			exit = fmt.Sprintf("%d", *r.ExitCode)
-		}
+	for i, r := range rows {
+		exit := exitLabel(r)
 		cwdShow := TruncateCwdTail(r.Cwd, cwdW)
 		cmdShow := TruncateRight(r.Cmd, cmdW)
 
@@ -197,6 +242,6 @@ func renderDebug(rows []Std1Row, termWidth int, w io.Writer) {
 
 		// Clamp line to prevent overflow
 		line = clampLine(line, termWidth)
-		_, _ = fmt.Fprintln(w, line)
+		marks.writeRow(w, rows, i, line)
 	}
 }
@@ -10,21 +10,76 @@ import (
 
 // Config holds resolved paths and settings. Paths use XDG defaults when not in file.
 type Config struct {
-	SpoolDir              string   `yaml:"spool_dir"`
-	BlobDir               string   `yaml:"blob_dir"`
-	DbPath                string   `yaml:"db_path"`
-	RetentionEventsMonths int      `yaml:"retention_events_months"`
-	RetentionBlobsDays    int      `yaml:"retention_blobs_days"`
-	BlobDiskCapGB         float64  `yaml:"blob_disk_cap_gb"`
-	AllowlistMode         bool     `yaml:"allowlist_mode"`
-	AllowlistBins         []string `yaml:"allowlist_bins"`
-	IgnorePatterns        []string `yaml:"ignore_patterns"`
+	SpoolDir              string       `yaml:"spool_dir"`
+	BlobDir               string       `yaml:"blob_dir"`
+	DbPath                string       `yaml:"db_path"`
+	RetentionEventsMonths int          `yaml:"retention_events_months"`
+	RetentionBlobsDays    int          `yaml:"retention_blobs_days"`
+	BlobDiskCapGB         float64      `yaml:"blob_disk_cap_gb"`
+	RunOutputKB           int          `yaml:"run_output_kb"`            // hx run keeps this much of the end of a command's output
+	SpoolRotateMB         int          `yaml:"spool_rotate_mb"`          // seal events.jsonl once ingested and this large
+	SpoolSealedGraceHours int          `yaml:"spool_sealed_grace_hours"` // delete sealed spool segments after this long
+	AllowlistMode         bool         `yaml:"allowlist_mode"`
+	AllowlistBins         []string     `yaml:"allowlist_bins"`
+	IgnorePatterns        []string     `yaml:"ignore_patterns"`
+	IgnoreRules           []IgnoreRule `yaml:"ignore_rules"`
+	IgnoreSpace           bool         `yaml:"ignore_space"` // commands typed with a leading space are not recorded (default true)
 	// Ollama (M5): semantic search and LLM explanations
 	OllamaEnabled    bool         `yaml:"ollama_enabled"`
 	OllamaBaseURL    string       `yaml:"ollama_base_url"`
 	OllamaEmbedModel string       `yaml:"ollama_embed_model"`
 	OllamaChatModel  string       `yaml:"ollama_chat_model"`
+	LLM              LLMConfig    `yaml:"llm"`
 	Search           SearchConfig `yaml:"search"`
+	Redact           RedactConfig `yaml:"redact"`
+	Env              EnvConfig    `yaml:"env"`
+}
+
+// EnvConfig lists the environment variables recorded with each command (see
+// internal/envctx). Nothing is recorded unless a name is listed.
+type EnvConfig struct {
+	Capture []string `yaml:"capture"` // recorded as is, e.g. AWS_PROFILE, KUBECONFIG
+	Hash    []string `yaml:"hash"`    // recorded as a sha256 prefix, never the value
+}
+
+// RedactConfig tunes secret redaction (internal/redact) for capture,
+// hx export --redacted, LLM prompts and sync.
+type RedactConfig struct {
+	Rules   []RedactRule      `yaml:"rules"`   // custom detectors, run after the built-ins
+	Disable []string          `yaml:"disable"` // built-in detectors to turn off, e.g. high-entropy
+	Sync    bool              `yaml:"sync"`    // redact cmd and cwd in segments before hx sync push
+	Capture bool              `yaml:"capture"` // scrub commands in hx-emit/hxd before they reach disk (default true)
+	Actions map[string]string `yaml:"actions"` // capture action per built-in detector: mask (default) or drop
+}
+
+// RedactRule is a custom redaction detector.
+type RedactRule struct {
+	Name    string `yaml:"name"`    // shown in the placeholder: <REDACTED:name>
+	Pattern string `yaml:"pattern"` // Go regexp; a (?P<secret>...) group masks only that part
+	Action  string `yaml:"action"`  // at capture: mask (default) or drop the whole command
+}
+
+// IgnoreRule keeps matching commands out of history. Every field that is set
+// must match; a rule with only Cwd drops everything run under that directory.
+type IgnoreRule struct {
+	Name  string `yaml:"name"`  // label shown by hx debug --cmd
+	Glob  string `yaml:"glob"`  // shell glob on the whole command, like ignore_patterns
+	Regex string `yaml:"regex"` // Go regexp searched in the command
+	Cwd   string `yaml:"cwd"`   // directory prefix; ~ and $HOME expand
+	Host  string `yaml:"host"`  // shell glob on the hostname
+}
+
+// LLMConfig selects the embedding and chat provider (see internal/llm).
+// Empty fields fall back to the ollama_* keys for the ollama provider.
+// Enabled turns any provider on or off; unset, ollama_enabled decides for
+// the ollama provider and other providers are on.
+type LLMConfig struct {
+	Enabled    *bool  `yaml:"enabled"`
+	Provider   string `yaml:"provider"`    // ollama (default), openai (OpenAI-compatible: llama.cpp, vLLM, ...), none
+	BaseURL    string `yaml:"base_url"`    // openai: include the /v1 prefix
+	EmbedModel string `yaml:"embed_model"` // model for semantic search and the embedding index
+	ChatModel  string `yaml:"chat_model"`  // model for hx query summaries
+	APIKeyEnv  string `yaml:"api_key_env"` // env var holding the API key, sent as a Bearer token
 }
 
 // SearchConfig controls interactive history search (Ctrl-R / hx search).
@@ -34,6 +89,25 @@ type SearchConfig struct {
 	DefaultMode   string `yaml:"default_mode"`   // fuzzy, prefix, fts, semantic
 	UIStyle       string `yaml:"ui_style"`       // full, inline (Phase 2 TUI)
 	InlineHeight  int    `yaml:"inline_height"`
+	Rank          string `yaml:"rank"` // recent (default), frecency
+
+	Frecency FrecencyConfig `yaml:"frecency"`
+}
+
+// FrecencyConfig weights the terms of the frecency ranking. Each term is
+// scaled to 0..1 before weighting; a weight of 0 turns the term off.
+type FrecencyConfig struct {
+	Frequency     float64 `yaml:"frequency"`       // how often the command ran
+	Recency       float64 `yaml:"recency"`         // how recently it ran
+	HalfLifeHours float64 `yaml:"half_life_hours"` // recency halves every this many hours
+	Dir           float64 `yaml:"dir"`             // how often it ran in the current directory
+	Repo          float64 `yaml:"repo"`            // how often it ran in the current git repo
+	Success       float64 `yaml:"success"`         // share of its runs that exited 0
+}
+
+// DefaultFrecency returns the frecency weights used when config sets none.
+func DefaultFrecency() FrecencyConfig {
+	return FrecencyConfig{Frequency: 1, Recency: 1, HalfLifeHours: 72, Dir: 1, Repo: 0.5, Success: 0.5}
 }
 
 type rawConfig struct {
@@ -43,14 +117,22 @@ type rawConfig struct {
 	RetentionEventsMonths int           `yaml:"retention_events_months"`
 	RetentionBlobsDays    int           `yaml:"retention_blobs_days"`
 	BlobDiskCapGB         float64       `yaml:"blob_disk_cap_gb"`
+	RunOutputKB           int           `yaml:"run_output_kb"`
+	SpoolRotateMB         int           `yaml:"spool_rotate_mb"`
+	SpoolSealedGraceHours int           `yaml:"spool_sealed_grace_hours"`
 	AllowlistMode         bool          `yaml:"allowlist_mode"`
 	AllowlistBins         []string      `yaml:"allowlist_bins"`
 	IgnorePatterns        []string      `yaml:"ignore_patterns"`
+	IgnoreRules           []IgnoreRule  `yaml:"ignore_rules"`
+	IgnoreSpace           *bool         `yaml:"ignore_space"`
 	OllamaEnabled         *bool         `yaml:"ollama_enabled"`
 	OllamaBaseURL         string        `yaml:"ollama_base_url"`
 	OllamaEmbedModel      string        `yaml:"ollama_embed_model"`
 	OllamaChatModel       string        `yaml:"ollama_chat_model"`
+	LLM                   *LLMConfig    `yaml:"llm"`
 	Search                *SearchConfig `yaml:"search"`
+	Redact                *RedactConfig `yaml:"redact"`
+	Env                   *EnvConfig    `yaml:"env"`
 }
 
 // Load reads config from XDG_CONFIG_HOME/hx/config.yaml. Missing file uses defaults.
@@ -67,15 +149,24 @@ func Load() (*Config, error) {
 		RetentionEventsMonths: 12,
 		RetentionBlobsDays:    90,
 		BlobDiskCapGB:         2.0,
+		RunOutputKB:           256,
+		SpoolRotateMB:         8,
+		SpoolSealedGraceHours: 24,
+		IgnoreSpace:           true,
 		OllamaEnabled:         true,
 		OllamaBaseURL:         "http://localhost:11434",
 		OllamaEmbedModel:      "nomic-embed-text",
 		OllamaChatModel:       "llama3.2",
+		Search:                SearchConfig{Frecency: DefaultFrecency()},
+		Redact:                RedactConfig{Capture: true},
 	}
 
 	b, err := os.ReadFile(configPath)
 	if err == nil {
-		var raw rawConfig
+		// Frecency weights and redact.capture decode over the defaults so a
+		// key left out of the file keeps its default and an explicit 0 or
+		// false still turns it off.
+		raw := rawConfig{Search: &SearchConfig{Frecency: c.Search.Frecency}, Redact: &RedactConfig{Capture: c.Redact.Capture}}
 		if err := yaml.Unmarshal(b, &raw); err != nil {
 			return nil, err
 		}
@@ -104,6 +195,15 @@ func applyRawConfig(c *Config, raw *rawConfig, dataHome string) {
 	if raw.BlobDiskCapGB > 0 {
 		c.BlobDiskCapGB = raw.BlobDiskCapGB
 	}
+	if raw.RunOutputKB > 0 {
+		c.RunOutputKB = raw.RunOutputKB
+	}
+	if raw.SpoolRotateMB > 0 {
+		c.SpoolRotateMB = raw.SpoolRotateMB
+	}
+	if raw.SpoolSealedGraceHours > 0 {
+		c.SpoolSealedGraceHours = raw.SpoolSealedGraceHours
+	}
 	c.AllowlistMode = raw.AllowlistMode
 	if len(raw.AllowlistBins) > 0 {
 		c.AllowlistBins = raw.AllowlistBins
@@ -111,6 +211,12 @@ func applyRawConfig(c *Config, raw *rawConfig, dataHome string) {
 	if len(raw.IgnorePatterns) > 0 {
 		c.IgnorePatterns = raw.IgnorePatterns
 	}
+	if len(raw.IgnoreRules) > 0 {
+		c.IgnoreRules = raw.IgnoreRules
+	}
+	if raw.IgnoreSpace != nil {
+		c.IgnoreSpace = *raw.IgnoreSpace
+	}
 	if raw.OllamaEnabled != nil {
 		c.OllamaEnabled = *raw.OllamaEnabled
 	}
@@ -123,6 +229,9 @@ func applyRawConfig(c *Config, raw *rawConfig, dataHome string) {
 	if raw.OllamaChatModel != "" {
 		c.OllamaChatModel = raw.OllamaChatModel
 	}
+	if raw.LLM != nil {
+		c.LLM = *raw.LLM
+	}
 	if raw.Search != nil {
 		if raw.Search.DefaultFilter != "" {
 			c.Search.DefaultFilter = raw.Search.DefaultFilter
@@ -136,8 +245,21 @@ func applyRawConfig(c *Config, raw *rawConfig, dataHome string) {
 		if raw.Search.InlineHeight > 0 {
 			c.Search.InlineHeight = raw.Search.InlineHeight
 		}
+		if raw.Search.Rank != "" {
+			c.Search.Rank = raw.Search.Rank
+		}
+		c.Search.Frecency = raw.Search.Frecency
+		if c.Search.Frecency.HalfLifeHours <= 0 {
+			c.Search.Frecency.HalfLifeHours = DefaultFrecency().HalfLifeHours
+		}
 		c.Search.EnterAccept = raw.Search.EnterAccept
 	}
+	if raw.Redact != nil {
+		c.Redact = *raw.Redact
+	}
+	if raw.Env != nil {
+		c.Env = *raw.Env
+	}
 }
 
 func applyEnvOverrides(c *Config) {
@@ -141,3 +141,174 @@ func TestLoadEnvOverride(t *testing.T) {
 		t.Errorf("SpoolDir = %q, want /env/override (env takes precedence)", c.SpoolDir)
 	}
 }
+
+func TestLoadFrecencyWeights(t *testing.T) {
+	dir := t.TempDir()
+	configDir := filepath.Join(dir, "hx")
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := `search:
+  rank: frecency
+  frecency:
+    recency: 2
+    success: 0
+`
+	if err := os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Setenv("XDG_CONFIG_HOME", dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.Unsetenv("XDG_CONFIG_HOME"); err != nil {
+			t.Logf("Warning: failed to unsetenv: %v", err)
+		}
+	}()
+
+	c, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if c.Search.Rank != "frecency" {
+		t.Errorf("Search.Rank = %q, want frecency", c.Search.Rank)
+	}
+	want := DefaultFrecency()
+	want.Recency = 2
+	want.Success = 0
+	if c.Search.Frecency != want {
+		t.Errorf("Search.Frecency = %+v, want %+v (unset keys keep defaults)", c.Search.Frecency, want)
+	}
+}
+
+func TestLoadLLMProvider(t *testing.T) {
+	dir := t.TempDir()
+	configDir := filepath.Join(dir, "hx")
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := `llm:
+  enabled: false
+  provider: openai
+  base_url: http://localhost:8080/v1
+  embed_model: bge-small
+  api_key_env: HX_TEST_KEY
+`
+	if err := os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Setenv("XDG_CONFIG_HOME", dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.Unsetenv("XDG_CONFIG_HOME"); err != nil {
+			t.Logf("Warning: failed to unsetenv: %v", err)
+		}
+	}()
+
+	c, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if c.LLM.Enabled == nil || *c.LLM.Enabled {
+		t.Errorf("LLM.Enabled = %v, want false", c.LLM.Enabled)
+	}
+	got := c.LLM
+	got.Enabled = nil
+	want := LLMConfig{Provider: "openai", BaseURL: "http://localhost:8080/v1", EmbedModel: "bge-small", APIKeyEnv: "HX_TEST_KEY"}
+	if got != want {
+		t.Errorf("LLM = %+v, want %+v", got, want)
+	}
+	if c.OllamaEmbedModel != "nomic-embed-text" {
+		t.Errorf("OllamaEmbedModel = %q, want default kept", c.OllamaEmbedModel)
+	}
+}
+
+func TestLoadRedactCapture(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Setenv("XDG_CONFIG_HOME", dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.Unsetenv("XDG_CONFIG_HOME"); err != nil {
+			t.Logf("Warning: failed to unsetenv: %v", err)
+		}
+	}()
+	c, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !c.Redact.Capture {
+		t.Error("Redact.Capture should be true by default")
+	}
+
+	configDir := filepath.Join(dir, "hx")
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := `redact:
+  actions:
+    aws-key: drop
+  rules:
+    - name: acme
+      pattern: 'acme_\w+'
+      action: drop
+`
+	if err := os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err = Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !c.Redact.Capture {
+		t.Error("Redact.Capture should stay true when the key is left out")
+	}
+	if c.Redact.Actions["aws-key"] != "drop" || len(c.Redact.Rules) != 1 || c.Redact.Rules[0].Action != "drop" {
+		t.Errorf("Redact = %+v", c.Redact)
+	}
+}
+
+func TestLoadIgnoreRules(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Setenv("XDG_CONFIG_HOME", dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.Unsetenv("XDG_CONFIG_HOME"); err != nil {
+			t.Logf("Warning: failed to unsetenv: %v", err)
+		}
+	}()
+	c, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !c.IgnoreSpace {
+		t.Error("IgnoreSpace should be true by default")
+	}
+
+	configDir := filepath.Join(dir, "hx")
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := `ignore_space: false
+ignore_rules:
+  - name: kube
+    regex: '^kubectl .*secret'
+  - cwd: ~/clients/acme
+    host: 'prod-*'
+`
+	if err := os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err = Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if c.IgnoreSpace {
+		t.Error("IgnoreSpace should be false")
+	}
+	if len(c.IgnoreRules) != 2 || c.IgnoreRules[0].Name != "kube" || c.IgnoreRules[1].Cwd != "~/clients/acme" || c.IgnoreRules[1].Host != "prod-*" {
+		t.Errorf("IgnoreRules = %+v", c.IgnoreRules)
+	}
+}
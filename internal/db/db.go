@@ -15,7 +15,7 @@ func Open(path string) (*sql.DB, error) {
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, fmt.Errorf("create db dir: %w", err)
 	}
-	conn, err := sql.Open("sqlite3", path+"?_journal_mode=WAL")
+	conn, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_busy_timeout=5000")
 	if err != nil {
 		return nil, fmt.Errorf("open db: %w", err)
 	}
@@ -53,6 +53,30 @@ func migrate(conn *sql.DB) error {
 	if err := migrateSync(conn); err != nil {
 		return fmt.Errorf("migrate sync: %w", err)
 	}
+	if err := migrateSignal(conn); err != nil {
+		return fmt.Errorf("migrate signal: %w", err)
+	}
+	if err := migrateState(conn); err != nil {
+		return fmt.Errorf("migrate state: %w", err)
+	}
+	if err := migrateImportResume(conn); err != nil {
+		return fmt.Errorf("migrate import resume: %w", err)
+	}
+	if err := migrateDedupBatch(conn); err != nil {
+		return fmt.Errorf("migrate dedup batch: %w", err)
+	}
+	if err := migrateEmbeddings(conn); err != nil {
+		return fmt.Errorf("migrate embeddings: %w", err)
+	}
+	if err := migrateArtifactSeq(conn); err != nil {
+		return fmt.Errorf("migrate artifact seq: %w", err)
+	}
+	if err := migrateTombstoneKeep(conn); err != nil {
+		return fmt.Errorf("migrate tombstone keep: %w", err)
+	}
+	if err := migratePublishedState(conn); err != nil {
+		return fmt.Errorf("migrate published state: %w", err)
+	}
 	return nil
 }
 
@@ -141,6 +165,95 @@ func migratePinned(conn *sql.DB) error {
 	return err
 }
 
+// migrateSignal adds events.signal (e.g. SIGINT) for commands killed by a signal.
+func migrateSignal(conn *sql.DB) error {
+	var count int
+	err := conn.QueryRow("SELECT COUNT(*) FROM pragma_table_info('events') WHERE name='signal'").Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err = conn.Exec("ALTER TABLE events ADD COLUMN signal TEXT")
+	return err
+}
+
+// migrateState adds events.state for commands without a post event
+// (running, interrupted, unknown). NULL means completed.
+func migrateState(conn *sql.DB) error {
+	var count int
+	err := conn.QueryRow("SELECT COUNT(*) FROM pragma_table_info('events') WHERE name='state'").Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		if _, err := conn.Exec("ALTER TABLE events ADD COLUMN state TEXT"); err != nil {
+			return err
+		}
+	}
+	_, err = conn.Exec("CREATE INDEX IF NOT EXISTS idx_events_state ON events(state) WHERE state IS NOT NULL")
+	return err
+}
+
+// migrateImportResume adds import_batches.status ('running' until the import
+// finishes; NULL for batches from before streaming import) and resume_pos
+// (entries consumed from the source, committed with each transaction).
+func migrateImportResume(conn *sql.DB) error {
+	var count int
+	err := conn.QueryRow("SELECT COUNT(*) FROM pragma_table_info('import_batches') WHERE name='status'").Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	for _, q := range []string{
+		`ALTER TABLE import_batches ADD COLUMN status TEXT`,
+		`ALTER TABLE import_batches ADD COLUMN resume_pos INTEGER NOT NULL DEFAULT 0`,
+	} {
+		if _, err := conn.Exec(q); err != nil {
+			return fmt.Errorf("%s: %w", q, err)
+		}
+	}
+	return nil
+}
+
+// migrateDedupBatch adds import_dedup.batch_id so undoing a batch can drop
+// its hashes. Hashes recorded before this are NULL.
+func migrateDedupBatch(conn *sql.DB) error {
+	var count int
+	err := conn.QueryRow("SELECT COUNT(*) FROM pragma_table_info('import_dedup') WHERE name='batch_id'").Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err = conn.Exec(`
+		ALTER TABLE import_dedup ADD COLUMN batch_id TEXT;
+		CREATE INDEX IF NOT EXISTS idx_import_dedup_batch ON import_dedup(batch_id);
+	`)
+	return err
+}
+
+// migrateEmbeddings adds the embedding index: one vector per command and
+// embedding model (little-endian float32), filled in the background by hxd.
+func migrateEmbeddings(conn *sql.DB) error {
+	_, err := conn.Exec(`
+		CREATE TABLE IF NOT EXISTS embeddings (
+			cmd_id INTEGER NOT NULL,
+			model TEXT NOT NULL,
+			dim INTEGER NOT NULL,
+			vec BLOB NOT NULL,
+			created_at REAL NOT NULL,
+			PRIMARY KEY (cmd_id, model)
+		);
+		CREATE INDEX IF NOT EXISTS idx_embeddings_model ON embeddings(model);
+	`)
+	return err
+}
+
 func migrateImport(conn *sql.DB) error {
 	// Check if events.origin exists (M7 already applied)
 	var count int
@@ -192,6 +305,25 @@ func migrateImport(conn *sql.DB) error {
 	return err
 }
 
+// migrateArtifactSeq adds artifacts.linked_seq: hx run saves output before
+// hxd has ingested the command it ran as, so the artifact names the event by
+// session and seq until ingest fills in linked_event_id.
+func migrateArtifactSeq(conn *sql.DB) error {
+	var count int
+	err := conn.QueryRow("SELECT COUNT(*) FROM pragma_table_info('artifacts') WHERE name='linked_seq'").Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err = conn.Exec(`
+		ALTER TABLE artifacts ADD COLUMN linked_seq INTEGER;
+		CREATE INDEX IF NOT EXISTS idx_artifacts_pending ON artifacts(linked_session_id, linked_seq) WHERE linked_event_id IS NULL AND linked_seq IS NOT NULL;
+	`)
+	return err
+}
+
 func migrateBlobsArtifacts(conn *sql.DB) error {
 	_, err := conn.Exec(`
 		CREATE TABLE IF NOT EXISTS blobs (
@@ -279,4 +411,48 @@ CREATE TABLE IF NOT EXISTS events (
 );
 CREATE INDEX IF NOT EXISTS idx_events_session_seq ON events(session_id, seq);
 CREATE INDEX IF NOT EXISTS idx_events_started ON events(started_at);
+CREATE INDEX IF NOT EXISTS idx_events_cmd ON events(cmd_id);
+CREATE INDEX IF NOT EXISTS idx_events_repo ON events(repo_root, git_branch);
 `
+
+// migrateTombstoneKeep adds applied_tombstones.keep_sessions (JSON list of
+// pinned sessions a tombstone spares) and sync_pending_tombstones, which holds
+// tombstones from hx forget until they reach the sync store.
+func migrateTombstoneKeep(conn *sql.DB) error {
+	if _, err := conn.Exec(`
+		CREATE TABLE IF NOT EXISTS sync_pending_tombstones (
+			pending_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			vault_id TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			queued_at REAL NOT NULL
+		);
+	`); err != nil {
+		return err
+	}
+	var count int
+	err := conn.QueryRow("SELECT COUNT(*) FROM pragma_table_info('applied_tombstones') WHERE name='keep_sessions'").Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err = conn.Exec("ALTER TABLE applied_tombstones ADD COLUMN keep_sessions TEXT")
+	return err
+}
+
+// migratePublishedState adds sync_published_events.state: the event's state
+// when it was pushed (NULL if completed). An interrupted or unknown event is
+// pushed again once a late post completes it.
+func migratePublishedState(conn *sql.DB) error {
+	var count int
+	err := conn.QueryRow("SELECT COUNT(*) FROM pragma_table_info('sync_published_events') WHERE name='state'").Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err = conn.Exec("ALTER TABLE sync_published_events ADD COLUMN state TEXT")
+	return err
+}
@@ -0,0 +1,222 @@
+// Package embedding keeps a persistent index of command embeddings: one
+// vector per distinct command (command_dict.cmd_id) and embedding model.
+// hxd fills it in the background with Backfill; semantic search ranks every
+// indexed command with Nearest instead of re-embedding FTS candidates.
+package embedding
+
+import (
+	"container/heap"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// maxTextLen caps the command text sent to the model; very long commands
+// (pasted heredocs) would exceed the model's context.
+const maxTextLen = 2000
+
+// Func embeds texts and returns one vector per text, in order.
+type Func func(ctx context.Context, texts []string) ([][]float32, error)
+
+// Match is an indexed command and its similarity to a query vector.
+type Match struct {
+	CmdID int64
+	Score float32
+}
+
+// Backfill embeds up to limit commands that have events but no vector for
+// model, newest first, and stores them. It returns how many it handled; 0
+// means the index is complete for model. When the batch fails, each command
+// is retried alone; one the model rejects while others succeed is stored as
+// an empty vector (dim 0) so it does not hold up the rest. Nearest and Stats
+// ignore those.
+func Backfill(ctx context.Context, db *sql.DB, model string, embed Func, limit int) (int, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT c.cmd_id, c.cmd_text FROM command_dict c
+		WHERE NOT EXISTS (SELECT 1 FROM embeddings m WHERE m.cmd_id = c.cmd_id AND m.model = ?)
+		  AND EXISTS (SELECT 1 FROM events e WHERE e.cmd_id = c.cmd_id)
+		ORDER BY c.cmd_id DESC
+		LIMIT ?
+	`, model, limit)
+	if err != nil {
+		return 0, fmt.Errorf("embedding backfill: %w", err)
+	}
+	var ids []int64
+	var texts []string
+	for rows.Next() {
+		var id int64
+		var text string
+		if err := rows.Scan(&id, &text); err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		if strings.TrimSpace(text) == "" {
+			text = "(empty)"
+		}
+		if len(text) > maxTextLen {
+			text = text[:maxTextLen]
+		}
+		ids = append(ids, id)
+		texts = append(texts, text)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	vecs, err := embed(ctx, texts)
+	if err == nil && len(vecs) != len(ids) {
+		err = fmt.Errorf("got %d vectors for %d commands", len(vecs), len(ids))
+	}
+	if err != nil {
+		if vecs, err = embedEach(ctx, embed, texts, err); err != nil {
+			return 0, fmt.Errorf("embedding backfill: %w", err)
+		}
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	now := float64(time.Now().Unix())
+	for i, id := range ids {
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO embeddings (cmd_id, model, dim, vec, created_at) VALUES (?, ?, ?, ?, ?)`,
+			id, model, len(vecs[i]), encodeVec(vecs[i]), now); err != nil {
+			return 0, fmt.Errorf("embedding backfill: %w", err)
+		}
+	}
+	return len(ids), tx.Commit()
+}
+
+// embedEach embeds texts one at a time after the batch failed with batchErr.
+// Texts that still fail get a nil vector. If none succeeds the model or server
+// is at fault rather than the texts, and batchErr is returned.
+func embedEach(ctx context.Context, embed Func, texts []string, batchErr error) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	ok := 0
+	for i, text := range texts {
+		v, err := embed(ctx, []string{text})
+		if err != nil || len(v) != 1 || len(v[0]) == 0 {
+			continue
+		}
+		out[i] = v[0]
+		ok++
+	}
+	if ok == 0 {
+		return nil, batchErr
+	}
+	return out, nil
+}
+
+// PruneModels deletes vectors from models other than model, so changing the
+// configured model re-indexes from scratch instead of mixing vector spaces.
+func PruneModels(db *sql.DB, model string) (int64, error) {
+	res, err := db.Exec(`DELETE FROM embeddings WHERE model != ?`, model)
+	if err != nil {
+		return 0, fmt.Errorf("embedding prune: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// Stats returns how many commands have a vector for model and how many
+// commands with events there are.
+func Stats(db *sql.DB, model string) (indexed, total int, err error) {
+	err = db.QueryRow(`
+		SELECT
+		  (SELECT COUNT(*) FROM embeddings WHERE model = ? AND dim > 0),
+		  (SELECT COUNT(DISTINCT cmd_id) FROM events WHERE cmd_id IS NOT NULL)
+	`, model).Scan(&indexed, &total)
+	return indexed, total, err
+}
+
+// Nearest returns the k indexed commands most similar to vec for model,
+// best first. It scans every vector for the model; vectors of another
+// dimension (a model swapped under the same name) are skipped.
+func Nearest(ctx context.Context, db *sql.DB, model string, vec []float32, k int) ([]Match, error) {
+	return NearestIn(ctx, db, model, vec, k, "")
+}
+
+// NearestIn is Nearest over the commands cmdIDs selects: a subquery
+// returning cmd_id (with args), so callers can apply their filters before
+// the top k are taken. An empty cmdIDs scans every command.
+func NearestIn(ctx context.Context, db *sql.DB, model string, vec []float32, k int, cmdIDs string, args ...interface{}) ([]Match, error) {
+	if k <= 0 || len(vec) == 0 {
+		return nil, nil
+	}
+	q := `SELECT cmd_id, vec FROM embeddings WHERE model = ? AND dim = ?`
+	qargs := []interface{}{model, len(vec)}
+	if cmdIDs != "" {
+		q += ` AND cmd_id IN (` + cmdIDs + `)`
+		qargs = append(qargs, args...)
+	}
+	rows, err := db.QueryContext(ctx, q, qargs...)
+	if err != nil {
+		return nil, fmt.Errorf("embedding search: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	h := &matchHeap{}
+	for rows.Next() {
+		var id int64
+		var blob []byte
+		if err := rows.Scan(&id, &blob); err != nil {
+			return nil, err
+		}
+		score := dot(vec, blob)
+		if h.Len() < k {
+			heap.Push(h, Match{CmdID: id, Score: score})
+		} else if score > (*h)[0].Score {
+			(*h)[0] = Match{CmdID: id, Score: score}
+			heap.Fix(h, 0)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	out := make([]Match, h.Len())
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = heap.Pop(h).(Match)
+	}
+	return out, nil
+}
+
+// dot is the dot product of a and an encoded vector: cosine similarity for
+// the L2-normalized vectors llm providers return.
+func dot(a []float32, blob []byte) float32 {
+	if len(blob) != 4*len(a) {
+		return 0
+	}
+	var sum float64
+	for i, x := range a {
+		sum += float64(x * math.Float32frombits(binary.LittleEndian.Uint32(blob[4*i:])))
+	}
+	return float32(sum)
+}
+
+func encodeVec(v []float32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(x))
+	}
+	return b
+}
+
+// matchHeap is a min-heap on Score, holding the best k matches seen.
+type matchHeap []Match
+
+func (h matchHeap) Len() int            { return len(h) }
+func (h matchHeap) Less(i, j int) bool  { return h[i].Score < h[j].Score }
+func (h matchHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *matchHeap) Push(x interface{}) { *h = append(*h, x.(Match)) }
+func (h *matchHeap) Pop() interface{} {
+	old := *h
+	m := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return m
+}
@@ -0,0 +1,162 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mrcawood/History_eXtended/internal/db"
+	"github.com/mrcawood/History_eXtended/internal/store"
+)
+
+// fakeEmbed maps texts onto three axes: git, make, everything else.
+func fakeEmbed(calls *int) Func {
+	return func(ctx context.Context, texts []string) ([][]float32, error) {
+		*calls++
+		out := make([][]float32, len(texts))
+		for i, t := range texts {
+			switch {
+			case strings.Contains(t, "git"):
+				out[i] = []float32{1, 0, 0}
+			case strings.Contains(t, "make"):
+				out[i] = []float32{0, 1, 0}
+			default:
+				out[i] = []float32{0, 0, 1}
+			}
+		}
+		return out, nil
+	}
+}
+
+func TestBackfillAndNearest(t *testing.T) {
+	conn, err := db.Open(filepath.Join(t.TempDir(), "hx.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	st := store.New(conn)
+	if err := st.EnsureSession("s1", "h", "pts/0", "/", 1); err != nil {
+		t.Fatal(err)
+	}
+	for i, cmd := range []string{"git status", "make build", "ls -la", "git push"} {
+		cmdID, err := st.CmdID(cmd, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := st.InsertEvent(
+			&store.PreEvent{T: "pre", Ts: float64(i + 1), Sid: "s1", Seq: i + 1, Cmd: cmd, Cwd: "/", Host: "h"},
+			&store.PostEvent{T: "post", Ts: float64(i + 1), Sid: "s1", Seq: i + 1},
+			cmdID,
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A command without events is not indexed
+	if _, err := st.CmdID("orphan", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	calls := 0
+	n, err := Backfill(ctx, conn, "m1", fakeEmbed(&calls), 3)
+	if err != nil || n != 3 {
+		t.Fatalf("Backfill = %d, %v; want 3", n, err)
+	}
+	n, err = Backfill(ctx, conn, "m1", fakeEmbed(&calls), 3)
+	if err != nil || n != 1 {
+		t.Fatalf("second Backfill = %d, %v; want 1", n, err)
+	}
+	n, err = Backfill(ctx, conn, "m1", fakeEmbed(&calls), 3)
+	if err != nil || n != 0 || calls != 2 {
+		t.Fatalf("Backfill when complete = %d, %v (calls %d); want 0 without calling the model", n, err, calls)
+	}
+	indexed, total, err := Stats(conn, "m1")
+	if err != nil || indexed != 4 || total != 4 {
+		t.Errorf("Stats = %d/%d, %v; want 4/4", indexed, total, err)
+	}
+
+	matches, err := Nearest(ctx, conn, "m1", []float32{1, 0, 0}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 || matches[0].Score != 1 || matches[1].Score != 1 {
+		t.Fatalf("Nearest(git) = %+v, want the two git commands", matches)
+	}
+	var text string
+	_ = conn.QueryRow(`SELECT cmd_text FROM command_dict WHERE cmd_id = ?`, matches[0].CmdID).Scan(&text)
+	if !strings.HasPrefix(text, "git ") {
+		t.Errorf("best match = %q, want a git command", text)
+	}
+	if m, _ := Nearest(ctx, conn, "m1", []float32{1, 0}, 5); len(m) != 0 {
+		t.Errorf("Nearest with another dimension = %+v, want none", m)
+	}
+
+	// A model change drops the old vectors and re-indexes everything
+	if _, err := PruneModels(conn, "m2"); err != nil {
+		t.Fatal(err)
+	}
+	if indexed, _, _ := Stats(conn, "m1"); indexed != 0 {
+		t.Errorf("m1 vectors left after switching model: %d", indexed)
+	}
+	if n, err := Backfill(ctx, conn, "m2", fakeEmbed(&calls), 10); err != nil || n != 4 {
+		t.Errorf("Backfill(m2) = %d, %v; want 4", n, err)
+	}
+}
+
+func TestBackfillSkipsRejectedCommand(t *testing.T) {
+	conn, err := db.Open(filepath.Join(t.TempDir(), "hx.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	st := store.New(conn)
+	if err := st.EnsureSession("s1", "h", "pts/0", "/", 1); err != nil {
+		t.Fatal(err)
+	}
+	for i, cmd := range []string{"git status", "cat \xff\xfe", "make build"} {
+		cmdID, err := st.CmdID(cmd, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := st.InsertEvent(
+			&store.PreEvent{T: "pre", Ts: float64(i + 1), Sid: "s1", Seq: i + 1, Cmd: cmd, Cwd: "/", Host: "h"},
+			&store.PostEvent{T: "post", Ts: float64(i + 1), Sid: "s1", Seq: i + 1},
+			cmdID,
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+	calls := 0
+	good := fakeEmbed(&calls)
+	// The model rejects any request containing the binary command
+	picky := func(ctx context.Context, texts []string) ([][]float32, error) {
+		for _, t := range texts {
+			if strings.Contains(t, "\xff") {
+				return nil, fmt.Errorf("invalid input")
+			}
+		}
+		return good(ctx, texts)
+	}
+	down := func(ctx context.Context, texts []string) ([][]float32, error) {
+		return nil, fmt.Errorf("connection refused")
+	}
+
+	if n, err := Backfill(ctx, conn, "m1", down, 10); err == nil || n != 0 {
+		t.Fatalf("Backfill with the server down = %d, %v; want an error", n, err)
+	}
+	if n, err := Backfill(ctx, conn, "m1", picky, 10); err != nil || n != 3 {
+		t.Fatalf("Backfill = %d, %v; want 3 handled", n, err)
+	}
+	if n, err := Backfill(ctx, conn, "m1", picky, 10); err != nil || n != 0 {
+		t.Fatalf("Backfill after skipping = %d, %v; want 0 (rejected command not retried)", n, err)
+	}
+	if indexed, total, _ := Stats(conn, "m1"); indexed != 2 || total != 3 {
+		t.Errorf("Stats = %d/%d, want 2/3", indexed, total)
+	}
+	if m, _ := Nearest(ctx, conn, "m1", []float32{0, 0, 1}, 5); len(m) != 2 {
+		t.Errorf("Nearest = %+v, want only the two embedded commands", m)
+	}
+}
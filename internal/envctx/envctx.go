@@ -0,0 +1,187 @@
+// Package envctx records a configured set of environment variables with each
+// command (AWS_PROFILE, KUBECONFIG, VIRTUAL_ENV, ...). Shell hooks ask
+// hx-emit for the spec once per shell (hx-emit env-spec) and hand it back in
+// HX_ENV_CAPTURE on every call, so hx-emit never loads config on the hot
+// path. hx-emit reads the listed variables from the environment it inherits
+// from the shell and hashes the sensitive ones before anything leaves it.
+package envctx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mrcawood/History_eXtended/internal/config"
+)
+
+// SpecVar is the variable hooks pass the spec to hx-emit in.
+const SpecVar = "HX_ENV_CAPTURE"
+
+const (
+	hashSuffix  = ":hash"   // spec marker for a hashed variable
+	hashPrefix  = "sha256:" // stored value of a hashed variable
+	hashLen     = 16        // hex digits of the digest kept
+	maxValueLen = 1024      // longer values are cut; a PATH-sized value is not context
+)
+
+// Var is one variable of a spec.
+type Var struct {
+	Name string
+	Hash bool
+}
+
+// Spec renders cfg as the space-separated spec hooks pass to hx-emit, e.g.
+// "AWS_PROFILE KUBECONFIG VAULT_TOKEN:hash". A name in both lists is hashed.
+// Invalid names are left out and reported in the error.
+func Spec(cfg config.EnvConfig) (string, error) {
+	hashed := make(map[string]bool, len(cfg.Hash))
+	for _, n := range cfg.Hash {
+		hashed[n] = true
+	}
+	var parts, bad []string
+	seen := make(map[string]bool)
+	for _, n := range append(append([]string{}, cfg.Capture...), cfg.Hash...) {
+		if seen[n] {
+			continue
+		}
+		seen[n] = true
+		if !ValidName(n) {
+			bad = append(bad, fmt.Sprintf("%q", n))
+			continue
+		}
+		if hashed[n] {
+			n += hashSuffix
+		}
+		parts = append(parts, n)
+	}
+	spec := strings.Join(parts, " ")
+	if len(bad) > 0 {
+		return spec, fmt.Errorf("env: invalid variable names %s", strings.Join(bad, ", "))
+	}
+	return spec, nil
+}
+
+// ParseSpec parses a spec from Spec. Invalid entries are skipped.
+func ParseSpec(spec string) []Var {
+	var out []Var
+	for _, f := range strings.Fields(spec) {
+		name, hash := strings.CutSuffix(f, hashSuffix)
+		if ValidName(name) {
+			out = append(out, Var{Name: name, Hash: hash})
+		}
+	}
+	return out
+}
+
+// Capture looks up the variables of spec and returns the set ones, hashed
+// where the spec says so, or nil when none is set.
+func Capture(spec string, lookup func(string) (string, bool)) map[string]string {
+	var out map[string]string
+	for _, v := range ParseSpec(spec) {
+		val, ok := lookup(v.Name)
+		if !ok {
+			continue
+		}
+		switch {
+		case v.Hash:
+			val = Hash(val)
+		case len(val) > maxValueLen:
+			val = val[:maxValueLen]
+		}
+		if out == nil {
+			out = make(map[string]string)
+		}
+		out[v.Name] = val
+	}
+	return out
+}
+
+// Hash is the stored form of a hashed variable: equal values hash alike, so
+// "was it the same token?" stays answerable without keeping the token.
+func Hash(val string) string {
+	sum := sha256.Sum256([]byte(val))
+	return hashPrefix + hex.EncodeToString(sum[:])[:hashLen]
+}
+
+// IsHashed reports whether a stored value is a Hash.
+func IsHashed(val string) bool {
+	return strings.HasPrefix(val, hashPrefix) && len(val) == len(hashPrefix)+hashLen
+}
+
+// ValidName reports whether s is a portable environment variable name.
+func ValidName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// extra is the events.extra_json layout for captured events.
+type extra struct {
+	Env map[string]string `json:"env,omitempty"`
+}
+
+// ExtraJSON returns env as events.extra_json, or "" when env is empty.
+func ExtraJSON(env map[string]string) string {
+	if len(env) == 0 {
+		return ""
+	}
+	b, err := json.Marshal(extra{Env: env})
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// FromExtra returns the variables recorded in an events.extra_json value.
+// Other keys (import metadata) are ignored.
+func FromExtra(extraJSON string) map[string]string {
+	if extraJSON == "" {
+		return nil
+	}
+	var x extra
+	if err := json.Unmarshal([]byte(extraJSON), &x); err != nil {
+		return nil
+	}
+	return x.Env
+}
+
+// Names returns the keys of env in sorted order, for display.
+func Names(env map[string]string) []string {
+	names := make([]string, 0, len(env))
+	for n := range env {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SQLFilter returns an " AND ..." clause over events e matching events whose
+// recorded variable name is set (op ""), equal to value (op "=") or set to
+// something else (op "!="). Values match hashed variables too. Empty when
+// name is empty.
+func SQLFilter(name, op, value string) (string, []interface{}) {
+	if name == "" {
+		return "", nil
+	}
+	path := "$.env." + name
+	switch op {
+	case "=":
+		return " AND json_extract(e.extra_json, ?) IN (?, ?)", []interface{}{path, value, Hash(value)}
+	case "!=":
+		return " AND json_extract(e.extra_json, ?) NOT IN (?, ?)", []interface{}{path, value, Hash(value)}
+	default:
+		return " AND json_extract(e.extra_json, ?) IS NOT NULL", []interface{}{path}
+	}
+}
@@ -0,0 +1,57 @@
+package envctx
+
+import (
+	"testing"
+
+	"github.com/mrcawood/History_eXtended/internal/config"
+)
+
+func TestSpecRoundTrip(t *testing.T) {
+	spec, err := Spec(config.EnvConfig{
+		Capture: []string{"AWS_PROFILE", "KUBECONFIG", "VAULT_TOKEN", "AWS_PROFILE"},
+		Hash:    []string{"VAULT_TOKEN", "GITHUB_TOKEN", "1BAD"},
+	})
+	if err == nil {
+		t.Error("invalid name 1BAD: want error")
+	}
+	if spec != "AWS_PROFILE KUBECONFIG VAULT_TOKEN:hash GITHUB_TOKEN:hash" {
+		t.Fatalf("Spec = %q", spec)
+	}
+	vars := ParseSpec(spec + " bad-name :hash")
+	if len(vars) != 4 || vars[2] != (Var{Name: "VAULT_TOKEN", Hash: true}) || vars[0].Hash {
+		t.Fatalf("ParseSpec = %+v", vars)
+	}
+}
+
+func TestCapture(t *testing.T) {
+	env := map[string]string{"AWS_PROFILE": "prod", "VAULT_TOKEN": "s3cr3t", "EMPTY": ""}
+	lookup := func(k string) (string, bool) { v, ok := env[k]; return v, ok }
+
+	got := Capture("AWS_PROFILE VAULT_TOKEN:hash EMPTY UNSET", lookup)
+	if len(got) != 3 || got["AWS_PROFILE"] != "prod" || got["EMPTY"] != "" {
+		t.Fatalf("Capture = %v", got)
+	}
+	if got["VAULT_TOKEN"] != Hash("s3cr3t") || !IsHashed(got["VAULT_TOKEN"]) {
+		t.Fatalf("hashed value = %q", got["VAULT_TOKEN"])
+	}
+	if Capture("", lookup) != nil || Capture("UNSET", lookup) != nil {
+		t.Error("nothing captured: want nil")
+	}
+}
+
+func TestExtraJSON(t *testing.T) {
+	if ExtraJSON(nil) != "" {
+		t.Error("empty env: want no extra_json")
+	}
+	env := map[string]string{"KUBECONFIG": "/k/prod", "AWS_PROFILE": "prod"}
+	got := FromExtra(ExtraJSON(env))
+	if len(got) != 2 || got["KUBECONFIG"] != "/k/prod" {
+		t.Fatalf("FromExtra(ExtraJSON) = %v", got)
+	}
+	if FromExtra(`{"fish_path":"/x"}`) != nil || FromExtra("not json") != nil {
+		t.Error("extra_json without env: want nil")
+	}
+	if n := Names(env); n[0] != "AWS_PROFILE" || n[1] != "KUBECONFIG" {
+		t.Errorf("Names = %v", n)
+	}
+}
@@ -0,0 +1,83 @@
+// Package exitcode interprets shell exit statuses: signal terminations
+// (128+N) and per-stage pipeline statuses.
+package exitcode
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// sigPipe is 128+SIGPIPE: an upstream stage killed because a downstream
+// stage stopped reading (e.g. `yes | head`). Not a failure.
+const sigPipe = 128 + 13
+
+// signalNames maps POSIX signal numbers (Linux numbering) to names.
+var signalNames = map[int]string{
+	1: "SIGHUP", 2: "SIGINT", 3: "SIGQUIT", 4: "SIGILL", 5: "SIGTRAP",
+	6: "SIGABRT", 7: "SIGBUS", 8: "SIGFPE", 9: "SIGKILL", 10: "SIGUSR1",
+	11: "SIGSEGV", 12: "SIGUSR2", 13: "SIGPIPE", 14: "SIGALRM", 15: "SIGTERM",
+	24: "SIGXCPU", 25: "SIGXFSZ", 31: "SIGSYS",
+}
+
+// SignalName returns the signal name for a 128+N exit status, or "".
+func SignalName(exit int) string {
+	if exit <= 128 {
+		return ""
+	}
+	return signalNames[exit-128]
+}
+
+// Signal returns the signal that terminated the command: from the final exit
+// status, else from the first pipeline stage killed by a signal other than
+// SIGPIPE. Returns "" when no signal was involved.
+func Signal(exit int, pipe []int) string {
+	if s := SignalName(exit); s != "" {
+		return s
+	}
+	for _, st := range pipe {
+		if st == sigPipe {
+			continue
+		}
+		if s := SignalName(st); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// Failed reports whether the command failed: non-zero exit status, or any
+// pipeline stage that failed (SIGPIPE in a non-final stage is ignored).
+func Failed(exit int, pipe []int) bool {
+	if exit != 0 {
+		return true
+	}
+	for i, st := range pipe {
+		if st == 0 || (st == sigPipe && i < len(pipe)-1) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// ParsePipe decodes pipe_status_json; malformed or empty input yields nil.
+func ParsePipe(s string) []int {
+	var pipe []int
+	if s == "" || json.Unmarshal([]byte(s), &pipe) != nil {
+		return nil
+	}
+	return pipe
+}
+
+// FormatPipe renders pipeline statuses as "1,0" (empty for a single command).
+func FormatPipe(pipe []int) string {
+	if len(pipe) < 2 {
+		return ""
+	}
+	parts := make([]string, len(pipe))
+	for i, st := range pipe {
+		parts[i] = strconv.Itoa(st)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,57 @@
+package exitcode
+
+import "testing"
+
+func TestSignal(t *testing.T) {
+	tests := []struct {
+		exit int
+		pipe []int
+		want string
+	}{
+		{0, nil, ""},
+		{1, nil, ""},
+		{130, nil, "SIGINT"},
+		{137, []int{137}, "SIGKILL"},
+		{0, []int{141, 0}, ""},        // SIGPIPE upstream is normal
+		{0, []int{143, 0}, "SIGTERM"}, // upstream killed
+		{200, nil, ""},                // unknown signal number
+	}
+	for _, tt := range tests {
+		if got := Signal(tt.exit, tt.pipe); got != tt.want {
+			t.Errorf("Signal(%d, %v) = %q, want %q", tt.exit, tt.pipe, got, tt.want)
+		}
+	}
+}
+
+func TestFailed(t *testing.T) {
+	tests := []struct {
+		exit int
+		pipe []int
+		want bool
+	}{
+		{0, nil, false},
+		{0, []int{0}, false},
+		{2, []int{2}, true},
+		{0, []int{2, 0}, true},    // make | tee log
+		{0, []int{141, 0}, false}, // yes | head
+		{141, []int{0, 141}, true},
+		{130, nil, true},
+	}
+	for _, tt := range tests {
+		if got := Failed(tt.exit, tt.pipe); got != tt.want {
+			t.Errorf("Failed(%d, %v) = %v, want %v", tt.exit, tt.pipe, got, tt.want)
+		}
+	}
+}
+
+func TestParseFormatPipe(t *testing.T) {
+	if got := FormatPipe(ParsePipe("[1,0]")); got != "1,0" {
+		t.Errorf("FormatPipe = %q, want 1,0", got)
+	}
+	if got := FormatPipe(ParsePipe("[0]")); got != "" {
+		t.Errorf("single stage FormatPipe = %q, want empty", got)
+	}
+	if ParsePipe("not json") != nil || ParsePipe("") != nil {
+		t.Error("ParsePipe should return nil for malformed/empty input")
+	}
+}
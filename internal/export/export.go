@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/mrcawood/History_eXtended/internal/artifact"
+	"github.com/mrcawood/History_eXtended/internal/redact"
 )
 
 // SessionExport holds session + events + artifacts for export.
@@ -32,12 +33,18 @@ type ArtifactRef struct {
 	BlobPath   string
 }
 
-// Redact applies Skeletonize to text when redact is true.
-func Redact(text string, redact bool) string {
-	if !redact {
+// Redact masks secrets with the built-in detectors and applies Skeletonize
+// when on is true.
+func Redact(text string, on bool) string {
+	if !on {
 		return text
 	}
-	return artifact.Skeletonize(text)
+	return RedactWith(redact.Default(), text)
+}
+
+// RedactWith masks the secrets r finds in text, then applies Skeletonize.
+func RedactWith(r *redact.Redactor, text string) string {
+	return artifact.Skeletonize(r.Redact(text))
 }
 
 // ExportSession loads session export data.
@@ -86,8 +93,19 @@ func ExportSession(conn *sql.DB, sessionID string) (*SessionExport, error) {
 	}, nil
 }
 
-// Markdown formats the export as markdown.
-func Markdown(exp *SessionExport, redact bool) string {
+// Markdown formats the export as markdown, redacted with the built-in
+// detectors when redacted is true.
+func Markdown(exp *SessionExport, redacted bool) string {
+	var r *redact.Redactor
+	if redacted {
+		r = redact.Default()
+	}
+	return MarkdownWith(exp, r)
+}
+
+// MarkdownWith formats the export as markdown, redacting commands and cwds
+// with r unless r is nil.
+func MarkdownWith(exp *SessionExport, r *redact.Redactor) string {
 	var b strings.Builder
 	b.WriteString("# Session Export\n\n")
 	b.WriteString(fmt.Sprintf("- **Session:** %s\n", exp.SessionID))
@@ -95,8 +113,10 @@ func Markdown(exp *SessionExport, redact bool) string {
 	b.WriteString(fmt.Sprintf("- **Started:** %.0f\n\n", exp.StartedAt))
 	b.WriteString("## Events\n\n")
 	for _, e := range exp.Events {
-		cmd := Redact(e.Cmd, redact)
-		cwd := Redact(e.Cwd, redact)
+		cmd, cwd := e.Cmd, e.Cwd
+		if r != nil {
+			cmd, cwd = RedactWith(r, cmd), RedactWith(r, cwd)
+		}
 		b.WriteString(fmt.Sprintf("- [%d] exit=%d  %s\n", e.Seq, e.ExitCode, cmd))
 		if cwd != "" {
 			b.WriteString(fmt.Sprintf("  cwd: %s\n", cwd))
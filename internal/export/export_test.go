@@ -21,6 +21,9 @@ func TestRedact(t *testing.T) {
 		{"run at 1707734400.123", true, "run at <TS>"},
 		{"error at 0x7f8b2c3d4e5f", true, "error at <ADDR>"},
 		{"pid 12345 failed", true, "pid <ID> failed"},
+		{"mysql -u root -pS3cret", false, "mysql -u root -pS3cret"},
+		{"mysql -u root -pS3cret", true, "mysql -u root -p<REDACTED:password>"},
+		{"curl -H 'Authorization: Bearer abc123def456ghi' at 1707734400", true, "curl -H 'Authorization: Bearer <REDACTED:bearer>' at <TS>"},
 	}
 	for _, tt := range tests {
 		got := Redact(tt.text, tt.redact)
@@ -1,42 +1,285 @@
+// Package filter decides which commands are recorded. Rules come from
+// config (ignore_patterns, ignore_rules, ignore_space, allowlist_mode) and
+// from a .hxignore file at the root of the git repo a command runs in.
 package filter
 
 import (
+	"bufio"
+	"fmt"
+	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/mrcawood/History_eXtended/internal/config"
+	"github.com/mrcawood/History_eXtended/internal/gitctx"
+	"github.com/mrcawood/History_eXtended/internal/redact"
 )
 
-// ShouldCapture returns false if the command should be skipped (ignored or not allowlisted).
-func ShouldCapture(cmd string, cfg *config.Config) bool {
-	if cfg == nil {
-		return true
+// IgnoreFile is the per-repo ignore file hxd reads from the repo root.
+const IgnoreFile = ".hxignore"
+
+// Rule is one reason not to record a command. A command matches when every
+// pattern set on the rule matches; rules with no pattern (empty command,
+// leading space, allowlist) are built-in checks described by Source alone.
+type Rule struct {
+	Source string // where the rule comes from: ignore_rules[1], /repo/.hxignore:3, ...
+	Glob   string
+	Regex  *regexp.Regexp
+	Cwd    string
+	Host   string
+}
+
+func (r *Rule) String() string {
+	var parts []string
+	if r.Glob != "" {
+		parts = append(parts, "glob "+r.Glob)
 	}
-	cmd = strings.TrimSpace(cmd)
-	if cmd == "" {
+	if r.Regex != nil {
+		parts = append(parts, "regex "+r.Regex.String())
+	}
+	if r.Cwd != "" {
+		parts = append(parts, "cwd "+r.Cwd)
+	}
+	if r.Host != "" {
+		parts = append(parts, "host "+r.Host)
+	}
+	if len(parts) == 0 {
+		return r.Source
+	}
+	return r.Source + ": " + strings.Join(parts, ", ")
+}
+
+func (r *Rule) match(cmd, cwd, host string) bool {
+	if r.Glob != "" {
+		if ok, err := filepath.Match(r.Glob, cmd); err != nil || !ok {
+			return false
+		}
+	}
+	if r.Regex != nil && !r.Regex.MatchString(cmd) {
 		return false
 	}
-	for _, pattern := range cfg.IgnorePatterns {
-		matched, err := filepath.Match(pattern, cmd)
-		if err == nil && matched {
+	if r.Cwd != "" && !underDir(cwd, r.Cwd) {
+		return false
+	}
+	if r.Host != "" {
+		if ok, err := filepath.Match(r.Host, host); err != nil || !ok {
 			return false
 		}
 	}
+	return true
+}
+
+// Filter holds the compiled config rules and caches .hxignore files by repo
+// root. It is safe for concurrent use.
+type Filter struct {
+	ignoreSpace bool
+	rules       []Rule
+	allowlist   bool
+	bins        map[string]bool
+
+	mu       sync.Mutex
+	ignFiles map[string]ignoreFile
+}
+
+// ignoreFile is a parsed .hxignore and the mtime it was read at.
+type ignoreFile struct {
+	mtime time.Time
+	rules []Rule
+}
+
+// New compiles cfg's filter rules. A nil cfg records everything but empty
+// and space-prefixed commands. Broken rules are skipped and reported in the
+// error, but the Filter is always usable and keeps every rule that compiled:
+// one typo must not start recording what the other rules keep out.
+func New(cfg *config.Config) (*Filter, error) {
+	f := &Filter{ignoreSpace: true, ignFiles: make(map[string]ignoreFile)}
+	if cfg == nil {
+		return f, nil
+	}
+	f.ignoreSpace = cfg.IgnoreSpace
+	for _, p := range cfg.IgnorePatterns {
+		f.rules = append(f.rules, Rule{Source: "ignore_patterns", Glob: p})
+	}
+	var bad []string
+	for i, ir := range cfg.IgnoreRules {
+		src := fmt.Sprintf("ignore_rules[%d]", i)
+		if ir.Name != "" {
+			src += " " + ir.Name
+		}
+		r := Rule{Source: src, Glob: ir.Glob, Cwd: expandHome(ir.Cwd), Host: ir.Host}
+		if ir.Regex != "" {
+			re, err := regexp.Compile(ir.Regex)
+			if err != nil {
+				bad = append(bad, fmt.Sprintf("%s: %v", src, err))
+				continue
+			}
+			r.Regex = re
+		}
+		if r.Glob == "" && r.Regex == nil && r.Cwd == "" && r.Host == "" {
+			bad = append(bad, src+": needs glob, regex, cwd or host")
+			continue
+		}
+		f.rules = append(f.rules, r)
+	}
 	if cfg.AllowlistMode {
-		if len(cfg.AllowlistBins) == 0 {
-			return false
+		f.allowlist = true
+		f.bins = make(map[string]bool, len(cfg.AllowlistBins))
+		for _, b := range cfg.AllowlistBins {
+			f.bins[b] = true
 		}
-		first := strings.Fields(cmd)
-		if len(first) == 0 {
-			return false
+	}
+	if len(bad) > 0 {
+		return f, fmt.Errorf("filter: skipped %s", strings.Join(bad, "; "))
+	}
+	return f, nil
+}
+
+// Match returns the rule that keeps cmd, run in cwd on host, out of history,
+// or nil when it should be recorded.
+func (f *Filter) Match(cmd, cwd, host string) *Rule {
+	if f.ignoreSpace && strings.HasPrefix(cmd, " ") {
+		return &Rule{Source: "ignore_space (leading space)"}
+	}
+	cmd = strings.TrimSpace(cmd)
+	if cmd == "" {
+		return &Rule{Source: "empty command"}
+	}
+	for i := range f.rules {
+		if f.rules[i].match(cmd, cwd, host) {
+			return &f.rules[i]
 		}
-		bin := filepath.Base(first[0])
-		for _, allowed := range cfg.AllowlistBins {
-			if bin == allowed {
-				return true
+	}
+	if cwd != "" {
+		if root := gitctx.Resolve(cwd).Root; root != "" {
+			rules := f.repoRules(root)
+			for i := range rules {
+				if rules[i].match(cmd, cwd, host) {
+					return &rules[i]
+				}
 			}
 		}
-		return false
 	}
-	return true
+	if f.allowlist {
+		bin := filepath.Base(strings.Fields(cmd)[0])
+		if !f.bins[bin] {
+			return &Rule{Source: fmt.Sprintf("allowlist_mode (%s not in allowlist_bins)", bin)}
+		}
+	}
+	return nil
+}
+
+// Admit is the capture-time decision for one command: filter rules first,
+// then secret scrubbing with scrub (nil for none). It returns the command to
+// record and false when nothing should be recorded.
+func (f *Filter) Admit(cmd, cwd, host string, scrub *redact.Redactor) (string, bool) {
+	if f.Match(cmd, cwd, host) != nil {
+		return "", false
+	}
+	if scrub == nil {
+		return cmd, true
+	}
+	return scrub.Scrub(cmd)
+}
+
+// repoRules returns the rules of root's .hxignore, re-reading it when its
+// mtime changes.
+func (f *Filter) repoRules(root string) []Rule {
+	path := filepath.Join(root, IgnoreFile)
+	fi, err := os.Stat(path)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err != nil {
+		delete(f.ignFiles, root)
+		return nil
+	}
+	if cached, ok := f.ignFiles[root]; ok && cached.mtime.Equal(fi.ModTime()) {
+		return cached.rules
+	}
+	rules, _ := ParseIgnoreFile(path)
+	f.ignFiles[root] = ignoreFile{mtime: fi.ModTime(), rules: rules}
+	return rules
+}
+
+// ParseIgnoreFile reads a .hxignore. One rule per line: a shell glob on the
+// command, "re:<regexp>" searched in the command, or "dir:<path>" for
+// everything run under path (relative to the repo root). Blank lines and
+// lines starting with # are skipped. Bad lines are skipped too and reported
+// in the error, so one typo does not disable the rest of the file.
+func ParseIgnoreFile(path string) ([]Rule, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = fh.Close() }()
+	root := filepath.Dir(path)
+	var rules []Rule
+	var bad []string
+	sc := bufio.NewScanner(fh)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r := Rule{Source: fmt.Sprintf("%s:%d", path, n)}
+		switch {
+		case strings.HasPrefix(line, "re:"):
+			re, err := regexp.Compile(strings.TrimSpace(line[3:]))
+			if err != nil {
+				bad = append(bad, fmt.Sprintf("line %d: %v", n, err))
+				continue
+			}
+			r.Regex = re
+		case strings.HasPrefix(line, "dir:"):
+			dir := strings.TrimSpace(line[4:])
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(root, dir)
+			}
+			r.Cwd = filepath.Clean(dir)
+		default:
+			if _, err := filepath.Match(line, ""); err != nil {
+				bad = append(bad, fmt.Sprintf("line %d: %v", n, err))
+				continue
+			}
+			r.Glob = line
+		}
+		rules = append(rules, r)
+	}
+	if err := sc.Err(); err != nil {
+		return rules, err
+	}
+	if len(bad) > 0 {
+		return rules, fmt.Errorf("%s: %s", path, strings.Join(bad, "; "))
+	}
+	return rules, nil
+}
+
+// underDir reports whether path is dir or inside it.
+func underDir(path, dir string) bool {
+	dir = strings.TrimSuffix(dir, "/")
+	return path == dir || strings.HasPrefix(path, dir+"/")
+}
+
+// expandHome expands a leading ~ or $HOME in a config path.
+func expandHome(p string) string {
+	if p == "" {
+		return ""
+	}
+	home, _ := os.UserHomeDir()
+	switch {
+	case p == "~":
+		p = home
+	case strings.HasPrefix(p, "~/"):
+		p = filepath.Join(home, p[2:])
+	default:
+		p = os.Expand(p, func(k string) string {
+			if k == "HOME" {
+				return home
+			}
+			return os.Getenv(k)
+		})
+	}
+	return filepath.Clean(p)
 }
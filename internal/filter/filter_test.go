@@ -0,0 +1,210 @@
+package filter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrcawood/History_eXtended/internal/config"
+	"github.com/mrcawood/History_eXtended/internal/redact"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMatchConfigRules(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	cfg := &config.Config{
+		IgnoreSpace:    true,
+		IgnorePatterns: []string{"*password*"},
+		IgnoreRules: []config.IgnoreRule{
+			{Name: "kube", Regex: `^kubectl .*secret`},
+			{Name: "acme", Cwd: "~/clients/acme"},
+			{Glob: "vault *", Host: "prod-*"},
+		},
+	}
+	f, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	acme := filepath.Join(home, "clients", "acme")
+	tests := []struct {
+		cmd, cwd, host string
+		want           string // rule Source prefix, "" for recorded
+	}{
+		{"make test", "/tmp", "laptop", ""},
+		{" make test", "/tmp", "laptop", "ignore_space"},
+		{"   ", "/tmp", "laptop", "ignore_space"},
+		{"", "/tmp", "laptop", "empty command"},
+		{"echo password123", "/tmp", "laptop", "ignore_patterns"},
+		{"kubectl get secret db", "/tmp", "laptop", "ignore_rules[0] kube"},
+		{"kubectl get pods", "/tmp", "laptop", ""},
+		{"ls", acme, "laptop", "ignore_rules[1] acme"},
+		{"ls", filepath.Join(acme, "src"), "laptop", "ignore_rules[1] acme"},
+		{"ls", acme + "-other", "laptop", ""},
+		{"vault read x", "/tmp", "prod-db1", "ignore_rules[2]"},
+		{"vault read x", "/tmp", "laptop", ""},
+	}
+	for _, tt := range tests {
+		r := f.Match(tt.cmd, tt.cwd, tt.host)
+		switch {
+		case tt.want == "" && r != nil:
+			t.Errorf("Match(%q, %q, %q) = %s, want recorded", tt.cmd, tt.cwd, tt.host, r)
+		case tt.want != "" && (r == nil || !strings.HasPrefix(r.Source, tt.want)):
+			t.Errorf("Match(%q, %q, %q) = %v, want %s", tt.cmd, tt.cwd, tt.host, r, tt.want)
+		}
+	}
+}
+
+func TestMatchIgnoreSpaceOff(t *testing.T) {
+	f, err := New(&config.Config{IgnoreSpace: false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := f.Match(" make test", "/tmp", "h"); r != nil {
+		t.Errorf("Match = %s, want recorded with ignore_space off", r)
+	}
+	if r := f.Match(" ", "/tmp", "h"); r == nil || r.Source != "empty command" {
+		t.Errorf("Match(blank) = %v, want empty command", r)
+	}
+}
+
+func TestMatchAllowlist(t *testing.T) {
+	f, err := New(&config.Config{IgnoreSpace: true, AllowlistMode: true, AllowlistBins: []string{"make", "git"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := f.Match("/usr/bin/make -j8", "/tmp", "h"); r != nil {
+		t.Errorf("make: %s", r)
+	}
+	if r := f.Match("ls -la", "/tmp", "h"); r == nil || !strings.HasPrefix(r.Source, "allowlist_mode") {
+		t.Errorf("ls: got %v, want allowlist_mode", r)
+	}
+}
+
+func TestNewInvalidRules(t *testing.T) {
+	if _, err := New(&config.Config{IgnoreRules: []config.IgnoreRule{{Name: "bad", Regex: "("}}}); err == nil {
+		t.Error("bad regex: want error")
+	}
+	if _, err := New(&config.Config{IgnoreRules: []config.IgnoreRule{{Name: "empty"}}}); err == nil {
+		t.Error("rule without patterns: want error")
+	}
+	f, err := New(&config.Config{
+		IgnoreRules: []config.IgnoreRule{
+			{Name: "bad", Regex: "("},
+			{Name: "acme", Cwd: "/home/me/clients/acme"},
+			{Name: "vault", Regex: "^vault "},
+		},
+		AllowlistMode: true,
+		AllowlistBins: []string{"make", "vault"},
+	})
+	if err == nil || f == nil {
+		t.Fatalf("one bad rule: got %v, %v; want usable filter and error", f, err)
+	}
+	if r := f.Match("make", "/home/me/clients/acme/api", "h"); r == nil || !strings.Contains(r.Source, "acme") {
+		t.Errorf("cwd rule after a bad rule: got %v, want acme", r)
+	}
+	if r := f.Match("vault read secret", "/tmp", "h"); r == nil || !strings.Contains(r.Source, "vault") {
+		t.Errorf("regex rule after a bad rule: got %v, want vault", r)
+	}
+	if r := f.Match("ls", "/tmp", "h"); r == nil || !strings.HasPrefix(r.Source, "allowlist_mode") {
+		t.Errorf("allowlist after a bad rule: got %v, want allowlist_mode", r)
+	}
+	f, err = New(nil)
+	if err != nil || f.Match(" ls", "", "") == nil || f.Match("ls", "", "") != nil {
+		t.Errorf("New(nil) = %v, %v; want space-prefixed ignored, ls recorded", f, err)
+	}
+}
+
+func TestRepoIgnoreFile(t *testing.T) {
+	repo := filepath.Join(t.TempDir(), "proj")
+	writeFile(t, filepath.Join(repo, ".git", "HEAD"), "ref: refs/heads/main\n")
+	ign := filepath.Join(repo, IgnoreFile)
+	writeFile(t, ign, `# comments and blank lines are skipped
+
+terraform apply*
+re:--token[= ]
+dir:secrets
+re:(
+`)
+	rules, err := ParseIgnoreFile(ign)
+	if err == nil || !strings.Contains(err.Error(), "line 6") {
+		t.Errorf("ParseIgnoreFile error = %v, want line 6 reported", err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("rules = %d, want 3 (bad line skipped)", len(rules))
+	}
+
+	f, err := New(&config.Config{IgnoreSpace: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(repo, "src")
+	tests := []struct {
+		cmd, cwd string
+		want     string
+	}{
+		{"terraform apply -auto-approve", src, ign + ":3"},
+		{"deploy --token abc", repo, ign + ":4"},
+		{"ls", filepath.Join(repo, "secrets", "prod"), ign + ":5"},
+		{"ls", src, ""},
+		{"terraform apply", t.TempDir(), ""},
+	}
+	for _, tt := range tests {
+		r := f.Match(tt.cmd, tt.cwd, "h")
+		got := ""
+		if r != nil {
+			got = r.Source
+		}
+		if got != tt.want {
+			t.Errorf("Match(%q, %q) = %q, want %q", tt.cmd, tt.cwd, got, tt.want)
+		}
+	}
+
+	// edits are picked up without a new Filter
+	writeFile(t, ign, "ls\n")
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(ign, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if r := f.Match("ls", src, "h"); r == nil || r.Source != ign+":1" {
+		t.Errorf("after edit: Match(ls) = %v, want %s:1", r, ign)
+	}
+	if r := f.Match("terraform apply", src, "h"); r != nil {
+		t.Errorf("after edit: Match(terraform apply) = %s, want recorded", r)
+	}
+	if err := os.Remove(ign); err != nil {
+		t.Fatal(err)
+	}
+	if r := f.Match("ls", src, "h"); r != nil {
+		t.Errorf("after remove: Match(ls) = %s, want recorded", r)
+	}
+}
+
+func TestAdmit(t *testing.T) {
+	f, err := New(&config.Config{IgnoreSpace: true, IgnorePatterns: []string{"*skipme*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scrub := redact.Default()
+	if _, ok := f.Admit("echo skipme", "/tmp", "h", scrub); ok {
+		t.Error("filtered command admitted")
+	}
+	got, ok := f.Admit("mysql -u root -phunter22 db", "/tmp", "h", scrub)
+	if !ok || strings.Contains(got, "hunter22") {
+		t.Errorf("Admit = %q, %v; want password masked", got, ok)
+	}
+	if got, ok := f.Admit("make test", "/tmp", "h", nil); !ok || got != "make test" {
+		t.Errorf("Admit without scrubber = %q, %v", got, ok)
+	}
+}
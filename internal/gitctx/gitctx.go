@@ -0,0 +1,181 @@
+// Package gitctx resolves git context (repo root, branch, commit) for a
+// directory by reading .git directly. No git subprocess is spawned, so it is
+// cheap enough to call for every ingested event.
+package gitctx
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxRefDepth bounds symbolic ref chains (ref: -> ref: -> ...).
+const maxRefDepth = 5
+
+// Info is the git context of a directory. Zero value means "not in a repo".
+// Branch is empty for a detached HEAD; Commit is empty for an unborn branch.
+type Info struct {
+	Root   string
+	Branch string
+	Commit string
+}
+
+// Resolve returns git context for dir by walking up to the nearest .git.
+func Resolve(dir string) Info {
+	if dir == "" || !filepath.IsAbs(dir) {
+		return Info{}
+	}
+	root, gitDir := findGitDir(filepath.Clean(dir))
+	if gitDir == "" {
+		return Info{}
+	}
+	info := Info{Root: root}
+	head, err := readTrimmed(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return info
+	}
+	ref, ok := strings.CutPrefix(head, "ref: ")
+	if !ok {
+		info.Commit = head
+		return info
+	}
+	info.Branch = strings.TrimPrefix(ref, "refs/heads/")
+	info.Commit = resolveRef(gitDir, commonDir(gitDir), ref)
+	return info
+}
+
+// Resolver caches Resolve results per directory. Use one per ingest batch so
+// branch switches are picked up on the next batch.
+type Resolver struct {
+	cache map[string]Info
+}
+
+// NewResolver returns an empty Resolver.
+func NewResolver() *Resolver {
+	return &Resolver{cache: make(map[string]Info)}
+}
+
+// Resolve returns cached git context for dir.
+func (r *Resolver) Resolve(dir string) Info {
+	if info, ok := r.cache[dir]; ok {
+		return info
+	}
+	info := Resolve(dir)
+	r.cache[dir] = info
+	return info
+}
+
+// findGitDir walks up from dir. Returns the worktree root and its git dir;
+// .git may be a directory or a "gitdir: <path>" file (worktrees, submodules).
+func findGitDir(dir string) (string, string) {
+	for {
+		p := filepath.Join(dir, ".git")
+		if fi, err := os.Stat(p); err == nil {
+			if fi.IsDir() {
+				return dir, p
+			}
+			if s, err := readTrimmed(p); err == nil {
+				if target, ok := strings.CutPrefix(s, "gitdir: "); ok {
+					if !filepath.IsAbs(target) {
+						target = filepath.Join(dir, target)
+					}
+					return dir, filepath.Clean(target)
+				}
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ""
+		}
+		dir = parent
+	}
+}
+
+// commonDir returns the directory holding shared refs (differs from gitDir for linked worktrees).
+func commonDir(gitDir string) string {
+	s, err := readTrimmed(filepath.Join(gitDir, "commondir"))
+	if err != nil || s == "" {
+		return gitDir
+	}
+	if !filepath.IsAbs(s) {
+		s = filepath.Join(gitDir, s)
+	}
+	return filepath.Clean(s)
+}
+
+// resolveRef follows ref to a commit hash via loose refs, then packed-refs.
+func resolveRef(gitDir, common, ref string) string {
+	for i := 0; i < maxRefDepth; i++ {
+		if !strings.HasPrefix(ref, "refs/") || strings.Contains(ref, "..") {
+			return ""
+		}
+		val, err := readTrimmed(filepath.Join(gitDir, filepath.FromSlash(ref)))
+		if err != nil && common != gitDir {
+			val, err = readTrimmed(filepath.Join(common, filepath.FromSlash(ref)))
+		}
+		if err != nil {
+			return packedRef(common, ref)
+		}
+		next, ok := strings.CutPrefix(val, "ref: ")
+		if !ok {
+			return val
+		}
+		ref = next
+	}
+	return ""
+}
+
+// packedRef looks ref up in packed-refs ("<hash> <ref>" lines).
+func packedRef(common, ref string) string {
+	f, err := os.Open(filepath.Join(common, "packed-refs"))
+	if err != nil {
+		return ""
+	}
+	defer func() { _ = f.Close() }()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" || line[0] == '#' || line[0] == '^' {
+			continue
+		}
+		hash, name, ok := strings.Cut(line, " ")
+		if ok && name == ref {
+			return hash
+		}
+	}
+	return ""
+}
+
+func readTrimmed(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// SQLFilter returns an " AND ..." clause restricting events (aliased e) to
+// repo and/or branch. repo is matched as a full root path when it contains a
+// slash, otherwise against the root's base name.
+func SQLFilter(repo, branch string) (string, []interface{}) {
+	var clauses []string
+	var args []interface{}
+	if repo != "" {
+		if strings.Contains(repo, "/") {
+			clauses = append(clauses, "e.repo_root = ?")
+			args = append(args, strings.TrimSuffix(repo, "/"))
+		} else {
+			clauses = append(clauses, "(e.repo_root = ? OR substr(e.repo_root, -length(?) - 1) = '/' || ?)")
+			args = append(args, repo, repo, repo)
+		}
+	}
+	if branch != "" {
+		clauses = append(clauses, "e.git_branch = ?")
+		args = append(args, branch)
+	}
+	if len(clauses) == 0 {
+		return "", nil
+	}
+	return " AND " + strings.Join(clauses, " AND "), args
+}
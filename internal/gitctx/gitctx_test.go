@@ -0,0 +1,84 @@
+package gitctx
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	hashA = "1111111111111111111111111111111111111111"
+	hashB = "2222222222222222222222222222222222222222"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolveLooseAndPackedRefs(t *testing.T) {
+	repo := filepath.Join(t.TempDir(), "proj")
+	sub := filepath.Join(repo, "src", "pkg")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(repo, ".git", "HEAD"), "ref: refs/heads/main\n")
+	writeFile(t, filepath.Join(repo, ".git", "refs", "heads", "main"), hashA+"\n")
+
+	got := Resolve(sub)
+	want := Info{Root: repo, Branch: "main", Commit: hashA}
+	if got != want {
+		t.Fatalf("loose ref: got %+v, want %+v", got, want)
+	}
+
+	writeFile(t, filepath.Join(repo, ".git", "HEAD"), "ref: refs/heads/feature/x\n")
+	writeFile(t, filepath.Join(repo, ".git", "packed-refs"), "# pack-refs with: peeled\n"+hashB+" refs/heads/feature/x\n^"+hashA+"\n")
+	got = Resolve(repo)
+	want = Info{Root: repo, Branch: "feature/x", Commit: hashB}
+	if got != want {
+		t.Fatalf("packed ref: got %+v, want %+v", got, want)
+	}
+}
+
+func TestResolveDetachedAndUnborn(t *testing.T) {
+	repo := t.TempDir()
+	writeFile(t, filepath.Join(repo, ".git", "HEAD"), hashA+"\n")
+	if got := Resolve(repo); got.Branch != "" || got.Commit != hashA {
+		t.Fatalf("detached: got %+v", got)
+	}
+	writeFile(t, filepath.Join(repo, ".git", "HEAD"), "ref: refs/heads/main\n")
+	if got := Resolve(repo); got.Branch != "main" || got.Commit != "" {
+		t.Fatalf("unborn: got %+v", got)
+	}
+}
+
+func TestResolveWorktreeGitFile(t *testing.T) {
+	tmp := t.TempDir()
+	mainGit := filepath.Join(tmp, "main", ".git")
+	writeFile(t, filepath.Join(mainGit, "refs", "heads", "wt"), hashB+"\n")
+	wtGit := filepath.Join(mainGit, "worktrees", "wt")
+	writeFile(t, filepath.Join(wtGit, "HEAD"), "ref: refs/heads/wt\n")
+	writeFile(t, filepath.Join(wtGit, "commondir"), "../..\n")
+	wt := filepath.Join(tmp, "wt")
+	writeFile(t, filepath.Join(wt, ".git"), "gitdir: "+wtGit+"\n")
+
+	got := Resolve(wt)
+	want := Info{Root: wt, Branch: "wt", Commit: hashB}
+	if got != want {
+		t.Fatalf("worktree: got %+v, want %+v", got, want)
+	}
+}
+
+func TestResolveNotARepo(t *testing.T) {
+	if got := Resolve(t.TempDir()); got != (Info{}) {
+		t.Fatalf("got %+v, want zero Info", got)
+	}
+	if got := Resolve("relative/path"); got != (Info{}) {
+		t.Fatalf("relative: got %+v, want zero Info", got)
+	}
+}
@@ -1,4 +1,4 @@
-// Package history provides parsers for shell history file formats (zsh, bash, plain).
+// Package history provides parsers for shell history file formats (zsh, bash, fish, plain).
 package history
 
 import (
@@ -13,11 +13,12 @@ type Format string
 const (
 	FormatZsh   Format = "zsh"
 	FormatBash  Format = "bash"
+	FormatFish  Format = "fish"
 	FormatPlain Format = "plain"
 )
 
 var (
-	zshExtendedRe   = regexp.MustCompile(`^: (\d+):(\d+);(.*)$`)
+	zshExtendedRe   = regexp.MustCompile(`(?s)^: (\d+):(\d+);(.*)$`)
 	bashTimestampRe = regexp.MustCompile(`^#(\d{9,})$`)
 )
 
@@ -66,8 +67,57 @@ func ParsePlain(line string) (cmd string, ok bool) {
 	return cmd, cmd != ""
 }
 
+// fishCmdPrefix starts each record in fish_history.
+const fishCmdPrefix = "- cmd: "
+
+// FishEntry is one record from fish_history.
+type FishEntry struct {
+	Cmd   string
+	When  float64  // 0 when the record has no when: field
+	Paths []string // arguments fish recognised as existing paths
+	Line  int      // 1-based line of the "- cmd:" line
+}
+
+// ParseFish parses fish_history, a YAML-like list of records. Each record
+// starts with "- cmd: <cmd>" followed by indented "when: <unix_ts>" and a
+// "paths:" list of "- <path>" lines. Unknown fields and malformed lines are skipped.
+func ParseFish(lines []string) []FishEntry {
+	var out []FishEntry
+	sc := NewScanner(strings.NewReader(strings.Join(lines, "\n")), FormatFish)
+	for sc.Scan() {
+		e := sc.Entry()
+		out = append(out, FishEntry{Cmd: e.Cmd, When: e.Ts, Paths: e.Paths, Line: e.Line})
+	}
+	return out
+}
+
+// unescapeFish reverses fish's history escaping: `\\` is a backslash and
+// `\n` a newline (multi-line commands).
+func unescapeFish(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case '\\':
+				b.WriteByte('\\')
+				i++
+				continue
+			case 'n':
+				b.WriteByte('\n')
+				i++
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
 // DetectFormat sniffs the first N lines to determine format.
-// Order: zsh extended (`: \d+:\d+;`) > bash (`#\d{9,}`) > plain.
+// Order: zsh extended (`: \d+:\d+;`) > bash (`#\d{9,}`) > fish (`- cmd: `) > plain.
 func DetectFormat(lines []string) Format {
 	for _, l := range lines {
 		s := strings.TrimSpace(l)
@@ -80,6 +130,9 @@ func DetectFormat(lines []string) Format {
 		if bashTimestampRe.MatchString(s) {
 			return FormatBash
 		}
+		if strings.HasPrefix(l, fishCmdPrefix) {
+			return FormatFish
+		}
 		// Non-empty, non-matching: continue scanning for format markers
 	}
 	return FormatPlain
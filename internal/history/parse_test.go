@@ -105,6 +105,7 @@ func TestDetectFormat(t *testing.T) {
 		{[]string{`: 1458291931:15;cmd`, `#1625963751`}, FormatZsh},
 		{[]string{}, FormatPlain},
 		{[]string{`  `}, FormatPlain},
+		{[]string{`- cmd: make test`, `  when: 1700000000`}, FormatFish},
 	}
 	for _, tt := range tests {
 		got := DetectFormat(tt.lines)
@@ -113,3 +114,31 @@ func TestDetectFormat(t *testing.T) {
 		}
 	}
 }
+
+func TestParseFish(t *testing.T) {
+	lines := []string{
+		"- cmd: make test",
+		"  when: 1700000000",
+		"  paths:",
+		"    - Makefile",
+		"    - src/main.c",
+		"- cmd: echo a\\nb \\\\ c",
+		"  when: 1700000010",
+		"- cmd: ls",
+		"  when: bogus",
+	}
+	got := ParseFish(lines)
+	if len(got) != 3 {
+		t.Fatalf("got %d entries, want 3: %+v", len(got), got)
+	}
+	if e := got[0]; e.Cmd != "make test" || e.When != 1700000000 || e.Line != 1 ||
+		len(e.Paths) != 2 || e.Paths[0] != "Makefile" || e.Paths[1] != "src/main.c" {
+		t.Errorf("entry 0 = %+v", e)
+	}
+	if e := got[1]; e.Cmd != "echo a\nb \\ c" || e.When != 1700000010 || e.Line != 6 || e.Paths != nil {
+		t.Errorf("entry 1 = %+v", e)
+	}
+	if e := got[2]; e.Cmd != "ls" || e.When != 0 {
+		t.Errorf("entry 2 = %+v", e)
+	}
+}
@@ -0,0 +1,208 @@
+package history
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Entry is one command record streamed from a history file.
+type Entry struct {
+	Line    int      // 1-based first line of the record
+	CmdLine int      // 1-based line where the command text starts (differs for bash "#<ts>" records)
+	Cmd     string   // multi-line commands are joined with "\n"
+	Ts      float64  // 0 when the record has no timestamp
+	DurSec  int      // zsh extended history only
+	Paths   []string // fish only
+}
+
+// Scanner streams entries from a history file without loading it into memory.
+// Multi-line commands become one entry: zsh continuation lines (a backslash
+// before the newline), bash lines between two "#<ts>" markers, and fish's
+// escaped "\n". Empty or unparseable records are counted in Skipped.
+type Scanner struct {
+	r       *bufio.Reader
+	format  Format
+	line    int   // physical lines read
+	offset  int64 // bytes read
+	pending *physLine
+	entry   Entry
+	skipped int
+	err     error
+}
+
+type physLine struct {
+	text string
+	num  int
+}
+
+// NewScanner returns a Scanner reading format from r.
+func NewScanner(r io.Reader, format Format) *Scanner {
+	return &Scanner{r: bufio.NewReaderSize(r, 64<<10), format: format}
+}
+
+// Scan advances to the next entry. It returns false at EOF or on error.
+func (s *Scanner) Scan() bool {
+	for {
+		pl, ok := s.next()
+		if !ok {
+			return false
+		}
+		var e Entry
+		switch s.format {
+		case FormatZsh:
+			e, ok = s.zsh(pl)
+		case FormatBash:
+			e, ok = s.bash(pl)
+		case FormatFish:
+			e, ok = s.fish(pl)
+		default:
+			e = Entry{Line: pl.num, CmdLine: pl.num}
+			e.Cmd, ok = ParsePlain(pl.text)
+		}
+		if !ok {
+			s.skipped++
+			continue
+		}
+		s.entry = e
+		return true
+	}
+}
+
+// Entry returns the entry read by the last successful Scan.
+func (s *Scanner) Entry() Entry { return s.entry }
+
+// Err returns the first non-EOF read error.
+func (s *Scanner) Err() error { return s.err }
+
+// Skipped returns the number of empty or unparseable records so far.
+func (s *Scanner) Skipped() int { return s.skipped }
+
+// Offset returns the number of bytes consumed so far (for progress).
+func (s *Scanner) Offset() int64 { return s.offset }
+
+// next returns the next physical line, without its line ending.
+func (s *Scanner) next() (physLine, bool) {
+	if s.pending != nil {
+		pl := *s.pending
+		s.pending = nil
+		return pl, true
+	}
+	if s.err != nil {
+		return physLine{}, false
+	}
+	text, err := s.r.ReadString('\n')
+	if err != nil {
+		if err != io.EOF {
+			s.err = err
+			return physLine{}, false
+		}
+		if text == "" {
+			return physLine{}, false
+		}
+	}
+	s.offset += int64(len(text))
+	s.line++
+	text = strings.TrimSuffix(text, "\n")
+	text = strings.TrimSuffix(text, "\r")
+	return physLine{text: text, num: s.line}, true
+}
+
+func (s *Scanner) unread(pl physLine) {
+	s.pending = &pl
+}
+
+// zsh joins continuation lines, then parses the extended-history record.
+func (s *Scanner) zsh(pl physLine) (Entry, bool) {
+	text := pl.text
+	for strings.HasSuffix(text, "\\") {
+		cont, ok := s.next()
+		if !ok {
+			break
+		}
+		text = text[:len(text)-1] + "\n" + cont.text
+	}
+	cmd, ts, dur, ok := ParseZshExtended(text)
+	if !ok || cmd == "" {
+		return Entry{}, false
+	}
+	return Entry{Line: pl.num, CmdLine: pl.num, Cmd: cmd, Ts: ts, DurSec: dur}, true
+}
+
+// bash reads a "#<ts>" record (all lines up to the next marker) or, before
+// the first marker, a plain one-line command.
+func (s *Scanner) bash(pl physLine) (Entry, bool) {
+	ts, isMarker := bashMarker(pl.text)
+	if !isMarker {
+		cmd, ok := ParsePlain(pl.text)
+		return Entry{Line: pl.num, CmdLine: pl.num, Cmd: cmd}, ok
+	}
+	e := Entry{Line: pl.num, Ts: ts}
+	var parts []string
+	for {
+		body, ok := s.next()
+		if !ok {
+			break
+		}
+		if _, marker := bashMarker(body.text); marker {
+			s.unread(body)
+			break
+		}
+		if e.CmdLine == 0 {
+			e.CmdLine = body.num
+		}
+		parts = append(parts, body.text)
+	}
+	e.Cmd = strings.TrimSpace(strings.Join(parts, "\n"))
+	return e, e.Cmd != ""
+}
+
+func bashMarker(line string) (float64, bool) {
+	m := bashTimestampRe.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return 0, false
+	}
+	ts, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return float64(ts), true
+}
+
+// fish reads one "- cmd:" record with its when: and paths: fields. Lines
+// outside a record are skipped.
+func (s *Scanner) fish(pl physLine) (Entry, bool) {
+	cmd, ok := strings.CutPrefix(pl.text, fishCmdPrefix)
+	if !ok {
+		return Entry{}, false
+	}
+	e := Entry{Line: pl.num, CmdLine: pl.num, Cmd: unescapeFish(cmd)}
+	inPaths := false
+	for {
+		field, ok := s.next()
+		if !ok {
+			break
+		}
+		if strings.HasPrefix(field.text, fishCmdPrefix) {
+			s.unread(field)
+			break
+		}
+		trimmed := strings.TrimSpace(field.text)
+		switch {
+		case strings.HasPrefix(trimmed, "when:"):
+			ts, err := strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(trimmed, "when:")), 10, 64)
+			if err == nil {
+				e.Ts = float64(ts)
+			}
+			inPaths = false
+		case trimmed == "paths:":
+			inPaths = true
+		case inPaths && strings.HasPrefix(trimmed, "- "):
+			e.Paths = append(e.Paths, unescapeFish(strings.TrimPrefix(trimmed, "- ")))
+		default:
+			inPaths = false
+		}
+	}
+	return e, strings.TrimSpace(e.Cmd) != ""
+}
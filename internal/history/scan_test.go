@@ -0,0 +1,75 @@
+package history
+
+import (
+	"strings"
+	"testing"
+)
+
+func scanAll(t *testing.T, content string, format Format) ([]Entry, int) {
+	t.Helper()
+	sc := NewScanner(strings.NewReader(content), format)
+	var out []Entry
+	for sc.Scan() {
+		out = append(out, sc.Entry())
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if sc.Offset() != int64(len(content)) {
+		t.Errorf("Offset = %d, want %d", sc.Offset(), len(content))
+	}
+	return out, sc.Skipped()
+}
+
+func TestScannerZshContinuation(t *testing.T) {
+	content := ": 1700000000:3;for f in *.go; do\\\n  gofmt -l $f\\\ndone\n" +
+		": 1700000010:0;ls\r\n" +
+		"garbage\n" +
+		": 1700000020:1;echo 'no newline at EOF'"
+	got, skipped := scanAll(t, content, FormatZsh)
+	if len(got) != 3 || skipped != 1 {
+		t.Fatalf("got %d entries, %d skipped: %+v", len(got), skipped, got)
+	}
+	want := Entry{Line: 1, CmdLine: 1, Cmd: "for f in *.go; do\n  gofmt -l $f\ndone", Ts: 1700000000, DurSec: 3}
+	if got[0].Cmd != want.Cmd || got[0].Ts != want.Ts || got[0].DurSec != want.DurSec || got[0].Line != want.Line {
+		t.Errorf("entry 0 = %+v, want %+v", got[0], want)
+	}
+	if got[1].Cmd != "ls" || got[1].Line != 4 {
+		t.Errorf("entry 1 = %+v, want ls on line 4", got[1])
+	}
+	if got[2].Cmd != "echo 'no newline at EOF'" || got[2].Line != 6 {
+		t.Errorf("entry 2 = %+v", got[2])
+	}
+}
+
+func TestScannerBashMultiLine(t *testing.T) {
+	content := "echo before timestamps\n" +
+		"#1625963751\n" +
+		"cat <<EOF\n" +
+		"hello\n" +
+		"EOF\n" +
+		"#1625963760\n" +
+		"ls -la\n" +
+		"#1625963770\n"
+	got, skipped := scanAll(t, content, FormatBash)
+	if len(got) != 3 || skipped != 1 {
+		t.Fatalf("got %d entries, %d skipped: %+v", len(got), skipped, got)
+	}
+	if got[0].Cmd != "echo before timestamps" || got[0].Ts != 0 {
+		t.Errorf("entry 0 = %+v", got[0])
+	}
+	if got[1].Cmd != "cat <<EOF\nhello\nEOF" || got[1].Ts != 1625963751 || got[1].Line != 2 || got[1].CmdLine != 3 {
+		t.Errorf("entry 1 = %+v", got[1])
+	}
+	if got[2].Cmd != "ls -la" || got[2].Line != 6 || got[2].CmdLine != 7 {
+		t.Errorf("entry 2 = %+v", got[2])
+	}
+}
+
+func TestScannerLongLine(t *testing.T) {
+	long := strings.Repeat("x", 200<<10) // beyond bufio.Scanner's default token size
+	got, _ := scanAll(t, "echo "+long+"\nls\n", FormatPlain)
+	if len(got) != 2 || len(got[0].Cmd) != len(long)+5 || got[1].Line != 2 {
+		t.Errorf("got %d entries", len(got))
+	}
+}
@@ -0,0 +1,225 @@
+package imp
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrBatchNotFound is returned when no import batch matches an id.
+var ErrBatchNotFound = errors.New("import batch not found")
+
+// Batch is one import_batches row.
+type Batch struct {
+	ID         string
+	SourceFile string
+	Shell      string
+	Host       string
+	ImportedAt float64
+	EventCount int
+	Status     string // "running" until the import finishes (then resumable if interrupted), else "complete"
+	ResumePos  int
+}
+
+const batchColumns = `batch_id, source_file, source_shell, COALESCE(source_host, ''), imported_at, event_count,
+	COALESCE(status, 'complete'), resume_pos`
+
+func scanBatch(sc interface{ Scan(...interface{}) error }) (Batch, error) {
+	var b Batch
+	err := sc.Scan(&b.ID, &b.SourceFile, &b.Shell, &b.Host, &b.ImportedAt, &b.EventCount, &b.Status, &b.ResumePos)
+	return b, err
+}
+
+// ListBatches returns all import batches, newest first.
+func ListBatches(db *sql.DB) ([]Batch, error) {
+	rows, err := db.Query(`SELECT ` + batchColumns + ` FROM import_batches ORDER BY imported_at DESC, batch_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var out []Batch
+	for rows.Next() {
+		b, err := scanBatch(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+// FindBatch returns the batch whose id is id or starts with it, so the short
+// ids printed by `hx import list` work. An ambiguous prefix is an error.
+func FindBatch(db *sql.DB, id string) (*Batch, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return nil, ErrBatchNotFound
+	}
+	rows, err := db.Query(`SELECT `+batchColumns+` FROM import_batches WHERE batch_id = ? OR substr(batch_id, 1, ?) = ? LIMIT 2`,
+		id, len(id), id)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var found []Batch
+	for rows.Next() {
+		b, err := scanBatch(rows)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("%s: %w", id, ErrBatchNotFound)
+	case 1:
+		return &found[0], nil
+	}
+	return nil, fmt.Errorf("%s: ambiguous batch id prefix", id)
+}
+
+// BatchSummary describes the events an import batch added.
+type BatchSummary struct {
+	Batch
+	Events      int            // events still in the database
+	First, Last float64        // started_at range; 0 when no events
+	Tiers       map[string]int // events per quality tier
+	Sample      []string       // first commands in source order
+}
+
+// SummarizeBatch counts the batch's events and returns up to sample commands.
+func SummarizeBatch(db *sql.DB, b *Batch, sample int) (*BatchSummary, error) {
+	s := &BatchSummary{Batch: *b, Tiers: map[string]int{}}
+	rows, err := db.Query(`
+		SELECT COALESCE(quality_tier, ''), COUNT(*), MIN(started_at), MAX(started_at)
+		FROM events WHERE import_batch_id = ? GROUP BY quality_tier
+	`, b.ID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var tier string
+		var n int
+		var first, last float64
+		if err := rows.Scan(&tier, &n, &first, &last); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		s.Tiers[tier] = n
+		s.Events += n
+		if s.First == 0 || first < s.First {
+			s.First = first
+		}
+		if last > s.Last {
+			s.Last = last
+		}
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`
+		SELECT c.cmd_text FROM events e JOIN command_dict c ON c.cmd_id = e.cmd_id
+		WHERE e.import_batch_id = ? ORDER BY e.seq LIMIT ?
+	`, b.ID, sample)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var cmd string
+		if err := rows.Scan(&cmd); err != nil {
+			return nil, err
+		}
+		s.Sample = append(s.Sample, cmd)
+	}
+	return s, rows.Err()
+}
+
+// UndoResult counts what UndoBatch removed.
+type UndoResult struct {
+	Events int64 // events (and their events_fts rows)
+	Hashes int64 // import_dedup hashes
+}
+
+// UndoBatch deletes a batch's events, their events_fts rows, its import
+// session, its import_dedup hashes and the batch row, in one transaction.
+// With the hashes gone the same file can be imported again. Hashes recorded
+// before import_dedup.batch_id existed are recomputed from the events
+// (best effort: line-based sources only).
+func UndoBatch(db *sql.DB, b *Batch) (*UndoResult, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res := &UndoResult{}
+	legacy, err := legacyDedupHashes(tx, b)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range legacy {
+		r, err := tx.Exec(`DELETE FROM import_dedup WHERE dedup_hash = ? AND batch_id IS NULL`, h)
+		if err != nil {
+			return nil, err
+		}
+		n, _ := r.RowsAffected()
+		res.Hashes += n
+	}
+	r, err := tx.Exec(`DELETE FROM import_dedup WHERE batch_id = ?`, b.ID)
+	if err != nil {
+		return nil, err
+	}
+	n, _ := r.RowsAffected()
+	res.Hashes += n
+
+	if _, err := tx.Exec(`DELETE FROM events_fts WHERE rowid IN (SELECT event_id FROM events WHERE import_batch_id = ?)`, b.ID); err != nil {
+		return nil, err
+	}
+	r, err = tx.Exec(`DELETE FROM events WHERE import_batch_id = ?`, b.ID)
+	if err != nil {
+		return nil, err
+	}
+	res.Events, _ = r.RowsAffected()
+	if _, err := tx.Exec(`DELETE FROM sessions WHERE import_batch_id = ? AND origin = 'import'`, b.ID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM import_batches WHERE batch_id = ?`, b.ID); err != nil {
+		return nil, err
+	}
+	return res, tx.Commit()
+}
+
+// legacyDedupHashes returns the hashes a line-based import of b would have
+// recorded for its events: DedupHash on the event's line, and on the next
+// line for bash "#<ts>" records (the hash uses the command line).
+func legacyDedupHashes(tx *sql.Tx, b *Batch) ([]string, error) {
+	var untagged int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM import_dedup WHERE batch_id IS NULL`).Scan(&untagged); err != nil || untagged == 0 {
+		return nil, err
+	}
+	rows, err := tx.Query(`
+		SELECT e.seq, c.cmd_text FROM events e JOIN command_dict c ON c.cmd_id = e.cmd_id
+		WHERE e.import_batch_id = ?
+	`, b.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var out []string
+	for rows.Next() {
+		var seq int
+		var cmd string
+		if err := rows.Scan(&seq, &cmd); err != nil {
+			return nil, err
+		}
+		out = append(out, DedupHash(b.SourceFile, seq, cmd), DedupHash(b.SourceFile, seq+1, cmd))
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,132 @@
+package imp
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mrcawood/History_eXtended/internal/db"
+)
+
+func TestBatchListShowUndo(t *testing.T) {
+	dir := t.TempDir()
+	zshPath := filepath.Join(dir, ".zsh_history")
+	plainPath := filepath.Join(dir, "plain.txt")
+	if err := os.WriteFile(zshPath, []byte(": 1700000000:1;make test\n: 1700000100:0;ls\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(plainPath, []byte("uptime\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := db.Open(filepath.Join(dir, "hx.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	zsh, err := Run(context.Background(), conn, zshPath, Options{Shell: "zsh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Run(context.Background(), conn, plainPath, Options{Shell: "plain"}); err != nil {
+		t.Fatal(err)
+	}
+
+	batches, err := ListBatches(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 2 {
+		t.Fatalf("ListBatches = %d batches, want 2", len(batches))
+	}
+
+	b, err := FindBatch(conn, zsh.BatchID[:8])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.ID != zsh.BatchID || b.EventCount != 2 || b.Status != "complete" || b.Shell != "zsh" {
+		t.Errorf("FindBatch = %+v", b)
+	}
+	if _, err := FindBatch(conn, "zzzz"); !errors.Is(err, ErrBatchNotFound) {
+		t.Errorf("FindBatch(unknown) err = %v, want ErrBatchNotFound", err)
+	}
+
+	s, err := SummarizeBatch(conn, b, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Events != 2 || s.First != 1700000000 || s.Last != 1700000100 || s.Tiers["high"] != 2 {
+		t.Errorf("SummarizeBatch = %+v", s)
+	}
+	if len(s.Sample) != 1 || s.Sample[0] != "make test" {
+		t.Errorf("Sample = %q, want [make test]", s.Sample)
+	}
+
+	res, err := UndoBatch(conn, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Events != 2 || res.Hashes != 2 {
+		t.Errorf("UndoBatch = %+v, want 2 events, 2 hashes", res)
+	}
+	var events, fts, sessions int
+	_ = conn.QueryRow(`SELECT COUNT(*) FROM events WHERE import_batch_id = ?`, b.ID).Scan(&events)
+	_ = conn.QueryRow(`SELECT COUNT(*) FROM events_fts WHERE events_fts MATCH 'make'`).Scan(&fts)
+	_ = conn.QueryRow(`SELECT COUNT(*) FROM sessions WHERE import_batch_id = ?`, b.ID).Scan(&sessions)
+	if events != 0 || fts != 0 || sessions != 0 {
+		t.Errorf("after undo: events=%d fts=%d sessions=%d, want 0", events, fts, sessions)
+	}
+	if _, err := FindBatch(conn, b.ID); !errors.Is(err, ErrBatchNotFound) {
+		t.Errorf("batch row kept after undo: %v", err)
+	}
+	var uptime int
+	_ = conn.QueryRow(`SELECT COUNT(*) FROM events_fts WHERE events_fts MATCH 'uptime'`).Scan(&uptime)
+	if uptime != 1 {
+		t.Error("undo touched another batch")
+	}
+
+	// Hashes are gone, so the same file imports again
+	again, err := Run(context.Background(), conn, zshPath, Options{Shell: "zsh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Inserted != 2 {
+		t.Errorf("re-import after undo inserted %d, want 2", again.Inserted)
+	}
+}
+
+func TestUndoLegacyHashes(t *testing.T) {
+	dir := t.TempDir()
+	bashPath := filepath.Join(dir, ".bash_history")
+	if err := os.WriteFile(bashPath, []byte("#1625963751\nmake test\n#1625963760\nls\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := db.Open(filepath.Join(dir, "hx.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	res, err := Run(context.Background(), conn, bashPath, Options{Shell: "bash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Hashes recorded before import_dedup.batch_id existed
+	if _, err := conn.Exec(`UPDATE import_dedup SET batch_id = NULL`); err != nil {
+		t.Fatal(err)
+	}
+	b, err := FindBatch(conn, res.BatchID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	undo, err := UndoBatch(conn, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var left int
+	_ = conn.QueryRow(`SELECT COUNT(*) FROM import_dedup`).Scan(&left)
+	if undo.Hashes != 2 || left != 0 {
+		t.Errorf("legacy undo cleared %d hashes, %d left", undo.Hashes, left)
+	}
+}
@@ -3,9 +3,10 @@ package imp
 
 import (
 	"crypto/sha256"
-	"database/sql"
 	"encoding/hex"
 	"fmt"
+
+	"github.com/mrcawood/History_eXtended/internal/store"
 )
 
 // DedupHash returns sha256(source_file + line_num + cmd) for idempotency.
@@ -14,9 +15,10 @@ func DedupHash(sourceFile string, lineNum int, cmd string) string {
 	return hex.EncodeToString(h[:])
 }
 
-// RecordOrSkip inserts hash into import_dedup. Returns true if new (should insert event), false if duplicate.
-func RecordOrSkip(db *sql.DB, hash string) (inserted bool, err error) {
-	res, err := db.Exec(`INSERT OR IGNORE INTO import_dedup (dedup_hash) VALUES (?)`, hash)
+// RecordOrSkip inserts hash into import_dedup, tagged with the batch that
+// claimed it. Returns true if new (should insert event), false if duplicate.
+func RecordOrSkip(db store.DBTX, hash, batchID string) (inserted bool, err error) {
+	res, err := db.Exec(`INSERT OR IGNORE INTO import_dedup (dedup_hash, batch_id) VALUES (?, ?)`, hash, batchID)
 	if err != nil {
 		return false, err
 	}
@@ -39,7 +39,7 @@ func TestRecordOrSkip(t *testing.T) {
 	}()
 
 	hash := DedupHash("test", 1, "cmd")
-	ins, err := RecordOrSkip(conn, hash)
+	ins, err := RecordOrSkip(conn, hash, "b1")
 	if err != nil {
 		t.Fatalf("RecordOrSkip: %v", err)
 	}
@@ -48,7 +48,7 @@ func TestRecordOrSkip(t *testing.T) {
 	}
 
 	// Second time: duplicate
-	ins, err = RecordOrSkip(conn, hash)
+	ins, err = RecordOrSkip(conn, hash, "b1")
 	if err != nil {
 		t.Fatalf("RecordOrSkip 2: %v", err)
 	}
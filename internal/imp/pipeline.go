@@ -2,207 +2,430 @@ package imp
 
 import (
 	"bufio"
+	"context"
 	"crypto/rand"
 	"database/sql"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/mrcawood/History_eXtended/internal/filter"
 	"github.com/mrcawood/History_eXtended/internal/history"
+	"github.com/mrcawood/History_eXtended/internal/redact"
 	"github.com/mrcawood/History_eXtended/internal/store"
 )
 
-const maxLines = 100_000
+// batchSize is the number of entries committed per transaction. Each commit
+// also records the resume position, so an interrupted import loses at most
+// one transaction of work.
+const batchSize = 2000
 
-// MaxLines is the import line cap (exported for CLI messages).
-const MaxLines = maxLines
+// sniffLines is how many leading lines DetectFormat sees.
+const sniffLines = 1000
 
-// Run imports a history file. Returns (inserted, skipped, truncated, error).
-// truncated is true when the file exceeded maxLines and was truncated.
-func Run(db *sql.DB, sourceFile, sourceHost, sourceShell string) (int, int, bool, error) {
-	path, err := filepath.Abs(sourceFile)
+// DefaultCapturedWindow is how far apart an imported entry and a captured
+// event with the same command on the same host may start and still be taken
+// for the same run. Shell history timestamps have one-second resolution.
+const DefaultCapturedWindow = 5 * time.Second
+
+// ErrBatchComplete is returned when resuming a batch that already finished.
+var ErrBatchComplete = errors.New("import batch already complete")
+
+// Options configure an import.
+type Options struct {
+	Host     string         // source host label; "" keeps the source's own host (databases) or "import"
+	Shell    string         // zsh, bash, fish, plain, atuin, histdb, mcfly; "" or "auto" to detect
+	BatchID  string         // resume this interrupted batch (source file, shell and host come from the batch)
+	Progress func(Progress) // called after each committed transaction
+
+	// CapturedWindow: entries matching a live or synced event within this
+	// window are skipped (see DefaultCapturedWindow, used when 0). Negative
+	// imports them anyway.
+	CapturedWindow time.Duration
+
+	// Filter and Scrub are the capture filter and secret scrubber live
+	// commands go through (filter.New, redact.Capture); nil skips either.
+	Filter *filter.Filter
+	Scrub  *redact.Redactor
+}
+
+// Progress reports how far an import has got.
+type Progress struct {
+	Entries int   // entries read from the source so far
+	Done    int64 // bytes (files) or rows (databases) consumed
+	Total   int64 // file size or row count
+}
+
+// Result summarises an import.
+type Result struct {
+	BatchID  string
+	Shell    string
+	Inserted int
+	Captured int // entries skipped because hx already captured them live
+	Filtered int // entries the capture filter or a drop rule kept out
+	Skipped  int // empty or unparseable entries
+	Resumed  bool
+}
+
+// record is one history entry from any source, ready to insert.
+type record struct {
+	seq       int // position in the source; unique within the batch
+	dedupLine int // line (or row id) for DedupHash
+	cmd       string
+	startedAt float64 // 0 = unknown; the batch's imported_at is used
+	durMs     int64
+	exit      *int
+	cwd       string
+	host      string
+	tier      string
+	extra     string
+}
+
+// recordSource streams records from a history file or database.
+type recordSource interface {
+	next() (record, bool)
+	err() error
+	skipped() int
+	progress() (done, total int64)
+	close() error
+}
+
+// batch is an import_batches row being written.
+type batch struct {
+	id, path, shell, host string
+	sessionID             string
+	importedAt            float64
+	resumePos             int
+	resumed               bool
+
+	localHost string  // host of captured events for entries without a host label
+	window    float64 // CapturedWindow in seconds; 0 disables the check
+	filter    *filter.Filter
+	scrub     *redact.Redactor
+}
+
+// outcome is what insertRecord did with a record.
+type outcome int
+
+const (
+	outcomeDuplicate outcome = iota // empty, or already imported (DedupHash)
+	outcomeInserted
+	outcomeCaptured // matches a captured event; not inserted
+	outcomeFiltered // the capture filter or a drop rule rejected it
+)
+
+// Run imports a history file or database, streaming it in transactions of
+// batchSize entries. The file is never loaded whole, so there is no size cap.
+// Cancelling ctx stops after the current transaction; the batch can then be
+// resumed with Options.BatchID. Idempotent via DedupHash.
+func Run(ctx context.Context, db *sql.DB, sourceFile string, opts Options) (*Result, error) {
+	b, err := openBatch(db, sourceFile, opts)
 	if err != nil {
-		path = sourceFile
+		return nil, err
 	}
-	lines, err := readLines(path)
+	b.localHost, _ = os.Hostname()
+	b.filter, b.scrub = opts.Filter, opts.Scrub
+	switch {
+	case opts.CapturedWindow > 0:
+		b.window = opts.CapturedWindow.Seconds()
+	case opts.CapturedWindow == 0:
+		b.window = DefaultCapturedWindow.Seconds()
+	}
+	src, err := openSource(b.path, b.shell)
 	if err != nil {
-		return 0, 0, false, err
+		return nil, err
 	}
-	truncated := false
-	if len(lines) > maxLines {
-		lines = lines[:maxLines]
-		truncated = true
+	defer func() { _ = src.close() }()
+
+	// Skip entries committed by the interrupted run of this batch
+	for i := 0; i < b.resumePos; i++ {
+		if _, ok := src.next(); !ok {
+			break
+		}
 	}
+	res := &Result{BatchID: b.id, Shell: b.shell, Resumed: b.resumed}
+	pos := b.resumePos
+	for more := true; more; {
+		if err := ctx.Err(); err != nil {
+			res.Skipped = src.skipped()
+			return res, err
+		}
+		more, err = importChunk(db, src, b, &pos, res)
+		if err != nil {
+			return res, err
+		}
+		if opts.Progress != nil {
+			done, total := src.progress()
+			opts.Progress(Progress{Entries: pos, Done: done, Total: total})
+		}
+	}
+	res.Skipped = src.skipped()
+	if err := src.err(); err != nil {
+		return res, err
+	}
+	return res, finishBatch(db, b)
+}
 
-	shell := sourceShell
-	if shell == "" || shell == "auto" {
-		shell = string(history.DetectFormat(lines))
+// openBatch loads the batch to resume, or detects the source format and
+// records a new running batch with its import session.
+func openBatch(db *sql.DB, sourceFile string, opts Options) (*batch, error) {
+	if opts.BatchID != "" {
+		found, err := FindBatch(db, opts.BatchID)
+		if err != nil {
+			return nil, err
+		}
+		if found.Status != "running" {
+			return nil, fmt.Errorf("%s: %w", found.ID, ErrBatchComplete)
+		}
+		return &batch{
+			id: found.ID, path: found.SourceFile, shell: found.Shell, host: found.Host,
+			sessionID: "import-" + found.ID, importedAt: found.ImportedAt,
+			resumePos: found.ResumePos, resumed: true,
+		}, nil
 	}
 
-	batchID, err := newBatchID()
+	path, err := filepath.Abs(sourceFile)
 	if err != nil {
-		return 0, 0, false, err
+		path = sourceFile
 	}
-	sessionID := "import-" + batchID
-	st := store.New(db)
-
-	importedAt := float64(time.Now().Unix())
-	if err := st.EnsureImportSession(sessionID, batchID, path, sourceHost, importedAt); err != nil {
-		return 0, 0, false, err
+	shell, err := detectShell(path, opts.Shell)
+	if err != nil {
+		return nil, err
 	}
-
-	var inserted, skipped int
-
-	switch history.Format(shell) {
-	case history.FormatZsh:
-		inserted, skipped = processZshFormat(db, st, lines, path, sessionID, batchID, sourceHost)
-	case history.FormatBash:
-		inserted, skipped = processBashFormat(db, st, lines, path, sessionID, batchID, sourceHost, importedAt)
-	default: // FormatPlain
-		inserted, skipped = processPlainFormat(db, st, lines, path, sessionID, batchID, sourceHost, importedAt)
+	id, err := newBatchID()
+	if err != nil {
+		return nil, err
 	}
-
-	// Update session ended_at
-	lastStarted := importedAt
-	if inserted > 0 {
-		var last float64
-		_ = db.QueryRow(`SELECT MAX(started_at) FROM events WHERE session_id = ?`, sessionID).Scan(&last)
-		if last > 0 {
-			lastStarted = last
-		}
+	b := &batch{
+		id: id, path: path, shell: shell, host: opts.Host,
+		sessionID: "import-" + id, importedAt: float64(time.Now().Unix()),
 	}
-	_, _ = db.Exec(`UPDATE sessions SET ended_at = ? WHERE session_id = ?`, lastStarted, sessionID)
-
-	// Record batch
-	_, _ = db.Exec(
-		`INSERT INTO import_batches (batch_id, source_file, source_shell, source_host, imported_at, event_count) VALUES (?, ?, ?, ?, ?, ?)`,
-		batchID, path, shell, sourceHost, importedAt, inserted,
+	if err := store.New(db).EnsureImportSession(b.sessionID, b.id, b.path, b.host, b.importedAt); err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(
+		`INSERT INTO import_batches (batch_id, source_file, source_shell, source_host, imported_at, event_count, status, resume_pos) VALUES (?, ?, ?, ?, ?, 0, 'running', 0)`,
+		b.id, b.path, b.shell, b.host, b.importedAt,
 	)
-
-	return inserted, skipped, truncated, nil
+	if err != nil {
+		return nil, fmt.Errorf("record import batch: %w", err)
+	}
+	return b, nil
 }
 
-func readLines(path string) ([]string, error) {
+// detectShell resolves "auto" to a database source or a line format sniffed
+// from the first lines of the file.
+func detectShell(path, shell string) (string, error) {
+	if shell != "" && shell != "auto" {
+		return shell, nil
+	}
+	src, err := DetectDBSource(path)
+	if err != nil {
+		return "", err
+	}
+	if src != "" {
+		return src, nil
+	}
 	f, err := os.Open(path)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	defer func() {
-		if closeErr := f.Close(); closeErr != nil {
-			// Log error but don't override original error
-			fmt.Fprintf(os.Stderr, "Warning: failed to close file %s: %v\n", path, closeErr)
-		}
-	}()
+	defer func() { _ = f.Close() }()
 	var lines []string
 	sc := bufio.NewScanner(f)
-	for sc.Scan() {
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for len(lines) < sniffLines && sc.Scan() {
 		lines = append(lines, sc.Text())
 	}
-	return lines, sc.Err()
+	return string(history.DetectFormat(lines)), nil
 }
 
-func newBatchID() (string, error) {
-	b := make([]byte, 16)
-	if _, err := rand.Read(b); err != nil {
-		return "", err
+func openSource(path, shell string) (recordSource, error) {
+	if isDBSource(shell) {
+		return openDBSource(path, shell)
 	}
-	return hex.EncodeToString(b), nil
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	var size int64
+	if fi, err := f.Stat(); err == nil {
+		size = fi.Size()
+	}
+	format := history.Format(shell)
+	return &fileSource{f: f, sc: history.NewScanner(f, format), format: format, size: size}, nil
 }
 
-// processZshFormat handles zsh extended history format
-func processZshFormat(db *sql.DB, st *store.Store, lines []string, path, sessionID, batchID, sourceHost string) (int, int) {
-	var inserted, skipped int
-	for i, line := range lines {
-		cmd, startedAt, durSec, ok := history.ParseZshExtended(line)
-		if !ok {
-			skipped++
-			continue
+// importChunk inserts up to batchSize records in one transaction and commits
+// the new resume position with them, then adds the counts to res. more is
+// false once the source is drained.
+func importChunk(db *sql.DB, src recordSource, b *batch, pos *int, res *Result) (more bool, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
 		}
-		hash := DedupHash(path, i+1, cmd)
-		if ins, _ := RecordOrSkip(db, hash); !ins {
-			continue
+	}()
+	st := store.New(tx)
+	var inserted, captured, filtered int
+	more = true
+	for i := 0; i < batchSize; i++ {
+		r, ok := src.next()
+		if !ok {
+			more = false
+			break
 		}
-		cmdID, err := st.CmdID(cmd, startedAt)
+		*pos++
+		var out outcome
+		out, err = insertRecord(tx, st, b, &r)
 		if err != nil {
-			skipped++
-			continue
+			return false, err
 		}
-		durMs := int64(durSec) * 1000
-		ok2, _ := st.InsertImportEvent(cmd, startedAt, durMs, i+1, sessionID, cmdID, "high", path, sourceHost, batchID)
-		if ok2 {
+		switch out {
+		case outcomeInserted:
 			inserted++
+		case outcomeCaptured:
+			captured++
+		case outcomeFiltered:
+			filtered++
 		}
 	}
-	return inserted, skipped
+	if _, err = tx.Exec(
+		`UPDATE import_batches SET resume_pos = ?, event_count = event_count + ? WHERE batch_id = ?`,
+		*pos, inserted, b.id,
+	); err != nil {
+		return false, err
+	}
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+	res.Inserted += inserted
+	res.Captured += captured
+	res.Filtered += filtered
+	return more, nil
 }
 
-// processBashFormat handles bash timestamped history format
-func processBashFormat(db *sql.DB, st *store.Store, lines []string, path, sessionID, batchID, sourceHost string, importedAt float64) (int, int) {
-	var inserted, skipped int
-	for i := 0; i < len(lines); i++ {
-		cmd, startedAt, ok := history.ParseBashTimestamped(lines, i)
-		if !ok {
-			// May be plain line (mixed format)
-			cmd, plainOk := history.ParsePlain(lines[i])
-			if plainOk {
-				hash := DedupHash(path, i+1, cmd)
-				if ins, _ := RecordOrSkip(db, hash); ins {
-					cmdID, err := st.CmdID(cmd, importedAt)
-					if err == nil {
-						if ok2, _ := st.InsertImportEvent(cmd, importedAt, 0, i+1, sessionID, cmdID, "low", path, sourceHost, batchID); ok2 {
-							inserted++
-						}
-					}
-				}
-			} else {
-				skipped++
-			}
-			continue
-		}
-		hash := DedupHash(path, i+2, cmd) // line_num of command line (i+2 = 1-based for second line)
-		if ins, _ := RecordOrSkip(db, hash); !ins {
-			i++ // skip cmd line
-			continue
+// insertRecord inserts r unless the capture filter rejects it, its DedupHash
+// was already imported or, for timestamped entries, hx captured the same
+// command on the same host around the same time. Secrets are scrubbed as for
+// live commands. The hash of the source text is recorded for everything but
+// filtered entries, so re-imports stay no-ops.
+func insertRecord(tx *sql.Tx, st *store.Store, b *batch, r *record) (outcome, error) {
+	cmd := strings.TrimSpace(r.cmd)
+	if cmd == "" {
+		return outcomeDuplicate, nil
+	}
+	host := b.host
+	if host == "" {
+		host = r.host
+	}
+	stored, keep := cmd, true
+	switch {
+	case b.filter != nil:
+		stored, keep = b.filter.Admit(r.cmd, r.cwd, host, b.scrub)
+		stored = strings.TrimSpace(stored)
+	case b.scrub != nil:
+		stored, keep = b.scrub.Scrub(cmd)
+	}
+	if !keep {
+		return outcomeFiltered, nil
+	}
+	ins, err := RecordOrSkip(tx, DedupHash(b.path, r.dedupLine, cmd), b.id)
+	if err != nil || !ins {
+		return outcomeDuplicate, err
+	}
+	startedAt := r.startedAt
+	if startedAt <= 0 {
+		startedAt = b.importedAt
+	}
+	cmdID, err := st.CmdID(stored, startedAt)
+	if err != nil {
+		return outcomeDuplicate, err
+	}
+	if b.window > 0 && r.startedAt > 0 {
+		capturedOn := host
+		if capturedOn == "" {
+			capturedOn = b.localHost
 		}
-		cmdID, err := st.CmdID(cmd, startedAt)
+		id, err := st.CapturedEventNear(cmdID, capturedOn, r.startedAt, b.window)
 		if err != nil {
-			skipped++
-			i++ // skip cmd line
-			continue
+			return outcomeDuplicate, err
 		}
-		ok2, _ := st.InsertImportEvent(cmd, startedAt, 0, i+1, sessionID, cmdID, "medium", path, sourceHost, batchID)
-		if ok2 {
-			inserted++
+		if id != 0 {
+			return outcomeCaptured, nil
 		}
-		i++ // consumed #ts + cmd
 	}
-	return inserted, skipped
+	ok, err := st.InsertImport(&store.ImportEvent{
+		Cmd: stored, StartedAt: startedAt, DurationMs: r.durMs, Seq: r.seq, SessionID: b.sessionID, CmdID: cmdID,
+		QualityTier: r.tier, SourceFile: b.path, SourceHost: host, BatchID: b.id,
+		Cwd: r.cwd, ExitCode: r.exit, ExtraJSON: r.extra,
+	})
+	if err != nil || !ok {
+		return outcomeDuplicate, err
+	}
+	return outcomeInserted, nil
 }
 
-// processPlainFormat handles plain history format
-func processPlainFormat(db *sql.DB, st *store.Store, lines []string, path, sessionID, batchID, sourceHost string, importedAt float64) (int, int) {
-	var inserted, skipped int
-	for i, line := range lines {
-		cmd, ok := history.ParsePlain(line)
-		if !ok {
-			skipped++
-			continue
-		}
-		hash := DedupHash(path, i+1, cmd)
-		if ins, _ := RecordOrSkip(db, hash); !ins {
-			continue
-		}
-		cmdID, err := st.CmdID(cmd, importedAt)
-		if err != nil {
-			skipped++
-			continue
-		}
-		ok2, _ := st.InsertImportEvent(cmd, importedAt, 0, i+1, sessionID, cmdID, "low", path, sourceHost, batchID)
-		if ok2 {
-			inserted++
-		}
+// finishBatch marks the batch complete and closes its session at the last imported command.
+func finishBatch(db *sql.DB, b *batch) error {
+	ended := b.importedAt
+	var last sql.NullFloat64
+	_ = db.QueryRow(`SELECT MAX(started_at) FROM events WHERE session_id = ?`, b.sessionID).Scan(&last)
+	if last.Valid && last.Float64 > 0 {
+		ended = last.Float64
 	}
-	return inserted, skipped
+	_, _ = db.Exec(`UPDATE sessions SET ended_at = ? WHERE session_id = ?`, ended, b.sessionID)
+	_, err := db.Exec(`UPDATE import_batches SET status = 'complete' WHERE batch_id = ?`, b.id)
+	return err
+}
+
+// fileSource streams records from a line-based history file.
+type fileSource struct {
+	f      *os.File
+	sc     *history.Scanner
+	format history.Format
+	size   int64
+}
+
+// next maps a history entry to a record. Quality: zsh extended history is
+// high (timestamp and duration), other timestamped entries medium, the rest low.
+func (s *fileSource) next() (record, bool) {
+	if !s.sc.Scan() {
+		return record{}, false
+	}
+	e := s.sc.Entry()
+	r := record{seq: e.Line, dedupLine: e.CmdLine, cmd: e.Cmd, startedAt: e.Ts, tier: "low"}
+	switch {
+	case s.format == history.FormatZsh:
+		r.durMs = int64(e.DurSec) * 1000
+		r.tier = "high"
+	case e.Ts > 0:
+		r.tier = "medium"
+	}
+	if len(e.Paths) > 0 {
+		b, _ := json.Marshal(map[string][]string{"paths": e.Paths})
+		r.extra = string(b)
+	}
+	return r, true
+}
+
+func (s *fileSource) err() error               { return s.sc.Err() }
+func (s *fileSource) skipped() int             { return s.sc.Skipped() }
+func (s *fileSource) close() error             { return s.f.Close() }
+func (s *fileSource) progress() (int64, int64) { return s.sc.Offset(), s.size }
+
+func newBatchID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
@@ -0,0 +1,190 @@
+package imp
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Database sources: history tools that keep their own SQLite store.
+const (
+	SourceAtuin  = "atuin"  // ~/.local/share/atuin/history.db
+	SourceHistdb = "histdb" // ~/.histdb/zsh-history.db
+	SourceMcfly  = "mcfly"  // ~/.local/share/mcfly/history.db
+)
+
+// sqliteMagic is the header of every SQLite database file.
+var sqliteMagic = []byte("SQLite format 3\x00")
+
+func isDBSource(shell string) bool {
+	switch shell {
+	case SourceAtuin, SourceHistdb, SourceMcfly:
+		return true
+	}
+	return false
+}
+
+// DetectDBSource reports which database source path is, or "" when it is not
+// a SQLite file (line-based history) or not a known schema.
+func DetectDBSource(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	head := make([]byte, len(sqliteMagic))
+	_, err = io.ReadFull(f, head)
+	_ = f.Close()
+	if err != nil || !bytes.Equal(head, sqliteMagic) {
+		return "", nil
+	}
+	src, err := openReadOnly(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = src.Close() }()
+	switch {
+	case hasColumns(src, "history", "timestamp", "exit", "hostname"):
+		return SourceAtuin, nil
+	case hasColumns(src, "history", "command_id", "place_id") && hasColumns(src, "places", "dir"):
+		return SourceHistdb, nil
+	case hasColumns(src, "commands", "cmd", "when_run"):
+		return SourceMcfly, nil
+	}
+	return "", fmt.Errorf("%s: SQLite file is not an atuin, zsh-histdb or McFly database", path)
+}
+
+// openReadOnly opens a SQLite file without taking write locks on it.
+func openReadOnly(path string) (*sql.DB, error) {
+	u := url.URL{Scheme: "file", Path: path, RawQuery: "mode=ro"}
+	conn, err := sql.Open("sqlite3", u.String())
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Ping(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func hasColumns(conn *sql.DB, table string, cols ...string) bool {
+	for _, c := range cols {
+		var n int
+		if err := conn.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, c).Scan(&n); err != nil || n == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// dbQueries select each source's rows oldest first as: row id, command,
+// start (seconds), duration (ms), exit status (NULL when unknown), cwd, host,
+// source session id.
+var dbQueries = map[string]string{
+	// timestamp and duration are nanoseconds; exit/duration -1 mean unknown
+	SourceAtuin: `SELECT rowid, command, timestamp / 1e9,
+		CASE WHEN duration > 0 THEN duration / 1000000 ELSE 0 END,
+		CASE WHEN exit >= 0 THEN exit END,
+		COALESCE(cwd, ''), COALESCE(hostname, ''), COALESCE(session, '')
+		FROM history WHERE deleted_at IS NULL ORDER BY timestamp, rowid`,
+	// start_time and duration are seconds; duration is NULL while running
+	SourceHistdb: `SELECT h.id, c.argv, h.start_time,
+		COALESCE(h.duration, 0) * 1000,
+		h.exit_status,
+		COALESCE(p.dir, ''), COALESCE(p.host, ''), COALESCE(CAST(h.session AS TEXT), '')
+		FROM history h
+		JOIN commands c ON c.id = h.command_id
+		LEFT JOIN places p ON p.id = h.place_id
+		ORDER BY h.start_time, h.id`,
+	// when_run is seconds; McFly records no duration or host
+	SourceMcfly: `SELECT id, cmd, when_run, 0, exit_code,
+		COALESCE(dir, ''), '', COALESCE(session_id, '')
+		FROM commands ORDER BY when_run, id`,
+}
+
+// dbSource streams records from a database source. Rows keep cwd, exit
+// status, duration and host; the source session id goes to extra_json.
+type dbSource struct {
+	conn     *sql.DB
+	rows     *sql.Rows
+	source   string
+	n, total int64
+	skip     int
+	scanErr  error
+}
+
+func openDBSource(path, source string) (*dbSource, error) {
+	q, ok := dbQueries[source]
+	if !ok {
+		return nil, fmt.Errorf("unknown database source %q", source)
+	}
+	conn, err := openReadOnly(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &dbSource{conn: conn, source: source}
+	_ = conn.QueryRow(`SELECT COUNT(*) FROM (` + q + `)`).Scan(&s.total)
+	if s.rows, err = conn.Query(q); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("read %s database: %w", source, err)
+	}
+	return s, nil
+}
+
+// next returns the next row with a command and start time. The row id stands
+// in for the line number in DedupHash.
+func (s *dbSource) next() (record, bool) {
+	for s.scanErr == nil && s.rows.Next() {
+		s.n++
+		var r record
+		var exit sql.NullInt64
+		var session string
+		if err := s.rows.Scan(&r.dedupLine, &r.cmd, &r.startedAt, &r.durMs, &exit, &r.cwd, &r.host, &session); err != nil {
+			s.scanErr = fmt.Errorf("read %s database: %w", s.source, err)
+			return record{}, false
+		}
+		if strings.TrimSpace(r.cmd) == "" || r.startedAt <= 0 {
+			s.skip++
+			continue
+		}
+		r.seq = int(s.n)
+		// tier is high when the source recorded the exit status (alongside
+		// time and cwd), else medium
+		r.tier = "medium"
+		if exit.Valid {
+			v := int(exit.Int64)
+			r.exit = &v
+			r.tier = "high"
+		}
+		if s.source == SourceAtuin {
+			// atuin stores hostname as "host:user"
+			r.host, _, _ = strings.Cut(r.host, ":")
+		}
+		if session != "" {
+			b, _ := json.Marshal(map[string]string{"source": s.source, "session": session})
+			r.extra = string(b)
+		}
+		return r, true
+	}
+	return record{}, false
+}
+
+func (s *dbSource) err() error {
+	if s.scanErr != nil {
+		return s.scanErr
+	}
+	return s.rows.Err()
+}
+
+func (s *dbSource) skipped() int                  { return s.skip }
+func (s *dbSource) progress() (done, total int64) { return s.n, s.total }
+
+func (s *dbSource) close() error {
+	_ = s.rows.Close()
+	return s.conn.Close()
+}
@@ -0,0 +1,174 @@
+package imp
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mrcawood/History_eXtended/internal/db"
+)
+
+// writeSourceDB creates a SQLite file at path with the given statements.
+func writeSourceDB(t *testing.T, path string, stmts ...string) {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	for _, s := range stmts {
+		if _, err := conn.Exec(s); err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+	}
+}
+
+type importedRow struct {
+	exit  sql.NullInt64
+	dur   int64
+	cwd   string
+	tier  string
+	host  string
+	extra string
+}
+
+func importedEvent(t *testing.T, conn *sql.DB, cmd string) importedRow {
+	t.Helper()
+	var r importedRow
+	err := conn.QueryRow(`
+		SELECT e.exit_code, e.duration_ms, e.cwd, e.quality_tier, COALESCE(e.source_host, ''), COALESCE(e.extra_json, '')
+		FROM events e JOIN command_dict c ON c.cmd_id = e.cmd_id WHERE c.cmd_text = ?
+	`, cmd).Scan(&r.exit, &r.dur, &r.cwd, &r.tier, &r.host, &r.extra)
+	if err != nil {
+		t.Fatalf("event %q: %v", cmd, err)
+	}
+	return r
+}
+
+func TestRunDBSources(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		stmts  []string
+		check  func(t *testing.T, conn *sql.DB)
+	}{
+		{
+			name:   "atuin",
+			source: SourceAtuin,
+			stmts: []string{
+				`CREATE TABLE history (id TEXT PRIMARY KEY, timestamp INTEGER NOT NULL, duration INTEGER NOT NULL, exit INTEGER NOT NULL,
+					command TEXT NOT NULL, cwd TEXT NOT NULL, session TEXT NOT NULL, hostname TEXT NOT NULL, deleted_at INTEGER)`,
+				`INSERT INTO history VALUES ('a1', 1700000000000000000, 2500000000, 2, 'make test', '/src/app', 'sess1', 'laptop:alice', NULL)`,
+				`INSERT INTO history VALUES ('a2', 1700000010000000000, -1, -1, 'vim notes', '/home/alice', 'sess1', 'laptop:alice', NULL)`,
+				`INSERT INTO history VALUES ('a3', 1700000020000000000, 1000, 0, 'secret', '/', 'sess1', 'laptop:alice', 1700000030000000000)`,
+			},
+			check: func(t *testing.T, conn *sql.DB) {
+				r := importedEvent(t, conn, "make test")
+				if !r.exit.Valid || r.exit.Int64 != 2 || r.dur != 2500 || r.cwd != "/src/app" || r.tier != "high" || r.host != "laptop" {
+					t.Errorf("make test = %+v", r)
+				}
+				if r.extra != `{"session":"sess1","source":"atuin"}` {
+					t.Errorf("extra_json = %q", r.extra)
+				}
+				r = importedEvent(t, conn, "vim notes")
+				if r.exit.Valid || r.dur != 0 || r.tier != "medium" {
+					t.Errorf("unknown exit/duration = %+v", r)
+				}
+			},
+		},
+		{
+			name:   "histdb",
+			source: SourceHistdb,
+			stmts: []string{
+				`CREATE TABLE commands (id INTEGER PRIMARY KEY AUTOINCREMENT, argv TEXT, UNIQUE(argv))`,
+				`CREATE TABLE places (id INTEGER PRIMARY KEY AUTOINCREMENT, host TEXT, dir TEXT, UNIQUE(host, dir))`,
+				`CREATE TABLE history (id INTEGER PRIMARY KEY AUTOINCREMENT, session INT, command_id INT REFERENCES commands(id),
+					place_id INT REFERENCES places(id), exit_status INT, start_time INT, duration INT)`,
+				`INSERT INTO commands (argv) VALUES ('cargo build'), ('sleep 100')`,
+				`INSERT INTO places (host, dir) VALUES ('desk', '/src/rust')`,
+				`INSERT INTO history (session, command_id, place_id, exit_status, start_time, duration) VALUES (7, 1, 1, 0, 1700000000, 42)`,
+				`INSERT INTO history (session, command_id, place_id, exit_status, start_time, duration) VALUES (7, 2, 1, 130, 1700000100, 3)`,
+			},
+			check: func(t *testing.T, conn *sql.DB) {
+				r := importedEvent(t, conn, "cargo build")
+				if !r.exit.Valid || r.exit.Int64 != 0 || r.dur != 42000 || r.cwd != "/src/rust" || r.tier != "high" || r.host != "desk" {
+					t.Errorf("cargo build = %+v", r)
+				}
+				var signal string
+				_ = conn.QueryRow(`SELECT COALESCE(signal, '') FROM events WHERE exit_code = 130`).Scan(&signal)
+				if signal != "SIGINT" {
+					t.Errorf("signal = %q, want SIGINT", signal)
+				}
+			},
+		},
+		{
+			name:   "mcfly",
+			source: SourceMcfly,
+			stmts: []string{
+				`CREATE TABLE commands (id INTEGER PRIMARY KEY AUTOINCREMENT, cmd TEXT NOT NULL, cmd_tpl TEXT, session_id TEXT NOT NULL,
+					when_run INTEGER NOT NULL, exit_code INTEGER NOT NULL, selected INTEGER NOT NULL, dir TEXT, old_dir TEXT)`,
+				`INSERT INTO commands (cmd, session_id, when_run, exit_code, selected, dir) VALUES ('git push', 'mc1', 1700000000, 1, 0, '/src/site')`,
+			},
+			check: func(t *testing.T, conn *sql.DB) {
+				r := importedEvent(t, conn, "git push")
+				if !r.exit.Valid || r.exit.Int64 != 1 || r.cwd != "/src/site" || r.tier != "high" {
+					t.Errorf("git push = %+v", r)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			srcPath := filepath.Join(dir, "history.db")
+			writeSourceDB(t, srcPath, tt.stmts...)
+			if got, err := DetectDBSource(srcPath); err != nil || got != tt.source {
+				t.Fatalf("DetectDBSource = %q, %v; want %q", got, err, tt.source)
+			}
+			conn, err := db.Open(filepath.Join(dir, "hx.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = conn.Close() }()
+			res, err := Run(context.Background(), conn, srcPath, Options{Shell: "auto"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Inserted == 0 {
+				t.Fatal("nothing imported")
+			}
+			tt.check(t, conn)
+
+			// Re-import: DedupHash on source row id skips everything
+			res2, err := Run(context.Background(), conn, srcPath, Options{Shell: tt.source})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res2.Inserted != 0 {
+				t.Errorf("re-import inserted %d, want 0", res2.Inserted)
+			}
+			var shell string
+			_ = conn.QueryRow(`SELECT source_shell FROM import_batches LIMIT 1`).Scan(&shell)
+			if shell != tt.source {
+				t.Errorf("import_batches.source_shell = %q, want %q", shell, tt.source)
+			}
+		})
+	}
+}
+
+func TestDetectDBSourceNotSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".zsh_history")
+	if err := os.WriteFile(path, []byte(": 1458291931:15;make test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := DetectDBSource(path); err != nil || got != "" {
+		t.Errorf("DetectDBSource(text file) = %q, %v; want \"\", nil", got, err)
+	}
+	unknown := filepath.Join(t.TempDir(), "other.db")
+	writeSourceDB(t, unknown, `CREATE TABLE notes (body TEXT)`)
+	if _, err := DetectDBSource(unknown); err == nil {
+		t.Error("unknown SQLite schema: want error")
+	}
+}
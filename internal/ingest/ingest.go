@@ -2,17 +2,25 @@ package ingest
 
 import (
 	"fmt"
+	"sort"
+	"time"
 
-	"github.com/mrcawood/History_eXtended/internal/config"
 	"github.com/mrcawood/History_eXtended/internal/filter"
+	"github.com/mrcawood/History_eXtended/internal/gitctx"
+	"github.com/mrcawood/History_eXtended/internal/redact"
 	"github.com/mrcawood/History_eXtended/internal/spool"
 	"github.com/mrcawood/History_eXtended/internal/store"
 )
 
+// pendingMaxAge bounds how long an unmatched pre event is carried in the checkpoint.
+const pendingMaxAge = 7 * 24 * time.Hour
+
 // Run reads events from spool, pairs pre+post, inserts into DB.
 // Idempotent: INSERT OR IGNORE on events.
-// If cfg is non-nil, applies ignore_patterns and allowlist_mode before inserting.
-func Run(st *store.Store, eventsPath string, cfg *config.Config) (int, error) {
+// Commands pass flt (nil for the default rules) and are scrubbed of secrets
+// by scrub (nil when scrubbing is off), env values included, before
+// inserting. hxd builds both once from config (filter.New, redact.Capture).
+func Run(st *store.Store, eventsPath string, flt *filter.Filter, scrub *redact.Redactor) (int, error) {
 	events, err := spool.Read(eventsPath)
 	if err != nil {
 		return 0, err
@@ -20,37 +28,89 @@ func Run(st *store.Store, eventsPath string, cfg *config.Config) (int, error) {
 	if len(events) == 0 {
 		return 0, nil
 	}
-
-	// Buffer pre events by (sid, seq)
 	preBuf := make(map[string]*store.PreEvent)
+	n := ingestEvents(st, events, preBuf, flt, scrub)
+	reconcileStates(st, time.Now())
+	return n, nil
+}
+
+// Tail ingests only what was appended to the spool since the last checkpoint.
+// The checkpoint (inode, offset, unmatched pre events) is saved after each batch
+// is in the DB, so a crash replays at most one batch, which INSERT OR IGNORE absorbs.
+// Once the live file is fully ingested and at least rotateBytes long, it is sealed.
+// flt and scrub are applied as in Run.
+func Tail(st *store.Store, spoolDir string, flt *filter.Filter, scrub *redact.Redactor, rotateBytes int64) (int, error) {
+	cp, err := spool.LoadCheckpoint(spoolDir)
+	if err != nil {
+		return 0, err
+	}
 	var inserted int
+	for {
+		events, next, err := spool.Tail(spoolDir, cp)
+		if err != nil {
+			return inserted, err
+		}
+		moved := next.Inode != cp.Inode || next.Offset != cp.Offset
+		if !moved && len(events) == 0 {
+			break
+		}
+		preBuf := make(map[string]*store.PreEvent, len(next.Pending))
+		for _, e := range next.Pending {
+			preBuf[pairKey(e.Sid, e.Seq)] = preFromSpool(e)
+		}
+		inserted += ingestEvents(st, events, preBuf, flt, scrub)
+		next.Pending = pendingEvents(preBuf, time.Now())
+		if err := spool.SaveCheckpoint(spoolDir, next); err != nil {
+			return inserted, fmt.Errorf("save checkpoint: %w", err)
+		}
+		cp = next
+	}
+	reconcileStates(st, time.Now())
+	if rotateBytes > 0 {
+		if _, err := spool.Rotate(spoolDir, cp, rotateBytes); err != nil {
+			return inserted, fmt.Errorf("rotate spool: %w", err)
+		}
+	}
+	return inserted, nil
+}
 
+// ingestEvents filters and scrubs pre events, pairs them with post events using preBuf
+// (which may carry pre events from earlier batches) and inserts matched pairs. Unmatched pre events remain in
+// preBuf; those first seen in this batch are recorded as running events so
+// in-flight commands are visible before their post arrives.
+func ingestEvents(st *store.Store, events []spool.Event, preBuf map[string]*store.PreEvent, flt *filter.Filter, scrubber *redact.Redactor) int {
+	var inserted int
+	git := gitctx.NewResolver()
+	fresh := make(map[string]bool)
+	if flt == nil {
+		flt, _ = filter.New(nil)
+	}
 	for _, e := range events {
+		key := pairKey(e.Sid, e.Seq)
 		if e.T == "pre" {
-			key := fmt.Sprintf("%s:%d", e.Sid, e.Seq)
-			preBuf[key] = &store.PreEvent{
-				T:    e.T,
-				Ts:   e.Ts,
-				Sid:  e.Sid,
-				Seq:  e.Seq,
-				Cmd:  e.Cmd,
-				Cwd:  e.Cwd,
-				Tty:  e.Tty,
-				Host: e.Host,
+			pre := preFromSpool(e)
+			cmd, keep := flt.Admit(pre.Cmd, pre.Cwd, pre.Host, scrubber)
+			if !keep {
+				// Its post arrives as a late post and completes nothing
+				continue
 			}
+			pre.Cmd, pre.Env = cmd, scrubber.ScrubEnv(pre.Env)
+			preBuf[key] = pre
+			fresh[key] = true
 			continue
 		}
 		// post
-		key := fmt.Sprintf("%s:%d", e.Sid, e.Seq)
+		post := postFromSpool(e)
 		pre, ok := preBuf[key]
 		if !ok {
+			// Late post whose pre was already recorded (and dropped from pending)
+			if done, err := st.CompleteEvent(post); err == nil && done {
+				inserted++
+			}
 			continue
 		}
 		delete(preBuf, key)
-
-		if !filter.ShouldCapture(pre.Cmd, cfg) {
-			continue
-		}
+		delete(fresh, key)
 
 		if err := st.EnsureSession(pre.Sid, pre.Host, pre.Tty, pre.Cwd, pre.Ts); err != nil {
 			continue
@@ -59,15 +119,8 @@ func Run(st *store.Store, eventsPath string, cfg *config.Config) (int, error) {
 		if err != nil {
 			continue
 		}
-		post := &store.PostEvent{
-			T:     e.T,
-			Ts:    e.Ts,
-			Sid:   e.Sid,
-			Seq:   e.Seq,
-			Exit:  e.Exit,
-			DurMs: e.DurMs,
-			Pipe:  e.Pipe,
-		}
+		gi := git.Resolve(pre.Cwd)
+		pre.RepoRoot, pre.GitBranch, pre.GitCommit = gi.Root, gi.Branch, gi.Commit
 		insertedRow, ierr := st.InsertEvent(pre, post, cmdID)
 		if ierr != nil {
 			continue
@@ -79,6 +132,70 @@ func Run(st *store.Store, eventsPath string, cfg *config.Config) (int, error) {
 			// non-fatal
 		}
 	}
+	for key := range fresh {
+		recordPending(st, preBuf[key], git)
+	}
+	return inserted
+}
 
-	return inserted, nil
+// recordPending stores an unmatched pre event as a running event.
+func recordPending(st *store.Store, pre *store.PreEvent, git *gitctx.Resolver) {
+	if err := st.EnsureSession(pre.Sid, pre.Host, pre.Tty, pre.Cwd, pre.Ts); err != nil {
+		return
+	}
+	cmdID, err := st.CmdID(pre.Cmd, pre.Ts)
+	if err != nil {
+		return
+	}
+	gi := git.Resolve(pre.Cwd)
+	pre.RepoRoot, pre.GitBranch, pre.GitCommit = gi.Root, gi.Branch, gi.Commit
+	_, _ = st.InsertPendingEvent(pre, cmdID, store.StateRunning)
+}
+
+func pairKey(sid string, seq int) string {
+	return fmt.Sprintf("%s:%d", sid, seq)
+}
+
+func preFromSpool(e spool.Event) *store.PreEvent {
+	return &store.PreEvent{
+		T:    e.T,
+		Ts:   e.Ts,
+		Sid:  e.Sid,
+		Seq:  e.Seq,
+		Cmd:  e.Cmd,
+		Cwd:  e.Cwd,
+		Tty:  e.Tty,
+		Host: e.Host,
+		Env:  e.Env,
+	}
+}
+
+func postFromSpool(e spool.Event) *store.PostEvent {
+	return &store.PostEvent{
+		T:     e.T,
+		Ts:    e.Ts,
+		Sid:   e.Sid,
+		Seq:   e.Seq,
+		Exit:  e.Exit,
+		DurMs: e.DurMs,
+		Pipe:  e.Pipe,
+	}
+}
+
+// pendingEvents converts unmatched pre events back to spool form for the checkpoint,
+// dropping those older than pendingMaxAge.
+func pendingEvents(preBuf map[string]*store.PreEvent, now time.Time) []spool.Event {
+	cutoff := float64(now.Add(-pendingMaxAge).Unix())
+	var out []spool.Event
+	for _, p := range preBuf {
+		if p.Ts < cutoff {
+			continue
+		}
+		out = append(out, spool.Event{
+			T: p.T, Ts: p.Ts, Sid: p.Sid, Seq: p.Seq,
+			Cmd: p.Cmd, Cwd: p.Cwd, Tty: p.Tty, Host: p.Host, Env: p.Env,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Ts < out[j].Ts })
+	return out
 }
@@ -0,0 +1,60 @@
+package ingest
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mrcawood/History_eXtended/internal/store"
+)
+
+// reconcileStates re-evaluates running events: those superseded by a later
+// command in the session (or older than pendingMaxAge) become unknown; those
+// whose shell has exited become interrupted. Errors are non-fatal.
+func reconcileStates(st *store.Store, now time.Time) {
+	_, _ = st.MarkStaleRunning(float64(now.Add(-pendingMaxAge).Unix()))
+	sessions, err := st.RunningSessions()
+	if err != nil {
+		return
+	}
+	localHost, _ := os.Hostname()
+	for sid, host := range sessions {
+		if !ShellAlive(sid, host, localHost) {
+			_, _ = st.MarkSessionInterrupted(sid)
+		}
+	}
+}
+
+// ShellAlive reports whether the shell owning sid may still be running. Hook
+// session IDs embed the shell PID (hx-<pid>-<ts>-<rand>). Sessions from other
+// hosts or with unrecognised IDs cannot be checked and are assumed alive.
+func ShellAlive(sid, host, localHost string) bool {
+	if host == "" || host != localHost {
+		return true
+	}
+	pid := sessionPID(sid)
+	if pid <= 0 {
+		return true
+	}
+	return !errors.Is(syscall.Kill(pid, 0), syscall.ESRCH)
+}
+
+// sessionPID extracts the shell PID from a hook session ID, or 0.
+func sessionPID(sid string) int {
+	rest, ok := strings.CutPrefix(sid, "hx-")
+	if !ok {
+		return 0
+	}
+	pidStr, _, ok := strings.Cut(rest, "-")
+	if !ok {
+		return 0
+	}
+	pid, err := strconv.Atoi(pidStr)
+	if err != nil {
+		return 0
+	}
+	return pid
+}
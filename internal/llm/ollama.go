@@ -0,0 +1,29 @@
+package llm
+
+import (
+	"context"
+
+	"github.com/mrcawood/History_eXtended/internal/ollama"
+)
+
+// ollamaProvider talks to Ollama's native /api endpoints.
+type ollamaProvider struct {
+	baseURL, embedModel, chatModel string
+}
+
+func (p *ollamaProvider) Name() string       { return "ollama" }
+func (p *ollamaProvider) BaseURL() string    { return p.baseURL }
+func (p *ollamaProvider) EmbedModel() string { return p.embedModel }
+func (p *ollamaProvider) ChatModel() string  { return p.chatModel }
+
+func (p *ollamaProvider) Available(ctx context.Context) bool {
+	return ollama.Available(ctx, p.baseURL)
+}
+
+func (p *ollamaProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return ollama.Embed(ctx, p.baseURL, p.embedModel, texts)
+}
+
+func (p *ollamaProvider) Complete(ctx context.Context, prompt string) (string, error) {
+	return ollama.Generate(ctx, p.baseURL, p.chatModel, prompt)
+}
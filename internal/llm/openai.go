@@ -0,0 +1,155 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+const (
+	embedTimeout     = 30 * time.Second
+	completeTimeout  = 60 * time.Second
+	availableTimeout = 5 * time.Second
+)
+
+// openAIProvider talks to an OpenAI-compatible server: /embeddings,
+// /chat/completions and /models under a base URL that ends in /v1.
+type openAIProvider struct {
+	baseURL, embedModel, chatModel string
+	apiKey                         string // sent as a Bearer token when set
+}
+
+func (p *openAIProvider) Name() string       { return "openai" }
+func (p *openAIProvider) BaseURL() string    { return p.baseURL }
+func (p *openAIProvider) EmbedModel() string { return p.embedModel }
+func (p *openAIProvider) ChatModel() string  { return p.chatModel }
+
+// Available uses GET /models as a lightweight check.
+func (p *openAIProvider) Available(ctx context.Context) bool {
+	resp, err := p.do(ctx, http.MethodGet, "models", nil, availableTimeout)
+	if err != nil {
+		return false
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// Embed uses POST /embeddings with input as an array of strings. Servers
+// differ on whether they normalize, so vectors are L2-normalized here.
+func (p *openAIProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	reqBody := map[string]interface{}{"input": texts}
+	if p.embedModel != "" {
+		reqBody["model"] = p.embedModel
+	}
+	var out struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := p.post(ctx, "embeddings", reqBody, embedTimeout, &out); err != nil {
+		return nil, fmt.Errorf("openai embed: %w", err)
+	}
+	if len(out.Data) != len(texts) {
+		return nil, fmt.Errorf("openai embed: got %d embeddings, expected %d", len(out.Data), len(texts))
+	}
+	sort.SliceStable(out.Data, func(i, j int) bool { return out.Data[i].Index < out.Data[j].Index })
+	vecs := make([][]float32, len(out.Data))
+	for i, d := range out.Data {
+		vecs[i] = normalize(d.Embedding)
+	}
+	return vecs, nil
+}
+
+// Complete uses POST /chat/completions with the prompt as a single user
+// message.
+func (p *openAIProvider) Complete(ctx context.Context, prompt string) (string, error) {
+	reqBody := map[string]interface{}{
+		"messages": []map[string]string{{"role": "user", "content": prompt}},
+		"stream":   false,
+	}
+	if p.chatModel != "" {
+		reqBody["model"] = p.chatModel
+	}
+	var out struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := p.post(ctx, "chat/completions", reqBody, completeTimeout, &out); err != nil {
+		return "", fmt.Errorf("openai chat: %w", err)
+	}
+	if len(out.Choices) == 0 {
+		return "", fmt.Errorf("openai chat: no choices in response")
+	}
+	return out.Choices[0].Message.Content, nil
+}
+
+// post sends reqBody as JSON to path and decodes a 200 response into out.
+func (p *openAIProvider) post(ctx context.Context, path string, reqBody interface{}, timeout time.Duration, out interface{}) error {
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return err
+	}
+	resp, err := p.do(ctx, http.MethodPost, path, body, timeout)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, string(b))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (p *openAIProvider) do(ctx context.Context, method, path string, body []byte, timeout time.Duration) (*http.Response, error) {
+	u, err := url.JoinPath(p.baseURL, path)
+	if err != nil {
+		return nil, err
+	}
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, rd)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+	client := &http.Client{Timeout: timeout}
+	return client.Do(req)
+}
+
+// normalize scales v to unit length so a dot product is cosine similarity.
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	n := float32(1 / math.Sqrt(sum))
+	for i := range v {
+		v[i] *= n
+	}
+	return v
+}
@@ -0,0 +1,127 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// openAIStandIn answers /v1/models, /v1/embeddings and /v1/chat/completions
+// like llama.cpp's server and records the Authorization header it saw.
+func openAIStandIn(t *testing.T, auth *string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/models", func(w http.ResponseWriter, r *http.Request) {
+		*auth = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(`{"object":"list","data":[{"id":"local"}]}`))
+	})
+	mux.HandleFunc("/v1/embeddings", func(w http.ResponseWriter, r *http.Request) {
+		*auth = r.Header.Get("Authorization")
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Model != "bge-small" {
+			t.Errorf("embed model = %q, want bge-small", req.Model)
+		}
+		// Out of order and unnormalized, as some servers return them
+		type item struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		}
+		var data []item
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			data = append(data, item{Index: i, Embedding: []float32{float32(i + 1), 0, 0}})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	})
+	mux.HandleFunc("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		*auth = r.Header.Get("Authorization")
+		var req struct {
+			Model    string `json:"model"`
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Model != "qwen2.5" || len(req.Messages) != 1 || req.Messages[0].Role != "user" {
+			t.Errorf("chat request = %+v", req)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"role": "assistant", "content": "echo: " + req.Messages[0].Content}},
+			},
+		})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOpenAIProvider(t *testing.T) {
+	var auth string
+	server := openAIStandIn(t, &auth)
+	p := &openAIProvider{baseURL: server.URL + "/v1", embedModel: "bge-small", chatModel: "qwen2.5", apiKey: "sk-test"}
+	ctx := context.Background()
+
+	if !p.Available(ctx) {
+		t.Fatal("Available = false, want true")
+	}
+	if auth != "Bearer sk-test" {
+		t.Errorf("Authorization = %q, want Bearer sk-test", auth)
+	}
+
+	vecs, err := p.Embed(ctx, []string{"make", "make test"})
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(vecs) != 2 {
+		t.Fatalf("len(vecs) = %d, want 2", len(vecs))
+	}
+	for i, v := range vecs {
+		if math.Abs(float64(v[0])-1) > 1e-6 {
+			t.Errorf("vecs[%d] = %v, want unit vector", i, v)
+		}
+	}
+
+	out, err := p.Complete(ctx, "hi")
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if out != "echo: hi" {
+		t.Errorf("Complete = %q, want echo: hi", out)
+	}
+}
+
+func TestOpenAIProviderErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "model not loaded", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	p := &openAIProvider{baseURL: server.URL + "/v1"}
+	ctx := context.Background()
+
+	if p.Available(ctx) {
+		t.Error("Available = true, want false on 503")
+	}
+	if _, err := p.Embed(ctx, []string{"ls"}); err == nil {
+		t.Error("Embed: want error on 503")
+	}
+	if _, err := p.Complete(ctx, "hi"); err == nil {
+		t.Error("Complete: want error on 503")
+	}
+	if vecs, err := p.Embed(ctx, nil); err != nil || vecs != nil {
+		t.Errorf("Embed(nil) = %v, %v; want nil, nil without a request", vecs, err)
+	}
+}
@@ -0,0 +1,88 @@
+// Package llm puts embedding and chat models behind one interface so
+// semantic search, the embedding index and hx query summaries work with
+// Ollama or any OpenAI-compatible server (llama.cpp, vLLM, ...).
+package llm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mrcawood/History_eXtended/internal/config"
+)
+
+// Provider embeds text and answers prompts.
+type Provider interface {
+	// Name is the provider kind from config ("ollama", "openai").
+	Name() string
+	// BaseURL is the server the provider talks to.
+	BaseURL() string
+	// EmbedModel names the embedding model; the embedding index keys
+	// vectors by it.
+	EmbedModel() string
+	// ChatModel names the model used by Complete.
+	ChatModel() string
+	// Available reports whether the server is reachable.
+	Available(ctx context.Context) bool
+	// Embed returns one L2-normalized vector per text, in order.
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	// Complete returns the model's answer to a single prompt.
+	Complete(ctx context.Context, prompt string) (string, error)
+}
+
+// defaultOpenAIBaseURL is llama.cpp's llama-server default.
+const defaultOpenAIBaseURL = "http://localhost:8080/v1"
+
+// New returns the provider selected by cfg.LLM, or nil when inference is
+// turned off (llm.enabled: false, provider: none, or ollama_enabled: false
+// for the ollama provider when llm.enabled is unset). Empty llm fields fall
+// back to the ollama_* keys for the ollama provider. The openai provider
+// needs llm.embed_model: it has no default, and the embedding index is
+// keyed by model name.
+func New(cfg *config.Config) (Provider, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	l := cfg.LLM
+	if l.Enabled != nil && !*l.Enabled {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(l.Provider)) {
+	case "", "ollama":
+		if l.Enabled == nil && !cfg.OllamaEnabled {
+			return nil, nil
+		}
+		return &ollamaProvider{
+			baseURL:    firstNonEmpty(l.BaseURL, cfg.OllamaBaseURL),
+			embedModel: firstNonEmpty(l.EmbedModel, cfg.OllamaEmbedModel),
+			chatModel:  firstNonEmpty(l.ChatModel, cfg.OllamaChatModel),
+		}, nil
+	case "openai":
+		if strings.TrimSpace(l.EmbedModel) == "" {
+			return nil, fmt.Errorf("llm: provider openai needs llm.embed_model")
+		}
+		p := &openAIProvider{
+			baseURL:    firstNonEmpty(l.BaseURL, defaultOpenAIBaseURL),
+			embedModel: l.EmbedModel,
+			chatModel:  l.ChatModel,
+		}
+		if l.APIKeyEnv != "" {
+			p.apiKey = os.Getenv(l.APIKeyEnv)
+		}
+		return p, nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("llm: unknown provider %q (want ollama, openai or none)", l.Provider)
+	}
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,119 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mrcawood/History_eXtended/internal/config"
+)
+
+func baseConfig() *config.Config {
+	return &config.Config{
+		OllamaEnabled:    true,
+		OllamaBaseURL:    "http://localhost:11434",
+		OllamaEmbedModel: "nomic-embed-text",
+		OllamaChatModel:  "llama3.2",
+	}
+}
+
+func TestNew(t *testing.T) {
+	t.Setenv("HX_TEST_LLM_KEY", "sk-local")
+	on, off := true, false
+	tests := []struct {
+		name                 string
+		llm                  config.LLMConfig
+		enabled              bool
+		want                 string // provider name, "" for nil
+		baseURL, embed, chat string
+		apiKey               string
+	}{
+		{name: "default ollama", enabled: true, want: "ollama",
+			baseURL: "http://localhost:11434", embed: "nomic-embed-text", chat: "llama3.2"},
+		{name: "ollama overrides", enabled: true, llm: config.LLMConfig{Provider: "ollama", BaseURL: "http://gpu:11434", ChatModel: "mistral"},
+			want: "ollama", baseURL: "http://gpu:11434", embed: "nomic-embed-text", chat: "mistral"},
+		{name: "openai", enabled: true, llm: config.LLMConfig{Provider: "OpenAI", EmbedModel: "bge-small", ChatModel: "qwen2.5", APIKeyEnv: "HX_TEST_LLM_KEY"},
+			want: "openai", baseURL: defaultOpenAIBaseURL, embed: "bge-small", chat: "qwen2.5", apiKey: "sk-local"},
+		{name: "none", enabled: true, llm: config.LLMConfig{Provider: "none"}},
+		{name: "ollama disabled", enabled: false},
+		{name: "openai without ollama", enabled: false, llm: config.LLMConfig{Provider: "openai", EmbedModel: "bge-small"},
+			want: "openai", baseURL: defaultOpenAIBaseURL, embed: "bge-small"},
+		{name: "llm disabled", enabled: true, llm: config.LLMConfig{Enabled: &off, Provider: "openai", EmbedModel: "bge-small"}},
+		{name: "llm enabled over ollama_enabled", enabled: false, llm: config.LLMConfig{Enabled: &on},
+			want: "ollama", baseURL: "http://localhost:11434", embed: "nomic-embed-text", chat: "llama3.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := baseConfig()
+			cfg.OllamaEnabled = tt.enabled
+			cfg.LLM = tt.llm
+			p, err := New(cfg)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			if tt.want == "" {
+				if p != nil {
+					t.Fatalf("New = %s, want nil", p.Name())
+				}
+				return
+			}
+			if p == nil {
+				t.Fatalf("New = nil, want %s", tt.want)
+			}
+			if p.Name() != tt.want || p.BaseURL() != tt.baseURL || p.EmbedModel() != tt.embed || p.ChatModel() != tt.chat {
+				t.Errorf("New = %s %s %s %s, want %s %s %s %s",
+					p.Name(), p.BaseURL(), p.EmbedModel(), p.ChatModel(), tt.want, tt.baseURL, tt.embed, tt.chat)
+			}
+			if o, ok := p.(*openAIProvider); ok && o.apiKey != tt.apiKey {
+				t.Errorf("apiKey = %q, want %q", o.apiKey, tt.apiKey)
+			}
+		})
+	}
+
+	if _, err := New(nil); err != nil {
+		t.Errorf("New(nil): %v", err)
+	}
+	cfg := baseConfig()
+	cfg.LLM.Provider = "bedrock"
+	if _, err := New(cfg); err == nil {
+		t.Error("New: want error for unknown provider")
+	}
+	cfg.LLM.Provider = "openai"
+	if _, err := New(cfg); err == nil {
+		t.Error("New: want error for openai without embed_model")
+	}
+}
+
+func TestOllamaProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			_, _ = w.Write([]byte(`{"models":[]}`))
+		case "/api/embed":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"embeddings": [][]float32{{1, 0}}})
+		case "/api/generate":
+			_, _ = w.Write([]byte(`{"response":"done"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	cfg := baseConfig()
+	cfg.OllamaBaseURL = server.URL
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ctx := context.Background()
+	if !p.Available(ctx) {
+		t.Error("Available = false, want true")
+	}
+	if vecs, err := p.Embed(ctx, []string{"ls"}); err != nil || len(vecs) != 1 {
+		t.Errorf("Embed = %v, %v", vecs, err)
+	}
+	if out, err := p.Complete(ctx, "hi"); err != nil || out != "done" {
+		t.Errorf("Complete = %q, %v; want done", out, err)
+	}
+}
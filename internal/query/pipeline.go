@@ -3,10 +3,13 @@ package query
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"strings"
 
 	"github.com/mrcawood/History_eXtended/internal/config"
-	"github.com/mrcawood/History_eXtended/internal/ollama"
+	"github.com/mrcawood/History_eXtended/internal/embedding"
+	"github.com/mrcawood/History_eXtended/internal/gitctx"
+	"github.com/mrcawood/History_eXtended/internal/llm"
 )
 
 const candidateLimit = 50
@@ -15,6 +18,13 @@ const resultLimit = 20
 // RetrieveOpts configures Retrieve behavior.
 type RetrieveOpts struct {
 	NoFallback bool
+	Repo       string // restrict to repo root path or base name
+	Branch     string // restrict to git branch
+
+	// Where is an extra " AND ..." clause over events e and sessions s
+	// (search.Where.SQL), with its arguments in WhereArgs.
+	Where     string
+	WhereArgs []interface{}
 }
 
 // RetrieveMeta holds explainability data for a retrieval (no sensitive content).
@@ -24,6 +34,7 @@ type RetrieveMeta struct {
 	FTSCount         int
 	UsedFallback     bool
 	SemanticReranked bool
+	SemanticIndex    bool // candidates came from the embedding index
 }
 
 // RetrieveResult is the result of Retrieve.
@@ -34,12 +45,23 @@ type RetrieveResult struct {
 
 // Retrieve finds evidence for a question: keyword-based FTS candidates, optionally semantic re-rank.
 // If FTS returns 0 results and NoFallback is false, falls back to recent events and sets Meta.UsedFallback.
+// Once hxd has indexed commands for the provider's embedding model, the index
+// ranks every command instead and only the question is embedded.
 func Retrieve(ctx context.Context, conn *sql.DB, question string, cfg *config.Config, opts *RetrieveOpts) (*RetrieveResult, error) {
 	if opts == nil {
 		opts = &RetrieveOpts{}
 	}
 	res := &RetrieveResult{Meta: RetrieveMeta{}}
 	if strings.TrimSpace(question) == "" {
+		if opts.Where == "" {
+			return res, nil
+		}
+		// Filters only: the most recent matching events
+		candidates, err := recentCandidates(conn, resultLimit, opts)
+		if err != nil {
+			return nil, err
+		}
+		res.Candidates = candidates
 		return res, nil
 	}
 
@@ -51,18 +73,31 @@ func Retrieve(ctx context.Context, conn *sql.DB, question string, cfg *config.Co
 	var candidates []Candidate
 	var err error
 	if ftsQuery != "" {
-		candidates, err = ftsCandidatesWithQuery(conn, ftsQuery, candidateLimit)
+		candidates, err = ftsCandidatesWithQuery(conn, ftsQuery, candidateLimit, opts)
 		if err != nil {
 			return nil, err
 		}
 	}
 	res.Meta.FTSCount = len(candidates)
 
+	p, _ := llm.New(cfg)
+	available := p != nil && p.Available(ctx)
+	if available {
+		if indexed, _, err := embedding.Stats(conn, p.EmbedModel()); err == nil && indexed > 0 {
+			ranked, err := indexCandidates(ctx, conn, p.EmbedModel(), p.Embed, question, opts)
+			if err == nil && len(ranked) > 0 {
+				res.Candidates = ranked[:min(resultLimit, len(ranked))]
+				res.Meta.SemanticIndex = true
+				return res, nil
+			}
+		}
+	}
+
 	if len(candidates) == 0 {
 		if opts.NoFallback {
 			return res, nil
 		}
-		candidates, err = recentCandidates(conn, candidateLimit)
+		candidates, err = recentCandidates(conn, candidateLimit, opts)
 		if err != nil {
 			return nil, err
 		}
@@ -72,11 +107,8 @@ func Retrieve(ctx context.Context, conn *sql.DB, question string, cfg *config.Co
 		return res, nil
 	}
 
-	if cfg != nil && cfg.OllamaEnabled && ollama.Available(ctx, cfg.OllamaBaseURL) {
-		embedFn := func(ctx context.Context, texts []string) ([][]float32, error) {
-			return ollama.Embed(ctx, cfg.OllamaBaseURL, cfg.OllamaEmbedModel, texts)
-		}
-		ranked, err := RerankBySemantic(ctx, question, candidates, embedFn)
+	if available {
+		ranked, err := RerankBySemantic(ctx, question, candidates, p.Embed)
 		if err != nil {
 			res.Candidates = candidates[:min(resultLimit, len(candidates))]
 			return res, nil
@@ -93,19 +125,92 @@ func Retrieve(ctx context.Context, conn *sql.DB, question string, cfg *config.Co
 	return res, nil
 }
 
-func ftsCandidatesWithQuery(conn *sql.DB, ftsQuery string, limit int) ([]Candidate, error) {
+// indexCandidates embeds the question once, takes the candidateLimit indexed
+// commands nearest to it among those with an event passing opts, and returns
+// the latest such event of each in similarity order.
+func indexCandidates(ctx context.Context, conn *sql.DB, model string, embed EmbedFn, question string, opts *RetrieveOpts) ([]Candidate, error) {
+	vecs, err := embed(ctx, []string{question})
+	if err != nil {
+		return nil, err
+	}
+	if len(vecs) != 1 {
+		return nil, fmt.Errorf("no question embedding")
+	}
+	gitWhere, gitArgs := gitctx.SQLFilter(opts.Repo, opts.Branch)
+	where := gitWhere + opts.Where
+	args := append(gitArgs, opts.WhereArgs...)
+	var eligible string
+	if where != "" {
+		eligible = `SELECT e.cmd_id FROM events e
+			LEFT JOIN command_dict c ON e.cmd_id = c.cmd_id
+			LEFT JOIN sessions s ON s.session_id = e.session_id
+			WHERE e.cmd_id IS NOT NULL` + where
+	}
+	matches, err := embedding.NearestIn(ctx, conn, model, vecs[0], candidateLimit, eligible, args...)
+	if err != nil || len(matches) == 0 {
+		return nil, err
+	}
+	ids := make([]interface{}, len(matches))
+	for i, m := range matches {
+		ids[i] = m.CmdID
+	}
+	rows, err := conn.QueryContext(ctx, `
+		SELECT e.event_id, e.session_id, e.seq, e.exit_code, e.cwd, COALESCE(c.cmd_text, ''), e.started_at, e.cmd_id
+		FROM events e
+		LEFT JOIN command_dict c ON e.cmd_id = c.cmd_id
+		LEFT JOIN sessions s ON s.session_id = e.session_id
+		WHERE e.cmd_id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)`+where+`
+		ORDER BY e.started_at DESC
+	`, append(ids, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	latest := make(map[int64]Candidate, len(matches))
+	for rows.Next() {
+		var c Candidate
+		var exitCode *int
+		var cmdID int64
+		if err := rows.Scan(&c.EventID, &c.SessionID, &c.Seq, &exitCode, &c.Cwd, &c.Cmd, &c.StartedAt, &cmdID); err != nil {
+			continue
+		}
+		if _, ok := latest[cmdID]; ok {
+			continue
+		}
+		if exitCode != nil {
+			c.ExitCode = *exitCode
+		}
+		latest[cmdID] = c
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	out := make([]Candidate, 0, len(latest))
+	for _, m := range matches {
+		if c, ok := latest[m.CmdID]; ok {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func ftsCandidatesWithQuery(conn *sql.DB, ftsQuery string, limit int, opts *RetrieveOpts) ([]Candidate, error) {
 	if ftsQuery == "" {
 		return nil, nil
 	}
+	gitWhere, gitArgs := gitctx.SQLFilter(opts.Repo, opts.Branch)
+	args := append([]interface{}{ftsQuery}, gitArgs...)
+	args = append(args, opts.WhereArgs...)
 	rows, err := conn.Query(`
 		SELECT e.event_id, e.session_id, e.seq, e.exit_code, e.cwd, COALESCE(c.cmd_text, ''), e.started_at
 		FROM events_fts
 		JOIN events e ON e.event_id = events_fts.rowid
 		LEFT JOIN command_dict c ON e.cmd_id = c.cmd_id
-		WHERE events_fts MATCH ?
+		LEFT JOIN sessions s ON s.session_id = e.session_id
+		WHERE events_fts MATCH ?`+gitWhere+opts.Where+`
 		ORDER BY e.started_at DESC
 		LIMIT ?
-	`, ftsQuery, limit)
+	`, append(args, limit)...)
 	if err != nil {
 		return nil, err
 	}
@@ -113,14 +218,18 @@ func ftsCandidatesWithQuery(conn *sql.DB, ftsQuery string, limit int) ([]Candida
 	return scanCandidates(rows)
 }
 
-func recentCandidates(conn *sql.DB, limit int) ([]Candidate, error) {
+func recentCandidates(conn *sql.DB, limit int, opts *RetrieveOpts) ([]Candidate, error) {
+	gitWhere, gitArgs := gitctx.SQLFilter(opts.Repo, opts.Branch)
+	args := append(gitArgs, opts.WhereArgs...)
 	rows, err := conn.Query(`
 		SELECT e.event_id, e.session_id, e.seq, e.exit_code, e.cwd, COALESCE(c.cmd_text, ''), e.started_at
 		FROM events e
 		LEFT JOIN command_dict c ON e.cmd_id = c.cmd_id
+		LEFT JOIN sessions s ON s.session_id = e.session_id
+		WHERE 1=1`+gitWhere+opts.Where+`
 		ORDER BY e.started_at DESC
 		LIMIT ?
-	`, limit)
+	`, append(args, limit)...)
 	if err != nil {
 		return nil, err
 	}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/mrcawood/History_eXtended/internal/db"
+	"github.com/mrcawood/History_eXtended/internal/embedding"
 )
 
 func TestRetrieve_KeywordMatch(t *testing.T) {
@@ -143,3 +144,49 @@ func TestRetrieve_NoMatch_NoFallback(t *testing.T) {
 		t.Errorf("Expected FTSCount=0; got %d", result.Meta.FTSCount)
 	}
 }
+
+func TestIndexCandidates(t *testing.T) {
+	conn, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Skipf("DB open failed (FTS5 or timeout): %v", err)
+	}
+	defer conn.Close()
+	_, _ = conn.Exec("INSERT INTO sessions (session_id, started_at, host, tty) VALUES ('s1', 1, 'alpha', ''), ('s2', 1, 'beta', '')")
+	_, _ = conn.Exec("INSERT INTO command_dict (cmd_hash, cmd_text, first_seen_at) VALUES ('h1','git status',1), ('h2','make build',1), ('h3','git log',1)")
+	_, _ = conn.Exec(`INSERT INTO events (session_id, seq, started_at, cwd, cmd_id) VALUES
+		('s1', 1, 100, '/a', 1),
+		('s1', 2, 200, '/b', 1),
+		('s1', 3, 300, '/a', 2),
+		('s2', 1, 400, '/a', 3)`)
+
+	var texts []string
+	embed := func(ctx context.Context, in []string) ([][]float32, error) {
+		texts = append(texts, in...)
+		out := make([][]float32, len(in))
+		for i, t := range in {
+			if strings.Contains(t, "git") || strings.Contains(t, "version") {
+				out[i] = []float32{1, 0}
+			} else {
+				out[i] = []float32{0, 1}
+			}
+		}
+		return out, nil
+	}
+	ctx := context.Background()
+	if _, err := embedding.Backfill(ctx, conn, "m", embed, 100); err != nil {
+		t.Fatal(err)
+	}
+	texts = nil
+
+	opts := &RetrieveOpts{Where: " AND s.host = ?", WhereArgs: []interface{}{"alpha"}}
+	got, err := indexCandidates(ctx, conn, "m", embed, "which version control commands", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(texts) != 1 {
+		t.Errorf("embedded %d texts, want only the question", len(texts))
+	}
+	if len(got) != 2 || got[0].Cmd != "git status" || got[0].Cwd != "/b" || got[1].Cmd != "make build" {
+		t.Fatalf("indexCandidates = %+v, want latest git status on alpha, then make build", got)
+	}
+}
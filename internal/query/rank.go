@@ -17,7 +17,7 @@ type Candidate struct {
 }
 
 // CosineSimilarity returns the cosine similarity between two L2-normalized vectors.
-// Ollama embeddings are L2-normalized, so dot product equals cosine similarity.
+// Provider embeddings are L2-normalized, so dot product equals cosine similarity.
 func CosineSimilarity(a, b []float32) float32 {
 	if len(a) != len(b) || len(a) == 0 {
 		return 0
@@ -0,0 +1,101 @@
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mrcawood/History_eXtended/internal/config"
+	"github.com/mrcawood/History_eXtended/internal/envctx"
+)
+
+// placeholderRe finds secrets masked by an earlier pass, so a command
+// scrubbed by hxd and seen again at ingest keeps its drop action.
+var placeholderRe = regexp.MustCompile(`<REDACTED:([^>\s]+)>`)
+
+// Capture returns the Redactor capture-time scrubbing uses, or nil when
+// cfg.Redact.Capture is off. A nil cfg gets the built-in detectors. When the
+// redact config is invalid it still returns the built-ins, so a typo in a
+// custom rule never turns scrubbing off, along with the error to report.
+func Capture(cfg *config.Config) (*Redactor, error) {
+	if cfg == nil {
+		return Default(), nil
+	}
+	if !cfg.Redact.Capture {
+		return nil, nil
+	}
+	r, err := New(cfg.Redact)
+	if err != nil {
+		return Default(), err
+	}
+	return r, nil
+}
+
+// Scrub masks the secrets in cmd for storage. It returns keep false when one
+// of them is a kind whose action is drop: the whole command must not be
+// recorded.
+func (r *Redactor) Scrub(cmd string) (string, bool) {
+	for _, m := range r.Find(cmd) {
+		if r.drop[m.Kind] {
+			return "", false
+		}
+	}
+	for _, sm := range placeholderRe.FindAllStringSubmatch(cmd, -1) {
+		if r.drop[sm[1]] {
+			return "", false
+		}
+	}
+	return r.Redact(cmd), true
+}
+
+// ScrubEnv masks the secrets in the captured variable values of env, except
+// hashed ones. Each value is checked as NAME=value so rules keyed on the
+// assignment apply. Env values are masked, never dropped. It returns env
+// itself when nothing changed or r is nil.
+func (r *Redactor) ScrubEnv(env map[string]string) map[string]string {
+	if r == nil || len(env) == 0 {
+		return env
+	}
+	var out map[string]string
+	for name, val := range env {
+		if envctx.IsHashed(val) {
+			continue
+		}
+		assign := name + "=" + val
+		matches := r.Find(assign)
+		if len(matches) == 0 {
+			continue
+		}
+		masked, ok := strings.CutPrefix(r.Redact(assign), name+"=")
+		if !ok {
+			// The match took in the name: the whole value is the secret
+			masked = Placeholder(matches[0].Kind)
+		}
+		if out == nil {
+			out = make(map[string]string, len(env))
+			for k, v := range env {
+				out[k] = v
+			}
+		}
+		out[name] = masked
+	}
+	if out == nil {
+		return env
+	}
+	return out
+}
+
+func (r *Redactor) setAction(kind, action string) error {
+	switch action {
+	case "", "mask":
+		delete(r.drop, kind)
+	case "drop":
+		if r.drop == nil {
+			r.drop = make(map[string]bool)
+		}
+		r.drop[kind] = true
+	default:
+		return fmt.Errorf("redact: %s: unknown action %q (want mask or drop)", kind, action)
+	}
+	return nil
+}
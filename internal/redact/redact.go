@@ -0,0 +1,230 @@
+// Package redact finds secrets in command lines and text (cloud keys,
+// tokens, passwords, URL userinfo, sensitive assignments and high-entropy
+// strings) and masks them as <REDACTED:kind>. It backs hx export
+// --redacted, the prompt sent to the LLM provider, and redacted sync.
+package redact
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mrcawood/History_eXtended/internal/config"
+)
+
+// Match is a secret found in text: s[Start:End] is the span to mask.
+type Match struct {
+	Start, End int
+	Kind       string
+}
+
+// rule is one detector. When re has a group named "secret", only that group
+// is masked (the flag or variable name stays readable); otherwise the whole
+// match is.
+type rule struct {
+	kind string
+	re   *regexp.Regexp
+}
+
+// value is the tail shared by flag and assignment rules: a quoted string or
+// a bare word.
+const value = `(?P<secret>"[^"]*"|'[^']*'|[^\s;&|"']+)`
+
+// builtins run in order; an earlier rule wins when spans overlap, so the
+// specific key formats come before the generic shapes.
+var builtins = sync.OnceValue(func() []rule {
+	return []rule{
+		{"private-key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?(?:-----END [A-Z ]*PRIVATE KEY-----|$)`)},
+		{"aws-key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+		{"gcp-key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`)},
+		{"github-token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})`)},
+		{"slack-token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+		{"api-key", regexp.MustCompile(`\bsk-(?:proj-|ant-)?[A-Za-z0-9_-]{20,}`)},
+		{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)},
+		{"bearer", regexp.MustCompile(`(?i)\b(?:authorization:\s*(?:\w+\s+)?|bearer\s+|basic\s+)(?P<secret>[A-Za-z0-9._~+/-]{8,}=*)`)},
+		{"url-password", regexp.MustCompile(`(?i)\b[a-z][a-z0-9+.-]*://[^/\s:@]+:(?P<secret>[^/\s@]+)@`)},
+		{"password", regexp.MustCompile(`(?i)(?:^|\s)--?(?:password|passwd|pass|pwd|token|secret|api[-_]?key|access[-_]?key|client[-_]?secret|auth[-_]?token)(?:=|\s+)` + value)},
+		{"password", regexp.MustCompile(`\b(?:mysql|mysqldump|mysqladmin|mariadb)\b[^|;&\n]*?\s-p(?P<secret>[^\s'"]\S*)`)},
+		{"password", regexp.MustCompile(`\bsshpass\s+-p\s*(?P<secret>\S+)`)},
+		{"password", regexp.MustCompile(`\bcurl\b[^|;&\n]*?\s(?:-u|--user)\s*[^\s:]+:(?P<secret>[^\s'"]+)`)},
+		{"secret-var", regexp.MustCompile(`(?i)\b[A-Z0-9_]*(?:SECRET|PASSWORD|PASSWD|TOKEN|API_?KEY|ACCESS_?KEY|PRIVATE_?KEY|CREDENTIALS?)[A-Z0-9_]*=` + value)},
+	}
+})
+
+// highEntropyKind names the built-in random-string detector, which is code
+// rather than a regexp.
+const highEntropyKind = "high-entropy"
+
+// Kinds returns the names of the built-in detectors, for config's disable
+// list.
+func Kinds() []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, r := range builtins() {
+		if !seen[r.kind] {
+			seen[r.kind] = true
+			out = append(out, r.kind)
+		}
+	}
+	return append(out, highEntropyKind)
+}
+
+// Redactor masks secrets with the built-in detectors plus custom rules.
+type Redactor struct {
+	rules   []rule
+	entropy bool
+	drop    map[string]bool // kinds whose capture action is drop
+}
+
+// Default returns a Redactor with every built-in detector and no custom
+// rules.
+func Default() *Redactor {
+	return &Redactor{rules: builtins(), entropy: true}
+}
+
+// New returns a Redactor with the built-ins not listed in cfg.Disable,
+// followed by cfg.Rules. Custom rules run after the built-ins.
+func New(cfg config.RedactConfig) (*Redactor, error) {
+	off := make(map[string]bool)
+	known := make(map[string]bool)
+	for _, k := range Kinds() {
+		known[k] = true
+	}
+	for _, k := range cfg.Disable {
+		if !known[k] {
+			return nil, fmt.Errorf("redact: unknown detector %q in disable (have %s)", k, strings.Join(Kinds(), ", "))
+		}
+		off[k] = true
+	}
+	r := &Redactor{entropy: !off[highEntropyKind]}
+	for _, b := range builtins() {
+		if !off[b.kind] {
+			r.rules = append(r.rules, b)
+		}
+	}
+	for _, c := range cfg.Rules {
+		re, err := regexp.Compile(c.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redact: rule %q: %w", c.Name, err)
+		}
+		kind := c.Name
+		if kind == "" {
+			kind = "custom"
+		}
+		r.rules = append(r.rules, rule{kind: kind, re: re})
+		if err := r.setAction(kind, c.Action); err != nil {
+			return nil, err
+		}
+	}
+	for kind, action := range cfg.Actions {
+		if !known[kind] {
+			return nil, fmt.Errorf("redact: unknown detector %q in actions (have %s)", kind, strings.Join(Kinds(), ", "))
+		}
+		if err := r.setAction(kind, action); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Find returns the secrets in s, ordered by position and not overlapping.
+// A value that is a shell expansion ($TOKEN, $(cat f)) is not a secret.
+func (r *Redactor) Find(s string) []Match {
+	var found []Match
+	overlaps := func(start, end int) bool {
+		for _, m := range found {
+			if start < m.End && m.Start < end {
+				return true
+			}
+		}
+		return false
+	}
+	add := func(start, end int, kind string) {
+		if start >= end || strings.HasPrefix(s[start:end], "$") || overlaps(start, end) {
+			return
+		}
+		found = append(found, Match{Start: start, End: end, Kind: kind})
+	}
+	for _, ru := range r.rules {
+		secret := ru.re.SubexpIndex("secret")
+		for _, loc := range ru.re.FindAllStringSubmatchIndex(s, -1) {
+			if secret > 0 {
+				if loc[2*secret] >= 0 {
+					add(loc[2*secret], loc[2*secret+1], ru.kind)
+				}
+				continue
+			}
+			add(loc[0], loc[1], ru.kind)
+		}
+	}
+	if r.entropy {
+		for _, loc := range entropyCandidate.FindAllStringIndex(s, -1) {
+			if loc[0] > 0 && strings.ContainsRune("/.~", rune(s[loc[0]-1])) {
+				continue
+			}
+			if looksRandom(s[loc[0]:loc[1]]) {
+				add(loc[0], loc[1], highEntropyKind)
+			}
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Start < found[j].Start })
+	return found
+}
+
+// Redact replaces every secret in s with <REDACTED:kind>.
+func (r *Redactor) Redact(s string) string {
+	matches := r.Find(s)
+	if len(matches) == 0 {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(s[last:m.Start])
+		b.WriteString(Placeholder(m.Kind))
+		last = m.End
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// Placeholder is the text a secret of kind is replaced with.
+func Placeholder(kind string) string {
+	return "<REDACTED:" + kind + ">"
+}
+
+// entropyCandidate matches base64/base62-ish runs long enough to be keys.
+// Find skips runs that follow /, . or ~ (path components).
+var entropyCandidate = regexp.MustCompile(`[A-Za-z0-9+_-][A-Za-z0-9+/_-]{19,}={0,2}`)
+
+// looksRandom reports whether a candidate run mixes upper case, lower case
+// and digits and has close to the Shannon entropy of random text of its
+// length. Identifiers like TestOpenAIProvider2 fall well short.
+func looksRandom(s string) bool {
+	var upper, lower, digit bool
+	counts := make(map[rune]int)
+	for _, c := range s {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= '0' && c <= '9':
+			digit = true
+		}
+		counts[c]++
+	}
+	if !upper || !lower || !digit {
+		return false
+	}
+	n := float64(len(s))
+	var h float64
+	for _, k := range counts {
+		p := float64(k) / n
+		h -= p * math.Log2(p)
+	}
+	return h >= math.Min(math.Log2(n)-0.5, 4.3)
+}
@@ -0,0 +1,109 @@
+package search
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+// seqSpan is a run of seq numbers in one session.
+type seqSpan struct {
+	sessionID string
+	lo, hi    int
+	first     int // index of the earliest hit in the span, for group order
+}
+
+// WithContext returns hits with up to before events preceding and after
+// events following each one in its session (like grep -C). Overlapping
+// windows in a session merge into one group. Groups keep the order of their
+// first hit and list events in seq order; each row gets its Group number and
+// neighbours that are not hits get Context. Hits keep their own fields
+// (DupCount and so on). With before and after both 0, hits come back as
+// one-row groups.
+func WithContext(conn *sql.DB, hits []Row, before, after int) ([]Row, error) {
+	type key struct {
+		sid string
+		seq int
+	}
+	hitAt := make(map[key]Row, len(hits))
+	var spans []seqSpan
+	for i, h := range hits {
+		k := key{h.SessionID, h.Seq}
+		if _, dup := hitAt[k]; dup {
+			continue
+		}
+		hitAt[k] = h
+		lo, err := seqBound(conn, h.SessionID, h.Seq, before, false)
+		if err != nil {
+			return nil, err
+		}
+		hi, err := seqBound(conn, h.SessionID, h.Seq, after, true)
+		if err != nil {
+			return nil, err
+		}
+		spans = append(spans, seqSpan{sessionID: h.SessionID, lo: lo, hi: hi, first: i})
+	}
+	spans = mergeSpans(spans)
+
+	var out []Row
+	for g, sp := range spans {
+		rows, err := runQuery(conn, baseSelect+` WHERE e.session_id = ? AND e.seq BETWEEN ? AND ? ORDER BY e.seq`,
+			sp.sessionID, sp.lo, sp.hi)
+		if err != nil {
+			return nil, fmt.Errorf("context: %w", err)
+		}
+		for _, r := range rows {
+			if h, ok := hitAt[key{r.SessionID, r.Seq}]; ok {
+				r = h
+			} else {
+				r.Context = true
+			}
+			r.Group = g + 1
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+// seqBound returns the seq n events before (or after) seq in the session, or
+// the furthest one there is. Gaps in seq do not count as events.
+func seqBound(conn *sql.DB, sessionID string, seq, n int, forward bool) (int, error) {
+	if n <= 0 {
+		return seq, nil
+	}
+	q := `SELECT MIN(seq) FROM (SELECT seq FROM events WHERE session_id = ? AND seq < ? ORDER BY seq DESC LIMIT ?)`
+	if forward {
+		q = `SELECT MAX(seq) FROM (SELECT seq FROM events WHERE session_id = ? AND seq > ? ORDER BY seq LIMIT ?)`
+	}
+	var bound sql.NullInt64
+	if err := conn.QueryRow(q, sessionID, seq, n).Scan(&bound); err != nil {
+		return 0, fmt.Errorf("context: %w", err)
+	}
+	if !bound.Valid {
+		return seq, nil
+	}
+	return int(bound.Int64), nil
+}
+
+// mergeSpans joins overlapping or touching spans of a session and orders the
+// result by first hit.
+func mergeSpans(spans []seqSpan) []seqSpan {
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i].sessionID != spans[j].sessionID {
+			return spans[i].sessionID < spans[j].sessionID
+		}
+		return spans[i].lo < spans[j].lo
+	})
+	var out []seqSpan
+	for _, sp := range spans {
+		if n := len(out); n > 0 && out[n-1].sessionID == sp.sessionID && sp.lo <= out[n-1].hi+1 {
+			last := &out[n-1]
+			last.hi = max(last.hi, sp.hi)
+			last.first = min(last.first, sp.first)
+			continue
+		}
+		out = append(out, sp)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].first < out[j].first })
+	return out
+}
@@ -0,0 +1,71 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/mrcawood/History_eXtended/internal/store"
+)
+
+func TestWithContext(t *testing.T) {
+	st, conn := openTestDB(t)
+	if err := st.EnsureSession("s1", "alpha", "pts/0", "/src", 1000); err != nil {
+		t.Fatal(err)
+	}
+	cmds := []string{"git fetch", "git rebase main", "git status", "make", "git push", "ls"}
+	for i, cmd := range cmds {
+		ts := float64(1000 + i)
+		cmdID, err := st.CmdID(cmd, ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := st.InsertEvent(
+			&store.PreEvent{T: "pre", Ts: ts, Sid: "s1", Seq: i + 1, Cmd: cmd, Cwd: "/src", Host: "alpha"},
+			&store.PostEvent{T: "post", Ts: ts, Sid: "s1", Seq: i + 1, Exit: 0},
+			cmdID,
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Newest hit first, as search returns them; seq 2 and 3 share a window
+	hits := []Row{
+		{SessionID: "s1", Seq: 6, Cmd: "ls", DupCount: 4},
+		{SessionID: "s1", Seq: 2, Cmd: "git rebase main"},
+		{SessionID: "s1", Seq: 3, Cmd: "git status"},
+	}
+	rows, err := WithContext(conn, hits, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		seq, group int
+		context    bool
+	}{
+		{5, 1, true}, {6, 1, false},
+		{1, 2, true}, {2, 2, false}, {3, 2, false},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("WithContext = %d rows, want %d: %+v", len(rows), len(want), rows)
+	}
+	for i, w := range want {
+		r := rows[i]
+		if r.Seq != w.seq || r.Group != w.group || r.Context != w.context {
+			t.Errorf("row %d = seq %d group %d context %v, want %+v", i, r.Seq, r.Group, r.Context, w)
+		}
+	}
+	if rows[1].DupCount != 4 {
+		t.Errorf("hit lost its fields: %+v", rows[1])
+	}
+	if rows[0].Cmd != "git push" || rows[0].EventID == 0 {
+		t.Errorf("context row not loaded: %+v", rows[0])
+	}
+
+	// Windows clamp at the ends of the session
+	rows, err = WithContext(conn, []Row{{SessionID: "s1", Seq: 1}}, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0].Seq != 1 || rows[2].Seq != 3 {
+		t.Errorf("WithContext(seq 1, -B3 -A2) = %+v", rows)
+	}
+}
@@ -4,14 +4,21 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+
+	"github.com/mrcawood/History_eXtended/internal/envctx"
+	"github.com/mrcawood/History_eXtended/internal/exitcode"
 )
 
 // EventDetail is full metadata for one event (hx show).
 type EventDetail struct {
 	Row
 	Seq       int
+	Pipe      []int  // per-stage exit statuses for pipelines
+	Signal    string // e.g. SIGINT when killed by a signal
+	State     string // running, interrupted, unknown; "" when completed
 	Tty       string
 	Shell     string
+	Env       map[string]string // recorded environment variables (internal/envctx)
 	Artifacts []ArtifactLine
 }
 
@@ -26,12 +33,15 @@ type ArtifactLine struct {
 func GetEvent(conn *sql.DB, eventID int64) (*EventDetail, error) {
 	var d EventDetail
 	var exit, dur sql.NullInt64
+	var pipeJSON, extraJSON string
 	err := conn.QueryRow(`
 		SELECT e.event_id, e.session_id, e.seq, e.exit_code, e.duration_ms,
 		       COALESCE(NULLIF(TRIM(e.cwd), ''), NULLIF(TRIM(s.initial_cwd), ''), ''),
 		       COALESCE(c.cmd_text, ''), e.started_at, COALESCE(e.git_branch, ''), COALESCE(e.git_commit, ''),
 		       COALESCE(s.host, ''), COALESCE(e.origin, 'live'),
-		       COALESCE(s.tty, ''), COALESCE(s.shell, 'zsh')
+		       COALESCE(s.tty, ''), COALESCE(s.shell, 'zsh'),
+		       COALESCE(e.pipe_status_json, ''), COALESCE(e.signal, ''), COALESCE(e.state, ''),
+		       COALESCE(e.extra_json, '')
 		FROM events e
 		LEFT JOIN command_dict c ON e.cmd_id = c.cmd_id
 		LEFT JOIN sessions s ON s.session_id = e.session_id
@@ -39,6 +49,7 @@ func GetEvent(conn *sql.DB, eventID int64) (*EventDetail, error) {
 	`, eventID).Scan(
 		&d.EventID, &d.SessionID, &d.Seq, &exit, &dur, &d.Cwd, &d.Cmd,
 		&d.StartedAt, &d.GitBranch, &d.GitCommit, &d.Host, &d.Origin, &d.Tty, &d.Shell,
+		&pipeJSON, &d.Signal, &d.State, &extraJSON,
 	)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("event %d not found", eventID)
@@ -54,11 +65,14 @@ func GetEvent(conn *sql.DB, eventID int64) (*EventDetail, error) {
 		v := dur.Int64
 		d.DurationMs = &v
 	}
+	d.Pipe = exitcode.ParsePipe(pipeJSON)
+	d.Env = envctx.FromExtra(extraJSON)
 	rows, err := conn.Query(`
 		SELECT artifact_id, kind, blob_path FROM artifacts
-		WHERE linked_event_id = ? OR (linked_event_id IS NULL AND linked_session_id = ?)
+		WHERE linked_event_id = ?
+		   OR (linked_event_id IS NULL AND linked_session_id = ? AND (linked_seq IS NULL OR linked_seq = ?))
 		ORDER BY artifact_id DESC LIMIT 10
-	`, eventID, d.SessionID)
+	`, eventID, d.SessionID, d.Seq)
 	if err != nil {
 		return &d, nil
 	}
@@ -73,6 +87,15 @@ func GetEvent(conn *sql.DB, eventID int64) (*EventDetail, error) {
 	return &d, nil
 }
 
+// Failed reports a non-zero exit, a failed pipeline stage, or a signal kill.
+func (d *EventDetail) Failed() bool {
+	exit := 0
+	if d.ExitCode != nil {
+		exit = *d.ExitCode
+	}
+	return exitcode.Failed(exit, d.Pipe) || d.Signal != ""
+}
+
 // FormatDetail renders human-readable metadata for preview/inspector.
 func FormatDetail(d *EventDetail) string {
 	var b strings.Builder
@@ -89,10 +112,23 @@ func FormatDetail(d *EventDetail) string {
 		b.WriteString("cwd:      -\n")
 	}
 	if d.ExitCode != nil {
-		fmt.Fprintf(&b, "exit:     %d\n", *d.ExitCode)
+		fmt.Fprintf(&b, "exit:     %d", *d.ExitCode)
+		if d.Signal != "" {
+			fmt.Fprintf(&b, " (%s)", d.Signal)
+		}
+		b.WriteString("\n")
+	} else if d.State != "" {
+		fmt.Fprintf(&b, "exit:     - (%s)\n", d.State)
 	} else {
 		b.WriteString("exit:     -\n")
 	}
+	if p := exitcode.FormatPipe(d.Pipe); p != "" {
+		fmt.Fprintf(&b, "pipe:     %s", p)
+		if d.Failed() && d.ExitCode != nil && *d.ExitCode == 0 {
+			b.WriteString(" (failed stage)")
+		}
+		b.WriteString("\n")
+	}
 	if d.DurationMs != nil {
 		fmt.Fprintf(&b, "duration: %dms\n", *d.DurationMs)
 	}
@@ -105,6 +141,9 @@ func FormatDetail(d *EventDetail) string {
 	if d.Shell != "" {
 		fmt.Fprintf(&b, "shell:    %s\n", d.Shell)
 	}
+	for _, n := range envctx.Names(d.Env) {
+		fmt.Fprintf(&b, "env:      %s=%s\n", n, d.Env[n])
+	}
 	for _, a := range d.Artifacts {
 		fmt.Fprintf(&b, "artifact: [%s] %s (id %d)\n", a.Kind, a.BlobPath, a.ArtifactID)
 	}
@@ -49,3 +49,20 @@ func stringsSplitLines(s string) []string {
 	}
 	return out
 }
+
+func TestFormatDetailPipeAndSignal(t *testing.T) {
+	zero, sigint := 0, 130
+	d := &EventDetail{Row: Row{Cmd: "make | tee log", ExitCode: &zero}, Pipe: []int{2, 0}}
+	out := FormatDetail(d)
+	if !d.Failed() || !stringsContainsLine(out, "pipe:     2,0 (failed stage)") {
+		t.Fatalf("failed pipeline stage not shown: %q", out)
+	}
+	d = &EventDetail{Row: Row{Cmd: "sleep 100", ExitCode: &sigint}, Signal: "SIGINT"}
+	if out := FormatDetail(d); !stringsContainsLine(out, "exit:     130 (SIGINT)") {
+		t.Fatalf("signal not shown: %q", out)
+	}
+	d = &EventDetail{Row: Row{Cmd: "terraform apply"}, State: "interrupted"}
+	if out := FormatDetail(d); !stringsContainsLine(out, "exit:     - (interrupted)") {
+		t.Fatalf("state not shown: %q", out)
+	}
+}
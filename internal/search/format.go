@@ -53,11 +53,21 @@ func WriteRows(w io.Writer, format FormatKind, rows []Row) error {
 	}
 }
 
-func exitStr(exit *int) string {
-	if exit == nil {
-		return "-"
+// ExitLabel is the exit column text: the exit code, the state of a command
+// that has none yet (run, intr, unk), or "-". Labels fit the 5-wide column.
+func ExitLabel(exit *int, state string) string {
+	if exit != nil {
+		return strconv.Itoa(*exit)
 	}
-	return strconv.Itoa(*exit)
+	switch state {
+	case "running":
+		return "run"
+	case "interrupted":
+		return "intr"
+	case "unknown":
+		return "unk"
+	}
+	return "-"
 }
 
 func writeNull(w io.Writer, rows []Row) error {
@@ -65,7 +75,7 @@ func writeNull(w io.Writer, rows []Row) error {
 		line := strings.Join([]string{
 			strconv.FormatInt(r.EventID, 10),
 			r.Cmd,
-			exitStr(r.ExitCode),
+			ExitLabel(r.ExitCode, r.State),
 			RelTime(r.StartedAt),
 			r.Cwd,
 			strconv.Itoa(r.DupCount),
@@ -80,7 +90,7 @@ func writeNull(w io.Writer, rows []Row) error {
 func writeTSV(w io.Writer, rows []Row) error {
 	for _, r := range rows {
 		_, err := fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\n",
-			r.EventID, r.Cmd, exitStr(r.ExitCode), RelTime(r.StartedAt), r.Cwd, r.DupCount)
+			r.EventID, r.Cmd, ExitLabel(r.ExitCode, r.State), RelTime(r.StartedAt), r.Cwd, r.DupCount)
 		if err != nil {
 			return err
 		}
@@ -99,14 +109,32 @@ func writeTable(w io.Writer, rows []Row) error {
 		_, err := fmt.Fprintln(w, "(no matches)")
 		return err
 	}
-	_, _ = fmt.Fprintf(w, "%-8s %-5s %-8s %-18s %s\n", "id", "exit", "when", "cwd", "cmd")
-	for _, r := range rows {
+	// WithContext output: "> " marks matches, "--" separates groups
+	grouped := rows[0].Group > 0
+	mark := func(r Row) string {
+		switch {
+		case !grouped:
+			return ""
+		case r.Context:
+			return "  "
+		}
+		return "> "
+	}
+	pad := ""
+	if grouped {
+		pad = "  "
+	}
+	_, _ = fmt.Fprintf(w, "%s%-8s %-5s %-8s %-18s %s\n", pad, "id", "exit", "when", "cwd", "cmd")
+	for i, r := range rows {
+		if grouped && i > 0 && r.Group != rows[i-1].Group {
+			_, _ = fmt.Fprintln(w, "--")
+		}
 		cwd := r.Cwd
 		if len(cwd) > 18 {
 			cwd = cwd[:15] + "..."
 		}
-		_, err := fmt.Fprintf(w, "%-8d %-5s %-8s %-18s %s\n",
-			r.EventID, exitStr(r.ExitCode), RelTime(r.StartedAt), cwd, r.Cmd)
+		_, err := fmt.Fprintf(w, "%s%-8d %-5s %-8s %-18s %s\n",
+			mark(r), r.EventID, ExitLabel(r.ExitCode, r.State), RelTime(r.StartedAt), cwd, r.Cmd)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,190 @@
+package search
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mrcawood/History_eXtended/internal/config"
+	"github.com/mrcawood/History_eXtended/internal/gitctx"
+)
+
+// cmdStats counts a command's runs within the request's scope.
+type cmdStats struct {
+	runs, ok, inDir, inRepo int
+	last                    float64 // started_at of the latest run
+}
+
+func frecencyWeights(cfg *config.Config) config.FrecencyConfig {
+	if cfg == nil {
+		return config.DefaultFrecency()
+	}
+	return cfg.Search.Frecency
+}
+
+// frecentRows ranks every command matching the request, not just the most
+// recent candidates, by a weighted sum of how often it ran, how recently it
+// last ran, how often it ran in req.Cwd and its git repo, and its success
+// rate. Runs are aggregated per command in SQL; the n best commands are
+// returned as their latest event, so each command appears once. Counts are
+// log-scaled against the busiest command so one command run a thousand times
+// does not drown everything else.
+func frecentRows(conn *sql.DB, req Request, w config.FrecencyConfig, now time.Time, n int) ([]Row, error) {
+	scope, scopeArgs := frecencyScope(req)
+	stats, err := commandStats(conn, req, scope, scopeArgs...)
+	if err != nil {
+		return nil, err
+	}
+	if len(stats) == 0 && req.Mode == ModeFuzzy && scope != "" {
+		// No FTS match: rank the commands fuzzy search falls back to
+		rows, err := queryRecent(conn, req, candidateLimit)
+		if err != nil {
+			return nil, err
+		}
+		var ids []interface{}
+		seen := make(map[int64]bool)
+		for _, r := range rankFuzzy(rows, strings.TrimSpace(req.Query)) {
+			if r.cmdID != 0 && !seen[r.cmdID] {
+				seen[r.cmdID] = true
+				ids = append(ids, r.cmdID)
+			}
+		}
+		if len(ids) == 0 {
+			return nil, nil
+		}
+		stats, err = commandStats(conn, req, "?"+strings.Repeat(", ?", len(ids)-1), ids...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ids := rankCommands(stats, w, now)
+	if len(ids) > n {
+		ids = ids[:n]
+	}
+	rows, err := latestRows(conn, req, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		rows[i].DupCount = 1
+		if req.Dedup {
+			rows[i].DupCount = stats[rows[i].cmdID].runs
+		}
+	}
+	return rows, nil
+}
+
+// frecencyScope returns the subquery of cmd_ids matching the request's
+// query in its mode, or "" when every command in scope matches.
+func frecencyScope(req Request) (string, []interface{}) {
+	q := strings.TrimSpace(req.Query)
+	if q == "" {
+		return "", nil
+	}
+	var match string
+	switch req.Mode {
+	case ModeFTS:
+		match = strings.ReplaceAll(q, "\"", "\"\"")
+		if strings.Contains(match, " ") {
+			match = "\"" + match + "\""
+		}
+	default:
+		match = buildPrefixFTSQuery(tokenize(q))
+	}
+	if match == "" {
+		return "", nil
+	}
+	return `SELECT m.cmd_id FROM events_fts JOIN events m ON m.event_id = events_fts.rowid
+		WHERE events_fts MATCH ?`, []interface{}{match}
+}
+
+// rankCommands orders the commands of stats by frecency score, best first.
+func rankCommands(stats map[int64]cmdStats, w config.FrecencyConfig, now time.Time) []int64 {
+	var maxRuns, maxDir, maxRepo int
+	for _, st := range stats {
+		maxRuns = max(maxRuns, st.runs)
+		maxDir = max(maxDir, st.inDir)
+		maxRepo = max(maxRepo, st.inRepo)
+	}
+	halfLife := w.HalfLifeHours
+	if halfLife <= 0 {
+		halfLife = config.DefaultFrecency().HalfLifeHours
+	}
+	ids := make([]int64, 0, len(stats))
+	score := make(map[int64]float64, len(stats))
+	for id, st := range stats {
+		ageHours := math.Max(0, float64(now.Unix())-st.last) / 3600
+		s := w.Frequency*logScale(st.runs, maxRuns) +
+			w.Recency*math.Pow(0.5, ageHours/halfLife) +
+			w.Dir*logScale(st.inDir, maxDir) +
+			w.Repo*logScale(st.inRepo, maxRepo)
+		if st.runs > 0 {
+			s += w.Success * float64(st.ok) / float64(st.runs)
+		}
+		ids = append(ids, id)
+		score[id] = s
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := ids[i], ids[j]
+		if score[a] != score[b] {
+			return score[a] > score[b]
+		}
+		return stats[a].last > stats[b].last
+	})
+	return ids
+}
+
+func logScale(n, maxN int) float64 {
+	if n <= 0 || maxN <= 0 {
+		return 0
+	}
+	return math.Log1p(float64(n)) / math.Log1p(float64(maxN))
+}
+
+// commandStats aggregates runs per command under the request's filters,
+// for the commands scope selects: a subquery or placeholder list of
+// cmd_ids, or "" for all of them.
+func commandStats(conn *sql.DB, req Request, scope string, scopeArgs ...interface{}) (map[int64]cmdStats, error) {
+	// NULL never compares equal, so an unknown cwd or repo counts nothing
+	var cwd, repo interface{}
+	if req.Cwd != "" {
+		cwd = req.Cwd
+		if root := gitctx.Resolve(req.Cwd).Root; root != "" {
+			repo = root
+		}
+	}
+	where, whereArgs := filterClause(req)
+	args := []interface{}{cwd, repo}
+	q := `
+		SELECT e.cmd_id, COUNT(*), COALESCE(SUM(e.exit_code = 0), 0),
+		       COALESCE(SUM(e.cwd = ?), 0), COALESCE(SUM(e.repo_root = ?), 0), MAX(e.started_at)
+		FROM events e
+		LEFT JOIN command_dict c ON e.cmd_id = c.cmd_id
+		LEFT JOIN sessions s ON s.session_id = e.session_id
+		WHERE e.cmd_id IS NOT NULL`
+	if scope != "" {
+		q += ` AND e.cmd_id IN (` + scope + `)`
+		args = append(args, scopeArgs...)
+	}
+	q += where + `
+		GROUP BY e.cmd_id`
+	args = append(args, whereArgs...)
+	res, err := conn.Query(q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("frecency stats: %w", err)
+	}
+	defer func() { _ = res.Close() }()
+	out := make(map[int64]cmdStats)
+	for res.Next() {
+		var id int64
+		var st cmdStats
+		if err := res.Scan(&id, &st.runs, &st.ok, &st.inDir, &st.inRepo, &st.last); err != nil {
+			return nil, err
+		}
+		out[id] = st
+	}
+	return out, res.Err()
+}
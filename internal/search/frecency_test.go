@@ -0,0 +1,92 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mrcawood/History_eXtended/internal/config"
+)
+
+func TestSearchRankFrecency(t *testing.T) {
+	st, conn := openTestDB(t)
+	now := float64(time.Now().Unix())
+	for i := 0; i < 5; i++ {
+		seedEventsAt(t, conn, st, "alpha", "/src/hx", "make test", 0, now-2*86400-float64(i))
+	}
+	seedEventsAt(t, conn, st, "alpha", "/src/hx", "make lint", 2, now-2*86400-10)
+	seedEventsAt(t, conn, st, "alpha", "/tmp", "make clean", 0, now-60)
+
+	search := func(rank Rank, cfg *config.Config) []string {
+		t.Helper()
+		rows, err := Search(context.Background(), conn, cfg, Request{
+			Query: "make", Mode: ModeFuzzy, Rank: rank, Cwd: "/src/hx", Dedup: true, Limit: 20,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, r := range rows {
+			got = append(got, r.Cmd)
+		}
+		return got
+	}
+
+	if got := search(RankRecent, nil); len(got) != 3 || got[0] != "make clean" {
+		t.Errorf("recent = %q, want make clean first", got)
+	}
+	got := search(RankFrecency, nil)
+	want := []string{"make test", "make clean", "make lint"}
+	if len(got) != len(want) {
+		t.Fatalf("frecency = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("frecency = %q, want %q", got, want)
+		}
+	}
+
+	// Recency alone matches the default order
+	cfg := &config.Config{Search: config.SearchConfig{Frecency: config.FrecencyConfig{Recency: 1, HalfLifeHours: 24}}}
+	if got := search(RankFrecency, cfg); len(got) != 3 || got[0] != "make clean" {
+		t.Errorf("frecency with recency weight only = %q, want make clean first", got)
+	}
+}
+
+func TestSearchRankFrecencyBeyondRecentCandidates(t *testing.T) {
+	st, conn := openTestDB(t)
+	now := float64(time.Now().Unix())
+	for i := 0; i < 20; i++ {
+		seedEventsAt(t, conn, st, "alpha", "/src/hx", "make test", 0, now-7*86400-float64(i))
+	}
+	// More one-off commands since then than a recency fetch takes
+	for i := 0; i < candidateLimit+10; i++ {
+		seedEventsAt(t, conn, st, "alpha", "/tmp", fmt.Sprintf("make scratch-%d", i), 0, now-float64(i))
+	}
+
+	rows, err := Search(context.Background(), conn, nil, Request{
+		Query: "make", Mode: ModeFuzzy, Rank: RankFrecency, Cwd: "/src/hx", Dedup: true, Limit: 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 5 || rows[0].Cmd != "make test" || rows[0].DupCount != 20 {
+		t.Fatalf("frecency = %+v, want make test (20 runs) first", rows)
+	}
+}
+
+func TestParseRank(t *testing.T) {
+	if r, err := ParseRank("frecency"); err != nil || r != RankFrecency {
+		t.Errorf("ParseRank(frecency) = %v, %v", r, err)
+	}
+	if r, err := ParseRank(""); err != nil || r != RankRecent {
+		t.Errorf("ParseRank(\"\") = %v, %v", r, err)
+	}
+	if _, err := ParseRank("best"); err == nil {
+		t.Error("ParseRank(best): want error")
+	}
+	if NextRank(NextRank(RankRecent)) != RankRecent {
+		t.Error("NextRank should toggle")
+	}
+}
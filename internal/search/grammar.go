@@ -0,0 +1,395 @@
+package search
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mrcawood/History_eXtended/internal/envctx"
+	"github.com/mrcawood/History_eXtended/internal/gitctx"
+)
+
+// Where holds the structured filters of a query (key:value terms). The zero
+// value matches everything.
+type Where struct {
+	ExitOp    string // "=" or "!="; "" for any
+	Exit      int
+	Cwd       string // directory; matches it and everything below
+	Host      string
+	After     float64 // started_at lower bound (Unix seconds); 0 = none
+	Before    float64 // started_at upper bound; 0 = none
+	DurOp     string  // ">", ">=", "<", "<=" or "="; "" for any
+	DurMs     int64
+	Origin    string // live, import or sync
+	Repo      string // repo root path or base name
+	SessionID string
+	EnvName   string // recorded environment variable; "" for any
+	EnvOp     string // "=" or "!="; "" for set to anything
+	EnvValue  string
+}
+
+// QueryKeys lists the keys ParseQuery accepts, in help order.
+var QueryKeys = []string{"exit", "cwd", "host", "after", "before", "dur", "origin", "repo", "session", "env"}
+
+// QueryContext resolves relative values in a query. Zero fields default to
+// the current time, working directory and home directory.
+type QueryContext struct {
+	Now       time.Time
+	Cwd       string // for cwd:. and relative paths
+	Home      string // for cwd:~
+	SessionID string // for session:current
+}
+
+// Query is a parsed query: free text plus structured filters.
+type Query struct {
+	Text  string
+	Where Where
+}
+
+// QueryError is a query parse error at a byte offset into Query.
+type QueryError struct {
+	Query string
+	Pos   int
+	Msg   string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s (column %d)", e.Msg, e.column()+1)
+}
+
+func (e *QueryError) column() int {
+	pos := e.Pos
+	if pos > len(e.Query) {
+		pos = len(e.Query)
+	}
+	return utf8.RuneCountInString(e.Query[:pos])
+}
+
+// Caret returns the query and, under it, a caret at the error position.
+func (e *QueryError) Caret() string {
+	return e.Query + "\n" + strings.Repeat(" ", e.column()) + "^"
+}
+
+// ParseQuery splits input into free text and key:value filters, e.g.
+// `make exit:!0 cwd:~/src/hx after:2d`. Double quotes group words and make a
+// term text even if it contains a colon ("https://x"). A term whose prefix
+// before the colon is a word but not a known key is an error.
+func ParseQuery(input string, qc QueryContext) (*Query, error) {
+	if qc.Now.IsZero() {
+		qc.Now = time.Now()
+	}
+	if qc.Home == "" {
+		qc.Home, _ = os.UserHomeDir()
+	}
+	if qc.Cwd == "" {
+		qc.Cwd, _ = os.Getwd()
+	}
+	q := &Query{}
+	var text []string
+	terms, err := splitTerms(input)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range terms {
+		key, val, ok := strings.Cut(t.text, ":")
+		if t.quoted || !ok || !isKeyWord(key) {
+			text = append(text, t.text)
+			continue
+		}
+		key = strings.ToLower(key)
+		if !isQueryKey(key) {
+			return nil, &QueryError{Query: input, Pos: t.pos,
+				Msg: fmt.Sprintf("unknown key %q (want %s; quote text containing a colon)", key, strings.Join(QueryKeys, ", "))}
+		}
+		valPos := t.pos + len(key) + 1
+		fail := func(format string, a ...interface{}) error {
+			return &QueryError{Query: input, Pos: valPos, Msg: key + ": " + fmt.Sprintf(format, a...)}
+		}
+		if t.valQuoted >= 0 {
+			valPos = t.valQuoted
+		}
+		if val == "" {
+			return nil, fail("missing value")
+		}
+		w := &q.Where
+		switch key {
+		case "exit":
+			w.ExitOp = "="
+			if v, ok := strings.CutPrefix(val, "!"); ok {
+				w.ExitOp, val = "!=", v
+			}
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 0 {
+				return nil, fail("want a status like 0, !0 or 130")
+			}
+			w.Exit = n
+		case "cwd":
+			w.Cwd = resolveDir(val, qc)
+		case "host":
+			w.Host = val
+		case "after", "before":
+			ts, err := parseWhen(val, qc.Now)
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			if key == "after" {
+				w.After = ts
+			} else {
+				w.Before = ts
+			}
+		case "dur":
+			op, ms, err := parseDurFilter(val)
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			w.DurOp, w.DurMs = op, ms
+		case "origin":
+			switch v := strings.ToLower(val); v {
+			case "live", "import", "sync":
+				w.Origin = v
+			default:
+				return nil, fail("want live, import or sync")
+			}
+		case "repo":
+			w.Repo = resolveRepo(val, qc)
+		case "session":
+			if val == "current" {
+				if qc.SessionID == "" {
+					return nil, fail("not in a captured shell (HX_EVENT_SESSION is unset)")
+				}
+				val = qc.SessionID
+			}
+			w.SessionID = val
+		case "env":
+			name, op, value := val, "", ""
+			if i := strings.IndexByte(val, '='); i >= 0 {
+				name, op, value = val[:i], "=", val[i+1:]
+				if n, ok := strings.CutSuffix(name, "!"); ok {
+					name, op = n, "!="
+				}
+			}
+			if !envctx.ValidName(name) {
+				return nil, fail("want NAME, NAME=value or NAME!=value")
+			}
+			w.EnvName, w.EnvOp, w.EnvValue = name, op, value
+		}
+	}
+	q.Text = strings.Join(text, " ")
+	return q, nil
+}
+
+// term is one whitespace-separated word of a query.
+type term struct {
+	text      string
+	pos       int  // byte offset of the term in the query
+	quoted    bool // the whole term was quoted: always free text
+	valQuoted int  // offset of a quoted value (key:"a b"), or -1
+}
+
+func splitTerms(input string) ([]term, error) {
+	var out []term
+	i := 0
+	for i < len(input) {
+		if input[i] == ' ' || input[i] == '\t' {
+			i++
+			continue
+		}
+		t := term{pos: i, valQuoted: -1}
+		var b strings.Builder
+		for i < len(input) && input[i] != ' ' && input[i] != '\t' {
+			if input[i] != '"' {
+				b.WriteByte(input[i])
+				i++
+				continue
+			}
+			open := i
+			end := strings.IndexByte(input[i+1:], '"')
+			if end < 0 {
+				return nil, &QueryError{Query: input, Pos: open, Msg: "unterminated quote"}
+			}
+			if open == t.pos {
+				t.quoted = true
+			} else if strings.HasSuffix(b.String(), ":") && t.valQuoted < 0 {
+				t.valQuoted = open
+			}
+			b.WriteString(input[i+1 : i+1+end])
+			i += end + 2
+		}
+		t.text = b.String()
+		if t.text != "" || t.quoted {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// isKeyWord reports whether s looks like a key: letters only. "8080:80" and
+// "a.b:c" stay text; "https://x" is an unknown key unless quoted.
+func isKeyWord(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func isQueryKey(key string) bool {
+	for _, k := range QueryKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveRepo keeps a bare repo name (matched against the root's base name)
+// and resolves a path (".", "../x", "~/src/x") to its repo root.
+func resolveRepo(v string, qc QueryContext) string {
+	if v != "." && v != ".." && v != "~" && !strings.Contains(v, "/") {
+		return v
+	}
+	dir := resolveDir(v, qc)
+	if info := gitctx.Resolve(dir); info.Root != "" {
+		return info.Root
+	}
+	return dir
+}
+
+func resolveDir(v string, qc QueryContext) string {
+	switch {
+	case v == "~":
+		v = qc.Home
+	case strings.HasPrefix(v, "~/"):
+		v = filepath.Join(qc.Home, v[2:])
+	case !filepath.IsAbs(v):
+		v = filepath.Join(qc.Cwd, v)
+	}
+	if v != "/" {
+		v = strings.TrimSuffix(filepath.Clean(v), "/")
+	}
+	return v
+}
+
+// parseWhen parses an age (30m, 36h, 2d, 1w: that long before now) or a
+// local date or time (2026-09-01, 2026-09-01T15:04, 2026-09-01 15:04:05).
+func parseWhen(v string, now time.Time) (float64, error) {
+	if d, err := parseAge(v); err == nil {
+		return float64(now.Add(-d).Unix()), nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02T15:04", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, v, now.Location()); err == nil {
+			return float64(t.Unix()), nil
+		}
+	}
+	return 0, fmt.Errorf("want an age like 2d or 3h, or a date like 2026-09-01")
+}
+
+// parseAge parses a Go duration with d (days) and w (weeks) units added.
+func parseAge(v string) (time.Duration, error) {
+	if n, ok := strings.CutSuffix(v, "d"); ok {
+		days, err := strconv.ParseFloat(n, 64)
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("bad age %q", v)
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+	if n, ok := strings.CutSuffix(v, "w"); ok {
+		weeks, err := strconv.ParseFloat(n, 64)
+		if err != nil || weeks < 0 {
+			return 0, fmt.Errorf("bad age %q", v)
+		}
+		return time.Duration(weeks * float64(7*24*time.Hour)), nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("bad age %q", v)
+	}
+	return d, nil
+}
+
+// parseDurFilter parses ">30s", "<=2m", "1h" (equal) or a bare number of seconds.
+func parseDurFilter(v string) (string, int64, error) {
+	op := "="
+	for _, o := range []string{">=", "<=", ">", "<", "="} {
+		if rest, ok := strings.CutPrefix(v, o); ok {
+			op, v = o, rest
+			break
+		}
+	}
+	if n, err := strconv.ParseFloat(v, 64); err == nil && n >= 0 {
+		return op, int64(n * 1000), nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return "", 0, fmt.Errorf("want a duration like >30s, <500ms or >=2m")
+	}
+	return op, d.Milliseconds(), nil
+}
+
+// SQL returns an " AND ..." clause for w over events e joined with sessions
+// s, and its arguments. Empty when w matches everything.
+func (w Where) SQL() (string, []interface{}) {
+	var clauses []string
+	var args []interface{}
+	switch w.ExitOp {
+	case "=":
+		clauses = append(clauses, "e.exit_code = ?")
+		args = append(args, w.Exit)
+	case "!=":
+		clauses = append(clauses, "e.exit_code IS NOT NULL AND e.exit_code != ?")
+		args = append(args, w.Exit)
+	}
+	if w.Cwd != "" {
+		if w.Cwd == "/" {
+			clauses = append(clauses, "substr(e.cwd, 1, 1) = '/'")
+		} else {
+			clauses = append(clauses, "(e.cwd = ? OR substr(e.cwd, 1, length(?) + 1) = ? || '/')")
+			args = append(args, w.Cwd, w.Cwd, w.Cwd)
+		}
+	}
+	if w.Host != "" {
+		clauses = append(clauses, "s.host = ?")
+		args = append(args, w.Host)
+	}
+	if w.After > 0 {
+		clauses = append(clauses, "e.started_at >= ?")
+		args = append(args, w.After)
+	}
+	if w.Before > 0 {
+		clauses = append(clauses, "e.started_at < ?")
+		args = append(args, w.Before)
+	}
+	if w.DurOp != "" {
+		clauses = append(clauses, "e.duration_ms "+w.DurOp+" ?")
+		args = append(args, w.DurMs)
+	}
+	if w.Origin != "" {
+		clauses = append(clauses, "COALESCE(e.origin, 'live') = ?")
+		args = append(args, w.Origin)
+	}
+	if w.SessionID != "" {
+		clauses = append(clauses, "e.session_id = ?")
+		args = append(args, w.SessionID)
+	}
+	gitWhere, gitArgs := gitctx.SQLFilter(w.Repo, "")
+	args = append(args, gitArgs...)
+	envWhere, envArgs := envctx.SQLFilter(w.EnvName, w.EnvOp, w.EnvValue)
+	args = append(args, envArgs...)
+	if len(clauses) == 0 {
+		return gitWhere + envWhere, args
+	}
+	return " AND " + strings.Join(clauses, " AND ") + gitWhere + envWhere, args
+}
+
+// IsZero reports whether w has no filters.
+func (w Where) IsZero() bool {
+	return w == Where{}
+}
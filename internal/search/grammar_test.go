@@ -0,0 +1,223 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrcawood/History_eXtended/internal/envctx"
+	"github.com/mrcawood/History_eXtended/internal/store"
+)
+
+func testQueryContext() QueryContext {
+	return QueryContext{
+		Now:       time.Date(2026, 9, 10, 12, 0, 0, 0, time.Local),
+		Cwd:       "/work",
+		Home:      "/home/me",
+		SessionID: "sess-current",
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	qc := testQueryContext()
+	tests := []struct {
+		in   string
+		text string
+		want Where
+	}{
+		{"make test", "make test", Where{}},
+		{"make exit:!0", "make", Where{ExitOp: "!=", Exit: 0}},
+		{"exit:130", "", Where{ExitOp: "=", Exit: 130}},
+		{"cwd:~/src/foo ls", "ls", Where{Cwd: "/home/me/src/foo"}},
+		{"cwd:.", "", Where{Cwd: "/work"}},
+		{"cwd:sub/dir/", "", Where{Cwd: "/work/sub/dir"}},
+		{"host:build01 HOST:x", "", Where{Host: "x"}},
+		{"after:2d", "", Where{After: float64(qc.Now.Add(-48 * time.Hour).Unix())}},
+		{"before:2026-09-01", "", Where{Before: float64(time.Date(2026, 9, 1, 0, 0, 0, 0, time.Local).Unix())}},
+		{"dur:>30s", "", Where{DurOp: ">", DurMs: 30000}},
+		{"dur:<=500ms", "", Where{DurOp: "<=", DurMs: 500}},
+		{"dur:2", "", Where{DurOp: "=", DurMs: 2000}},
+		{"origin:Import", "", Where{Origin: "import"}},
+		{"repo:hx", "", Where{Repo: "hx"}},
+		{"session:current", "", Where{SessionID: "sess-current"}},
+		{"env:AWS_PROFILE=prod", "", Where{EnvName: "AWS_PROFILE", EnvOp: "=", EnvValue: "prod"}},
+		{"env:AWS_PROFILE!=prod", "", Where{EnvName: "AWS_PROFILE", EnvOp: "!=", EnvValue: "prod"}},
+		{"env:VIRTUAL_ENV", "", Where{EnvName: "VIRTUAL_ENV"}},
+		{"env:GOFLAGS=", "", Where{EnvName: "GOFLAGS", EnvOp: "="}},
+		{`"https://example.com" curl`, "https://example.com curl", Where{}},
+		{`grep "a b"`, "grep a b", Where{}},
+		{`host:"my host"`, "", Where{Host: "my host"}},
+		{"docker run -p 8080:80", "docker run -p 8080:80", Where{}},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.in, qc)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", tt.in, err)
+			continue
+		}
+		if q.Text != tt.text || q.Where != tt.want {
+			t.Errorf("ParseQuery(%q) = %q %+v, want %q %+v", tt.in, q.Text, q.Where, tt.text, tt.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		in  string
+		pos int
+	}{
+		{"make foo:bar", 5},
+		{"exit:x", 5},
+		{"exit:", 5},
+		{"after:yesterday", 6},
+		{"dur:>fast", 4},
+		{"origin:mars", 7},
+		{`grep "abc`, 5},
+		{`host:""`, 5},
+		{"env:=prod", 4},
+		{"env:AWS-PROFILE", 4},
+	}
+	for _, tt := range tests {
+		_, err := ParseQuery(tt.in, testQueryContext())
+		var qe *QueryError
+		if !errors.As(err, &qe) {
+			t.Errorf("ParseQuery(%q) err = %v, want QueryError", tt.in, err)
+			continue
+		}
+		if qe.Pos != tt.pos {
+			t.Errorf("ParseQuery(%q) pos = %d, want %d (%s)", tt.in, qe.Pos, tt.pos, qe.Msg)
+		}
+	}
+
+	_, err := ParseQuery("session:current", QueryContext{})
+	if err == nil {
+		t.Error("session:current outside a captured shell: want error")
+	}
+}
+
+func TestQueryErrorCaret(t *testing.T) {
+	_, err := ParseQuery("föö foo:bar", testQueryContext())
+	var qe *QueryError
+	if !errors.As(err, &qe) {
+		t.Fatalf("err = %v, want QueryError", err)
+	}
+	if qe.Caret() != "föö foo:bar\n    ^" {
+		t.Errorf("Caret() = %q", qe.Caret())
+	}
+	if qe.Error() != qe.Msg+" (column 5)" {
+		t.Errorf("Error() = %q", qe.Error())
+	}
+}
+
+func TestSearchWhere(t *testing.T) {
+	st, conn := openTestDB(t)
+	now := float64(time.Now().Unix())
+	seedEventsAt(t, conn, st, "alpha", "/src/hx", "make build", 0, now-3600)
+	seedEventsAt(t, conn, st, "alpha", "/src/hx/internal", "make test", 2, now-60)
+	seedEventsAt(t, conn, st, "beta", "/src/hxd", "make lint", 1, now-10*86400)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"make exit:!0", []string{"make test", "make lint"}},
+		{"make cwd:/src/hx", []string{"make test", "make build"}},
+		{"host:beta", []string{"make lint"}},
+		{"make after:1d", []string{"make test", "make build"}},
+		{"before:2d", []string{"make lint"}},
+		{"build origin:live", []string{"make build"}},
+		{"origin:import", nil},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.query, QueryContext{})
+		if err != nil {
+			t.Fatalf("ParseQuery(%q): %v", tt.query, err)
+		}
+		rows, err := Search(context.Background(), conn, nil, Request{
+			Query: q.Text, Where: q.Where, Mode: ModeFuzzy, Limit: 20,
+		})
+		if err != nil {
+			t.Fatalf("Search(%q): %v", tt.query, err)
+		}
+		var got []string
+		for _, r := range rows {
+			got = append(got, r.Cmd)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("Search(%q) = %q, want %q", tt.query, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Search(%q) = %q, want %q", tt.query, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestSearchWhereEnv(t *testing.T) {
+	st, conn := openTestDB(t)
+	now := float64(time.Now().Unix())
+	seed := func(seq int, cmd string, env map[string]string) {
+		cmdID, err := st.CmdID(cmd, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pre := &store.PreEvent{T: "pre", Ts: now + float64(seq), Sid: "sess-env", Seq: seq, Cmd: cmd, Cwd: "/work", Env: env}
+		post := &store.PostEvent{T: "post", Ts: now + float64(seq), Sid: "sess-env", Seq: seq, Exit: 1}
+		if _, err := st.InsertEvent(pre, post, cmdID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.EnsureSession("sess-env", "h", "pts/0", "/work", now); err != nil {
+		t.Fatal(err)
+	}
+	seed(1, "terraform plan", map[string]string{"AWS_PROFILE": "prod", "VAULT_TOKEN": envctx.Hash("t1")})
+	seed(2, "terraform apply", map[string]string{"AWS_PROFILE": "dev"})
+	seed(3, "terraform fmt", nil)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"terraform env:AWS_PROFILE=prod", []string{"terraform plan"}},
+		{"terraform env:AWS_PROFILE!=prod", []string{"terraform apply"}},
+		{"terraform env:AWS_PROFILE", []string{"terraform apply", "terraform plan"}},
+		{"terraform env:VAULT_TOKEN=t1", []string{"terraform plan"}},
+		{"terraform env:VAULT_TOKEN=t2", nil},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.query, QueryContext{})
+		if err != nil {
+			t.Fatalf("ParseQuery(%q): %v", tt.query, err)
+		}
+		rows, err := Search(context.Background(), conn, nil, Request{
+			Query: q.Text, Where: q.Where, Mode: ModeFuzzy, Limit: 20,
+		})
+		if err != nil {
+			t.Fatalf("Search(%q): %v", tt.query, err)
+		}
+		var got []string
+		for _, r := range rows {
+			got = append(got, r.Cmd)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("Search(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	var id int64
+	if err := conn.QueryRow(`SELECT event_id FROM events WHERE seq = 1`).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	d, err := GetEvent(conn, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Env["AWS_PROFILE"] != "prod" || !stringsContainsLine(FormatDetail(d), "env:      AWS_PROFILE=prod") {
+		t.Errorf("hx show env = %v:\n%s", d.Env, FormatDetail(d))
+	}
+}
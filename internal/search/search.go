@@ -6,9 +6,12 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/mrcawood/History_eXtended/internal/config"
-	"github.com/mrcawood/History_eXtended/internal/ollama"
+	"github.com/mrcawood/History_eXtended/internal/embedding"
+	"github.com/mrcawood/History_eXtended/internal/gitctx"
+	"github.com/mrcawood/History_eXtended/internal/llm"
 	"github.com/mrcawood/History_eXtended/internal/query"
 )
 
@@ -30,6 +33,19 @@ func Search(ctx context.Context, conn *sql.DB, cfg *config.Config, req Request)
 		limit = defaultLimit
 	}
 
+	// Frecency ranks every matching command, so it fetches its own candidates
+	if req.Rank == RankFrecency && req.Mode != ModeSemantic {
+		rows, err := frecentRows(conn, req, frecencyWeights(cfg), time.Now(), max(limit, candidateLimit))
+		if err != nil {
+			return nil, err
+		}
+		rows = excludeSelf(rows)
+		if len(rows) > limit {
+			rows = rows[:limit]
+		}
+		return rows, nil
+	}
+
 	rows, err := fetchCandidates(ctx, conn, cfg, req)
 	if err != nil {
 		return nil, err
@@ -61,13 +77,13 @@ func fetchCandidates(ctx context.Context, conn *sql.DB, cfg *config.Config, req
 	q := strings.TrimSpace(req.Query)
 	switch req.Mode {
 	case ModeSemantic:
-		if cfg != nil && cfg.OllamaEnabled && ollama.Available(ctx, cfg.OllamaBaseURL) && q != "" {
-			rows, err := semanticSearch(ctx, conn, cfg, req, q)
+		if p, _ := llm.New(cfg); p != nil && q != "" && p.Available(ctx) {
+			rows, err := semanticSearch(ctx, conn, p, req, q)
 			if err == nil && len(rows) > 0 {
 				return rows, nil
 			}
 		}
-		// Fall through to fuzzy when Ollama unavailable or empty semantic result.
+		// Fall through to fuzzy when the provider is unavailable or empty semantic result.
 		fallthrough
 	case ModeFuzzy:
 		if q == "" {
@@ -104,7 +120,80 @@ func fetchCandidates(ctx context.Context, conn *sql.DB, cfg *config.Config, req
 	}
 }
 
-func semanticSearch(ctx context.Context, conn *sql.DB, cfg *config.Config, req Request, q string) ([]Row, error) {
+// semanticSearch ranks every command in the embedding index against q and
+// returns the latest matching event of the best ones. Until hxd has indexed
+// anything it falls back to re-embedding FTS candidates.
+func semanticSearch(ctx context.Context, conn *sql.DB, p llm.Provider, req Request, q string) ([]Row, error) {
+	if indexed, _, err := embedding.Stats(conn, p.EmbedModel()); err == nil && indexed > 0 {
+		return indexSearch(ctx, conn, p.EmbedModel(), p.Embed, req, q)
+	}
+	return rerankCandidates(ctx, conn, p.Embed, req, q)
+}
+
+// indexSearch embeds q once and looks it up in the embedding index.
+func indexSearch(ctx context.Context, conn *sql.DB, model string, embed embedding.Func, req Request, q string) ([]Row, error) {
+	vecs, err := embed(ctx, []string{q})
+	if err != nil {
+		return nil, err
+	}
+	if len(vecs) != 1 {
+		return nil, fmt.Errorf("semantic search: no query embedding")
+	}
+	// Only commands with an event passing the filters compete for the top k
+	where, args := filterClause(req)
+	var eligible string
+	if where != "" {
+		eligible = `SELECT e.cmd_id FROM events e
+			LEFT JOIN command_dict c ON e.cmd_id = c.cmd_id
+			LEFT JOIN sessions s ON s.session_id = e.session_id
+			WHERE e.cmd_id IS NOT NULL` + where
+	}
+	matches, err := embedding.NearestIn(ctx, conn, model, vecs[0], candidateLimit, eligible, args...)
+	if err != nil || len(matches) == 0 {
+		return nil, err
+	}
+	ids := make([]int64, len(matches))
+	for i, m := range matches {
+		ids[i] = m.CmdID
+	}
+	return latestRows(conn, req, ids)
+}
+
+// latestRows returns the latest event passing the request's filters of each
+// command in ids, in the order of ids.
+func latestRows(conn *sql.DB, req Request, ids []int64) ([]Row, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	where, whereArgs := filterClause(req)
+	args := make([]interface{}, 0, len(ids)+len(whereArgs))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	args = append(args, whereArgs...)
+	rows, err := runQuery(conn, baseSelect+` WHERE e.cmd_id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)`+where+
+		` ORDER BY e.started_at DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	latest := make(map[int64]Row, len(ids))
+	for _, r := range rows {
+		if _, ok := latest[r.cmdID]; !ok {
+			latest[r.cmdID] = r
+		}
+	}
+	out := make([]Row, 0, len(latest))
+	for _, id := range ids {
+		if r, ok := latest[id]; ok {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+// rerankCandidates re-embeds FTS (or recent) candidates and orders them by
+// similarity to q.
+func rerankCandidates(ctx context.Context, conn *sql.DB, embedFn query.EmbedFn, req Request, q string) ([]Row, error) {
 	base, err := queryPrefixFTS(conn, req, buildPrefixFTSQuery(tokenize(q)), ftsCandidateCap)
 	if err != nil {
 		return nil, err
@@ -116,9 +205,6 @@ func semanticSearch(ctx context.Context, conn *sql.DB, cfg *config.Config, req R
 		}
 	}
 	cands := rowsToCandidates(base)
-	embedFn := func(ctx context.Context, texts []string) ([][]float32, error) {
-		return ollama.Embed(ctx, cfg.OllamaBaseURL, cfg.OllamaEmbedModel, texts)
-	}
 	ranked, err := query.RerankBySemantic(ctx, q, cands, embedFn)
 	if err != nil {
 		return nil, err
@@ -224,16 +310,20 @@ func filterClause(req Request) (string, []interface{}) {
 		clauses = append(clauses, "(e.origin IS NULL OR e.origin != 'import')")
 		clauses = append(clauses, "e.session_id NOT LIKE 'import-%'")
 	}
+	gitWhere, gitArgs := gitctx.SQLFilter(req.Repo, req.Branch)
+	args = append(args, gitArgs...)
+	where, whereArgs := req.Where.SQL()
+	args = append(args, whereArgs...)
 	if len(clauses) == 0 {
-		return "", args
+		return gitWhere + where, args
 	}
-	return " AND " + strings.Join(clauses, " AND "), args
+	return " AND " + strings.Join(clauses, " AND ") + gitWhere + where, args
 }
 
 const baseSelect = `
 	SELECT e.event_id, e.session_id, e.seq, e.exit_code, e.duration_ms, e.cwd,
 	       COALESCE(c.cmd_text, ''), e.started_at, COALESCE(e.git_branch, ''), COALESCE(e.git_commit, ''),
-	       COALESCE(s.host, ''), COALESCE(e.origin, 'live')
+	       COALESCE(s.host, ''), COALESCE(e.origin, 'live'), e.cmd_id, COALESCE(e.state, '')
 	FROM events e
 	LEFT JOIN command_dict c ON e.cmd_id = c.cmd_id
 	LEFT JOIN sessions s ON s.session_id = e.session_id`
@@ -253,7 +343,7 @@ func queryPrefixFTS(conn *sql.DB, req Request, ftsQuery string, limit int) ([]Ro
 	q := `
 		SELECT e.event_id, e.session_id, e.seq, e.exit_code, e.duration_ms, e.cwd,
 		       COALESCE(c.cmd_text, ''), e.started_at, COALESCE(e.git_branch, ''), COALESCE(e.git_commit, ''),
-		       COALESCE(s.host, ''), COALESCE(e.origin, 'live')
+		       COALESCE(s.host, ''), COALESCE(e.origin, 'live'), e.cmd_id, COALESCE(e.state, '')
 		FROM events_fts
 		JOIN events e ON e.event_id = events_fts.rowid
 		LEFT JOIN command_dict c ON e.cmd_id = c.cmd_id
@@ -277,12 +367,12 @@ func runQuery(conn *sql.DB, q string, args ...interface{}) ([]Row, error) {
 		var r Row
 		var exit sql.NullInt64
 		var dur sql.NullInt64
-		var seq int
-		if err := rows.Scan(&r.EventID, &r.SessionID, &seq, &exit, &dur, &r.Cwd, &r.Cmd,
-			&r.StartedAt, &r.GitBranch, &r.GitCommit, &r.Host, &r.Origin); err != nil {
+		var cmdID sql.NullInt64
+		if err := rows.Scan(&r.EventID, &r.SessionID, &r.Seq, &exit, &dur, &r.Cwd, &r.Cmd,
+			&r.StartedAt, &r.GitBranch, &r.GitCommit, &r.Host, &r.Origin, &cmdID, &r.State); err != nil {
 			continue
 		}
-		_ = seq
+		r.cmdID = cmdID.Int64
 		if exit.Valid {
 			v := int(exit.Int64)
 			r.ExitCode = &v
@@ -410,6 +500,34 @@ func ParseMode(s string) (Mode, error) {
 	}
 }
 
+// ParseRank parses a ranking name from CLI/config.
+func ParseRank(s string) (Rank, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "recent", "recency":
+		return RankRecent, nil
+	case "frecency", "frecent":
+		return RankFrecency, nil
+	default:
+		return RankRecent, fmt.Errorf("unknown rank %q", s)
+	}
+}
+
+// RankName returns the CLI name for a ranking.
+func RankName(r Rank) string {
+	if r == RankFrecency {
+		return "frecency"
+	}
+	return "recent"
+}
+
+// NextRank toggles between recent and frecency.
+func NextRank(r Rank) Rank {
+	if r == RankFrecency {
+		return RankRecent
+	}
+	return RankFrecency
+}
+
 // FilterName returns the CLI name for a filter.
 func FilterName(f Filter) string {
 	switch f {
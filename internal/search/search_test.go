@@ -75,6 +75,32 @@ func TestSearchFilterHost(t *testing.T) {
 	}
 }
 
+func TestSearchRepoBranchFilter(t *testing.T) {
+	st, conn := openTestDB(t)
+	seedEvents(t, conn, st, "alpha", "/src/hx", "make build", 0)
+	seedEvents(t, conn, st, "alpha", "/src/other", "make lint", 0)
+	seedEvents(t, conn, st, "alpha", "/tmp", "make clean", 0)
+	_, _ = conn.Exec(`UPDATE events SET repo_root = '/src/hx', git_branch = 'main' WHERE cwd = '/src/hx'`)
+	_, _ = conn.Exec(`UPDATE events SET repo_root = '/src/other', git_branch = 'dev' WHERE cwd = '/src/other'`)
+
+	for _, tc := range []struct {
+		repo, branch, want string
+	}{
+		{repo: "hx", want: "make build"},
+		{repo: "/src/other", want: "make lint"},
+		{branch: "main", want: "make build"},
+		{repo: "other", branch: "dev", want: "make lint"},
+	} {
+		rows, err := Search(context.Background(), conn, nil, Request{Query: "make", Mode: ModeFTS, Repo: tc.repo, Branch: tc.branch})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 1 || rows[0].Cmd != tc.want {
+			t.Errorf("repo=%q branch=%q: got %+v, want only %q", tc.repo, tc.branch, rows, tc.want)
+		}
+	}
+}
+
 func TestSearchExcludeSelf(t *testing.T) {
 	st, conn := openTestDB(t)
 	seedEvents(t, conn, st, "h1", "/tmp", "hx find foo", 0)
@@ -122,7 +148,7 @@ func TestSearchDedupPrefersLiveOverSync(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if _, err := st.InsertSyncEvent("sudo apt install ttyd", ts, ts, 100, nil, 1, sid, "", cmdID); err != nil {
+	if _, err := st.InsertSyncEvent("sudo apt install ttyd", ts, ts, 100, nil, 1, sid, "", cmdID, ""); err != nil {
 		t.Fatal(err)
 	}
 
@@ -172,6 +198,34 @@ func TestSearchRecencyOrder(t *testing.T) {
 	}
 }
 
+func TestSearchLabelsRunning(t *testing.T) {
+	st, conn := openTestDB(t)
+	base := float64(time.Now().Unix())
+	if err := st.EnsureSession("s1", "h1", "pts/0", "/tmp", base); err != nil {
+		t.Fatal(err)
+	}
+	cmdID, _ := st.CmdID("make test", base)
+	pre := &store.PreEvent{T: "pre", Ts: base, Sid: "s1", Seq: 1, Cmd: "make test", Cwd: "/tmp", Host: "h1"}
+	if _, err := st.InsertPendingEvent(pre, cmdID, store.StateRunning); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := Search(context.Background(), conn, nil, Request{Query: "make", Mode: ModeFuzzy, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].State != store.StateRunning {
+		t.Fatalf("want the running event with its state, got %+v", rows)
+	}
+	var buf strings.Builder
+	if err := WriteRows(&buf, FormatTSV, rows); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "\trun\t") {
+		t.Fatalf("running event not labelled: %q", buf.String())
+	}
+}
+
 func TestFuzzyScore(t *testing.T) {
 	if fuzzyScore("make", "make install") < fuzzyScore("make", "cargo build") {
 		t.Error("prefix should score higher")
@@ -5,6 +5,10 @@ import "strings"
 // IsSelfCmd reports whether cmd is hx querying itself (exclude from interactive search).
 func IsSelfCmd(cmd string) bool {
 	cmd = strings.TrimSpace(cmd)
+	// hx run wraps a user command: that is history, not hx querying itself
+	if strings.HasPrefix(cmd, "hx run ") || strings.HasPrefix(cmd, "./bin/hx run ") {
+		return false
+	}
 	if cmd == "hx" || strings.HasPrefix(cmd, "hx ") {
 		return true
 	}
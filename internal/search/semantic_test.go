@@ -0,0 +1,77 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mrcawood/History_eXtended/internal/embedding"
+)
+
+func TestIndexSearchCoversAllCommands(t *testing.T) {
+	st, conn := openTestDB(t)
+	seedEventsAt(t, conn, st, "alpha", "/src", "git status", 0, 1000)
+	seedEventsAt(t, conn, st, "alpha", "/src", "git status", 0, 2000)
+	seedEventsAt(t, conn, st, "alpha", "/src", "make build", 0, 3000)
+	seedEventsAt(t, conn, st, "beta", "/src", "git log", 0, 4000)
+
+	// Words about version control land on the git axis
+	embed := func(ctx context.Context, texts []string) ([][]float32, error) {
+		out := make([][]float32, len(texts))
+		for i, t := range texts {
+			if strings.Contains(t, "git") || strings.Contains(t, "version") {
+				out[i] = []float32{1, 0}
+			} else {
+				out[i] = []float32{0, 1}
+			}
+		}
+		return out, nil
+	}
+	if _, err := embedding.Backfill(context.Background(), conn, "m", embed, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := indexSearch(context.Background(), conn, "m", embed, Request{Filter: FilterHost, Host: "alpha"}, "version control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Cmd != "git status" || rows[1].Cmd != "make build" {
+		t.Fatalf("indexSearch = %+v, want git status (no FTS overlap with the query) then make build", rows)
+	}
+	if rows[0].StartedAt != 2000 {
+		t.Errorf("want the latest git status event, got started_at %v", rows[0].StartedAt)
+	}
+}
+
+func TestIndexSearchFiltersBeforeTopK(t *testing.T) {
+	st, conn := openTestDB(t)
+	// More close matches on another host than the candidate limit
+	for i := 0; i < candidateLimit+10; i++ {
+		seedEventsAt(t, conn, st, "beta", "/src", fmt.Sprintf("git log -%d", i), 0, float64(1000+i))
+	}
+	seedEventsAt(t, conn, st, "alpha", "/src", "git status", 0, 5000)
+
+	embed := func(ctx context.Context, texts []string) ([][]float32, error) {
+		out := make([][]float32, len(texts))
+		for i, t := range texts {
+			switch {
+			case strings.Contains(t, "git log") || strings.Contains(t, "version"):
+				out[i] = []float32{1, 0}
+			default:
+				out[i] = []float32{0.6, 0.8}
+			}
+		}
+		return out, nil
+	}
+	if _, err := embedding.Backfill(context.Background(), conn, "m", embed, 1000); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := indexSearch(context.Background(), conn, "m", embed, Request{Filter: FilterHost, Host: "alpha"}, "version control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Cmd != "git status" {
+		t.Fatalf("indexSearch on host alpha = %+v, want git status", rows)
+	}
+}
@@ -20,17 +20,29 @@ const (
 	ModeSemantic
 )
 
+// Rank orders non-semantic results.
+type Rank int
+
+const (
+	RankRecent   Rank = iota // newest first
+	RankFrecency             // frequency, recency, cwd/repo affinity and success
+)
+
 // Request is input to Search.
 type Request struct {
 	Query     string
 	Filter    Filter
 	Mode      Mode
+	Rank      Rank
 	Host      string // for FilterHost
 	Cwd       string // for FilterDir
 	SessionID string // for FilterSession
+	Repo      string // repo root path or base name (any filter)
+	Branch    string // git branch (any filter)
 	Dedup     bool
 	Limit     int
 	NoImport  bool
+	Where     Where // key:value filters from ParseQuery (any filter)
 }
 
 // Row is one search result for display or machine export.
@@ -40,11 +52,20 @@ type Row struct {
 	Cwd        string
 	Host       string
 	SessionID  string
+	Seq        int
 	Origin     string
 	ExitCode   *int
+	State      string `json:",omitempty"` // running, interrupted, unknown; "" when completed
 	DurationMs *int64
 	StartedAt  float64
 	GitBranch  string
 	GitCommit  string
 	DupCount   int
+
+	// Set by WithContext: Group numbers runs of neighbouring events from one
+	// session (1-based); Context marks neighbours that are not matches.
+	Group   int  `json:",omitempty"`
+	Context bool `json:",omitempty"`
+
+	cmdID int64 // command_dict id, for frecency stats
 }
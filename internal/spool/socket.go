@@ -0,0 +1,180 @@
+package spool
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// SendTimeout bounds how long hx-emit waits on hxd before falling back to the spool file.
+const SendTimeout = 5 * time.Millisecond
+
+// MaxDatagram is the largest payload sent over the socket; bigger events use the spool file.
+const MaxDatagram = 64 << 10
+
+// ErrTooLarge is returned by Send when the payload exceeds MaxDatagram.
+var ErrTooLarge = errors.New("payload too large for socket")
+
+// SocketPath returns the per-user hxd socket. Resolved from env only (no
+// config load) so hx-emit can use it on the hot path: HX_SOCKET, else
+// $XDG_RUNTIME_DIR/hx/hxd.sock, else $XDG_DATA_HOME/hx/hxd.sock.
+func SocketPath() string {
+	if v := os.Getenv("HX_SOCKET"); v != "" {
+		return v
+	}
+	if v := os.Getenv("XDG_RUNTIME_DIR"); v != "" {
+		return filepath.Join(v, "hx", "hxd.sock")
+	}
+	if v := os.Getenv("XDG_DATA_HOME"); v != "" {
+		return filepath.Join(v, "hx", "hxd.sock")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".local", "share", "hx", "hxd.sock")
+}
+
+// Send delivers JSONL payload (one or more complete lines) to hxd as a single
+// datagram. Fails fast when hxd is not listening; callers fall back to Append.
+// A nil error means the kernel queued the datagram, not that it is on disk:
+// if hxd dies before it reads and appends what is queued, those events are
+// lost. When the queue is full, Send times out and the caller falls back.
+func Send(path string, payload []byte, timeout time.Duration) error {
+	if len(payload) > MaxDatagram {
+		return ErrTooLarge
+	}
+	conn, err := net.DialTimeout("unixgram", path, timeout)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	if err := conn.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	_, err = conn.Write(payload)
+	return err
+}
+
+// Listen binds the hxd datagram socket, replacing a stale socket file left by
+// a previous run. The directory is 0700 and the socket 0600 (owner only).
+func Listen(path string) (*net.UnixConn, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(path)
+	}
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Append writes payload (complete JSONL lines) to events.jsonl in one write.
+// The write holds a shared lock on the live file so Rotate cannot seal it
+// mid-append; see openLive.
+func Append(spoolDir string, payload []byte) error {
+	if err := os.MkdirAll(spoolDir, 0755); err != nil {
+		return err
+	}
+	f, err := openLive(EventsPath(spoolDir))
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(payload); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ValidPayload reports whether every line of payload is a pre/post event.
+func ValidPayload(payload []byte) bool {
+	if len(payload) == 0 || payload[len(payload)-1] != '\n' {
+		return false
+	}
+	for _, line := range bytes.Split(bytes.TrimSuffix(payload, []byte("\n")), []byte("\n")) {
+		if _, ok := parseLine(line); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ScrubPayload passes every pre event in payload through scrub before it is
+// written anywhere; scrub rewrites the event's cmd and env in place, or
+// returns false to drop the event. A dropped pre event is removed along with
+// its post in the same payload. Lines are rewritten only when their cmd or
+// env changes.
+func ScrubPayload(payload []byte, scrub func(e *Event) bool) []byte {
+	lines := bytes.SplitAfter(payload, []byte("\n"))
+	dropped := make(map[string]bool)
+	var out []byte
+	for _, line := range lines {
+		e, ok := parseLine(bytes.TrimSuffix(line, []byte("\n")))
+		if !ok {
+			out = append(out, line...)
+			continue
+		}
+		key := e.Sid + ":" + strconv.Itoa(e.Seq)
+		if e.T == "post" {
+			if !dropped[key] {
+				out = append(out, line...)
+			}
+			continue
+		}
+		scrubbed := e
+		if !scrub(&scrubbed) {
+			dropped[key] = true
+			continue
+		}
+		if scrubbed.Cmd == e.Cmd && maps.Equal(scrubbed.Env, e.Env) {
+			out = append(out, line...)
+			continue
+		}
+		out = append(out, rewriteLine(line, scrubbed.Cmd, scrubbed.Env)...)
+	}
+	return out
+}
+
+// rewriteLine replaces the cmd and env fields of a JSONL line, keeping every
+// other field as sent.
+func rewriteLine(line []byte, cmd string, env map[string]string) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return line
+	}
+	// No HTML escaping: placeholders stay readable as <REDACTED:kind>
+	set := func(key string, v interface{}) bool {
+		var b bytes.Buffer
+		enc := json.NewEncoder(&b)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			return false
+		}
+		fields[key] = bytes.TrimSuffix(b.Bytes(), []byte("\n"))
+		return true
+	}
+	if !set("cmd", cmd) {
+		return line
+	}
+	if len(env) > 0 && !set("env", env) {
+		return line
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(fields); err != nil {
+		return line
+	}
+	return buf.Bytes()
+}
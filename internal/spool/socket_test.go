@@ -0,0 +1,204 @@
+package spool
+
+import (
+	"bytes"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testPre  = `{"t":"pre","ts":1,"sid":"s1","seq":1,"cmd":"hi","cwd":"/x","tty":"pts/0","host":"h"}` + "\n"
+	testPost = `{"t":"post","ts":2,"sid":"s1","seq":1,"exit":0,"dur_ms":100,"pipe":[]}` + "\n"
+)
+
+func TestSendListen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hx", "hxd.sock")
+	conn, err := Listen(path)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("socket mode = %v, want 0600", fi.Mode().Perm())
+	}
+
+	payload := []byte(testPre + testPost)
+	if err := Send(path, payload, SendTimeout); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	buf := make([]byte, MaxDatagram)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if string(buf[:n]) != string(payload) {
+		t.Errorf("received %q, want %q", buf[:n], payload)
+	}
+
+	// A second Listen replaces the stale socket file
+	_ = conn.Close()
+	conn2, err := Listen(path)
+	if err != nil {
+		t.Fatalf("Listen over stale socket: %v", err)
+	}
+	_ = conn2.Close()
+}
+
+func TestSendNoListener(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hxd.sock")
+	start := time.Now()
+	if err := Send(path, []byte(testPre), SendTimeout); err == nil {
+		t.Fatal("Send without listener: want error")
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("Send without listener took %v, want fast failure", d)
+	}
+	if err := Send(path, make([]byte, MaxDatagram+1), SendTimeout); err != ErrTooLarge {
+		t.Errorf("oversized Send: got %v, want ErrTooLarge", err)
+	}
+}
+
+func TestAppend(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "spool")
+	if err := Append(dir, []byte(testPre)); err != nil {
+		t.Fatal(err)
+	}
+	if err := Append(dir, []byte(testPost)); err != nil {
+		t.Fatal(err)
+	}
+	events, err := Read(EventsPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].T != "pre" || events[1].T != "post" {
+		t.Errorf("events = %+v", events)
+	}
+}
+
+func TestValidPayload(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    bool
+	}{
+		{testPre, true},
+		{testPre + testPost, true},
+		{"", false},
+		{"\n", false},
+		{testPre[:len(testPre)-1], false},
+		{testPre + "not json\n", false},
+		{`{"t":"other"}` + "\n", false},
+	}
+	for _, tt := range tests {
+		if got := ValidPayload([]byte(tt.payload)); got != tt.want {
+			t.Errorf("ValidPayload(%q) = %v, want %v", tt.payload, got, tt.want)
+		}
+	}
+}
+
+// BenchmarkSendSocket measures the hx-emit hot path when hxd is running and
+// reports p99 latency alongside the mean.
+func BenchmarkSendSocket(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "hxd.sock")
+	conn, err := Listen(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	go func() {
+		buf := make([]byte, MaxDatagram)
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	payload := []byte(testPre)
+	lat := make([]time.Duration, b.N)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := time.Now()
+		if err := Send(path, payload, SendTimeout); err != nil {
+			b.Fatal(err)
+		}
+		lat[i] = time.Since(start)
+	}
+	b.StopTimer()
+	reportP99(b, lat)
+}
+
+// BenchmarkAppendSpool measures the fallback path (hxd down).
+func BenchmarkAppendSpool(b *testing.B) {
+	dir := b.TempDir()
+	payload := []byte(testPre)
+	lat := make([]time.Duration, b.N)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := time.Now()
+		if err := Append(dir, payload); err != nil {
+			b.Fatal(err)
+		}
+		lat[i] = time.Since(start)
+	}
+	b.StopTimer()
+	reportP99(b, lat)
+}
+
+func reportP99(b *testing.B, lat []time.Duration) {
+	sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+	b.ReportMetric(float64(lat[len(lat)*99/100].Nanoseconds()), "p99-ns")
+}
+
+func TestScrubPayload(t *testing.T) {
+	secretPre := `{"t":"pre","ts":1,"sid":"s1","seq":2,"cmd":"mysql -pS3cret","cwd":"/x","tty":"pts/0","host":"h"}` + "\n"
+	dropPre := `{"t":"pre","ts":1,"sid":"s1","seq":3,"cmd":"vault unseal KEY","cwd":"/x","tty":"pts/0","host":"h"}` + "\n"
+	dropPost := `{"t":"post","ts":2,"sid":"s1","seq":3,"exit":0,"dur_ms":1,"pipe":[]}` + "\n"
+	envPre := `{"t":"pre","ts":1,"sid":"s1","seq":4,"cmd":"deploy","cwd":"/x","tty":"pts/0","host":"h","env":{"DB_PASS":"S3cret","AWS_PROFILE":"prod"}}` + "\n"
+	scrub := func(e *Event) bool {
+		if strings.Contains(e.Cmd, "KEY") {
+			return false
+		}
+		e.Cmd = strings.ReplaceAll(e.Cmd, "S3cret", "<REDACTED:password>")
+		if v, ok := e.Env["DB_PASS"]; ok {
+			env := maps.Clone(e.Env)
+			env["DB_PASS"] = strings.ReplaceAll(v, "S3cret", "<REDACTED:password>")
+			e.Env = env
+		}
+		return true
+	}
+
+	if got := string(ScrubPayload([]byte(testPre+testPost), scrub)); got != testPre+testPost {
+		t.Errorf("clean payload changed: %q", got)
+	}
+	if got := string(ScrubPayload([]byte(dropPre+dropPost+testPre), scrub)); got != testPre {
+		t.Errorf("dropped payload = %q, want only the other event", got)
+	}
+
+	out := ScrubPayload([]byte(secretPre), scrub)
+	if !ValidPayload(out) {
+		t.Fatalf("scrubbed payload invalid: %q", out)
+	}
+	if strings.Contains(string(out), "S3cret") || !strings.Contains(string(out), "mysql -p<REDACTED:password>") {
+		t.Errorf("scrubbed payload = %q", out)
+	}
+	e, _ := parseLine(bytes.TrimSuffix(out, []byte("\n")))
+	if e.Sid != "s1" || e.Seq != 2 || e.Cwd != "/x" || e.Host != "h" {
+		t.Errorf("other fields lost: %+v", e)
+	}
+
+	// Secrets in captured env values are masked too
+	out = ScrubPayload([]byte(envPre), scrub)
+	e, _ = parseLine(bytes.TrimSuffix(out, []byte("\n")))
+	if e.Cmd != "deploy" || e.Env["DB_PASS"] != "<REDACTED:password>" || e.Env["AWS_PROFILE"] != "prod" {
+		t.Errorf("env not scrubbed: %+v", e)
+	}
+}
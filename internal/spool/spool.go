@@ -21,6 +21,8 @@ type Event struct {
 	Exit  int     `json:"exit"`
 	DurMs int64   `json:"dur_ms"`
 	Pipe  []int   `json:"pipe"`
+
+	Env map[string]string `json:"env,omitempty"` // pre only: captured environment (internal/envctx)
 }
 
 // Read opens events.jsonl and yields parsed events. Skips invalid lines.
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestRead(t *testing.T) {
@@ -67,3 +68,156 @@ func TestEventsPath(t *testing.T) {
 		t.Errorf("EventsPath = %q, want %q", got, want)
 	}
 }
+
+func TestTailPartialLineAndResume(t *testing.T) {
+	dir := t.TempDir()
+	path := EventsPath(dir)
+	full := `{"t":"pre","ts":1,"sid":"s1","seq":1,"cmd":"a"}` + "\n"
+	partial := `{"t":"post","ts":2,"sid":"s1","seq":1,"exit":0`
+	if err := os.WriteFile(path, []byte(full+partial), 0644); err != nil {
+		t.Fatal(err)
+	}
+	events, cp, err := Tail(dir, &Checkpoint{})
+	if err != nil {
+		t.Fatalf("Tail: %v", err)
+	}
+	if len(events) != 1 || cp.Offset != int64(len(full)) {
+		t.Fatalf("got %d events offset %d, want 1 at %d", len(events), cp.Offset, len(full))
+	}
+	if err := SaveCheckpoint(dir, cp); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writer finishes the line; resume from saved checkpoint
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`,"dur_ms":1}` + "\n")
+	_ = f.Close()
+	loaded, err := LoadCheckpoint(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, cp, err = Tail(dir, loaded)
+	if err != nil {
+		t.Fatalf("Tail: %v", err)
+	}
+	if len(events) != 1 || events[0].T != "post" {
+		t.Fatalf("resume: got %+v, want one post", events)
+	}
+	events, _, err = Tail(dir, cp)
+	if err != nil || len(events) != 0 {
+		t.Fatalf("caught up: got %d events, err %v", len(events), err)
+	}
+}
+
+func TestRotateDrainsSealedAndPrunes(t *testing.T) {
+	dir := t.TempDir()
+	path := EventsPath(dir)
+	line := `{"t":"pre","ts":1,"sid":"s1","seq":1,"cmd":"a"}` + "\n"
+	if err := os.WriteFile(path, []byte(line), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, cp, err := Tail(dir, &Checkpoint{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := Rotate(dir, cp, 1)
+	if err != nil || !rotated {
+		t.Fatalf("Rotate = %v, %v; want true", rotated, err)
+	}
+
+	// Late write to the sealed file by a writer that skipped the lock, then new live file
+	entries, _ := os.ReadDir(SealedDir(dir))
+	if len(entries) != 1 {
+		t.Fatalf("sealed entries = %d, want 1", len(entries))
+	}
+	sealed := filepath.Join(SealedDir(dir), entries[0].Name())
+	f, _ := os.OpenFile(sealed, os.O_APPEND|os.O_WRONLY, 0644)
+	_, _ = f.WriteString(`{"t":"post","ts":2,"sid":"s1","seq":1,"exit":0}` + "\n")
+	_ = f.Close()
+	if err := os.WriteFile(path, []byte(`{"t":"pre","ts":3,"sid":"s1","seq":2,"cmd":"b"}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	events, cp, err := Tail(dir, cp)
+	if err != nil || len(events) != 1 || events[0].T != "post" {
+		t.Fatalf("drain sealed: got %+v, err %v", events, err)
+	}
+	events, cp, err = Tail(dir, cp)
+	if err != nil || len(events) != 1 || events[0].Cmd != "b" {
+		t.Fatalf("live after rotate: got %+v, err %v", events, err)
+	}
+
+	n, err := PruneSealed(dir, cp, -time.Second)
+	if err != nil || n != 1 {
+		t.Fatalf("PruneSealed = %d, %v; want 1", n, err)
+	}
+}
+
+func TestRotateWaitsForAppendLock(t *testing.T) {
+	dir := t.TempDir()
+	line := `{"t":"pre","ts":1,"sid":"s1","seq":1,"cmd":"a"}` + "\n"
+	if err := Append(dir, []byte(line)); err != nil {
+		t.Fatal(err)
+	}
+	_, cp, err := Tail(dir, &Checkpoint{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A writer holding the old inode mid-append blocks rotation
+	f, err := openLive(EventsPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan bool)
+	go func() {
+		rotated, err := Rotate(dir, cp, 1)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- rotated
+	}()
+	select {
+	case <-done:
+		t.Fatal("Rotate returned while an append held the lock")
+	case <-time.After(50 * time.Millisecond):
+	}
+	_ = f.Close()
+	if !<-done {
+		t.Fatal("Rotate = false after the append finished; want true")
+	}
+
+	// Appends after the rename go to a new live file, never the sealed one
+	if err := Append(dir, []byte(`{"t":"post","ts":2,"sid":"s1","seq":1,"exit":0}`+"\n")); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(SealedDir(dir))
+	if len(entries) != 1 {
+		t.Fatalf("sealed entries = %d, want 1", len(entries))
+	}
+	sealed, _ := os.ReadFile(filepath.Join(SealedDir(dir), entries[0].Name()))
+	if string(sealed) != line {
+		t.Errorf("sealed segment = %q, want only the ingested line", sealed)
+	}
+	events, _, err := Tail(dir, cp)
+	if err != nil || len(events) != 1 || events[0].T != "post" {
+		t.Fatalf("live after rotate: got %+v, err %v", events, err)
+	}
+}
+
+func TestSaveCheckpointPrivate(t *testing.T) {
+	dir := t.TempDir()
+	if err := SaveCheckpoint(dir, &Checkpoint{Inode: 1, Offset: 2}); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(CheckpointPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Errorf("checkpoint mode = %o, want 600", perm)
+	}
+}
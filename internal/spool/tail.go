@@ -0,0 +1,316 @@
+package spool
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// MaxTailEvents caps the number of events returned by one Tail call so a large
+// backlog is ingested in bounded batches, each followed by a checkpoint.
+const MaxTailEvents = 5000
+
+// Checkpoint records how far the ingester has consumed the live spool file.
+// Inode identifies the file the offset refers to; it changes when the spool is
+// rotated or recreated. Pending holds pre events still waiting for their post.
+type Checkpoint struct {
+	Inode   uint64  `json:"inode"`
+	Offset  int64   `json:"offset"`
+	Pending []Event `json:"pending,omitempty"`
+}
+
+// CheckpointPath returns path to the ingest checkpoint in spool dir.
+func CheckpointPath(spoolDir string) string {
+	return filepath.Join(spoolDir, "checkpoint.json")
+}
+
+// SealedDir returns the directory holding rotated (fully ingested) spool segments.
+func SealedDir(spoolDir string) string {
+	return filepath.Join(spoolDir, "sealed")
+}
+
+// LoadCheckpoint reads the checkpoint. Missing file yields a zero checkpoint (start of spool).
+func LoadCheckpoint(spoolDir string) (*Checkpoint, error) {
+	b, err := os.ReadFile(CheckpointPath(spoolDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Checkpoint{}, nil
+		}
+		return nil, err
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return nil, fmt.Errorf("parse checkpoint: %w", err)
+	}
+	return &cp, nil
+}
+
+// SaveCheckpoint writes the checkpoint atomically (tmp + fsync + rename).
+func SaveCheckpoint(spoolDir string, cp *Checkpoint) error {
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	path := CheckpointPath(spoolDir)
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Tail returns events appended since cp and the checkpoint to persist once they
+// are ingested. Only complete lines are consumed; a partially written last line
+// is left for the next call. If the tracked file was rotated away, its remaining
+// bytes are drained from the sealed dir before moving on to the live file.
+func Tail(spoolDir string, cp *Checkpoint) ([]Event, *Checkpoint, error) {
+	next := &Checkpoint{Inode: cp.Inode, Offset: cp.Offset, Pending: cp.Pending}
+	livePath := EventsPath(spoolDir)
+	liveIno, liveSize, err := statFile(livePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	live := err == nil
+
+	if next.Inode != 0 && (!live || next.Inode != liveIno) {
+		if sealed := findSealed(spoolDir, next.Inode); sealed != "" {
+			events, off, err := readFrom(sealed, next.Offset, MaxTailEvents)
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(events) == MaxTailEvents {
+				next.Offset = off
+				return events, next, nil
+			}
+			if live {
+				next.Inode, next.Offset = liveIno, 0
+			} else {
+				next.Inode, next.Offset = 0, 0
+			}
+			if len(events) > 0 {
+				return events, next, nil
+			}
+		} else if live {
+			next.Inode, next.Offset = liveIno, 0
+		} else {
+			next.Inode, next.Offset = 0, 0
+		}
+	}
+	if !live {
+		return nil, next, nil
+	}
+	if next.Inode != liveIno || liveSize < next.Offset {
+		// New or truncated spool file: start from the beginning.
+		next.Inode, next.Offset = liveIno, 0
+	}
+	events, off, err := readFrom(livePath, next.Offset, MaxTailEvents)
+	if err != nil {
+		return nil, nil, err
+	}
+	next.Offset = off
+	return events, next, nil
+}
+
+// Rotate seals the live spool file when cp shows it is fully ingested and it has
+// grown to at least minBytes. The file is renamed into SealedDir while holding
+// an exclusive lock, so no Append is mid-write and the size checked is final;
+// a writer that opened the old file waits on the lock, sees it was renamed
+// and reopens the live path. Returns true if a rotation happened.
+func Rotate(spoolDir string, cp *Checkpoint, minBytes int64) (bool, error) {
+	livePath := EventsPath(spoolDir)
+	f, err := os.Open(livePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer func() { _ = f.Close() }()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return false, fmt.Errorf("lock %s: %w", livePath, err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	if !sameFile(fi, livePath) {
+		return false, nil // rotated or recreated since we opened it
+	}
+	if inodeOf(fi) != cp.Inode || fi.Size() != cp.Offset || fi.Size() < minBytes {
+		return false, nil
+	}
+	dir := SealedDir(spoolDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false, err
+	}
+	name := fmt.Sprintf("events-%d.jsonl", time.Now().UnixNano())
+	if err := os.Rename(livePath, filepath.Join(dir, name)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// openLive opens the live spool file for append under a shared lock. If the
+// file was rotated between open and lock, the handle points at a sealed
+// segment, so it is dropped and the path reopened. Closing f releases the lock.
+func openLive(path string) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_SH); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("lock %s: %w", path, err)
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		if sameFile(fi, path) {
+			return f, nil
+		}
+		_ = f.Close()
+	}
+}
+
+// sameFile reports whether path still names the file fi describes.
+func sameFile(fi os.FileInfo, path string) bool {
+	cur, err := os.Stat(path)
+	return err == nil && os.SameFile(fi, cur)
+}
+
+// PruneSealed deletes sealed segments older than grace. The segment cp still
+// tracks is kept so its inode cannot be reused by a new live file.
+func PruneSealed(spoolDir string, cp *Checkpoint, grace time.Duration) (int, error) {
+	dir := SealedDir(spoolDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	cutoff := time.Now().Add(-grace)
+	var removed int
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".jsonl") {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		fi, err := os.Stat(path)
+		if err != nil || fi.ModTime().After(cutoff) {
+			continue
+		}
+		if cp != nil && inodeOf(fi) == cp.Inode {
+			continue
+		}
+		if err := os.Remove(path); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// readFrom parses complete lines starting at offset, up to max events.
+// Returns the offset just past the last consumed line.
+func readFrom(path string, offset int64, max int) ([]Event, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, offset, nil
+		}
+		return nil, offset, err
+	}
+	defer func() { _ = f.Close() }()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, offset, fmt.Errorf("seek %s: %w", path, err)
+	}
+	var out []Event
+	r := bufio.NewReader(f)
+	for len(out) < max {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break // partial line (no newline yet) is left for the next call
+			}
+			return nil, offset, fmt.Errorf("read %s: %w", path, err)
+		}
+		offset += int64(len(line))
+		if e, ok := parseLine(line); ok {
+			out = append(out, e)
+		}
+	}
+	return out, offset, nil
+}
+
+// parseLine decodes one JSONL line into a pre/post event. Invalid lines are rejected.
+func parseLine(line []byte) (Event, bool) {
+	var e Event
+	if len(strings.TrimSpace(string(line))) == 0 {
+		return e, false
+	}
+	if err := json.Unmarshal(line, &e); err != nil {
+		return e, false
+	}
+	if e.T != "pre" && e.T != "post" {
+		return e, false
+	}
+	return e, true
+}
+
+func findSealed(spoolDir string, ino uint64) string {
+	dir := SealedDir(spoolDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if inodeOf(fi) == ino {
+			return filepath.Join(dir, e.Name())
+		}
+	}
+	return ""
+}
+
+func statFile(path string) (uint64, int64, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	return inodeOf(fi), fi.Size(), nil
+}
+
+func inodeOf(fi os.FileInfo) uint64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
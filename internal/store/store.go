@@ -7,13 +7,32 @@ import (
 	"encoding/json"
 	"strings"
 	"time"
+
+	"github.com/mrcawood/History_eXtended/internal/envctx"
+	"github.com/mrcawood/History_eXtended/internal/exitcode"
+)
+
+// Event states for commands recorded without a matching post event.
+// Completed events have a NULL state.
+const (
+	StateRunning     = "running"     // no post yet and the shell is still alive
+	StateInterrupted = "interrupted" // the shell exited while the command ran
+	StateUnknown     = "unknown"     // the shell moved on but the post was lost
 )
 
+// DBTX is the part of *sql.DB and *sql.Tx that Store uses, so a Store can
+// run inside a transaction.
+type DBTX interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 type Store struct {
-	db *sql.DB
+	db DBTX
 }
 
-func New(db *sql.DB) *Store {
+func New(db DBTX) *Store {
 	return &Store{db: db}
 }
 
@@ -27,6 +46,13 @@ type PreEvent struct {
 	Cwd  string  `json:"cwd"`
 	Tty  string  `json:"tty"`
 	Host string  `json:"host"`
+
+	Env map[string]string `json:"env,omitempty"` // captured environment, stored in extra_json
+
+	// Git context, resolved at ingest time (not part of the spool format).
+	RepoRoot  string `json:"-"`
+	GitBranch string `json:"-"`
+	GitCommit string `json:"-"`
 }
 
 // PostEvent from spool (t=post)
@@ -114,16 +140,48 @@ func (s *Store) EnsureImportSession(sessionID, batchID, sourceFile, host string,
 	return err
 }
 
+// ImportEvent is one imported history entry with provenance.
+type ImportEvent struct {
+	Cmd         string
+	StartedAt   float64
+	DurationMs  int64 // 0 for unknown
+	Seq         int
+	SessionID   string
+	CmdID       int64
+	QualityTier string // "high", "medium", or "low"
+	SourceFile  string
+	SourceHost  string
+	BatchID     string
+	Cwd         string // "" when the source does not record it
+	ExitCode    *int   // nil when the source does not record it
+	ExtraJSON   string // optional source-specific metadata (e.g. fish paths)
+}
+
 // InsertImportEvent inserts an import event with provenance. Populates events_fts.
 // qualityTier: "high", "medium", or "low". durationMs may be 0 for unknown.
 func (s *Store) InsertImportEvent(cmd string, startedAt float64, durationMs int64, seq int, sessionID string, cmdID int64, qualityTier, sourceFile, sourceHost, batchID string) (bool, error) {
-	endedAt := startedAt
-	if durationMs > 0 {
-		endedAt = startedAt + float64(durationMs)/1000
+	return s.InsertImport(&ImportEvent{
+		Cmd: cmd, StartedAt: startedAt, DurationMs: durationMs, Seq: seq, SessionID: sessionID,
+		CmdID: cmdID, QualityTier: qualityTier, SourceFile: sourceFile, SourceHost: sourceHost, BatchID: batchID,
+	})
+}
+
+// InsertImport inserts ev with provenance. Populates events_fts.
+func (s *Store) InsertImport(ev *ImportEvent) (bool, error) {
+	endedAt := ev.StartedAt
+	if ev.DurationMs > 0 {
+		endedAt = ev.StartedAt + float64(ev.DurationMs)/1000
+	}
+	var exit interface{}
+	var signal string
+	if ev.ExitCode != nil {
+		exit = *ev.ExitCode
+		signal = exitcode.SignalName(*ev.ExitCode)
 	}
 	res, err := s.db.Exec(
-		`INSERT OR IGNORE INTO events (session_id, seq, started_at, ended_at, duration_ms, exit_code, pipe_status_json, cwd, cmd_id, origin, quality_tier, source_file, source_host, import_batch_id) VALUES (?, ?, ?, ?, ?, NULL, '[]', '', ?, 'import', ?, ?, ?, ?)`,
-		sessionID, seq, startedAt, endedAt, durationMs, cmdID, qualityTier, sourceFile, sourceHost, batchID,
+		`INSERT OR IGNORE INTO events (session_id, seq, started_at, ended_at, duration_ms, exit_code, signal, pipe_status_json, cwd, cmd_id, extra_json, origin, quality_tier, source_file, source_host, import_batch_id) VALUES (?, ?, ?, ?, ?, ?, ?, '[]', ?, ?, ?, 'import', ?, ?, ?, ?)`,
+		ev.SessionID, ev.Seq, ev.StartedAt, endedAt, ev.DurationMs, exit, nullIfEmpty(signal), ev.Cwd, ev.CmdID, nullIfEmpty(ev.ExtraJSON),
+		ev.QualityTier, ev.SourceFile, ev.SourceHost, ev.BatchID,
 	)
 	if err != nil {
 		return false, err
@@ -131,31 +189,57 @@ func (s *Store) InsertImportEvent(cmd string, startedAt float64, durationMs int6
 	n, _ := res.RowsAffected()
 	if n > 0 {
 		eventID, _ := res.LastInsertId()
-		_, _ = s.db.Exec(`INSERT INTO events_fts(rowid, cmd_text, cwd) VALUES (?, ?, ?)`, eventID, cmd, "")
+		_, _ = s.db.Exec(`INSERT INTO events_fts(rowid, cmd_text, cwd) VALUES (?, ?, ?)`, eventID, ev.Cmd, ev.Cwd)
 	}
 	return n > 0, nil
 }
 
+// CapturedEventNear returns the id of a captured (live or synced, not
+// imported) event on host that ran cmdID within window seconds of ts, or 0.
+// Imports use it to avoid duplicating commands hx already recorded.
+func (s *Store) CapturedEventNear(cmdID int64, host string, ts, window float64) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(`
+		SELECT e.event_id FROM events e JOIN sessions s ON s.session_id = e.session_id
+		WHERE e.started_at BETWEEN ? AND ? AND e.cmd_id = ? AND e.origin != 'import' AND s.host = ?
+		ORDER BY ABS(e.started_at - ?) LIMIT 1
+	`, ts-window, ts+window, cmdID, host, ts).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
 // SyncSessionID returns the composite session_id for sync: node_id|orig_session_id.
 func SyncSessionID(nodeID, origSessionID string) string {
 	return nodeID + "|" + origSessionID
 }
 
 // InsertSyncEvent inserts an event from sync. Uses INSERT OR IGNORE for idempotency.
-// sessionIDInDB must be SyncSessionID(nodeID, origSessionID).
-func (s *Store) InsertSyncEvent(cmd string, startedAt, endedAt float64, durationMs int64, exitCode *int, seq int, sessionIDInDB, cwd string, cmdID int64) (bool, error) {
+// sessionIDInDB must be SyncSessionID(nodeID, origSessionID). state is
+// StateInterrupted or StateUnknown for a command the peer never saw finish,
+// "" when completed. A synced event that still has a state takes the exit,
+// timing and state of a later copy, so a peer's late post reaches this node.
+func (s *Store) InsertSyncEvent(cmd string, startedAt, endedAt float64, durationMs int64, exitCode *int, seq int, sessionIDInDB, cwd string, cmdID int64, state string) (bool, error) {
 	var exit interface{} = nil
 	if exitCode != nil {
 		exit = *exitCode
 	}
 	res, err := s.db.Exec(
-		`INSERT OR IGNORE INTO events (session_id, seq, started_at, ended_at, duration_ms, exit_code, pipe_status_json, cwd, cmd_id, origin) VALUES (?, ?, ?, ?, ?, ?, '[]', ?, ?, 'sync')`,
-		sessionIDInDB, seq, startedAt, endedAt, durationMs, exit, cwd, cmdID,
+		`INSERT OR IGNORE INTO events (session_id, seq, started_at, ended_at, duration_ms, exit_code, pipe_status_json, cwd, cmd_id, origin, state) VALUES (?, ?, ?, ?, ?, ?, '[]', ?, ?, 'sync', ?)`,
+		sessionIDInDB, seq, startedAt, endedAt, durationMs, exit, cwd, cmdID, nullIfEmpty(state),
 	)
 	if err != nil {
 		return false, err
 	}
 	n, _ := res.RowsAffected()
+	if n == 0 {
+		_, err := s.db.Exec(
+			`UPDATE events SET ended_at = ?, duration_ms = ?, exit_code = ?, state = ? WHERE session_id = ? AND seq = ? AND origin = 'sync' AND state IS NOT NULL`,
+			endedAt, durationMs, exit, nullIfEmpty(state), sessionIDInDB, seq,
+		)
+		return false, err
+	}
 	if n > 0 {
 		eventID, _ := res.LastInsertId()
 		_, _ = s.db.Exec(`INSERT INTO events_fts(rowid, cmd_text, cwd) VALUES (?, ?, ?)`, eventID, cmd, cwd)
@@ -182,8 +266,36 @@ func (s *Store) InsertEvent(pre *PreEvent, post *PostEvent, cmdID int64) (bool,
 		pipeJSON = string(b)
 	}
 	res, err := s.db.Exec(
-		`INSERT OR IGNORE INTO events (session_id, seq, started_at, ended_at, duration_ms, exit_code, pipe_status_json, cwd, cmd_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		`INSERT OR IGNORE INTO events (session_id, seq, started_at, ended_at, duration_ms, exit_code, pipe_status_json, cwd, cmd_id, repo_root, git_branch, git_commit, signal, extra_json) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		pre.Sid, pre.Seq, pre.Ts, post.Ts, post.DurMs, post.Exit, pipeJSON, pre.Cwd, cmdID,
+		nullIfEmpty(pre.RepoRoot), nullIfEmpty(pre.GitBranch), nullIfEmpty(pre.GitCommit),
+		nullIfEmpty(exitcode.Signal(post.Exit, post.Pipe)), nullIfEmpty(envctx.ExtraJSON(pre.Env)),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		// Already recorded without a post (running/interrupted): promote it
+		return s.CompleteEvent(post)
+	}
+	eventID, _ := res.LastInsertId()
+	_, _ = s.db.Exec(
+		`INSERT INTO events_fts(rowid, cmd_text, cwd) VALUES (?, ?, ?)`,
+		eventID, pre.Cmd, pre.Cwd,
+	)
+	s.linkArtifacts(eventID, pre.Sid, pre.Seq)
+	return true, nil
+}
+
+// InsertPendingEvent records a command that has no post event yet, with the
+// given state. Exit status and end time stay NULL until CompleteEvent.
+func (s *Store) InsertPendingEvent(pre *PreEvent, cmdID int64, state string) (bool, error) {
+	res, err := s.db.Exec(
+		`INSERT OR IGNORE INTO events (session_id, seq, started_at, pipe_status_json, cwd, cmd_id, repo_root, git_branch, git_commit, state, extra_json) VALUES (?, ?, ?, '[]', ?, ?, ?, ?, ?, ?, ?)`,
+		pre.Sid, pre.Seq, pre.Ts, pre.Cwd, cmdID,
+		nullIfEmpty(pre.RepoRoot), nullIfEmpty(pre.GitBranch), nullIfEmpty(pre.GitCommit), state,
+		nullIfEmpty(envctx.ExtraJSON(pre.Env)),
 	)
 	if err != nil {
 		return false, err
@@ -195,6 +307,93 @@ func (s *Store) InsertEvent(pre *PreEvent, post *PostEvent, cmdID int64) (bool,
 			`INSERT INTO events_fts(rowid, cmd_text, cwd) VALUES (?, ?, ?)`,
 			eventID, pre.Cmd, pre.Cwd,
 		)
+		s.linkArtifacts(eventID, pre.Sid, pre.Seq)
 	}
 	return n > 0, nil
 }
+
+// linkArtifacts points artifacts hx run saved while the command was still
+// running (pending by session and seq) at its new event.
+func (s *Store) linkArtifacts(eventID int64, sid string, seq int) {
+	_, _ = s.db.Exec(
+		`UPDATE artifacts SET linked_event_id = ? WHERE linked_event_id IS NULL AND linked_session_id = ? AND linked_seq = ?`,
+		eventID, sid, seq,
+	)
+}
+
+// CompleteEvent applies a late post event to a pending event, turning it into
+// a normal completed event. Returns false if no pending event matched.
+func (s *Store) CompleteEvent(post *PostEvent) (bool, error) {
+	pipeJSON := "[]"
+	if len(post.Pipe) > 0 {
+		b, _ := json.Marshal(post.Pipe)
+		pipeJSON = string(b)
+	}
+	res, err := s.db.Exec(
+		`UPDATE events SET ended_at = ?, duration_ms = ?, exit_code = ?, pipe_status_json = ?, signal = ?, state = NULL WHERE session_id = ? AND seq = ? AND state IS NOT NULL`,
+		post.Ts, post.DurMs, post.Exit, pipeJSON, nullIfEmpty(exitcode.Signal(post.Exit, post.Pipe)),
+		post.Sid, post.Seq,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// MarkStaleRunning moves running events to unknown when a later command in the
+// same session exists (its post was lost) or when they started before cutoff.
+func (s *Store) MarkStaleRunning(cutoff float64) (int64, error) {
+	res, err := s.db.Exec(`
+		UPDATE events SET state = ?
+		WHERE state = ? AND (started_at < ? OR EXISTS (
+			SELECT 1 FROM events later WHERE later.session_id = events.session_id AND later.seq > events.seq
+		))
+	`, StateUnknown, StateRunning, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RunningSessions returns session_id -> host for sessions with running events.
+func (s *Store) RunningSessions() (map[string]string, error) {
+	rows, err := s.db.Query(`
+		SELECT DISTINCT e.session_id, COALESCE(s.host, '')
+		FROM events e LEFT JOIN sessions s ON s.session_id = e.session_id
+		WHERE e.state = ?
+	`, StateRunning)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	out := make(map[string]string)
+	for rows.Next() {
+		var sid, host string
+		if err := rows.Scan(&sid, &host); err != nil {
+			return nil, err
+		}
+		out[sid] = host
+	}
+	return out, rows.Err()
+}
+
+// MarkSessionInterrupted moves the session's running events to interrupted.
+func (s *Store) MarkSessionInterrupted(sessionID string) (int64, error) {
+	res, err := s.db.Exec(
+		`UPDATE events SET state = ? WHERE session_id = ? AND state = ?`,
+		StateInterrupted, sessionID, StateRunning,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// nullIfEmpty maps "" to SQL NULL for optional text columns.
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -68,6 +68,31 @@ func TestInsertEvent(t *testing.T) {
 	}
 }
 
+func TestInsertEventSignal(t *testing.T) {
+	conn, err := db.Open(filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	st := New(conn)
+	if err := st.EnsureSession("s1", "h", "pts/0", "/x", 1); err != nil {
+		t.Fatal(err)
+	}
+	cmdID, _ := st.CmdID("sleep 100", 1)
+	pre := &PreEvent{Sid: "s1", Seq: 1, Ts: 1, Cmd: "sleep 100", Cwd: "/x"}
+	post := &PostEvent{Sid: "s1", Seq: 1, Ts: 2, Exit: 130, Pipe: []int{130}}
+	if _, err := st.InsertEvent(pre, post, cmdID); err != nil {
+		t.Fatal(err)
+	}
+	var sig, pipe string
+	if err := conn.QueryRow(`SELECT signal, pipe_status_json FROM events WHERE seq = 1`).Scan(&sig, &pipe); err != nil {
+		t.Fatal(err)
+	}
+	if sig != "SIGINT" || pipe != "[130]" {
+		t.Errorf("signal = %q pipe = %q, want SIGINT [130]", sig, pipe)
+	}
+}
+
 func TestPinSession(t *testing.T) {
 	path := filepath.Join(t.TempDir(), "store.db")
 	conn, err := db.Open(path)
@@ -128,6 +128,7 @@ func TestConcurrentPullIdempotency(t *testing.T) {
 			node_id TEXT,
 			start_ts REAL NOT NULL,
 			end_ts REAL NOT NULL,
+			keep_sessions TEXT,
 			PRIMARY KEY (tombstone_id, vault_id)
 		)
 	`)
@@ -72,6 +72,18 @@ func SealWithKey(K_obj, nonce, plaintext, aad []byte) ([]byte, error) {
 	return aead.Seal(nil, nonce, plaintext, aad), nil
 }
 
+// OpenWithKey decrypts ciphertext sealed by SealWithKey.
+func OpenWithKey(K_obj, nonce, ciphertext, aad []byte) ([]byte, error) {
+	if len(K_obj) != KeySize || len(nonce) != NonceSize {
+		return nil, fmt.Errorf("invalid key or nonce size")
+	}
+	aead, err := chacha20poly1305.NewX(K_obj)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, nonce, ciphertext, aad)
+}
+
 // DecryptPayload decrypts using wrapped key and K_master.
 func DecryptPayload(K_master, nonce, ciphertext, wrappedKey, headerBytes []byte) ([]byte, error) {
 	if len(K_master) != KeySize {
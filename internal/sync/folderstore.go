@@ -59,6 +59,24 @@ func (f *FolderStore) List(prefix string) ([]string, error) {
 	return keys, nil
 }
 
+// ListPrefixes returns the names of the directories directly under prefix. Ignores tmp/.
+func (f *FolderStore) ListPrefixes(prefix string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(f.root, prefix))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() && e.Name() != "tmp" {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
 // Get reads the object at key. Returns ErrNotFound if missing.
 func (f *FolderStore) Get(key string) ([]byte, error) {
 	p := filepath.Join(f.root, key)
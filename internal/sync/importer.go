@@ -179,7 +179,7 @@ func insertSegmentData(st *store.Store, conn *sql.DB, h *Header, payload *Segmen
 		_ = st.EnsureSyncSession(sid, sess.Host, sess.Tty, sess.InitialCwd, sess.StartedAt)
 	}
 	for _, ev := range payload.Events {
-		if coveredByTombstone(ev.NodeID, ev.StartedAt, tombstones) {
+		if coveredByTombstone(ev.NodeID, ev.SessionID, ev.StartedAt, tombstones) {
 			continue
 		}
 		cmdID, err := st.CmdID(ev.Cmd, ev.StartedAt)
@@ -191,7 +191,7 @@ func insertSegmentData(st *store.Store, conn *sql.DB, h *Header, payload *Segmen
 		if endedAt == 0 && ev.DurationMs > 0 {
 			endedAt = ev.StartedAt + float64(ev.DurationMs)/1000
 		}
-		_, err = st.InsertSyncEvent(ev.Cmd, ev.StartedAt, endedAt, ev.DurationMs, ev.ExitCode, ev.Seq, sid, ev.Cwd, cmdID)
+		_, err = st.InsertSyncEvent(ev.Cmd, ev.StartedAt, endedAt, ev.DurationMs, ev.ExitCode, ev.Seq, sid, ev.Cwd, cmdID, ev.State)
 		if err != nil {
 			return err
 		}
@@ -294,8 +294,8 @@ func importTombstone(conn *sql.DB, syncStore SyncStore, key string, vaultID stri
 	}
 	deleteTombstoneEvents(conn, eventIDs)
 	_, err = conn.Exec(
-		`INSERT OR IGNORE INTO applied_tombstones (tombstone_id, vault_id, applied_at, node_id, start_ts, end_ts) VALUES (?, ?, ?, ?, ?, ?)`,
-		h.TombstoneID, vaultID, now, payload.NodeID, payload.StartTs, payload.EndTs,
+		`INSERT OR IGNORE INTO applied_tombstones (tombstone_id, vault_id, applied_at, node_id, start_ts, end_ts, keep_sessions) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		h.TombstoneID, vaultID, now, payload.NodeID, payload.StartTs, payload.EndTs, keepJSON(payload.Keep),
 	)
 	if err != nil {
 		return err
@@ -331,14 +331,14 @@ func queryTombstoneEventIDs(conn *sql.DB, payload *TombstonePayload) ([]int64, e
 	var err error
 	if nodePrefix != "" {
 		rows, err = conn.Query(`
-			SELECT e.event_id FROM events e
+			SELECT e.event_id, e.session_id FROM events e
 			JOIN sessions s ON s.session_id = e.session_id
 			WHERE e.started_at >= ? AND e.started_at <= ? AND s.pinned = 0
 			AND e.session_id LIKE ?
 		`, payload.StartTs, payload.EndTs, nodePrefix+"%")
 	} else {
 		rows, err = conn.Query(`
-			SELECT e.event_id FROM events e
+			SELECT e.event_id, e.session_id FROM events e
 			JOIN sessions s ON s.session_id = e.session_id
 			WHERE e.started_at >= ? AND e.started_at <= ? AND s.pinned = 0
 		`, payload.StartTs, payload.EndTs)
@@ -346,13 +346,22 @@ func queryTombstoneEventIDs(conn *sql.DB, payload *TombstonePayload) ([]int64, e
 	if err != nil {
 		return nil, err
 	}
+	// Sessions pinned on the tombstone's node, as this device names them
+	keep := make(map[string]bool, len(payload.Keep))
+	for _, sid := range payload.Keep {
+		keep[nodePrefix+sid] = true
+	}
 	var eventIDs []int64
 	for rows.Next() {
 		var id int64
-		if err := rows.Scan(&id); err != nil {
+		var sid string
+		if err := rows.Scan(&id, &sid); err != nil {
 			_ = rows.Close()
 			return nil, err
 		}
+		if nodePrefix != "" && keep[sid] {
+			continue
+		}
 		eventIDs = append(eventIDs, id)
 	}
 	_ = rows.Close()
@@ -368,6 +377,9 @@ func deleteTombstoneEvents(conn *sql.DB, eventIDs []int64) {
 
 func maybeDecrypt(h *Header, body []byte, K_master []byte) ([]byte, error) {
 	if h.Crypto.NonceHex == "" || h.Crypto.WrappedKey == "" {
+		if len(K_master) > 0 {
+			return nil, ErrPlaintextObject
+		}
 		return body, nil
 	}
 	if len(K_master) == 0 {
@@ -385,11 +397,12 @@ type tombstoneRec struct {
 	NodeID  string
 	StartTs float64
 	EndTs   float64
+	Keep    map[string]bool // sessions of NodeID the tombstone spares
 }
 
 func loadAppliedTombstones(conn *sql.DB, vaultID string) ([]tombstoneRec, error) {
 	rows, err := conn.Query(
-		`SELECT node_id, start_ts, end_ts FROM applied_tombstones WHERE vault_id = ?`,
+		`SELECT node_id, start_ts, end_ts, keep_sessions FROM applied_tombstones WHERE vault_id = ?`,
 		vaultID,
 	)
 	if err != nil {
@@ -399,23 +412,35 @@ func loadAppliedTombstones(conn *sql.DB, vaultID string) ([]tombstoneRec, error)
 	var out []tombstoneRec
 	for rows.Next() {
 		var r tombstoneRec
-		var nodeID sql.NullString
-		if err := rows.Scan(&nodeID, &r.StartTs, &r.EndTs); err != nil {
+		var nodeID, keep sql.NullString
+		if err := rows.Scan(&nodeID, &r.StartTs, &r.EndTs, &keep); err != nil {
 			return nil, err
 		}
 		if nodeID.Valid {
 			r.NodeID = nodeID.String
 		}
+		if keep.Valid && r.NodeID != "" {
+			var sids []string
+			if err := json.Unmarshal([]byte(keep.String), &sids); err == nil {
+				r.Keep = make(map[string]bool, len(sids))
+				for _, sid := range sids {
+					r.Keep[sid] = true
+				}
+			}
+		}
 		out = append(out, r)
 	}
 	return out, rows.Err()
 }
 
-func coveredByTombstone(nodeID string, startedAt float64, tombstones []tombstoneRec) bool {
+func coveredByTombstone(nodeID, sessionID string, startedAt float64, tombstones []tombstoneRec) bool {
 	for _, t := range tombstones {
 		if t.NodeID != "" && t.NodeID != nodeID {
 			continue
 		}
+		if t.Keep[sessionID] {
+			continue
+		}
 		if startedAt >= t.StartTs && startedAt <= t.EndTs {
 			return true
 		}
@@ -118,7 +118,10 @@ func DecodeManifest(data []byte, vaultKey []byte) (*Manifest, error) {
 		return nil, fmt.Errorf("decode object: %w", err)
 	}
 
-	// Decrypt body
+	// Decrypt body; an encrypted vault never accepts a plaintext manifest
+	if len(vaultKey) == KeySize && h.Crypto.WrappedKey == "" {
+		return nil, ErrPlaintextObject
+	}
 	plaintext, err := DecryptObject(h, body, vaultKey)
 	if err != nil {
 		return nil, fmt.Errorf("decrypt manifest: %w", err)
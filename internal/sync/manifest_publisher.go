@@ -78,7 +78,10 @@ func addManifestTombstones(manifest *Manifest, conn *sql.DB, vaultID, nodeID str
 }
 
 func encodeManifest(manifest *Manifest, K_master []byte, encrypt bool) ([]byte, error) {
-	if encrypt && len(K_master) == KeySize {
+	if encrypt {
+		if len(K_master) != KeySize {
+			return nil, fmt.Errorf("encrypted vault requires a %d-byte key", KeySize)
+		}
 		return manifest.Encode(K_master)
 	}
 	return manifest.Encode(nil)
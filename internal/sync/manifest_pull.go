@@ -2,8 +2,13 @@ package sync
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"path"
 	"strings"
+	"time"
+
+	"github.com/mrcawood/History_eXtended/internal/store"
 )
 
 // PullResult holds counts for pull operation.
@@ -14,6 +19,7 @@ type PullResult struct {
 	TombstonesImported  int
 	TombstonesSkipped   int            // already applied
 	ManifestsSkipped    int            // own or invalid
+	FallbackNodes       int            // nodes without a manifest, imported by scan
 	ListCallsByPrefix   map[string]int // for efficiency testing
 	GetCalls            int
 	Errors              []string
@@ -21,20 +27,113 @@ type PullResult struct {
 
 // Pull performs manifest-driven pull from sync store.
 func Pull(conn *sql.DB, syncStore SyncStore, vaultID, nodeID string, K_master []byte, encrypt bool) (*PullResult, error) {
+	res, _, err := pullManifests(conn, syncStore, vaultID, nodeID, K_master, encrypt)
+	return res, err
+}
+
+// pullManifests runs the manifest-driven pull and also returns the manifest keys it listed.
+func pullManifests(conn *sql.DB, syncStore SyncStore, vaultID, nodeID string, K_master []byte, encrypt bool) (*PullResult, []string, error) {
 	res := &PullResult{
 		ListCallsByPrefix: make(map[string]int),
 	}
 	manifestKeys, err := syncStore.List("vaults/" + vaultID + "/objects/manifests/")
 	if err != nil {
-		return res, fmt.Errorf("list manifests: %w", err)
+		return res, nil, fmt.Errorf("list manifests: %w", err)
 	}
 	res.ListCallsByPrefix["manifests"]++
 	for _, manifestKey := range manifestKeys {
 		processManifest(conn, syncStore, manifestKey, vaultID, nodeID, K_master, encrypt, res)
 	}
+	return res, manifestKeys, nil
+}
+
+// PullWithFallback runs the manifest-driven Pull, then imports segments from
+// nodes that publish no manifest. Tombstones come only from manifests;
+// hx sync pull --full-scan finds strays and blobs. When the store can list
+// prefixes, only the segment prefixes of nodes without a manifest are listed;
+// segments already imported are skipped without downloading them.
+func PullWithFallback(conn *sql.DB, syncStore SyncStore, vaultID, nodeID string, K_master []byte, encrypt bool) (*PullResult, error) {
+	res, manifestKeys, err := pullManifests(conn, syncStore, vaultID, nodeID, K_master, encrypt)
+	if err != nil {
+		return res, err
+	}
+	hasManifest := map[string]bool{nodeID: true}
+	for _, k := range manifestKeys {
+		if strings.HasSuffix(k, ".hxman") {
+			hasManifest[strings.TrimSuffix(path.Base(k), ".hxman")] = true
+		}
+	}
+	if !encrypt {
+		K_master = nil
+	}
+	segKeys, err := listFallbackSegments(syncStore, vaultID, hasManifest, res)
+	if err != nil {
+		return res, err
+	}
+
+	importRes := &ImportResult{}
+	now := float64(time.Now().UnixNano()) / 1e9
+	st := store.New(conn)
+	fallback := make(map[string]bool)
+	for _, k := range filterImportableKeys(segKeys, importRes) {
+		remoteNodeID := path.Base(path.Dir(k))
+		if hasManifest[remoteNodeID] {
+			continue
+		}
+		fallback[remoteNodeID] = true
+		segmentID := strings.TrimSuffix(path.Base(k), ".hxseg")
+		if segmentAlreadyImported(conn, vaultID, remoteNodeID, segmentID, importRes) {
+			res.SegmentsSkipped++
+			continue
+		}
+		before := importRes.SegmentsImported
+		if err := importSegment(conn, st, syncStore, k, vaultID, K_master, now, importRes); err != nil {
+			res.Errors = append(res.Errors, fmt.Sprintf("import segment %s: %v", segmentID, err))
+			continue
+		}
+		res.SegmentsImported += importRes.SegmentsImported - before
+	}
+	res.FallbackNodes = len(fallback)
 	return res, nil
 }
 
+// listFallbackSegments lists the segment keys of nodes without a manifest:
+// one prefix listing to find the nodes, then one listing per such node.
+// Stores that cannot list prefixes have every segment key listed instead.
+func listFallbackSegments(syncStore SyncStore, vaultID string, hasManifest map[string]bool, res *PullResult) ([]string, error) {
+	prefix := path.Join("vaults", vaultID, "objects", "segments")
+	var nodes []string
+	err := errNoPrefixList
+	if pl, ok := syncStore.(PrefixLister); ok {
+		nodes, err = pl.ListPrefixes(prefix)
+	}
+	if errors.Is(err, errNoPrefixList) {
+		keys, err := syncStore.List(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("list segments: %w", err)
+		}
+		res.ListCallsByPrefix["segments"]++
+		return keys, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list segment nodes: %w", err)
+	}
+	res.ListCallsByPrefix["segment-nodes"]++
+	var keys []string
+	for _, node := range nodes {
+		if hasManifest[node] {
+			continue
+		}
+		nodeKeys, err := syncStore.List(path.Join(prefix, node))
+		if err != nil {
+			return nil, fmt.Errorf("list segments of %s: %w", node, err)
+		}
+		res.ListCallsByPrefix["segments"]++
+		keys = append(keys, nodeKeys...)
+	}
+	return keys, nil
+}
+
 // processManifest processes a single manifest key. Errors are logged in res.
 func processManifest(conn *sql.DB, syncStore SyncStore, manifestKey, vaultID, nodeID string, K_master []byte, encrypt bool, res *PullResult) {
 	if !strings.HasSuffix(manifestKey, ".hxman") {
@@ -82,12 +181,18 @@ func processManifest(conn *sql.DB, syncStore SyncStore, manifestKey, vaultID, no
 		return
 	}
 	res.ManifestsDownloaded++
+	// Record the seq only if every object imported; otherwise the next pull
+	// would skip this manifest and never retry the failed ones.
+	errsBefore := len(res.Errors)
 	if err := importMissingSegments(conn, syncStore, vaultID, remoteNodeID, manifest.Segments, K_master, encrypt, res); err != nil {
 		res.Errors = append(res.Errors, fmt.Sprintf("import segments %s: %v", remoteNodeID, err))
 	}
 	if err := importMissingTombstones(conn, syncStore, vaultID, remoteNodeID, manifest.Tombstones, K_master, encrypt, res); err != nil {
 		res.Errors = append(res.Errors, fmt.Sprintf("import tombstones %s: %v", remoteNodeID, err))
 	}
+	if len(res.Errors) > errsBefore {
+		return
+	}
 	if _, err := conn.Exec(`
 		INSERT OR REPLACE INTO sync_node_manifests (vault_id, node_id, manifest_seq, published_at)
 		VALUES (?, ?, ?, datetime('now'))
@@ -114,10 +219,11 @@ func importMissingSegments(conn *sql.DB, syncStore SyncStore, vaultID, remoteNod
 		segmentKey := SegmentKey(vaultID, remoteNodeID, seg.SegmentID)
 
 		// Import segment
+		now := float64(time.Now().UnixNano()) / 1e9
 		if encrypt && len(K_master) == KeySize {
-			err = importSegment(conn, nil, syncStore, segmentKey, vaultID, K_master, 0, &ImportResult{})
+			err = importSegment(conn, store.New(conn), syncStore, segmentKey, vaultID, K_master, now, &ImportResult{})
 		} else {
-			err = importSegment(conn, nil, syncStore, segmentKey, vaultID, nil, 0, &ImportResult{})
+			err = importSegment(conn, store.New(conn), syncStore, segmentKey, vaultID, nil, now, &ImportResult{})
 		}
 		if err != nil {
 			res.Errors = append(res.Errors, fmt.Sprintf("import segment %s: %v", seg.SegmentID, err))
@@ -148,10 +254,11 @@ func importMissingTombstones(conn *sql.DB, syncStore SyncStore, vaultID, remoteN
 		tombstoneKey := TombstoneKey(vaultID, tomb.TombstoneID)
 
 		// Import tombstone
+		now := float64(time.Now().UnixNano()) / 1e9
 		if encrypt && len(K_master) == KeySize {
-			err = importTombstone(conn, syncStore, tombstoneKey, vaultID, K_master, 0, &ImportResult{})
+			err = importTombstone(conn, syncStore, tombstoneKey, vaultID, K_master, now, &ImportResult{})
 		} else {
-			err = importTombstone(conn, syncStore, tombstoneKey, vaultID, nil, 0, &ImportResult{})
+			err = importTombstone(conn, syncStore, tombstoneKey, vaultID, nil, now, &ImportResult{})
 		}
 		if err != nil {
 			res.Errors = append(res.Errors, fmt.Sprintf("import tombstone %s: %v", tomb.TombstoneID, err))
@@ -1,11 +1,32 @@
 package sync
 
 import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/mrcawood/History_eXtended/internal/store"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// seedLiveEvent inserts one live event so Push has something to publish.
+func seedLiveEvent(t *testing.T, conn *sql.DB, sid, cmd string, ts float64) {
+	t.Helper()
+	st := store.New(conn)
+	require.NoError(t, st.EnsureSession(sid, "hostA", "pts/0", "/work", ts))
+	cmdID, err := st.CmdID(cmd, ts)
+	require.NoError(t, err)
+	_, err = st.InsertEvent(
+		&store.PreEvent{T: "pre", Ts: ts, Sid: sid, Seq: 1, Cmd: cmd, Cwd: "/work", Host: "hostA"},
+		&store.PostEvent{T: "post", Ts: ts + 1, Sid: sid, Seq: 1, Exit: 0, DurMs: 5},
+		cmdID,
+	)
+	require.NoError(t, err)
+}
+
 func TestPublishManifest(t *testing.T) {
 	// This test would require a database connection and sync store
 	// For now, we'll test the manifest creation logic
@@ -13,9 +34,196 @@ func TestPublishManifest(t *testing.T) {
 }
 
 func TestPull_ManifestDriven(t *testing.T) {
-	// This test would require a database connection and sync store
-	// For now, we'll test the pull logic structure
-	t.Skip("Requires database setup - integration test")
+	tmpDir := t.TempDir()
+	fs := NewFolderStore(filepath.Join(tmpDir, "store"))
+	connA, err := openDBWithTimeout(filepath.Join(tmpDir, "a.db"), 10*time.Second)
+	if err != nil {
+		t.Skipf("DB open failed (FTS5 or timeout): %v", err)
+	}
+	defer connA.Close()
+	connB, err := openDBWithTimeout(filepath.Join(tmpDir, "b.db"), 10*time.Second)
+	if err != nil {
+		t.Skipf("DB open failed (FTS5 or timeout): %v", err)
+	}
+	defer connB.Close()
+
+	seedLiveEvent(t, connA, "sA", "make test", 1000)
+	_, err = Push(connA, fs, "v1", "nodeA", nil, false)
+	require.NoError(t, err)
+
+	res, err := Pull(connB, fs, "v1", "nodeB", nil, false)
+	require.NoError(t, err)
+	assert.Empty(t, res.Errors)
+	assert.Equal(t, 1, res.ManifestsDownloaded)
+	assert.Equal(t, 1, res.SegmentsImported)
+	assert.Equal(t, 0, res.ListCallsByPrefix["segments"])
+
+	var count int
+	require.NoError(t, connB.QueryRow(`SELECT COUNT(*) FROM events`).Scan(&count))
+	assert.Equal(t, 1, count)
+
+	// Unchanged manifest: nothing downloaded beyond the manifest itself
+	res, err = Pull(connB, fs, "v1", "nodeB", nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.SegmentsImported)
+	assert.Equal(t, 1, res.ManifestsSkipped)
+}
+
+// failGetStore fails reads of one key until fail is cleared, like a
+// segment that has not finished syncing to this device.
+type failGetStore struct {
+	SyncStore
+	key  string
+	fail bool
+}
+
+func (s *failGetStore) Get(key string) ([]byte, error) {
+	if s.fail && key == s.key {
+		return nil, fmt.Errorf("read %s: input/output error", key)
+	}
+	return s.SyncStore.Get(key)
+}
+
+func TestPull_RetriesManifestAfterFailedSegment(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs := NewFolderStore(filepath.Join(tmpDir, "store"))
+	connA, err := openDBWithTimeout(filepath.Join(tmpDir, "a.db"), 10*time.Second)
+	if err != nil {
+		t.Skipf("DB open failed (FTS5 or timeout): %v", err)
+	}
+	defer connA.Close()
+	connB, err := openDBWithTimeout(filepath.Join(tmpDir, "b.db"), 10*time.Second)
+	if err != nil {
+		t.Skipf("DB open failed (FTS5 or timeout): %v", err)
+	}
+	defer connB.Close()
+
+	seedLiveEvent(t, connA, "sA", "make test", 1000)
+	_, err = Push(connA, fs, "v1", "nodeA", nil, false)
+	require.NoError(t, err)
+	seedLiveEvent(t, connA, "sA2", "make lint", 2000)
+	_, err = Push(connA, fs, "v1", "nodeA", nil, false)
+	require.NoError(t, err)
+
+	keys, err := fs.List("vaults/v1/objects/segments/nodeA")
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	flaky := &failGetStore{SyncStore: fs, key: keys[0], fail: true}
+
+	res, err := Pull(connB, flaky, "v1", "nodeB", nil, false)
+	require.NoError(t, err)
+	assert.Len(t, res.Errors, 1)
+	assert.Equal(t, 1, res.SegmentsImported)
+
+	// The manifest seq was not recorded, so the next pull retries the segment
+	flaky.fail = false
+	res, err = Pull(connB, flaky, "v1", "nodeB", nil, false)
+	require.NoError(t, err)
+	assert.Empty(t, res.Errors)
+	assert.Equal(t, 1, res.ManifestsDownloaded)
+	assert.Equal(t, 1, res.SegmentsImported)
+	assert.Equal(t, 1, res.SegmentsSkipped)
+
+	var count int
+	require.NoError(t, connB.QueryRow(`SELECT COUNT(*) FROM events`).Scan(&count))
+	assert.Equal(t, 2, count)
+
+	res, err = Pull(connB, flaky, "v1", "nodeB", nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.ManifestsSkipped, "caught up: seq recorded")
+}
+
+func TestPull_InterruptedEventThenCompletion(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs := NewFolderStore(filepath.Join(tmpDir, "store"))
+	connA, err := openDBWithTimeout(filepath.Join(tmpDir, "a.db"), 10*time.Second)
+	if err != nil {
+		t.Skipf("DB open failed (FTS5 or timeout): %v", err)
+	}
+	defer connA.Close()
+	connB, err := openDBWithTimeout(filepath.Join(tmpDir, "b.db"), 10*time.Second)
+	if err != nil {
+		t.Skipf("DB open failed (FTS5 or timeout): %v", err)
+	}
+	defer connB.Close()
+
+	st := store.New(connA)
+	require.NoError(t, st.EnsureSession("sA", "hostA", "pts/0", "/work", 1000))
+	cmdID, err := st.CmdID("terraform apply", 1000)
+	require.NoError(t, err)
+	_, err = st.InsertPendingEvent(&store.PreEvent{T: "pre", Ts: 1000, Sid: "sA", Seq: 1, Cmd: "terraform apply", Cwd: "/work", Host: "hostA"}, cmdID, store.StateInterrupted)
+	require.NoError(t, err)
+	_, err = Push(connA, fs, "v1", "nodeA", nil, false)
+	require.NoError(t, err)
+
+	_, err = Pull(connB, fs, "v1", "nodeB", nil, false)
+	require.NoError(t, err)
+	var state sql.NullString
+	var exit sql.NullInt64
+	require.NoError(t, connB.QueryRow(`SELECT state, exit_code FROM events WHERE seq = 1`).Scan(&state, &exit))
+	assert.Equal(t, store.StateInterrupted, state.String, "peer sees the command the session ended during")
+	assert.False(t, exit.Valid)
+
+	// A late post on node A reaches node B on the next push and pull
+	_, err = st.CompleteEvent(&store.PostEvent{T: "post", Ts: 1005, Sid: "sA", Seq: 1, Exit: 1, DurMs: 5000})
+	require.NoError(t, err)
+	res, err := Push(connA, fs, "v1", "nodeA", nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.EventsPublished)
+	_, err = Pull(connB, fs, "v1", "nodeB", nil, false)
+	require.NoError(t, err)
+	require.NoError(t, connB.QueryRow(`SELECT state, exit_code FROM events WHERE seq = 1`).Scan(&state, &exit))
+	assert.False(t, state.Valid, "completed on the peer")
+	assert.Equal(t, int64(1), exit.Int64)
+	var n int
+	require.NoError(t, connB.QueryRow(`SELECT COUNT(*) FROM events`).Scan(&n))
+	assert.Equal(t, 1, n)
+}
+
+func TestPullWithFallback_NodeWithoutManifest(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs := NewFolderStore(filepath.Join(tmpDir, "store"))
+	connA, err := openDBWithTimeout(filepath.Join(tmpDir, "a.db"), 10*time.Second)
+	if err != nil {
+		t.Skipf("DB open failed (FTS5 or timeout): %v", err)
+	}
+	defer connA.Close()
+	connB, err := openDBWithTimeout(filepath.Join(tmpDir, "b.db"), 10*time.Second)
+	if err != nil {
+		t.Skipf("DB open failed (FTS5 or timeout): %v", err)
+	}
+	defer connB.Close()
+
+	seedLiveEvent(t, connA, "sA", "make test", 1000)
+	_, err = Push(connA, fs, "v1", "nodeA", nil, false)
+	require.NoError(t, err)
+
+	// A legacy node wrote a segment but never published a manifest
+	h := &Header{Magic: Magic, Version: Version, ObjectType: TypeSeg, VaultID: "v1", NodeID: "nodeL", SegmentID: "legacy1"}
+	raw, err := EncodeSegment(h, &SegmentPayload{
+		Events:   []SegmentEvent{{NodeID: "nodeL", SessionID: "sL", Seq: 1, Cmd: "ls", StartedAt: 2000, EndedAt: 2001}},
+		Sessions: []SegmentSession{{SessionID: "sL", StartedAt: 2000, Host: "hostL"}},
+	}, nil, false)
+	require.NoError(t, err)
+	require.NoError(t, fs.PutAtomic(SegmentKey("v1", "nodeL", "legacy1"), raw))
+
+	res, err := PullWithFallback(connB, fs, "v1", "nodeB", nil, false)
+	require.NoError(t, err)
+	assert.Empty(t, res.Errors)
+	assert.Equal(t, 2, res.SegmentsImported)
+	assert.Equal(t, 1, res.FallbackNodes)
+	assert.Equal(t, map[string]int{"manifests": 1, "segment-nodes": 1, "segments": 1}, res.ListCallsByPrefix,
+		"only the legacy node's segments are listed; tombstones come from manifests")
+
+	var count int
+	require.NoError(t, connB.QueryRow(`SELECT COUNT(*) FROM events`).Scan(&count))
+	assert.Equal(t, 2, count)
+
+	res, err = PullWithFallback(connB, fs, "v1", "nodeB", nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.SegmentsImported)
+	assert.Equal(t, 1, res.SegmentsSkipped)
+	assert.Equal(t, 1, res.GetCalls, "only nodeA's manifest is fetched")
 }
 
 func TestPullResult(t *testing.T) {
@@ -62,6 +62,34 @@ func (r *RetryableStore) List(prefix string) ([]string, error) {
 	return nil, fmt.Errorf("list failed after %d attempts: %w", r.config.MaxAttempts, lastErr)
 }
 
+// ListPrefixes implements PrefixLister with retry logic when the wrapped store does.
+func (r *RetryableStore) ListPrefixes(prefix string) ([]string, error) {
+	pl, ok := r.store.(PrefixLister)
+	if !ok {
+		return nil, errNoPrefixList
+	}
+	var lastErr error
+
+	for attempt := 0; attempt < r.config.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			delay := r.calculateDelay(attempt)
+			time.Sleep(delay)
+		}
+
+		result, err := pl.ListPrefixes(prefix)
+		if err == nil {
+			return result, nil
+		}
+
+		lastErr = err
+		if !isRetryableError(err) {
+			break // Don't retry non-retryable errors
+		}
+	}
+
+	return nil, fmt.Errorf("list prefixes failed after %d attempts: %w", r.config.MaxAttempts, lastErr)
+}
+
 // Get implements SyncStore with retry logic
 func (r *RetryableStore) Get(key string) ([]byte, error) {
 	var lastErr error
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -32,15 +33,65 @@ type S3Config struct {
 	Region       string
 	Endpoint     string
 	PathStyle    bool
+	Profile      string // shared config/credentials profile (optional)
 	AccessKey    string
 	SecretKey    string
 	SessionToken string // optional
 }
 
+// ParseS3URI parses s3://bucket/prefix?region=&endpoint=&path_style=true&profile=
+// into S3Config. Credentials are never part of the URI (it is stored in the DB);
+// they come from the AWS environment variables or the shared credentials file.
+func ParseS3URI(uri string) (S3Config, error) {
+	var cfg S3Config
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return cfg, fmt.Errorf("parse s3 uri: %w", err)
+	}
+	if parsed.Scheme != "s3" {
+		return cfg, fmt.Errorf("s3 uri must start with s3://")
+	}
+	if parsed.Host == "" {
+		return cfg, fmt.Errorf("s3 uri has no bucket")
+	}
+	if parsed.User != nil {
+		return cfg, fmt.Errorf("s3 uri must not contain credentials")
+	}
+	cfg.Bucket = parsed.Host
+	cfg.Prefix = strings.Trim(parsed.Path, "/")
+	cfg.Region = "us-east-1"
+
+	query := parsed.Query()
+	for _, k := range []string{"access_key", "secret_key", "session_token"} {
+		if query.Has(k) {
+			return cfg, fmt.Errorf("s3 uri must not contain %s; set AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY or use a credentials file", k)
+		}
+	}
+	if region := query.Get("region"); region != "" {
+		cfg.Region = region
+	}
+	if endpoint := query.Get("endpoint"); endpoint != "" {
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "https://" + endpoint
+		}
+		cfg.Endpoint = endpoint
+	}
+	switch query.Get("path_style") {
+	case "", "false":
+	case "true":
+		cfg.PathStyle = true
+	default:
+		return cfg, fmt.Errorf("s3 uri: path_style must be true or false")
+	}
+	cfg.Profile = query.Get("profile")
+	return cfg, nil
+}
+
 // NewS3Store creates a new S3Store from config.
 func NewS3Store(ctx context.Context, cfg S3Config) (*S3Store, error) {
 	awsCfg, err := config.LoadDefaultConfig(ctx,
 		config.WithRegion(cfg.Region),
+		config.WithSharedConfigProfile(cfg.Profile),
 		func(opts *config.LoadOptions) error {
 			if cfg.Endpoint != "" {
 				opts.EndpointResolverWithOptions = aws.EndpointResolverWithOptionsFunc(
@@ -145,6 +196,40 @@ func (s *S3Store) ListWithContext(ctx context.Context, prefix string) ([]string,
 	return keys, nil
 }
 
+// ListPrefixes returns the names one level below prefix, using "/" as the
+// delimiter so S3 does not return every key under it.
+func (s *S3Store) ListPrefixes(prefix string) ([]string, error) {
+	ctx := context.Background()
+	full := strings.TrimSuffix(s.key(prefix), "/") + "/"
+	var names []string
+	var continuationToken *string
+	for {
+		resp, err := s.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(s.bucket),
+			Prefix:            aws.String(full),
+			Delimiter:         aws.String("/"),
+			ContinuationToken: continuationToken,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("list prefixes: %w", err)
+		}
+		for _, cp := range resp.CommonPrefixes {
+			if cp.Prefix == nil {
+				continue
+			}
+			name := strings.TrimSuffix(strings.TrimPrefix(*cp.Prefix, full), "/")
+			if name != "" && name != "tmp" {
+				names = append(names, name)
+			}
+		}
+		if resp.IsTruncated == nil || !*resp.IsTruncated {
+			break
+		}
+		continuationToken = resp.NextContinuationToken
+	}
+	return names, nil
+}
+
 // Get downloads an object from S3.
 func (s *S3Store) Get(key string) ([]byte, error) {
 	return s.GetWithContext(context.Background(), key)
@@ -1,47 +1,12 @@
 package sync
 
 import (
-	"net/url"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-// ParseS3URI parses an S3 URI into S3Config.
-func ParseS3URI(uri string) (S3Config, error) {
-	var cfg S3Config
-
-	// Parse URI
-	parsed, err := url.Parse(uri)
-	if err != nil {
-		return cfg, err
-	}
-
-	cfg.Bucket = parsed.Host
-	cfg.Prefix = parsed.Path
-	if cfg.Prefix != "" && cfg.Prefix[0] == '/' {
-		cfg.Prefix = cfg.Prefix[1:]
-	}
-
-	// Default region
-	cfg.Region = "us-east-1"
-
-	// Parse query params
-	query := parsed.Query()
-	if region := query.Get("region"); region != "" {
-		cfg.Region = region
-	}
-	if endpoint := query.Get("endpoint"); endpoint != "" {
-		cfg.Endpoint = endpoint
-	}
-	if pathStyle := query.Get("path-style"); pathStyle == "true" {
-		cfg.PathStyle = true
-	}
-
-	return cfg, nil
-}
-
 func TestS3Store_ConfigParsing(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -69,7 +34,7 @@ func TestS3Store_ConfigParsing(t *testing.T) {
 		},
 		{
 			name: "MinIO with endpoint",
-			uri:  "s3+endpoint://test-bucket/hx?endpoint=http://localhost:9000&path-style=true",
+			uri:  "s3://test-bucket/hx?endpoint=http://localhost:9000&path_style=true",
 			want: S3Config{
 				Bucket:    "test-bucket",
 				Prefix:    "hx",
@@ -78,6 +43,21 @@ func TestS3Store_ConfigParsing(t *testing.T) {
 				PathStyle: true,
 			},
 		},
+		{
+			name: "endpoint without scheme defaults to https",
+			uri:  "s3://b?endpoint=s3.wasabisys.com&profile=hx",
+			want: S3Config{
+				Bucket:   "b",
+				Region:   "us-east-1",
+				Endpoint: "https://s3.wasabisys.com",
+				Profile:  "hx",
+			},
+		},
+		{name: "credentials in query", uri: "s3://b/p?access_key=a&secret_key=s", wantErr: true},
+		{name: "credentials in userinfo", uri: "s3://a:s@b/p", wantErr: true},
+		{name: "wrong scheme", uri: "folder:/tmp/x", wantErr: true},
+		{name: "no bucket", uri: "s3:///p", wantErr: true},
+		{name: "bad path_style", uri: "s3://b?path_style=yes", wantErr: true},
 	}
 
 	for _, tt := range tests {
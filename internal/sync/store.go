@@ -13,6 +13,16 @@ type SyncStore interface {
 	PutAtomic(key string, data []byte) error
 }
 
+// PrefixLister is implemented by stores that can list the names one level
+// below a prefix (like a directory listing) without walking every key.
+// Pull uses it to find nodes that publish no manifest.
+type PrefixLister interface {
+	ListPrefixes(prefix string) ([]string, error)
+}
+
+// errNoPrefixList means the store cannot list prefixes; callers List instead.
+var errNoPrefixList = errors.New("store cannot list prefixes")
+
 // Store key format per contract §4:
 //   objects/segments/<node_id>/<segment_id>.hxseg
 //   objects/blobs/<aa>/<bb>/<blob_hash>.hxblob
@@ -45,4 +55,6 @@ func IsObjectKey(key string) bool {
 
 var (
 	ErrNotFound = errors.New("object not found")
+	// ErrPlaintextObject rejects unencrypted objects in an encrypted vault (downgrade).
+	ErrPlaintextObject = errors.New("plaintext object in encrypted vault")
 )
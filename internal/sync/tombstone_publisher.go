@@ -0,0 +1,145 @@
+package sync
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// PublishTombstone publishes a time-window tombstone for this node, records it in
+// sync_published_tombstones and applied_tombstones (so later imports cannot
+// resurrect the window locally), and republishes the node manifest so peers
+// pick it up on their next pull. Returns the tombstone ID.
+func PublishTombstone(conn *sql.DB, syncStore SyncStore, vaultID, nodeID string, payload *TombstonePayload, K_master []byte, encrypt bool) (string, error) {
+	if payload.EndTs < payload.StartTs {
+		return "", fmt.Errorf("tombstone window ends before it starts")
+	}
+	tombstoneID := newUUID()
+	now := time.Now()
+	h := &Header{
+		Magic:       Magic,
+		Version:     Version,
+		ObjectType:  TypeTomb,
+		VaultID:     vaultID,
+		NodeID:      nodeID,
+		TombstoneID: tombstoneID,
+		CreatedAt:   now.UTC(),
+	}
+	raw, err := EncodeTombstone(h, payload, K_master, encrypt)
+	if err != nil {
+		return "", fmt.Errorf("encode tombstone: %w", err)
+	}
+	if err := syncStore.PutAtomic(TombstoneKey(vaultID, tombstoneID), raw); err != nil {
+		return "", fmt.Errorf("publish tombstone: %w", err)
+	}
+
+	ts := float64(now.UnixNano()) / 1e9
+	if _, err := conn.Exec(
+		`INSERT OR IGNORE INTO sync_published_tombstones (vault_id, node_id, tombstone_id, published_at) VALUES (?, ?, ?, ?)`,
+		vaultID, nodeID, tombstoneID, ts,
+	); err != nil {
+		return tombstoneID, fmt.Errorf("record published tombstone: %w", err)
+	}
+	if _, err := conn.Exec(
+		`INSERT OR IGNORE INTO applied_tombstones (tombstone_id, vault_id, applied_at, node_id, start_ts, end_ts, keep_sessions) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		tombstoneID, vaultID, ts, payload.NodeID, payload.StartTs, payload.EndTs, keepJSON(payload.Keep),
+	); err != nil {
+		return tombstoneID, fmt.Errorf("record applied tombstone: %w", err)
+	}
+
+	if err := PublishManifest(conn, syncStore, vaultID, nodeID, K_master, encrypt); err != nil {
+		return tombstoneID, fmt.Errorf("publish manifest: %w", err)
+	}
+	return tombstoneID, nil
+}
+
+// ForgetTombstone builds the tombstone for an hx forget of [start, end] on
+// nodeID. Like retention.ForgetSince it spares pinned sessions; peers do not
+// know this node's pins, so they are listed in the payload.
+func ForgetTombstone(conn *sql.DB, nodeID string, start, end float64) (*TombstonePayload, error) {
+	rows, err := conn.Query(`
+		SELECT DISTINCT s.session_id FROM sessions s
+		JOIN events e ON e.session_id = s.session_id
+		WHERE s.pinned = 1 AND e.started_at >= ? AND e.started_at <= ?
+		AND s.session_id NOT LIKE ?
+	`, start, end, "%"+syncSessionSep+"%")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	payload := &TombstonePayload{NodeID: nodeID, StartTs: start, EndTs: end, Reason: "forget"}
+	for rows.Next() {
+		var sid string
+		if err := rows.Scan(&sid); err != nil {
+			return nil, err
+		}
+		payload.Keep = append(payload.Keep, sid)
+	}
+	return payload, rows.Err()
+}
+
+// QueueTombstone stores payload until PublishPendingTombstones gets it to the
+// sync store, so a failed publish is retried with the same window.
+func QueueTombstone(conn *sql.DB, vaultID string, payload *TombstonePayload) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Exec(`INSERT INTO sync_pending_tombstones (vault_id, payload, queued_at) VALUES (?, ?, ?)`,
+		vaultID, string(b), float64(time.Now().UnixNano())/1e9)
+	return err
+}
+
+// PublishPendingTombstones publishes queued tombstones in order and returns
+// the IDs published. It stops at the first failure; the rest stay queued.
+func PublishPendingTombstones(conn *sql.DB, syncStore SyncStore, vaultID, nodeID string, K_master []byte, encrypt bool) ([]string, error) {
+	type pending struct {
+		id      int64
+		payload TombstonePayload
+	}
+	rows, err := conn.Query(`SELECT pending_id, payload FROM sync_pending_tombstones WHERE vault_id = ? ORDER BY pending_id`, vaultID)
+	if err != nil {
+		return nil, err
+	}
+	var queue []pending
+	for rows.Next() {
+		var p pending
+		var raw string
+		if err := rows.Scan(&p.id, &raw); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(raw), &p.payload); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("pending tombstone %d: %w", p.id, err)
+		}
+		queue = append(queue, p)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	var published []string
+	for _, p := range queue {
+		tombID, err := PublishTombstone(conn, syncStore, vaultID, nodeID, &p.payload, K_master, encrypt)
+		if tombID != "" {
+			// The object is in the store; publishing again would only duplicate it
+			_, _ = conn.Exec(`DELETE FROM sync_pending_tombstones WHERE pending_id = ?`, p.id)
+			published = append(published, tombID)
+		}
+		if err != nil {
+			return published, err
+		}
+	}
+	return published, nil
+}
+
+// keepJSON encodes a tombstone's kept sessions for applied_tombstones (NULL when none).
+func keepJSON(keep []string) interface{} {
+	if len(keep) == 0 {
+		return nil
+	}
+	b, _ := json.Marshal(keep)
+	return string(b)
+}
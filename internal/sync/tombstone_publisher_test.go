@@ -0,0 +1,193 @@
+package sync
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mrcawood/History_eXtended/internal/store"
+)
+
+func TestPublishTombstone_PropagatesViaManifest(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs := NewFolderStore(filepath.Join(tmpDir, "store"))
+	connA, err := openDBWithTimeout(filepath.Join(tmpDir, "a.db"), 10*time.Second)
+	if err != nil {
+		t.Skipf("DB open failed (FTS5 or timeout): %v", err)
+	}
+	defer connA.Close()
+	connB, err := openDBWithTimeout(filepath.Join(tmpDir, "b.db"), 10*time.Second)
+	if err != nil {
+		t.Skipf("DB open failed (FTS5 or timeout): %v", err)
+	}
+	defer connB.Close()
+
+	vaultID := "v1"
+	K_master := make([]byte, KeySize)
+	for i := range K_master {
+		K_master[i] = byte(i + 5)
+	}
+
+	// Node B already has an event from node A inside the window
+	h := &Header{Magic: Magic, Version: Version, ObjectType: TypeSeg, VaultID: vaultID, NodeID: "nodeA", SegmentID: "seg1"}
+	payload := &SegmentPayload{
+		Events:   []SegmentEvent{{NodeID: "nodeA", SessionID: "s1", Seq: 1, Cmd: "export TOKEN=x", StartedAt: 500, EndedAt: 501}},
+		Sessions: []SegmentSession{{SessionID: "s1", StartedAt: 500, Host: "hostA"}},
+	}
+	raw, err := EncodeSegment(h, payload, K_master, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.PutAtomic(SegmentKey(vaultID, "nodeA", "seg1"), raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Import(connB, fs, t.TempDir(), vaultID, K_master); err != nil {
+		t.Fatal(err)
+	}
+
+	tombID, err := PublishTombstone(connA, fs, vaultID, "nodeA", &TombstonePayload{StartTs: 400, EndTs: 600, Reason: "forget"}, K_master, true)
+	if err != nil {
+		t.Fatalf("PublishTombstone: %v", err)
+	}
+	var published, applied int
+	_ = connA.QueryRow(`SELECT COUNT(*) FROM sync_published_tombstones WHERE tombstone_id=?`, tombID).Scan(&published)
+	_ = connA.QueryRow(`SELECT COUNT(*) FROM applied_tombstones WHERE tombstone_id=?`, tombID).Scan(&applied)
+	if published != 1 || applied != 1 {
+		t.Fatalf("local records: published=%d applied=%d, want 1/1", published, applied)
+	}
+
+	manifestData, err := fs.Get(ManifestKey(vaultID, "nodeA"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := DecodeManifest(manifestData, K_master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Tombstones) != 1 || m.Tombstones[0].TombstoneID != tombID {
+		t.Fatalf("manifest tombstones = %+v, want %s", m.Tombstones, tombID)
+	}
+
+	res, err := Import(connB, fs, t.TempDir(), vaultID, K_master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TombstonesApplied != 1 {
+		t.Fatalf("TombstonesApplied = %d, want 1", res.TombstonesApplied)
+	}
+	var count int
+	_ = connB.QueryRow(`SELECT COUNT(*) FROM events`).Scan(&count)
+	if count != 0 {
+		t.Fatalf("node B events after tombstone = %d, want 0", count)
+	}
+}
+
+// failPutStore rejects every write, like an unreachable vault.
+type failPutStore struct{ SyncStore }
+
+func (failPutStore) PutAtomic(string, []byte) error { return fmt.Errorf("store offline") }
+
+func TestForgetTombstone_KeepsPinnedAndRetries(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs := NewFolderStore(filepath.Join(tmpDir, "store"))
+	connA, err := openDBWithTimeout(filepath.Join(tmpDir, "a.db"), 10*time.Second)
+	if err != nil {
+		t.Skipf("DB open failed (FTS5 or timeout): %v", err)
+	}
+	defer connA.Close()
+	connB, err := openDBWithTimeout(filepath.Join(tmpDir, "b.db"), 10*time.Second)
+	if err != nil {
+		t.Skipf("DB open failed (FTS5 or timeout): %v", err)
+	}
+	defer connB.Close()
+	vaultID := "v1"
+
+	// Node A: a pinned and an unpinned session inside the window
+	stA := store.New(connA)
+	for _, sid := range []string{"pinned", "plain"} {
+		if err := stA.EnsureSession(sid, "hostA", "", "/", 450); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := connA.Exec(`INSERT INTO events (session_id, seq, started_at) VALUES (?, 1, 500)`, sid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stA.PinSession("pinned"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Node B already has both sessions' events
+	h := &Header{Magic: Magic, Version: Version, ObjectType: TypeSeg, VaultID: vaultID, NodeID: "nodeA", SegmentID: "seg1"}
+	raw, err := EncodeSegment(h, &SegmentPayload{
+		Events: []SegmentEvent{
+			{NodeID: "nodeA", SessionID: "pinned", Seq: 1, Cmd: "make", StartedAt: 500, EndedAt: 501},
+			{NodeID: "nodeA", SessionID: "plain", Seq: 1, Cmd: "export TOKEN=x", StartedAt: 500, EndedAt: 501},
+		},
+		Sessions: []SegmentSession{{SessionID: "pinned", StartedAt: 450, Host: "hostA"}, {SessionID: "plain", StartedAt: 450, Host: "hostA"}},
+	}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.PutAtomic(SegmentKey(vaultID, "nodeA", "seg1"), raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Import(connB, fs, t.TempDir(), vaultID, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := ForgetTombstone(connA, "nodeA", 400, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload.NodeID != "nodeA" || len(payload.Keep) != 1 || payload.Keep[0] != "pinned" {
+		t.Fatalf("payload = %+v, want node nodeA keeping [pinned]", payload)
+	}
+	if err := QueueTombstone(connA, vaultID, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed publish leaves the same window queued
+	if ids, err := PublishPendingTombstones(connA, failPutStore{fs}, vaultID, "nodeA", nil, false); err == nil || len(ids) != 0 {
+		t.Fatalf("publish to offline store = %v, %v; want error", ids, err)
+	}
+	ids, err := PublishPendingTombstones(connA, fs, vaultID, "nodeA", nil, false)
+	if err != nil || len(ids) != 1 {
+		t.Fatalf("retry = %v, %v; want one tombstone", ids, err)
+	}
+	var queued int
+	_ = connA.QueryRow(`SELECT COUNT(*) FROM sync_pending_tombstones`).Scan(&queued)
+	if queued != 0 {
+		t.Fatalf("queued after publish = %d, want 0", queued)
+	}
+	var nodeID string
+	_ = connA.QueryRow(`SELECT node_id FROM applied_tombstones WHERE tombstone_id = ?`, ids[0]).Scan(&nodeID)
+	if nodeID != "nodeA" {
+		t.Errorf("applied_tombstones.node_id = %q, want nodeA", nodeID)
+	}
+
+	if _, err := Import(connB, fs, t.TempDir(), vaultID, nil); err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	rows, err := connB.Query(`SELECT session_id FROM events`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var sid string
+		_ = rows.Scan(&sid)
+		left = append(left, sid)
+	}
+	_ = rows.Close()
+	if len(left) != 1 || left[0] != store.SyncSessionID("nodeA", "pinned") {
+		t.Fatalf("node B events after tombstone = %v, want only the pinned session", left)
+	}
+	tombs, err := loadAppliedTombstones(connB, vaultID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coveredByTombstone("nodeA", "pinned", 500, tombs) || !coveredByTombstone("nodeA", "plain", 500, tombs) {
+		t.Error("re-import guard should spare the pinned session only")
+	}
+}
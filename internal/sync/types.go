@@ -59,6 +59,7 @@ type SegmentEvent struct {
 	ExitCode   *int    `json:"exit_code,omitempty"`
 	Cwd        string  `json:"cwd,omitempty"`
 	Cmd        string  `json:"cmd"`
+	State      string  `json:"state,omitempty"` // interrupted or unknown; empty when completed
 }
 
 // SegmentSession for sync.
@@ -90,4 +91,6 @@ type TombstonePayload struct {
 	StartTs float64 `json:"start_ts"`
 	EndTs   float64 `json:"end_ts"`
 	Reason  string  `json:"reason,omitempty"`
+	// Keep lists sessions of NodeID the tombstone leaves alone (pinned there).
+	Keep []string `json:"keep_sessions,omitempty"`
 }
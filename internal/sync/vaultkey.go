@@ -0,0 +1,216 @@
+package sync
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// KDFArgon2id is the only passphrase KDF supported in v0.
+const KDFArgon2id = "argon2id"
+
+// keyCheckPlaintext is sealed with K_master so a wrong passphrase is detected
+// at unlock time instead of as AEAD failures on every object.
+var keyCheckPlaintext = []byte("hx-vault-key-check-v0")
+
+// ErrWrongPassphrase is returned when a passphrase does not unlock the vault.
+var ErrWrongPassphrase = errors.New("wrong passphrase for vault")
+
+// KDFParams are the argon2id parameters used to derive K_master from a passphrase.
+type KDFParams struct {
+	Algorithm string `json:"algorithm"`
+	SaltHex   string `json:"salt"`
+	Time      uint32 `json:"time"`
+	MemoryKiB uint32 `json:"memory_kib"`
+	Threads   uint8  `json:"threads"`
+}
+
+// DefaultKDFParams returns the argon2id parameters for new vaults (RFC 9106
+// second recommended option: t=3, m=64 MiB) with a fresh random salt.
+func DefaultKDFParams() (KDFParams, error) {
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return KDFParams{}, err
+	}
+	return KDFParams{
+		Algorithm: KDFArgon2id,
+		SaltHex:   hex.EncodeToString(salt),
+		Time:      3,
+		MemoryKiB: 64 * 1024,
+		Threads:   4,
+	}, nil
+}
+
+// VaultMeta is the plaintext vault metadata object stored at VaultMetaKey.
+// It holds no secrets: only whether the vault is encrypted, the KDF salt and
+// parameters, and a key check value sealed with K_master.
+type VaultMeta struct {
+	Magic     string     `json:"magic"`
+	Version   int        `json:"version"`
+	VaultID   string     `json:"vault_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	Encrypt   bool       `json:"encrypt"`
+	KDF       *KDFParams `json:"kdf,omitempty"`
+	KeyCheck  string     `json:"key_check,omitempty"` // hex(nonce|sealed keyCheckPlaintext)
+}
+
+// VaultMetaKey returns the store key for the vault metadata object.
+// It lives beside objects/ so object listings never see it.
+func VaultMetaKey(vaultID string) string {
+	return path.Join("vaults", vaultID, "vault.json")
+}
+
+// NewVaultMeta creates metadata for a new vault. When encrypt is true, K_master
+// is derived from passphrase with params and returned alongside the metadata.
+func NewVaultMeta(vaultID string, encrypt bool, passphrase string, params KDFParams) (*VaultMeta, []byte, error) {
+	m := &VaultMeta{
+		Magic:     Magic,
+		Version:   Version,
+		VaultID:   vaultID,
+		CreatedAt: time.Now().UTC(),
+		Encrypt:   encrypt,
+	}
+	if !encrypt {
+		return m, nil, nil
+	}
+	if passphrase == "" {
+		return nil, nil, fmt.Errorf("passphrase required for encrypted vault")
+	}
+	key, err := DeriveKey(passphrase, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, NonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, err
+	}
+	sealed, err := SealWithKey(key, nonce, keyCheckPlaintext, []byte(vaultID))
+	if err != nil {
+		return nil, nil, err
+	}
+	m.KDF = &params
+	m.KeyCheck = hex.EncodeToString(append(nonce, sealed...))
+	return m, key, nil
+}
+
+// Unlock derives K_master from passphrase and verifies it against the key check.
+func (m *VaultMeta) Unlock(passphrase string) ([]byte, error) {
+	if !m.Encrypt {
+		return nil, nil
+	}
+	if m.KDF == nil {
+		return nil, fmt.Errorf("vault metadata missing kdf parameters")
+	}
+	key, err := DeriveKey(passphrase, *m.KDF)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.VerifyKey(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// VerifyKey checks key against the vault's key check value.
+func (m *VaultMeta) VerifyKey(key []byte) error {
+	if len(key) != KeySize {
+		return fmt.Errorf("vault key must be %d bytes", KeySize)
+	}
+	check, err := hex.DecodeString(m.KeyCheck)
+	if err != nil || len(check) < NonceSize {
+		return fmt.Errorf("vault metadata has invalid key check")
+	}
+	if _, err := OpenWithKey(key, check[:NonceSize], check[NonceSize:], []byte(m.VaultID)); err != nil {
+		return ErrWrongPassphrase
+	}
+	return nil
+}
+
+// DeriveKey derives a KeySize K_master from passphrase using params.
+func DeriveKey(passphrase string, params KDFParams) ([]byte, error) {
+	if params.Algorithm != KDFArgon2id {
+		return nil, fmt.Errorf("unsupported kdf %q", params.Algorithm)
+	}
+	salt, err := hex.DecodeString(params.SaltHex)
+	if err != nil || len(salt) < 8 {
+		return nil, fmt.Errorf("invalid kdf salt")
+	}
+	if params.Time == 0 || params.MemoryKiB == 0 || params.Threads == 0 {
+		return nil, fmt.Errorf("invalid kdf parameters")
+	}
+	return argon2.IDKey([]byte(passphrase), salt, params.Time, params.MemoryKiB, params.Threads, KeySize), nil
+}
+
+// PublishVaultMeta writes the vault metadata object to the store.
+func PublishVaultMeta(syncStore SyncStore, m *VaultMeta) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return syncStore.PutAtomic(VaultMetaKey(m.VaultID), data)
+}
+
+// FetchVaultMeta reads the vault metadata object. Returns ErrNotFound if the vault has none.
+func FetchVaultMeta(syncStore SyncStore, vaultID string) (*VaultMeta, error) {
+	data, err := syncStore.Get(VaultMetaKey(vaultID))
+	if err != nil {
+		return nil, err
+	}
+	var m VaultMeta
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parse vault metadata: %w", err)
+	}
+	if m.Magic != Magic || m.VaultID != vaultID {
+		return nil, fmt.Errorf("vault metadata does not match vault %s", vaultID)
+	}
+	return &m, nil
+}
+
+// SaveKeyFile caches an unlocked K_master at path (hex, mode 0600).
+func SaveKeyFile(keyPath string, key []byte) error {
+	if len(key) != KeySize {
+		return fmt.Errorf("vault key must be %d bytes", KeySize)
+	}
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+		return err
+	}
+	tmp := keyPath + ".tmp"
+	if err := os.WriteFile(tmp, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, 0600); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, keyPath)
+}
+
+// LoadKeyFile reads a cached K_master. Refuses files readable by group or others.
+func LoadKeyFile(keyPath string) ([]byte, error) {
+	fi, err := os.Stat(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	if fi.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("keyfile %s has mode %o; want 0600", keyPath, fi.Mode().Perm())
+	}
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != KeySize {
+		return nil, fmt.Errorf("keyfile %s is corrupt", keyPath)
+	}
+	return key, nil
+}
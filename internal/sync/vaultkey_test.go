@@ -0,0 +1,105 @@
+package sync
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testKDFParams keeps argon2id cheap for unit tests.
+func testKDFParams(t *testing.T) KDFParams {
+	t.Helper()
+	p, err := DefaultKDFParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Time, p.MemoryKiB, p.Threads = 1, 1024, 1
+	return p
+}
+
+func TestVaultMeta_UnlockRoundTrip(t *testing.T) {
+	fs := NewFolderStore(t.TempDir())
+	meta, key, err := NewVaultMeta("vault-default", true, "correct horse", testKDFParams(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != KeySize {
+		t.Fatalf("key len = %d, want %d", len(key), KeySize)
+	}
+	if err := PublishVaultMeta(fs, meta); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := FetchVaultMeta(fs, "vault-default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlocked, err := got.Unlock("correct horse")
+	if err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if !bytes.Equal(unlocked, key) {
+		t.Fatal("unlocked key differs from derived key")
+	}
+	if _, err := got.Unlock("wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("Unlock wrong passphrase: err = %v, want ErrWrongPassphrase", err)
+	}
+
+	raw, _ := fs.Get(VaultMetaKey("vault-default"))
+	if bytes.Contains(raw, []byte("correct horse")) {
+		t.Fatal("vault metadata must not contain the passphrase")
+	}
+}
+
+func TestVaultMeta_NoEncrypt(t *testing.T) {
+	meta, key, err := NewVaultMeta("vault-plain", false, "", KDFParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != nil || meta.KDF != nil || meta.Encrypt {
+		t.Fatalf("unencrypted vault meta = %+v, key %v", meta, key)
+	}
+}
+
+func TestKeyFile_Permissions(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "keys", "vault-default.key")
+	key := bytes.Repeat([]byte{7}, KeySize)
+	if err := SaveKeyFile(keyPath, key); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("keyfile mode = %o, want 0600", fi.Mode().Perm())
+	}
+	got, err := LoadKeyFile(keyPath)
+	if err != nil || !bytes.Equal(got, key) {
+		t.Fatalf("LoadKeyFile = %x, %v", got, err)
+	}
+
+	if err := os.Chmod(keyPath, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadKeyFile(keyPath); err == nil {
+		t.Fatal("LoadKeyFile should refuse a world-readable keyfile")
+	}
+}
+
+func TestImport_RejectsPlaintextInEncryptedVault(t *testing.T) {
+	h := &Header{Magic: Magic, Version: Version, ObjectType: TypeSeg, VaultID: "v1", NodeID: "n1", SegmentID: "s1"}
+	raw, err := EncodeSegment(h, &SegmentPayload{}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, body, err := DecodeObject(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := maybeDecrypt(h2, body, bytes.Repeat([]byte{1}, KeySize)); !errors.Is(err, ErrPlaintextObject) {
+		t.Fatalf("maybeDecrypt plaintext with key: err = %v, want ErrPlaintextObject", err)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"encoding/hex"
 	"fmt"
 	"time"
+
+	"github.com/mrcawood/History_eXtended/internal/store"
 )
 
 // PushResult holds counts for push operation.
@@ -17,16 +19,25 @@ type PushResult struct {
 // Push publishes unpublished live events to the sync store as segments.
 // nodeID is this device's identity; vaultID and K_master from vault config.
 func Push(conn *sql.DB, syncStore SyncStore, vaultID, nodeID string, K_master []byte, encrypt bool) (*PushResult, error) {
+	return PushRedacted(conn, syncStore, vaultID, nodeID, K_master, encrypt, nil)
+}
+
+// PushRedacted is Push with every command and cwd in the segment passed
+// through redact first, so secrets never leave this device. The local
+// history keeps the original text. A nil redact publishes text as is.
+func PushRedacted(conn *sql.DB, syncStore SyncStore, vaultID, nodeID string, K_master []byte, encrypt bool, redact func(string) string) (*PushResult, error) {
 	res := &PushResult{}
-	// Select unpublished live events
+	// Select live events not yet published in their current state. Running
+	// commands stay local; interrupted and unknown ones go out with their
+	// state and again once a late post completes them.
 	rows, err := conn.Query(`
-		SELECT e.event_id, e.session_id, e.seq, e.started_at, e.ended_at, e.duration_ms, e.exit_code, e.cwd, COALESCE(c.cmd_text, '')
+		SELECT e.event_id, e.session_id, e.seq, e.started_at, e.ended_at, e.duration_ms, e.exit_code, e.cwd, COALESCE(c.cmd_text, ''), e.state
 		FROM events e
 		LEFT JOIN command_dict c ON e.cmd_id = c.cmd_id
 		WHERE e.origin = 'live'
-		AND e.event_id NOT IN (SELECT event_id FROM sync_published_events WHERE vault_id = ?)
+		AND `+unpublishedEvent+`
 		ORDER BY e.started_at ASC
-	`, vaultID)
+	`, store.StateRunning, vaultID)
 	if err != nil {
 		return nil, err
 	}
@@ -35,7 +46,7 @@ func Push(conn *sql.DB, syncStore SyncStore, vaultID, nodeID string, K_master []
 	var events []event
 	for rows.Next() {
 		var e event
-		if err := rows.Scan(&e.eventID, &e.sessionID, &e.seq, &e.startedAt, &e.endedAt, &e.durationMs, &e.exitCode, &e.cwd, &e.cmd); err != nil {
+		if err := rows.Scan(&e.eventID, &e.sessionID, &e.seq, &e.startedAt, &e.endedAt, &e.durationMs, &e.exitCode, &e.cwd, &e.cmd, &e.state); err != nil {
 			return nil, err
 		}
 		events = append(events, e)
@@ -53,6 +64,9 @@ func Push(conn *sql.DB, syncStore SyncStore, vaultID, nodeID string, K_master []
 	if err != nil {
 		return nil, err
 	}
+	if redact != nil {
+		redactPayload(payload, redact)
+	}
 	h := &Header{
 		Magic:      Magic,
 		Version:    Version,
@@ -92,6 +106,20 @@ func Push(conn *sql.DB, syncStore SyncStore, vaultID, nodeID string, K_master []
 	return res, nil
 }
 
+// unpublishedEvent matches live events e that Push has yet to send to the
+// vault: not running, and not published in their current state. Its
+// arguments are store.StateRunning and the vault ID.
+const unpublishedEvent = `(e.state IS NULL OR e.state != ?)
+		AND NOT EXISTS (SELECT 1 FROM sync_published_events p
+			WHERE p.event_id = e.event_id AND p.vault_id = ? AND p.state IS e.state)`
+
+// CountUnpublished returns how many live events the next Push would send.
+func CountUnpublished(conn *sql.DB, vaultID string) (int, error) {
+	var n int
+	err := conn.QueryRow(`SELECT COUNT(*) FROM events e WHERE e.origin = 'live' AND `+unpublishedEvent, store.StateRunning, vaultID).Scan(&n)
+	return n, err
+}
+
 // NewNodeID returns a new UUID for a sync node.
 func NewNodeID() string {
 	return newUUID()
@@ -108,6 +136,7 @@ type event struct {
 	exitCode   sql.NullInt64
 	cwd        string
 	cmd        string
+	state      sql.NullString // NULL when completed
 }
 
 func newUUID() string {
@@ -147,6 +176,7 @@ func buildSegmentPayload(conn *sql.DB, nodeID string, events []event) (*SegmentP
 			ExitCode:   exitCode,
 			Cwd:        e.cwd,
 			Cmd:        e.cmd,
+			State:      e.state.String,
 		}
 		sessionIDs[e.sessionID] = true
 	}
@@ -169,9 +199,23 @@ func buildSegmentPayload(conn *sql.DB, nodeID string, events []event) (*SegmentP
 	return &SegmentPayload{Events: segEvents, Sessions: sessions}, nil
 }
 
+// redactPayload rewrites the free-text fields of a segment in place.
+func redactPayload(payload *SegmentPayload, redact func(string) string) {
+	for i := range payload.Events {
+		payload.Events[i].Cmd = redact(payload.Events[i].Cmd)
+		payload.Events[i].Cwd = redact(payload.Events[i].Cwd)
+	}
+	for i := range payload.Sessions {
+		payload.Sessions[i].InitialCwd = redact(payload.Sessions[i].InitialCwd)
+	}
+}
+
 // encodeSegmentData encodes the segment payload with optional encryption
 func encodeSegmentData(payload *SegmentPayload, h *Header, K_master []byte, encrypt bool) ([]byte, error) {
-	if encrypt && len(K_master) == KeySize {
+	if encrypt {
+		if len(K_master) != KeySize {
+			return nil, fmt.Errorf("encrypted vault requires a %d-byte key", KeySize)
+		}
 		return EncodeSegment(h, payload, K_master, true)
 	}
 	return EncodeSegment(h, payload, nil, false)
@@ -186,7 +230,7 @@ func markEventsAsPublished(conn *sql.DB, events []event, vaultID, nodeID string,
 	defer func() { _ = tx.Rollback() }()
 
 	for _, e := range events {
-		_, err = tx.Exec(`INSERT OR IGNORE INTO sync_published_events (event_id, vault_id, node_id, segment_id) VALUES (?, ?, ?, ?)`, e.eventID, vaultID, nodeID, segmentID)
+		_, err = tx.Exec(`INSERT OR REPLACE INTO sync_published_events (event_id, vault_id, node_id, segment_id, state) VALUES (?, ?, ?, ?, ?)`, e.eventID, vaultID, nodeID, segmentID, e.state)
 		if err != nil {
 			return err
 		}
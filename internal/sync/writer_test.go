@@ -2,6 +2,7 @@ package sync
 
 import (
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -79,6 +80,21 @@ func TestPush_PublishesSegment(t *testing.T) {
 	); err != nil {
 		t.Fatal(err)
 	}
+	// An interrupted command is published with its state; a running one stays local
+	pendingID, _ := st.CmdID("sleep 100", 102)
+	if _, err := st.InsertPendingEvent(
+		&store.PreEvent{T: "pre", Ts: 102, Sid: "s1", Seq: 2, Cmd: "sleep 100", Cwd: "/home", Host: "host1"},
+		pendingID, store.StateInterrupted,
+	); err != nil {
+		t.Fatal(err)
+	}
+	runningID, _ := st.CmdID("ssh build01", 104)
+	if _, err := st.InsertPendingEvent(
+		&store.PreEvent{T: "pre", Ts: 104, Sid: "s1", Seq: 3, Cmd: "ssh build01", Cwd: "/home", Host: "host1"},
+		runningID, store.StateRunning,
+	); err != nil {
+		t.Fatal(err)
+	}
 
 	fs := NewFolderStore(storeDir)
 	vaultID := "v1"
@@ -87,8 +103,11 @@ func TestPush_PublishesSegment(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if res.SegmentsPublished != 1 || res.EventsPublished != 1 {
-		t.Fatalf("expected 1/1, got %d/%d", res.SegmentsPublished, res.EventsPublished)
+	if res.SegmentsPublished != 1 || res.EventsPublished != 2 {
+		t.Fatalf("expected 1/2, got %d/%d", res.SegmentsPublished, res.EventsPublished)
+	}
+	if n, err := CountUnpublished(conn, vaultID); err != nil || n != 0 {
+		t.Fatalf("CountUnpublished = %d, %v; want 0 (running stays local)", n, err)
 	}
 
 	// Second push should publish nothing (already published)
@@ -99,4 +118,33 @@ func TestPush_PublishesSegment(t *testing.T) {
 	if res2.SegmentsPublished != 0 {
 		t.Fatalf("expected 0 segments on second push, got %d", res2.SegmentsPublished)
 	}
+
+	// A late post completes the event and the next push publishes it again
+	if _, err := st.CompleteEvent(&store.PostEvent{T: "post", Ts: 103, Sid: "s1", Seq: 2, Exit: 130, DurMs: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	res3, err := Push(conn, fs, vaultID, nodeID, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res3.EventsPublished != 1 {
+		t.Fatalf("expected the completed event on third push, got %d", res3.EventsPublished)
+	}
+}
+
+func TestRedactPayload(t *testing.T) {
+	payload := &SegmentPayload{
+		Events:   []SegmentEvent{{Cmd: "mysql -pS3cret", Cwd: "/srv/S3cret"}},
+		Sessions: []SegmentSession{{InitialCwd: "/home/S3cret"}},
+	}
+	redactPayload(payload, func(s string) string { return strings.ReplaceAll(s, "S3cret", "<REDACTED:password>") })
+	if got := payload.Events[0].Cmd; got != "mysql -p<REDACTED:password>" {
+		t.Errorf("Cmd = %q", got)
+	}
+	if got := payload.Events[0].Cwd; got != "/srv/<REDACTED:password>" {
+		t.Errorf("Cwd = %q", got)
+	}
+	if got := payload.Sessions[0].InitialCwd; got != "/home/<REDACTED:password>" {
+		t.Errorf("InitialCwd = %q", got)
+	}
 }
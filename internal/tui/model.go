@@ -3,6 +3,7 @@ package tui
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -80,10 +81,16 @@ func (m model) Init() tea.Cmd {
 
 func (m model) runSearch() tea.Cmd {
 	req := m.req
-	req.Query = m.input.Value()
+	input := m.input.Value()
 	conn := m.conn
 	cfg := m.cfg
 	return func() tea.Msg {
+		q, err := search.ParseQuery(input, search.QueryContext{Cwd: req.Cwd, SessionID: req.SessionID})
+		if err != nil {
+			return searchDoneMsg{err: err}
+		}
+		req.Query = q.Text
+		req.Where = q.Where
 		rows, err := search.Search(context.Background(), conn, cfg, req)
 		return searchDoneMsg{rows: rows, err: err}
 	}
@@ -117,6 +124,13 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case searchDoneMsg:
 		m.searching = false
 		if msg.err != nil {
+			var qe *search.QueryError
+			if errors.As(msg.err, &qe) {
+				m.rows = nil
+				m.cursor = 0
+				m.preview = qe.Msg + "\n\n" + qe.Caret()
+				return m, nil
+			}
 			m.preview = "search error: " + msg.err.Error()
 			return m, nil
 		}
@@ -188,6 +202,10 @@ func (m model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.req.Mode = search.NextMode(m.req.Mode)
 		m.searching = true
 		return m, m.runSearch()
+	case "ctrl+t":
+		m.req.Rank = search.NextRank(m.req.Rank)
+		m.searching = true
+		return m, m.runSearch()
 	case "ctrl+o":
 		if len(m.rows) > 0 {
 			m.inspector = true
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/mrcawood/History_eXtended/internal/search"
 )
@@ -101,3 +102,17 @@ func TestTruncatePreviewLine(t *testing.T) {
 		t.Fatalf("expected middle ellipsis: %q", got)
 	}
 }
+
+func TestQueryErrorPreview(t *testing.T) {
+	m := model{input: textinput.New(), rows: []search.Row{{Cmd: "ls"}}}
+	m.input.SetValue("make foo:bar")
+	msg := m.runSearch()()
+	got, _ := m.Update(msg)
+	gm := got.(model)
+	if len(gm.rows) != 0 {
+		t.Errorf("rows = %d, want 0 on a parse error", len(gm.rows))
+	}
+	if !strings.Contains(gm.preview, "make foo:bar\n     ^") {
+		t.Errorf("preview = %q, want caret under foo", gm.preview)
+	}
+}
@@ -62,7 +62,8 @@ func (m model) View() string {
 		return m.viewInspector()
 	}
 
-	header := styleTitle.Render(fmt.Sprintf("filter: %s  mode: %s", search.FilterName(m.req.Filter), search.ModeName(m.req.Mode)))
+	header := styleTitle.Render(fmt.Sprintf("filter: %s  mode: %s  rank: %s",
+		search.FilterName(m.req.Filter), search.ModeName(m.req.Mode), search.RankName(m.req.Rank)))
 	if m.searching {
 		header += styleMuted.Render("  searching…")
 	}
@@ -97,7 +98,7 @@ func (m model) View() string {
 	if m.enterAccept {
 		enterAction, tabAction = "run", "edit"
 	}
-	footer := styleFooter.Render(fmt.Sprintf("Enter %s · Tab %s · Ctrl-R filter · Ctrl-S mode · Ctrl-O inspector · Esc cancel", enterAction, tabAction))
+	footer := styleFooter.Render(fmt.Sprintf("Enter %s · Tab %s · Ctrl-R filter · Ctrl-S mode · Ctrl-T rank · Ctrl-O inspector · Esc cancel", enterAction, tabAction))
 	if m.inline {
 		h := m.inlineHeight
 		if h <= 0 {
@@ -190,10 +191,7 @@ func (m model) renderListHeader(width int) string {
 }
 
 func (m model) formatRow(r search.Row, width int, selected bool) string {
-	exit := "-"
-	if r.ExitCode != nil {
-		exit = fmt.Sprintf("%d", *r.ExitCode)
-	}
+	exit := search.ExitLabel(r.ExitCode, r.State)
 	when := search.RelTime(r.StartedAt)
 	host := r.Host
 	dup := ""
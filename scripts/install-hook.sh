@@ -1,7 +1,7 @@
 #!/usr/bin/env sh
 # Optionally add hx hook source to user's rc file for live capture.
 # Usage: install-hook.sh <hook_dir>
-# Hook dir contains hx.zsh and hx.bash.
+# Hook dir contains hx.zsh, hx.bash and hx.fish.
 
 HOOK_DIR="${1:-}"
 if [ -z "$HOOK_DIR" ] || [ ! -d "$HOOK_DIR" ]; then
@@ -21,8 +21,12 @@ case "$SHELL" in
       rcf="$HOME/.bash_profile"
     fi
     ;;
+  *fish)
+    hook_file="$HOOK_DIR/hx.fish"
+    rcf="${XDG_CONFIG_HOME:-$HOME/.config}/fish/config.fish"
+    ;;
   *)
-    echo "  • Shell $SHELL: add 'source $HOOK_DIR/hx.zsh' (zsh) or 'source $HOOK_DIR/hx.bash' (bash) to rc manually."
+    echo "  • Shell $SHELL: add 'source $HOOK_DIR/hx.zsh' (zsh), 'source $HOOK_DIR/hx.bash' (bash) or 'source $HOOK_DIR/hx.fish' (fish) to rc manually."
     exit 0
     ;;
 esac
@@ -33,7 +37,7 @@ if [ ! -f "$hook_file" ]; then
 fi
 
 # Check if already configured
-if [ -f "$rcf" ] && grep -q "hx\.zsh\|hx\.bash" "$rcf" 2>/dev/null; then
+if [ -f "$rcf" ] && grep -q "hx\.zsh\|hx\.bash\|hx\.fish" "$rcf" 2>/dev/null; then
   echo "  • Hook already sourced in $rcf"
   exit 0
 fi
@@ -43,6 +47,7 @@ if [ -t 0 ]; then
   read -r ans
   case "$ans" in
     [yY]|[yY][eE][sS])
+      mkdir -p "$(dirname "$rcf")"
       printf '\n# hx terminal capture\nsource "%s"\n' "$hook_file" >> "$rcf"
       echo "  Appended to $rcf. Run 'source $rcf' or open a new shell."
       ;;
@@ -1,4 +1,4 @@
-# hx Bash hooks: capture command events via hx-emit (single-call "cmd" mode).
+# hx Bash hooks: capture command events via hx-emit (pre from the DEBUG trap, post from PROMPT_COMMAND).
 # Source from .bashrc or .bash_profile:  source /path/to/hx.bash
 # Requires: Bash >= 5.0, hx-emit on PATH.
 # Set HX_BASH_ALLOW_UNSUPPORTED=1 to run on Bash < 5 (unsupported).
@@ -11,87 +11,83 @@ fi
 # Paused sentinel (same location as hx-emit).
 _hx_paused_file="${XDG_DATA_HOME:-$HOME/.local/share}/hx/.paused"
 
-# Recursion guard: do not emit for these commands (E1).
+# Recursion guard: do not emit for these commands (E1), except hx run.
 _hx_skip_cmd() {
   local first
   first="${1%% *}"
   first="${first##*/}"
   case "$first" in
     hx-emit|hxd) return 0 ;;  # skip
-    hx) return 0 ;;             # hx status, hx last, etc.
+    hx)                         # hx status, hx last, etc.
+      # hx run wraps a user command: record it so its saved output has an event.
+      [[ "${1#*hx }" == run\ * ]] && return 1
+      return 0 ;;
   esac
   return 1
 }
 
-# DEBUG trap: "command about to run". Only set start/cmd on first hit for this command line.
+# DEBUG trap: "command about to run". On the first hit for a command line,
+# send the pre event: hx ps lists the command while it runs, and cwd and env
+# are captured as they were before it ran (not after `cd` or `export`).
 hx_bash_preexec() {
   [[ -n "${HX_IN_PROMPT:-}" ]] && [[ "${HX_IN_PROMPT}" -eq 1 ]] && return 0
+  # PROMPT_COMMAND trips the trap too; it is not a command line.
+  [[ "${BASH_COMMAND:-}" == hx_bash_precmd ]] && return 0
+  # Once per command line, skipped or not, so the history bookkeeping stays current.
+  if [[ "${HX_LINE_CHECKED:-0}" -eq 0 ]]; then
+    HX_LINE_CHECKED=1
+    _hx_check_space_prefixed "${BASH_COMMAND:-}"
+  fi
   _hx_skip_cmd "${BASH_COMMAND:-}" && return 0
   [[ -f "$_hx_paused_file" ]] && return 0
-  if [[ -z "${HX_PREEXEC_SEEN:-}" ]] || [[ "${HX_PREEXEC_SEEN}" -eq 0 ]]; then
-    HX_CMD_START="${EPOCHREALTIME:-}"
-    HX_CMD_TEXT="${BASH_COMMAND:-}"
-    HX_PREEXEC_SEEN=1
-  fi
+  [[ "${HX_PREEXEC_SEEN:-0}" -eq 1 ]] && return 0
+  HX_CMD_START="${EPOCHREALTIME:-}"
+  HX_CMD_TEXT="${BASH_COMMAND:-}"
+  HX_PREEXEC_SEEN=1
+  # Tell hx run which event it is running as (links saved output to it).
+  export HX_EVENT_SESSION="${HX_SESSION_ID}" HX_EVENT_SEQ="${HX_SEQ}" HX_EVENT_PID="$$"
+  [[ "${HX_LINE_SPACE:-0}" -eq 1 ]] && HX_CMD_TEXT=" ${HX_CMD_TEXT}"
+
+  command -v hx-emit >/dev/null 2>&1 || return 0
+  # Base64 command for hx-emit (one subprocess for base64, one for hx-emit).
+  local _cmd_b64
+  _cmd_b64=$(printf '%s' "${HX_CMD_TEXT}" | base64 -w 0 2>/dev/null || printf '%s' "${HX_CMD_TEXT}" | base64 2>/dev/null | tr -d '\n')
+  ( HX_ENV_CAPTURE="${_hx_env_spec:-}" hx-emit pre "${HX_SESSION_ID}" "${HX_SEQ}" "${_cmd_b64}" "${PWD}" "${TTY##/dev/}" "${HOSTNAME:-unknown}" </dev/null >/dev/null 2>/dev/null & )
 }
 
-# Precmd: run first to capture $? and PIPESTATUS, then emit once, then user PROMPT_COMMAND.
+# Precmd: capture $? and PIPESTATUS first, send the post event for the
+# command preexec announced, then run the user's PROMPT_COMMAND.
 hx_bash_precmd() {
+  # One statement: any command in between resets both.
+  local _exit=$? _ps=("${PIPESTATUS[@]}")
   HX_IN_PROMPT=1
-  local _exit=$?
-  local _ps=("${PIPESTATUS[@]}")
   local _ts_end="${EPOCHREALTIME:-}"
-  local _host="${HOSTNAME:-unknown}"
-
-  if [[ -z "${HX_CMD_START:-}" ]]; then
-    HX_PREEXEC_SEEN=0
-    HX_CMD_START=
-    HX_CMD_TEXT=
-    HX_IN_PROMPT=0
-    _hx_run_user_prompt_command
-    return 0
+  # At the prompt HISTCMD is the next history number; keep the last one.
+  [[ -n "${HISTCMD:-}" ]] && HX_HIST_NUM=$(( HISTCMD - 1 ))
+  HX_LINE_CHECKED=0
+  HX_LINE_SPACE=0
+
+  if [[ "${HX_PREEXEC_SEEN:-0}" -eq 1 ]]; then
+    # Compute duration (ms). Use awk (no external date in hot path).
+    local _dur_ms=0
+    if [[ -n "${HX_CMD_START:-}" ]] && [[ -n "${_ts_end:-}" ]]; then
+      _dur_ms=$(awk "BEGIN { printf \"%.0f\", (${_ts_end} - ${HX_CMD_START}) * 1000 }" 2>/dev/null)
+    fi
+    [[ -z "${_dur_ms:-}" ]] || [[ "${_dur_ms}" -lt 0 ]] && _dur_ms=0
+
+    # Build pipe string (comma-separated).
+    local _pipe_str=""
+    if [[ ${#_ps[@]} -gt 0 ]]; then
+      _pipe_str=$(IFS=,; echo "${_ps[*]}")
+    fi
+
+    # Sent even if capture was paused meanwhile: the pre is already out.
+    if command -v hx-emit >/dev/null 2>&1; then
+      ( hx-emit post "${HX_SESSION_ID}" "${HX_SEQ}" "${_exit}" "${_dur_ms}" "${_pipe_str}" </dev/null >/dev/null 2>/dev/null & )
+    fi
+    HX_SEQ=$(( HX_SEQ + 1 ))
   fi
 
-  [[ -f "$_hx_paused_file" ]] && {
-    HX_PREEXEC_SEEN=0
-    HX_CMD_START=
-    HX_CMD_TEXT=
-    HX_IN_PROMPT=0
-    _hx_run_user_prompt_command
-    return 0
-  }
-
-  _hx_skip_cmd "${HX_CMD_TEXT:-}" && {
-    HX_PREEXEC_SEEN=0
-    HX_CMD_START=
-    HX_CMD_TEXT=
-    HX_IN_PROMPT=0
-    _hx_run_user_prompt_command
-    return 0
-  }
-
-  # Compute duration (ms). Use awk (no external date in hot path).
-  local _dur_ms=0
-  if [[ -n "${HX_CMD_START:-}" ]] && [[ -n "${_ts_end:-}" ]]; then
-    _dur_ms=$(awk "BEGIN { printf \"%.0f\", (${_ts_end} - ${HX_CMD_START}) * 1000 }" 2>/dev/null)
-  fi
-  [[ -z "${_dur_ms:-}" ]] || [[ "${_dur_ms}" -lt 0 ]] && _dur_ms=0
-
-  # Build pipe string (comma-separated).
-  local _pipe_str=""
-  if [[ ${#_ps[@]} -gt 0 ]]; then
-    _pipe_str=$(IFS=,; echo "${_ps[*]}")
-  fi
-
-  # Base64 command for hx-emit (one subprocess for base64, one for hx-emit).
-  local _cmd_b64
-  _cmd_b64=$(printf '%s' "${HX_CMD_TEXT:-}" | base64 -w 0 2>/dev/null || printf '%s' "${HX_CMD_TEXT:-}" | base64 2>/dev/null | tr -d '\n')
-
-  if command -v hx-emit >/dev/null 2>&1; then
-    ( hx-emit cmd "${HX_SESSION_ID}" "${HX_SEQ}" "${_cmd_b64}" "${PWD}" "${TTY##/dev/}" "${_host}" "${HX_CMD_START}" "${_ts_end}" "${_exit}" "${_dur_ms}" "${_pipe_str}" </dev/null >/dev/null 2>/dev/null & )
-  fi
-
-  HX_SEQ=$(( HX_SEQ + 1 ))
   HX_PREEXEC_SEEN=0
   HX_CMD_START=
   HX_CMD_TEXT=
@@ -100,6 +96,23 @@ hx_bash_precmd() {
   _hx_run_user_prompt_command
 }
 
+# BASH_COMMAND drops the leading space of " cmd", so hx-emit cannot apply
+# ignore_space itself. With HISTCONTROL=ignorespace (or ignoreboth), a command
+# line that did not advance the history number and is not a repeat of the last
+# entry (ignoredups) was space-prefixed: preexec restores the space and lets
+# the filter decide. In the DEBUG trap HISTCMD is the number of the last saved
+# entry, so this needs no subshell.
+_hx_check_space_prefixed() {
+  HX_LINE_SPACE=0
+  [[ "${HISTCONTROL:-}" == *ignorespace* || "${HISTCONTROL:-}" == *ignoreboth* ]] || return 0
+  [[ -o history ]] && [[ -n "${HISTCMD:-}" ]] || return 0
+  if [[ "${HISTCMD}" != "${HX_HIST_NUM:-}" ]]; then
+    HX_HIST_TEXT="$1"
+  elif [[ -n "${HX_HIST_NUM:-}" ]] && [[ "${HX_HIST_TEXT:-}" != "$1"* ]]; then
+    HX_LINE_SPACE=1
+  fi
+}
+
 # Run user's original PROMPT_COMMAND if set.
 _hx_run_user_prompt_command() {
   if [[ -n "${HX_USER_PROMPT_COMMAND:-}" ]]; then
@@ -112,6 +125,15 @@ if [[ -z "${HX_SESSION_ID:-}" ]]; then
   HX_SESSION_ID="hx-$$-$(date +%s)-${RANDOM:-0}"
 fi
 [[ -z "${HX_SEQ:-}" ]] && HX_SEQ=0
+# Environment variables to record with each command (config env.capture/env.hash); read once per shell.
+_hx_env_spec="$(hx-emit env-spec 2>/dev/null)"
+# Last history entry (possibly from HISTFILE), for the ignoredups check.
+if [[ -o history ]]; then
+  HX_HIST_TEXT=$(HISTTIMEFORMAT= builtin history 1)
+  HX_HIST_TEXT="${HX_HIST_TEXT#"${HX_HIST_TEXT%%[![:space:]]*}"}"
+  HX_HIST_TEXT="${HX_HIST_TEXT#"${HX_HIST_TEXT%%[!0-9]*}"}"
+  HX_HIST_TEXT="${HX_HIST_TEXT#"${HX_HIST_TEXT%%[![:space:]]*}"}"
+fi
 
 # Compose PROMPT_COMMAND: run hx precmd first (to capture $? and PIPESTATUS), then user's.
 if [[ -n "${PROMPT_COMMAND:-}" ]]; then
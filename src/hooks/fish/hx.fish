@@ -0,0 +1,56 @@
+# hx fish hooks: capture command events via hx-emit (pre on fish_preexec, post on fish_postexec).
+# Source from ~/.config/fish/config.fish:  source /path/to/hx.fish
+# Requires: fish >= 3.1 ($pipestatus), hx-emit on PATH.
+
+# Paused sentinel (same location as hx-emit).
+if set -q XDG_DATA_HOME
+    set -g _hx_paused_file $XDG_DATA_HOME/hx/.paused
+else
+    set -g _hx_paused_file $HOME/.local/share/hx/.paused
+end
+
+# Recursion guard: do not emit for hx itself, except hx run (it wraps a user command).
+function _hx_skip_cmd
+    set -l words (string split -m 2 ' ' -- $argv[1])
+    set -l first (string replace -r '.*/' '' -- $words[1])
+    test "$first" = hx -a "$words[2]" = run; and return 1
+    contains -- $first hx hx-emit hxd
+end
+
+# Send the pre event when the command starts: hx ps lists it while it runs,
+# and cwd and env are captured as they were before it ran.
+function _hx_preexec --on-event fish_preexec
+    set -l cmd $argv[1]
+    test -n "$cmd"; or return 0
+    _hx_skip_cmd $cmd; and return 0
+    test -f $_hx_paused_file; and return 0
+    command -q hx-emit; or return 0
+
+    set -g _hx_seq (math $_hx_seq + 1)
+    set -g _hx_pending_seq $_hx_seq
+    # Tell hx run which event it is running as (links saved output to it).
+    set -gx HX_EVENT_SESSION $HX_SESSION_ID
+    set -gx HX_EVENT_SEQ $_hx_seq
+    set -gx HX_EVENT_PID $fish_pid
+    set -l cmd_b64 (printf '%s' $cmd | base64 | string join '')
+    HX_ENV_CAPTURE="$_hx_env_spec" command hx-emit pre $HX_SESSION_ID $_hx_seq $cmd_b64 $PWD "$_hx_tty" $hostname </dev/null >/dev/null 2>/dev/null &
+    disown $last_pid 2>/dev/null
+end
+
+function _hx_postexec --on-event fish_postexec
+    # Capture $status and $pipestatus in one statement: any command in between resets both.
+    set -l st $status $pipestatus
+    set -q _hx_pending_seq; or return 0
+    set -l seq $_hx_pending_seq
+    set -e _hx_pending_seq
+    set -l pipe (string join , -- $st[2..-1])
+    command hx-emit post $HX_SESSION_ID $seq $st[1] $CMD_DURATION "$pipe" </dev/null >/dev/null 2>/dev/null &
+    disown $last_pid 2>/dev/null
+end
+
+# One-time init: session ID (stable for this shell), seq, tty.
+set -q HX_SESSION_ID; or set -g HX_SESSION_ID hx-$fish_pid-(date +%s)-(random)
+set -q _hx_seq; or set -g _hx_seq 0
+set -g _hx_tty (tty 2>/dev/null | string replace /dev/ '')
+# Environment variables to record with each command (config env.capture/env.hash); read once per shell.
+set -g _hx_env_spec (command hx-emit env-spec 2>/dev/null)